@@ -0,0 +1,80 @@
+package contracts
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DurationStats summarizes a set of durations, in hours
+type DurationStats struct {
+	Count        int     `json:"count"`
+	Average      float64 `json:"average"`
+	Median       float64 `json:"median"`
+	Percentile85 float64 `json:"p85"`
+}
+
+// NoteFlowTime represents how long a finished note took. Lead time runs from creation to done,
+// cycle time from when work started to done; both are in hours.
+type NoteFlowTime struct {
+	ID             uuid.UUID  `json:"id"`
+	Title          string     `json:"title"`
+	Status         string     `json:"status"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	StartedAt      *time.Time `json:"startedAt,omitempty"` // Unset when the note never recorded a start
+	DoneAt         time.Time  `json:"doneAt"`
+	LeadTimeHours  float64    `json:"leadTimeHours"`
+	CycleTimeHours *float64   `json:"cycleTimeHours,omitempty"`
+}
+
+// FlowTimesResponse represents the lead and cycle times of the notes finished in a period
+type FlowTimesResponse struct {
+	Notes     []NoteFlowTime `json:"notes"`
+	LeadTime  DurationStats  `json:"leadTime"`
+	CycleTime DurationStats  `json:"cycleTime"`
+}
+
+// ThroughputWeek represents the notes finished in the week starting on Monday WeekStart (UTC)
+type ThroughputWeek struct {
+	WeekStart string `json:"weekStart"` // YYYY-MM-DD
+	Count     int    `json:"count"`
+}
+
+// ThroughputResponse represents finished notes per week, oldest week first
+type ThroughputResponse struct {
+	Weeks []ThroughputWeek `json:"weeks"`
+}
+
+// FlowSeries is one band of a cumulative flow diagram: a board column
+type FlowSeries struct {
+	Key  string `json:"key"`
+	Name string `json:"name"`
+}
+
+// FlowDay represents how many notes were in each band at the end of a day (UTC)
+type FlowDay struct {
+	Date   string         `json:"date"` // YYYY-MM-DD
+	Counts map[string]int `json:"counts"`
+}
+
+// CumulativeFlowResponse represents a cumulative flow diagram dataset, oldest day first
+type CumulativeFlowResponse struct {
+	Series []FlowSeries `json:"series"`
+	Days   []FlowDay    `json:"days"`
+}
+
+// WorkItemAge represents a note in progress and how long it has been in progress, in hours
+type WorkItemAge struct {
+	ID       uuid.UUID `json:"id"`
+	Title    string    `json:"title"`
+	Status   string    `json:"status"`
+	Column   string    `json:"column"`
+	Since    time.Time `json:"since"`
+	AgeHours float64   `json:"ageHours"`
+}
+
+// WorkItemAgeResponse represents the notes in progress, oldest first
+type WorkItemAgeResponse struct {
+	Notes []WorkItemAge `json:"notes"`
+	Age   DurationStats `json:"age"`
+}
@@ -0,0 +1,14 @@
+package contracts
+
+import "NoteSense/models"
+
+// ActivityResponse represents a page of the user's activity feed, newest first
+type ActivityResponse struct {
+	Entries    []models.AuditEntry `json:"entries"`
+	NextCursor string              `json:"nextCursor,omitempty"`
+}
+
+// AuditSettingsRequest represents the structure for changing the audit log settings
+type AuditSettingsRequest struct {
+	RetentionDays int `json:"retentionDays"` // 0 keeps entries forever
+}
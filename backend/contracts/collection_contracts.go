@@ -0,0 +1,30 @@
+package contracts
+
+import "NoteSense/models"
+
+// CollectionRequest represents the payload for creating or updating a saved search
+type CollectionRequest struct {
+	Name     string         `json:"name,omitempty"`
+	Query    *string        `json:"query,omitempty"`
+	Filters  *SearchFilters `json:"filters,omitempty"`
+	Mode     string         `json:"mode,omitempty"`
+	Fuzzy    *bool          `json:"fuzzy,omitempty"`
+	Pinned   *bool          `json:"pinned,omitempty"`
+	Position *int           `json:"position,omitempty"`
+}
+
+// CollectionResponse represents the response for saved search operations
+type CollectionResponse struct {
+	Collection models.SavedSearch `json:"collection"`
+}
+
+// CollectionsResponse represents a list of saved searches
+type CollectionsResponse struct {
+	Collections []models.SavedSearch `json:"collections"`
+}
+
+// CollectionNotesResponse represents the notes currently matching a saved search
+type CollectionNotesResponse struct {
+	Collection models.SavedSearch `json:"collection"`
+	SearchNotesResponse
+}
@@ -0,0 +1,60 @@
+package contracts
+
+import "github.com/google/uuid"
+
+// GraphNode represents a note in a graph query result, without its content
+type GraphNode struct {
+	ID         uuid.UUID `json:"id"`
+	Title      string    `json:"title"`
+	Emoji      string    `json:"emoji,omitempty"`
+	Categories []string  `json:"categories"`
+	Status     string    `json:"status"`
+	Depth      *int      `json:"depth,omitempty"` // Hops from the start note in a neighborhood
+	InDegree   int       `json:"inDegree"`
+	OutDegree  int       `json:"outDegree"`
+	Degree     int       `json:"degree"` // Connections within the queried graph
+}
+
+// GraphEdge represents one connection between two notes
+type GraphEdge struct {
+	ID       uuid.UUID `json:"id"`
+	Source   uuid.UUID `json:"source"`
+	Target   uuid.UUID `json:"target"`
+	Type     string    `json:"type"`
+	Directed bool      `json:"directed"`
+	Label    string    `json:"label,omitempty"`
+	Weight   float64   `json:"weight"`
+}
+
+// GraphResponse represents a subgraph, such as the neighborhood of a note
+type GraphResponse struct {
+	Nodes []GraphNode `json:"nodes"`
+	Edges []GraphEdge `json:"edges"`
+}
+
+// GraphPathResponse represents the shortest path between two notes. Nodes are in path order
+// and Edges[i] joins Nodes[i] and Nodes[i+1].
+type GraphPathResponse struct {
+	From   uuid.UUID   `json:"from"`
+	To     uuid.UUID   `json:"to"`
+	Length int         `json:"length"`
+	Nodes  []GraphNode `json:"nodes"`
+	Edges  []GraphEdge `json:"edges"`
+}
+
+// GraphCluster represents a group of notes connected to each other
+type GraphCluster struct {
+	Size  int         `json:"size"`
+	Nodes []GraphNode `json:"nodes"`
+	Edges []GraphEdge `json:"edges"`
+}
+
+// GraphClustersResponse represents the clusters of a graph, largest first
+type GraphClustersResponse struct {
+	Clusters []GraphCluster `json:"clusters"`
+}
+
+// GraphNodesResponse represents a list of notes from a graph query, such as orphans or hubs
+type GraphNodesResponse struct {
+	Nodes []GraphNode `json:"nodes"`
+}
@@ -1,15 +1,29 @@
 package contracts
 
 import (
+	"time"
+
 	"NoteSense/models"
 
 	"github.com/google/uuid"
 )
 
-// ConnectionRequest represents the payload for creating a note connection
+// ConnectionRequest represents the payload for creating a note connection.
+// Connections are directed unless Directed is false; Weight defaults to 1.
 type ConnectionRequest struct {
-	ConnectedNoteID string `json:"connectedNoteId"`
-	ConnectionType  string `json:"connectionType"`
+	ConnectedNoteID string   `json:"connectedNoteId"`
+	ConnectionType  string   `json:"connectionType"`
+	Directed        *bool    `json:"directed,omitempty"`
+	Label           string   `json:"label,omitempty"`
+	Weight          *float64 `json:"weight,omitempty"`
+}
+
+// ConnectionUpdateRequest represents a partial update of a connection
+type ConnectionUpdateRequest struct {
+	ConnectionType *string  `json:"connectionType,omitempty"`
+	Directed       *bool    `json:"directed,omitempty"`
+	Label          *string  `json:"label,omitempty"`
+	Weight         *float64 `json:"weight,omitempty"`
 }
 
 // ConnectionResponse represents the response for note connections
@@ -18,19 +32,67 @@ type ConnectionResponse struct {
 	Connections []Connection `json:"connections"`
 }
 
-// Connection represents a single note connection
+// Connection represents a single note connection as seen from the requested note.
+// NoteID is the note at the other end; Direction is "outgoing", "incoming" or "undirected".
+// Relation reads the connection from the requested note, e.g. "blocks" or "blocked by".
 type Connection struct {
+	ID             uuid.UUID `json:"id"`
 	NoteID         uuid.UUID `json:"noteId"`
 	ConnectionType string    `json:"connectionType"`
+	Direction      string    `json:"direction"`
+	Relation       string    `json:"relation"`
+	Color          string    `json:"color,omitempty"`
+	Label          string    `json:"label,omitempty"`
+	Weight         float64   `json:"weight"`
+	CreatedAt      time.Time `json:"createdAt"`
+}
+
+// ConnectionTypeRequest represents the payload for creating or updating a connection type
+type ConnectionTypeRequest struct {
+	Name        string `json:"name,omitempty"`
+	InverseName string `json:"inverseName,omitempty"`
+	Color       string `json:"color,omitempty"`
+	Directed    *bool  `json:"directed,omitempty"` // Defaults to true
+	Scope       string `json:"scope,omitempty"`    // "user" (default) or "workspace", which only admins may use
+}
+
+// ConnectionTypeResponse represents the response for connection type operations
+type ConnectionTypeResponse struct {
+	ConnectionType models.ConnectionTypeDefinition `json:"connectionType"`
+}
+
+// ConnectionTypesResponse represents the connection types available to a user
+type ConnectionTypesResponse struct {
+	ConnectionTypes []models.ConnectionTypeDefinition `json:"connectionTypes"`
+}
+
+// NoteConnectionResponse represents a single stored connection
+type NoteConnectionResponse struct {
+	Connection models.NoteConnection `json:"connection"`
 }
 
-// NoteRequest represents the structure for note creation/update requests
+// NoteRequest represents the structure for note creation/update requests.
+// When Encrypted is set, Content must be base64 ciphertext and KeyEnvelope is required;
+// the server stores both as opaque values. Title and Categories are always plaintext.
 type NoteRequest struct {
-	Title      string   `json:"title,omitempty"`
-	Content    string   `json:"content,omitempty"`
-	Categories []string `json:"categories,omitempty"`
-	Status     string   `json:"status,omitempty"`
-	UserID     string   `json:"userId"`
+	Title       string              `json:"title,omitempty"`
+	Content     string              `json:"content,omitempty"`
+	Categories  []string            `json:"categories,omitempty"`
+	Status      string              `json:"status,omitempty"`
+	UserID      string              `json:"userId"`
+	Encrypted   bool                `json:"encrypted,omitempty"`
+	KeyEnvelope *models.KeyEnvelope `json:"keyEnvelope,omitempty"`
+}
+
+// LockNoteRequest replaces a note's plaintext content with client-side ciphertext (opaque)
+type LockNoteRequest struct {
+	Content     string              `json:"content"`
+	KeyEnvelope *models.KeyEnvelope `json:"keyEnvelope"`
+}
+
+// UnlockNoteRequest replaces a locked note's ciphertext with decrypted plaintext content
+type UnlockNoteRequest struct {
+	Content string `json:"content"`
 }
 
 // NoteResponse represents the response for note operations
@@ -38,9 +100,10 @@ type NoteResponse struct {
 	Note models.Note `json:"note"`
 }
 
-// NotesResponse represents a list of notes
+// NotesResponse represents a list of notes. NextCursor is set when a paged list has more notes.
 type NotesResponse struct {
-	Notes []models.Note `json:"notes"`
+	Notes      []models.Note `json:"notes"`
+	NextCursor string        `json:"nextCursor,omitempty"`
 }
 
 // UpdateNoteStateRequest represents the request to update a note's state
@@ -49,24 +112,258 @@ type UpdateNoteStateRequest struct {
 	UserID string `json:"userId"`
 }
 
-// KanbanNotesResponse represents notes organized in Kanban columns
+// KanbanNotesResponse represents notes laid out on a Kanban board. BoardID is unset for the
+// built-in board shown to users who have not set up a board of their own.
 type KanbanNotesResponse struct {
-	Backlog    []models.Note `json:"backlog"`
-	Todo       []models.Note `json:"todo"`
-	InProgress []models.Note `json:"in_progress"`
-	Done       []models.Note `json:"done"`
+	BoardID     *uuid.UUID              `json:"boardId,omitempty"`
+	Name        string                  `json:"name"`
+	Transitions models.BoardTransitions `json:"transitions,omitempty"`
+	Columns     []KanbanColumnNotes     `json:"columns"`
+
+	// Set when the board is in critical path order: the longest chain of unfinished dependent
+	// notes, first to do first, and the unfinished notes each unfinished note waits for
+	CriticalPath []uuid.UUID               `json:"criticalPath,omitempty"`
+	BlockedBy    map[uuid.UUID][]uuid.UUID `json:"blockedBy,omitempty"`
+}
+
+// KanbanColumnNotes represents one board column and its cards. NextCursor is set when the
+// column is paged and has more notes.
+type KanbanColumnNotes struct {
+	models.BoardColumn
+	Notes      []models.Note `json:"notes"`
+	NextCursor string        `json:"nextCursor,omitempty"`
+}
+
+// BoardRequest defines the structure for creating or updating a Kanban board.
+// On update, only the fields that are set change.
+type BoardRequest struct {
+	Name        string                  `json:"name"`
+	Columns     []models.BoardColumn    `json:"columns"`
+	Transitions models.BoardTransitions `json:"transitions"`
+	Filter      *models.BoardFilter     `json:"filter,omitempty"`
+	IsDefault   *bool                   `json:"isDefault,omitempty"`
 }
 
-// SearchNotesRequest represents the request structure for searching notes
+// BoardResponse represents the response for board operations
+type BoardResponse struct {
+	Board models.Board `json:"board"`
+}
+
+// BoardsResponse represents a user's Kanban boards
+type BoardsResponse struct {
+	Boards []models.Board `json:"boards"`
+}
+
+// KanbanUpdateRequest defines the structure for moving a card on the Kanban board
+type KanbanUpdateRequest struct {
+	Status   *string `json:"status,omitempty"`
+	Priority *int    `json:"priority,omitempty"`
+	Position *int    `json:"position,omitempty"` // Index within the target Kanban column
+
+	// Force starts or finishes a note even though notes it depends on are unfinished
+	Force bool `json:"force,omitempty"`
+}
+
+// KanbanUpdateResponse represents a card after a move. Warnings and BlockedBy are set
+// when a note was forced into progress or done ahead of its dependencies.
+type KanbanUpdateResponse struct {
+	models.Note
+	Warnings  []string         `json:"warnings,omitempty"`
+	BlockedBy []DependencyNote `json:"blockedBy,omitempty"`
+}
+
+// DependencyNote represents a note another note depends on
+type DependencyNote struct {
+	ID     uuid.UUID `json:"id"`
+	Title  string    `json:"title"`
+	Emoji  string    `json:"emoji,omitempty"`
+	Status string    `json:"status"`
+}
+
+// DependencyBlockedResponse explains why a card cannot move yet
+type DependencyBlockedResponse struct {
+	Error     string           `json:"error"`
+	BlockedBy []DependencyNote `json:"blockedBy"`
+}
+
+// DependencyTreeNode represents a note in a dependency tree. A note reached again, through a
+// shared dependency or a cycle, is listed without its children and marked Repeated.
+type DependencyTreeNode struct {
+	DependencyNote
+	Done     bool                 `json:"done"`
+	Blocked  bool                 `json:"blocked"` // Some note it depends on is unfinished
+	Repeated bool                 `json:"repeated,omitempty"`
+	Children []DependencyTreeNode `json:"children"`
+}
+
+// DependencyTreeResponse represents the notes a note depends on, or the notes depending on it,
+// as a tree rooted at the note
+type DependencyTreeResponse struct {
+	Direction string             `json:"direction"` // "dependencies" or "dependents"
+	Root      DependencyTreeNode `json:"root"`
+}
+
+// SearchNotesRequest represents the request structure for searching notes.
+// Query uses the search query language (e.g. `status:todo tag:infra "exact phrase" -draft`);
+// Filters carries the same constraints in structured form. Both may be combined.
 type SearchNotesRequest struct {
-	Query      string   `json:"q"`
-	Categories []string `json:"categories,omitempty"`
-	UserID     string   `json:"userId"`
+	Query      string         `json:"q"`
+	Categories []string       `json:"categories,omitempty"`
+	Filters    *SearchFilters `json:"filters,omitempty"`
+	UserID     string         `json:"userId"`
+
+	// Fuzzy also matches misspelled words by trigram similarity; FuzzyThreshold (0-1]
+	// sets how similar a word must be and defaults to 0.3
+	Fuzzy          bool     `json:"fuzzy,omitempty"`
+	FuzzyThreshold *float64 `json:"fuzzyThreshold,omitempty"`
+
+	// Mode is "keyword" (default), "semantic" (by meaning) or "hybrid" (both, fused)
+	Mode string `json:"mode,omitempty"`
+
+	// Scope limits where text must match: "all" (default), "body" or "attachments".
+	// It overrides an in: term in the query.
+	Scope string `json:"scope,omitempty"`
+
+	// Limit pages the results; Cursor continues from the nextCursor of a previous page.
+	// Fields restricts the note properties returned, e.g. ["id", "title"].
+	Limit  int      `json:"limit,omitempty"`
+	Cursor string   `json:"cursor,omitempty"`
+	Fields []string `json:"fields,omitempty"`
+}
+
+// SearchFilters are the structured equivalents of the query language's field filters
+type SearchFilters struct {
+	Status        []string   `json:"status,omitempty"`
+	Tags          []string   `json:"tags,omitempty"`
+	ExcludeTags   []string   `json:"excludeTags,omitempty"`
+	Title         string     `json:"title,omitempty"`
+	MinPriority   *int       `json:"minPriority,omitempty"`
+	MaxPriority   *int       `json:"maxPriority,omitempty"`
+	CreatedAfter  *time.Time `json:"createdAfter,omitempty"`
+	CreatedBefore *time.Time `json:"createdBefore,omitempty"`
+	UpdatedAfter  *time.Time `json:"updatedAfter,omitempty"`
+	UpdatedBefore *time.Time `json:"updatedBefore,omitempty"`
+	HasAttachment *bool      `json:"hasAttachment,omitempty"`
+	Pinned        *bool      `json:"pinned,omitempty"`
+	Favorite      *bool      `json:"favorite,omitempty"`
+	Archived      *bool      `json:"archived,omitempty"`
+	Locked        *bool      `json:"locked,omitempty"`
+	Phrases       []string   `json:"phrases,omitempty"` // Exact phrases that must appear
+	Exclude       []string   `json:"exclude,omitempty"` // Words or phrases that must not appear
+}
+
+// SearchResult represents a matched note with its relevance and highlighted, HTML-escaped snippets
+type SearchResult struct {
+	Note           models.Note       `json:"note"`
+	Rank           float64           `json:"rank"`
+	TitleHighlight string            `json:"titleHighlight"`
+	Snippet        string            `json:"snippet,omitempty"`
+	Attachments    []AttachmentMatch `json:"attachments,omitempty"`
+}
+
+// AttachmentMatch represents an attached file whose extracted (OCR or transcript) text matched.
+// Offsets are character ranges of the matched words within that text.
+type AttachmentMatch struct {
+	FileID   uuid.UUID   `json:"fileId"`
+	FileName string      `json:"fileName"`
+	FileType string      `json:"fileType"`
+	Snippet  string      `json:"snippet"`
+	Offsets  []TextRange `json:"offsets"`
+}
+
+// Attachment represents a file attached to a note
+type Attachment struct {
+	ID          uuid.UUID `json:"id"`
+	NoteID      uuid.UUID `json:"noteId"`
+	FileName    string    `json:"fileName"`
+	FileType    string    `json:"fileType"`
+	ContentType string    `json:"contentType"`
+	Size        int64     `json:"size"` // Unknown (0) for files uploaded before sizes were recorded
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// AttachmentsResponse represents the files attached to a note, oldest first
+type AttachmentsResponse struct {
+	Attachments []Attachment `json:"attachments"`
+}
+
+// StorageUsageResponse represents how much storage a user's files take up, in bytes. A quota
+// of 0 means storage is unlimited.
+type StorageUsageResponse struct {
+	UsedBytes  int64            `json:"usedBytes"`
+	QuotaBytes int64            `json:"quotaBytes"`
+	Files      int64            `json:"files"`
+	ByKind     map[string]int64 `json:"byKind"`
+	MaxSizes   map[string]int64 `json:"maxSizes"` // Largest upload allowed per kind
+}
+
+// TextRange represents a [start, end) range of character offsets
+type TextRange struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// SearchNotesResponse represents search results ordered by relevance
+type SearchNotesResponse struct {
+	Results    []SearchResult `json:"results"`
+	Suggestion string         `json:"suggestion,omitempty"` // "Did you mean" query
+	NextCursor string         `json:"nextCursor,omitempty"`
+}
+
+// SimilarNote represents a note related in meaning, with its cosine similarity
+type SimilarNote struct {
+	Note  models.Note `json:"note"`
+	Score float64     `json:"score"`
+}
+
+// SimilarNotesResponse represents the notes most similar to a note.
+// Pending is set while the note itself is still waiting to be embedded.
+type SimilarNotesResponse struct {
+	NoteID  uuid.UUID     `json:"noteId"`
+	Results []SimilarNote `json:"results"`
+	Pending bool          `json:"pending,omitempty"`
+}
+
+// UserSettingsRequest represents a change to the user's preferences
+type UserSettingsRequest struct {
+	SearchLanguage string `json:"searchLanguage"`
 }
 
 // MindmapNotesResponse represents notes and their connections for mindmap visualization
 type MindmapNotesResponse struct {
-	NoteConnections map[uuid.UUID][]uuid.UUID `json:"noteConnections"`
+	NoteConnections map[uuid.UUID][]uuid.UUID         `json:"noteConnections"`
+	Nodes           []MindmapNode                     `json:"nodes"`
+	Edges           []GraphEdge                       `json:"edges"`
+	Layout          string                            `json:"layout,omitempty"` // Layout the coordinates were computed with
+	ConnectionTypes []models.ConnectionTypeDefinition `json:"connectionTypes"`  // For styling edges by type
+	NextCursor      string                            `json:"nextCursor,omitempty"`
+}
+
+// MindmapNode represents a note on a mind map. Degrees count all of the note's connections, not only
+// those on the map. X and Y are set when a layout was requested or the user placed the node by hand.
+type MindmapNode struct {
+	GraphNode
+	X      *float64 `json:"x,omitempty"`
+	Y      *float64 `json:"y,omitempty"`
+	Pinned bool     `json:"pinned"` // Placed by hand; layouts keep the node where it is
+}
+
+// MindmapPosition defines where the user placed a note on a mind map
+type MindmapPosition struct {
+	NoteID uuid.UUID `json:"noteId" validate:"required"`
+	X      float64   `json:"x"`
+	Y      float64   `json:"y"`
+}
+
+// MindmapPositionsRequest defines the structure for saving node positions in a mind map view
+type MindmapPositionsRequest struct {
+	Positions []MindmapPosition `json:"positions" validate:"required,min=1,dive"`
+}
+
+// MindmapPositionsResponse represents the node positions saved in a mind map view
+type MindmapPositionsResponse struct {
+	View      string            `json:"view"`
+	Positions []MindmapPosition `json:"positions"`
 }
 
 // UpdateNoteRequest defines the structure for updating a note
@@ -77,4 +374,31 @@ type UpdateNoteRequest struct {
 	Categories []string  `json:"categories" validate:"omitempty,dive,min=1,max=50"`
 	Status     string    `json:"status" validate:"omitempty,oneof=draft completed archived"`
 	Priority   *int      `json:"priority" validate:"omitempty,min=0,max=5"`
+
+	// KeyEnvelope must accompany new ciphertext when updating a locked note
+	KeyEnvelope *models.KeyEnvelope `json:"keyEnvelope,omitempty"`
+
+	Pinned   *bool `json:"pinned,omitempty"`
+	Favorite *bool `json:"favorite,omitempty"`
+	Archived *bool `json:"archived,omitempty"`
+}
+
+// ReorderNotesRequest sets the manual order of notes; IDs are listed first to last
+type ReorderNotesRequest struct {
+	NoteIDs []uuid.UUID `json:"noteIds"`
+}
+
+// TOCEntry represents a heading in a rendered note's table of contents
+type TOCEntry struct {
+	Level  int    `json:"level"`
+	Text   string `json:"text"`
+	Anchor string `json:"anchor"`
+}
+
+// RenderNoteResponse represents a note's content rendered from Markdown to sanitized HTML
+type RenderNoteResponse struct {
+	NoteID          uuid.UUID  `json:"noteId"`
+	Format          string     `json:"format"`
+	HTML            string     `json:"html"`
+	TableOfContents []TOCEntry `json:"toc"`
 }
@@ -0,0 +1,29 @@
+package contracts
+
+import "NoteSense/models"
+
+// TemplateRequest represents the payload for creating or updating a note template
+type TemplateRequest struct {
+	Name          string   `json:"name,omitempty"`
+	Scope         string   `json:"scope,omitempty"`
+	Title         string   `json:"title,omitempty"`
+	Content       string   `json:"content,omitempty"`
+	Categories    []string `json:"categories,omitempty"`
+	DefaultStatus string   `json:"defaultStatus,omitempty"`
+	Prompts       []string `json:"prompts,omitempty"`
+}
+
+// TemplateResponse represents the response for template operations
+type TemplateResponse struct {
+	Template models.NoteTemplate `json:"template"`
+}
+
+// TemplatesResponse represents a list of templates
+type TemplatesResponse struct {
+	Templates []models.NoteTemplate `json:"templates"`
+}
+
+// CreateNoteFromTemplateRequest carries the values for the template's custom prompts
+type CreateNoteFromTemplateRequest struct {
+	Values map[string]string `json:"values,omitempty"`
+}
@@ -0,0 +1,20 @@
+package contracts
+
+import (
+	"NoteSense/models"
+
+	"github.com/google/uuid"
+)
+
+// CreateUploadRequest represents the structure for starting a resumable upload
+type CreateUploadRequest struct {
+	NoteID   uuid.UUID `json:"noteId"`
+	FileName string    `json:"fileName"`
+	Size     int64     `json:"size"`               // Total size of the file in bytes
+	Checksum string    `json:"checksum,omitempty"` // Optional hex SHA-256 of the whole file
+}
+
+// UploadResponse represents a resumable upload and how much of it has been received
+type UploadResponse struct {
+	Upload models.UploadSession `json:"upload"`
+}
@@ -0,0 +1,179 @@
+package controllers
+
+import (
+	"NoteSense/services"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// AnalyticsHandler holds the analytics service
+type AnalyticsHandler struct {
+	AnalyticsService *services.AnalyticsService
+}
+
+func NewAnalyticsHandler(analyticsService *services.AnalyticsService) *AnalyticsHandler {
+	return &AnalyticsHandler{
+		AnalyticsService: analyticsService,
+	}
+}
+
+// GetFlowTimesHandler handles retrieving the lead and cycle times of finished notes
+func (h *AnalyticsHandler) GetFlowTimesHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := extractUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	filter, err := analyticsFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	from, err := queryTime(r, "from")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	to, err := queryTime(r, "to")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	times, err := h.AnalyticsService.FlowTimes(filter, from, to, userID)
+	if err != nil {
+		writeAnalyticsError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(times)
+}
+
+// GetThroughputHandler handles retrieving the notes finished per week
+func (h *AnalyticsHandler) GetThroughputHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := extractUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	filter, err := analyticsFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	weeks, err := queryInt(r, "weeks", services.DefaultThroughputWeeks)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	throughput, err := h.AnalyticsService.Throughput(filter, weeks, userID)
+	if err != nil {
+		writeAnalyticsError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(throughput)
+}
+
+// GetCumulativeFlowHandler handles retrieving a cumulative flow diagram dataset
+func (h *AnalyticsHandler) GetCumulativeFlowHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := extractUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	filter, err := analyticsFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	days, err := queryInt(r, "days", services.DefaultFlowDays)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	flow, err := h.AnalyticsService.CumulativeFlow(filter, days, userID)
+	if err != nil {
+		writeAnalyticsError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(flow)
+}
+
+// GetWorkItemAgeHandler handles retrieving how long the notes in progress have been in progress
+func (h *AnalyticsHandler) GetWorkItemAgeHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := extractUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	filter, err := analyticsFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ages, err := h.AnalyticsService.WorkItemAge(filter, userID)
+	if err != nil {
+		writeAnalyticsError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ages)
+}
+
+// analyticsFilter reads the board and comma-separated categories query parameters
+func analyticsFilter(r *http.Request) (services.AnalyticsFilter, error) {
+	query := r.URL.Query()
+	filter := services.AnalyticsFilter{Categories: splitList(query.Get("categories"))}
+	if value := query.Get("board"); value != "" {
+		boardID, err := uuid.Parse(value)
+		if err != nil {
+			return filter, fmt.Errorf("Invalid board ID")
+		}
+		filter.BoardID = &boardID
+	}
+	return filter, nil
+}
+
+// queryTime reads a date (YYYY-MM-DD) or RFC 3339 time query parameter; nil when it is absent
+func queryTime(r *http.Request, name string) (*time.Time, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return nil, nil
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return &t, nil
+		}
+	}
+	return nil, fmt.Errorf("%s must be a date such as 2024-01-31 or an RFC 3339 time", name)
+}
+
+// writeAnalyticsError maps analytics errors to HTTP statuses
+func writeAnalyticsError(w http.ResponseWriter, err error) {
+	switch {
+	case err.Error() == "board not found" || err.Error() == "collection not found":
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case strings.HasPrefix(err.Error(), "failed to"):
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	default:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	}
+}
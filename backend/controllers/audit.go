@@ -0,0 +1,323 @@
+package controllers
+
+import (
+	"NoteSense/contracts"
+	"NoteSense/models"
+	"NoteSense/repositories"
+	"NoteSense/services"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// AuditHandler holds the audit service
+type AuditHandler struct {
+	AuditService *services.AuditService
+}
+
+func NewAuditHandler(auditService *services.AuditService) *AuditHandler {
+	return &AuditHandler{
+		AuditService: auditService,
+	}
+}
+
+// GetActivityHandler handles retrieving the user's activity feed
+func (h *AuditHandler) GetActivityHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := extractUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	// ?actions=note.update,user.login narrows the feed down; paging is limit=&cursor=
+	page, err := parsePage(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	actions := splitList(r.URL.Query().Get("actions"))
+
+	activity, err := h.AuditService.GetActivity(userID, actions, page)
+	if err != nil {
+		writeAuditError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(activity)
+}
+
+// ExportAuditHandler handles exporting the whole audit log as CSV or JSON (admins only)
+func (h *AuditHandler) ExportAuditHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := extractUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	from, err := queryTime(r, "from")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	to, err := queryTime(r, "to")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "json"
+	}
+	if format != "json" && format != "csv" {
+		http.Error(w, "format must be json or csv", http.StatusBadRequest)
+		return
+	}
+
+	// Entries are streamed, so errors after the first batch can only be logged
+	started := false
+	start := func() {
+		if started {
+			return
+		}
+		started = true
+		w.Header().Set("Content-Disposition", "attachment; filename=audit."+format)
+		if format == "csv" {
+			w.Header().Set("Content-Type", "text/csv")
+		} else {
+			w.Header().Set("Content-Type", "application/json")
+		}
+	}
+
+	if format == "csv" {
+		writer := csv.NewWriter(w)
+		err = h.AuditService.ExportAudit(from, to, userID, func(entries []models.AuditEntry) error {
+			if !started {
+				start()
+				writer.Write(auditCSVHeader)
+			}
+			for i := range entries {
+				if err := writer.Write(auditCSVRecord(&entries[i])); err != nil {
+					return err
+				}
+			}
+			writer.Flush()
+			return writer.Error()
+		})
+		if err == nil && !started {
+			start()
+			writer.Write(auditCSVHeader)
+			writer.Flush()
+		}
+	} else {
+		encoder := json.NewEncoder(w)
+		err = h.AuditService.ExportAudit(from, to, userID, func(entries []models.AuditEntry) error {
+			for i := range entries {
+				if started {
+					w.Write([]byte(","))
+				} else {
+					start()
+					w.Write([]byte("["))
+				}
+				if err := encoder.Encode(&entries[i]); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err == nil {
+			if !started {
+				start()
+				w.Write([]byte("["))
+			}
+			w.Write([]byte("]\n"))
+		}
+	}
+
+	if err != nil {
+		if started {
+			log.Printf("Audit export failed: %v", err)
+			return
+		}
+		writeAuditError(w, err)
+	}
+}
+
+// GetAuditSettingsHandler handles retrieving the audit log settings (admins only)
+func (h *AuditHandler) GetAuditSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := extractUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	settings, err := h.AuditService.GetAuditSettings(userID)
+	if err != nil {
+		writeAuditError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(settings)
+}
+
+// UpdateAuditSettingsHandler handles changing the audit log settings (admins only)
+func (h *AuditHandler) UpdateAuditSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := extractUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	var req contracts.AuditSettingsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	settings, err := h.AuditService.UpdateAuditSettings(&req, userID)
+	if err != nil {
+		writeAuditError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(settings)
+}
+
+// writeAuditError maps audit errors to HTTP statuses
+func writeAuditError(w http.ResponseWriter, err error) {
+	switch {
+	case err.Error() == "admin access required":
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, repositories.ErrInvalidCursor):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case strings.HasPrefix(err.Error(), "failed to"):
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	default:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	}
+}
+
+var auditCSVHeader = []string{"id", "created_at", "user_id", "actor_id", "action", "target_type", "target_id", "ip", "summary", "changes"}
+
+// auditCSVRecord flattens an audit entry into a CSV row; the changes stay JSON
+func auditCSVRecord(entry *models.AuditEntry) []string {
+	changes := ""
+	if len(entry.Changes) > 0 {
+		data, _ := json.Marshal(entry.Changes)
+		changes = string(data)
+	}
+	return []string{
+		entry.ID.String(),
+		entry.CreatedAt.UTC().Format(time.RFC3339),
+		optionalID(entry.UserID),
+		optionalID(entry.ActorID),
+		entry.Action,
+		entry.TargetType,
+		optionalID(entry.TargetID),
+		entry.IP,
+		entry.Summary,
+		changes,
+	}
+}
+
+func optionalID(id *uuid.UUID) string {
+	if id == nil {
+		return ""
+	}
+	return id.String()
+}
+
+// auditEntry starts an audit entry for an action the user took on their own data in this request
+func auditEntry(r *http.Request, userID uuid.UUID, action, targetType string, targetID uuid.UUID) *models.AuditEntry {
+	entry := &models.AuditEntry{
+		UserID:     &userID,
+		ActorID:    &userID,
+		Action:     action,
+		TargetType: targetType,
+		IP:         clientIP(r),
+	}
+	if targetID != uuid.Nil {
+		entry.TargetID = &targetID
+	}
+	return entry
+}
+
+// trustedProxies lists the networks of the reverse proxies allowed to report a client's address,
+// read once from TRUSTED_PROXIES (comma-separated IPs or CIDRs)
+var trustedProxies = struct {
+	once     sync.Once
+	networks []*net.IPNet
+}{}
+
+// isTrustedProxy reports whether an address belongs to a configured reverse proxy
+func isTrustedProxy(address string) bool {
+	trustedProxies.once.Do(func() {
+		for _, entry := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+			entry = strings.TrimSpace(entry)
+			if entry == "" {
+				continue
+			}
+			if !strings.Contains(entry, "/") {
+				if ip := net.ParseIP(entry); ip != nil && ip.To4() != nil {
+					entry += "/32"
+				} else {
+					entry += "/128"
+				}
+			}
+			_, network, err := net.ParseCIDR(entry)
+			if err != nil {
+				log.Printf("Ignoring invalid TRUSTED_PROXIES entry %q: %v", entry, err)
+				continue
+			}
+			trustedProxies.networks = append(trustedProxies.networks, network)
+		}
+	})
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return false
+	}
+	for _, network := range trustedProxies.networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP returns the address a request came from. X-Forwarded-For and X-Real-IP are only
+// honored when the request comes from a trusted proxy, since anyone else can set them; the
+// client is then the nearest forwarded address that is not itself a trusted proxy.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if !isTrustedProxy(host) {
+		return host
+	}
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		hops := strings.Split(forwarded, ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+			if i == 0 || !isTrustedProxy(hop) {
+				return hop
+			}
+		}
+	}
+	if realIP := r.Header.Get("X-Real-IP"); realIP != "" {
+		return strings.TrimSpace(realIP)
+	}
+	return host
+}
@@ -0,0 +1,198 @@
+package controllers
+
+import (
+	"NoteSense/contracts"
+	"NoteSense/services"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// BoardHandler holds the board service
+type BoardHandler struct {
+	BoardService *services.BoardService
+}
+
+func NewBoardHandler(boardService *services.BoardService) *BoardHandler {
+	return &BoardHandler{
+		BoardService: boardService,
+	}
+}
+
+// CreateBoardHandler handles creating a Kanban board
+func (h *BoardHandler) CreateBoardHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := extractUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	var req contracts.BoardRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	board, err := h.BoardService.CreateBoard(&req, userID)
+	if err != nil {
+		writeBoardError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(contracts.BoardResponse{Board: *board})
+}
+
+// GetBoardsHandler handles listing the user's Kanban boards
+func (h *BoardHandler) GetBoardsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := extractUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	boards, err := h.BoardService.GetBoards(userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(contracts.BoardsResponse{Boards: boards})
+}
+
+// GetBoardHandler handles retrieving a board with its notes grouped into columns
+func (h *BoardHandler) GetBoardHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := extractUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	boardID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid board ID", http.StatusBadRequest)
+		return
+	}
+
+	fields, err := parseNoteFields(splitFields(r.URL.Query().Get("fields")))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	board, err := h.BoardService.GetBoard(boardID, r.URL.Query().Get("order"), fields != nil && !fields["content"], userID)
+	if err != nil {
+		writeBoardError(w, err)
+		return
+	}
+
+	writeNotesJSON(w, board, fields)
+}
+
+// MoveCardHandler handles moving a card on a board
+func (h *BoardHandler) MoveCardHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := extractUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	boardID, err := uuid.Parse(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid board ID", http.StatusBadRequest)
+		return
+	}
+	noteID, err := uuid.Parse(vars["noteId"])
+	if err != nil {
+		http.Error(w, "Invalid note ID", http.StatusBadRequest)
+		return
+	}
+
+	var req contracts.KanbanUpdateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	card, err := h.BoardService.MoveCard(boardID, noteID, &req, userID)
+	if err != nil {
+		writeKanbanMoveError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(card)
+}
+
+// UpdateBoardHandler handles changing a Kanban board
+func (h *BoardHandler) UpdateBoardHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := extractUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	boardID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid board ID", http.StatusBadRequest)
+		return
+	}
+
+	var req contracts.BoardRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	board, err := h.BoardService.UpdateBoard(boardID, &req, userID)
+	if err != nil {
+		writeBoardError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(contracts.BoardResponse{Board: *board})
+}
+
+// DeleteBoardHandler handles deleting a Kanban board
+func (h *BoardHandler) DeleteBoardHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := extractUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	boardID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid board ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.BoardService.DeleteBoard(boardID, userID); err != nil {
+		writeBoardError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeBoardError maps board errors to HTTP statuses
+func writeBoardError(w http.ResponseWriter, err error) {
+	switch {
+	case err.Error() == "board not found":
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case strings.HasPrefix(err.Error(), "failed to"):
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	default:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,264 @@
+package controllers
+
+import (
+	"NoteSense/contracts"
+	"NoteSense/services"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// CollectionHandler holds the collection service
+type CollectionHandler struct {
+	CollectionService *services.CollectionService
+}
+
+func NewCollectionHandler(collectionService *services.CollectionService) *CollectionHandler {
+	return &CollectionHandler{
+		CollectionService: collectionService,
+	}
+}
+
+// CreateCollectionHandler handles saving a new search
+func (h *CollectionHandler) CreateCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := extractUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	var req contracts.CollectionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	collection, err := h.CollectionService.CreateCollection(&req, userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(contracts.CollectionResponse{Collection: *collection})
+}
+
+// GetCollectionsHandler handles listing the user's saved searches
+func (h *CollectionHandler) GetCollectionsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := extractUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	collections, err := h.CollectionService.GetCollections(userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(contracts.CollectionsResponse{Collections: collections})
+}
+
+// GetCollectionHandler handles retrieving a single saved search
+func (h *CollectionHandler) GetCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := extractUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	collectionID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid collection ID", http.StatusBadRequest)
+		return
+	}
+
+	collection, err := h.CollectionService.GetCollectionByID(collectionID, userID)
+	if err != nil {
+		if err.Error() == "collection not found" {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(contracts.CollectionResponse{Collection: *collection})
+}
+
+// UpdateCollectionHandler handles changing a saved search
+func (h *CollectionHandler) UpdateCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := extractUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	collectionID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid collection ID", http.StatusBadRequest)
+		return
+	}
+
+	var req contracts.CollectionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	collection, err := h.CollectionService.UpdateCollection(collectionID, &req, userID)
+	if err != nil {
+		if err.Error() == "collection not found" {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(contracts.CollectionResponse{Collection: *collection})
+}
+
+// DeleteCollectionHandler handles deleting a saved search
+func (h *CollectionHandler) DeleteCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := extractUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	collectionID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid collection ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.CollectionService.DeleteCollection(collectionID, userID); err != nil {
+		if err.Error() == "collection not found" {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetCollectionNotesHandler handles evaluating a saved search against the current notes
+func (h *CollectionHandler) GetCollectionNotesHandler(w http.ResponseWriter, r *http.Request) {
+	h.serveCollectionView(w, r, func(collectionID, userID uuid.UUID) (interface{}, error) {
+		return h.CollectionService.GetCollectionNotes(collectionID, userID)
+	})
+}
+
+// GetCollectionKanbanHandler handles showing a saved search as a Kanban board
+func (h *CollectionHandler) GetCollectionKanbanHandler(w http.ResponseWriter, r *http.Request) {
+	h.serveCollectionView(w, r, func(collectionID, userID uuid.UUID) (interface{}, error) {
+		return h.CollectionService.GetCollectionKanban(collectionID, userID)
+	})
+}
+
+// GetCollectionMindmapHandler handles showing a saved search as a mind map
+func (h *CollectionHandler) GetCollectionMindmapHandler(w http.ResponseWriter, r *http.Request) {
+	layout := r.URL.Query().Get("layout")
+	h.serveCollectionView(w, r, func(collectionID, userID uuid.UUID) (interface{}, error) {
+		return h.CollectionService.GetCollectionMindmap(collectionID, layout, userID)
+	})
+}
+
+// SaveCollectionMindmapPositionsHandler handles saving where the user placed notes on a collection's mind map
+func (h *CollectionHandler) SaveCollectionMindmapPositionsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := extractUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	collectionID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid collection ID", http.StatusBadRequest)
+		return
+	}
+
+	var req contracts.MindmapPositionsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	positions, err := h.CollectionService.SaveCollectionMindmapPositions(collectionID, &req, userID)
+	if err != nil {
+		writeMindmapPositionsError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(positions)
+}
+
+// ResetCollectionMindmapPositionsHandler handles forgetting the positions saved on a collection's mind map
+func (h *CollectionHandler) ResetCollectionMindmapPositionsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := extractUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	collectionID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid collection ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.CollectionService.ResetCollectionMindmapPositions(collectionID, userID); err != nil {
+		writeMindmapPositionsError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// serveCollectionView evaluates a collection with view and writes the result
+func (h *CollectionHandler) serveCollectionView(w http.ResponseWriter, r *http.Request, view func(collectionID, userID uuid.UUID) (interface{}, error)) {
+	userID, err := extractUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	collectionID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid collection ID", http.StatusBadRequest)
+		return
+	}
+
+	result, err := view(collectionID, userID)
+	if err != nil {
+		switch {
+		case err.Error() == "collection not found":
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case err.Error() == "semantic search is not available":
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		case strings.HasPrefix(err.Error(), "invalid layout"):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
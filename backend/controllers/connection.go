@@ -0,0 +1,438 @@
+package controllers
+
+import (
+	"NoteSense/contracts"
+	"NoteSense/models"
+	"NoteSense/repositories"
+	"NoteSense/services"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// ConnectionHandler holds the connection service
+type ConnectionHandler struct {
+	ConnectionService *services.ConnectionService
+	AuditService      *services.AuditService
+}
+
+func NewConnectionHandler(connectionService *services.ConnectionService, auditService *services.AuditService) *ConnectionHandler {
+	return &ConnectionHandler{
+		ConnectionService: connectionService,
+		AuditService:      auditService,
+	}
+}
+
+// GetNoteConnectionsHandler handles retrieving the incoming and outgoing connections of a note
+func (h *ConnectionHandler) GetNoteConnectionsHandler(w http.ResponseWriter, r *http.Request) {
+	// Extract user ID from token
+	userID, err := extractUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	// Get note ID from URL parameters
+	noteID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid note ID", http.StatusBadRequest)
+		return
+	}
+
+	connections, err := h.ConnectionService.GetNoteConnections(noteID, userID)
+	if err != nil {
+		if err.Error() == "note not found" {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return connections
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(connections)
+}
+
+// ConnectNoteHandler handles creating a connection between notes
+func (h *ConnectionHandler) ConnectNoteHandler(w http.ResponseWriter, r *http.Request) {
+	// Extract user ID from token
+	userID, err := extractUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	// Get note ID from URL parameters
+	noteID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid note ID", http.StatusBadRequest)
+		return
+	}
+
+	// Decode connection request
+	var req contracts.ConnectionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	if _, err := uuid.Parse(req.ConnectedNoteID); err != nil {
+		http.Error(w, "Invalid connected note ID", http.StatusBadRequest)
+		return
+	}
+
+	connection, err := h.ConnectionService.ConnectNotes(noteID, &req, userID)
+	if err != nil {
+		if err.Error() == "note not found" {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if strings.HasPrefix(err.Error(), "dependency cycle") {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	entry := auditEntry(r, userID, services.AuditConnectionCreate, services.AuditTargetConnection, connection.ID)
+	entry.Summary = fmt.Sprintf("connected note %s to %s as %s", connection.SourceID, connection.TargetID, connection.Type)
+	h.AuditService.Record(entry)
+
+	// Return success response
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":    "Notes connected successfully",
+		"connection": connection,
+	})
+}
+
+// UnlinkNoteHandler handles removing the connections from a note to another
+func (h *ConnectionHandler) UnlinkNoteHandler(w http.ResponseWriter, r *http.Request) {
+	// Extract user ID from token
+	userID, err := extractUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	// Get note IDs from URL parameters
+	vars := mux.Vars(r)
+	noteID, err := uuid.Parse(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid note ID", http.StatusBadRequest)
+		return
+	}
+
+	connectedNoteID, err := uuid.Parse(vars["connectedNoteId"])
+	if err != nil {
+		http.Error(w, "Invalid connected note ID", http.StatusBadRequest)
+		return
+	}
+
+	// Remove connection
+	if err := h.ConnectionService.UnlinkNotes(noteID, connectedNoteID, userID); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	entry := auditEntry(r, userID, services.AuditConnectionDelete, services.AuditTargetNote, noteID)
+	entry.Summary = fmt.Sprintf("unlinked note %s from %s", noteID, connectedNoteID)
+	h.AuditService.Record(entry)
+
+	// Return success response
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Notes unlinked successfully",
+	})
+}
+
+// UpdateConnectionHandler handles changing the type, direction, label or weight of a connection
+func (h *ConnectionHandler) UpdateConnectionHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := extractUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	connectionID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid connection ID", http.StatusBadRequest)
+		return
+	}
+
+	var req contracts.ConnectionUpdateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	// Keep the connection as it was for the audit diff
+	before, err := h.ConnectionService.GetConnection(connectionID, userID)
+	if err != nil {
+		if err.Error() == "connection not found" {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	connection, err := h.ConnectionService.UpdateConnection(connectionID, &req, userID)
+	if err != nil {
+		if err.Error() == "connection not found" {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if strings.HasPrefix(err.Error(), "dependency cycle") {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	entry := auditEntry(r, userID, services.AuditConnectionUpdate, services.AuditTargetConnection, connection.ID)
+	entry.Changes = services.ConnectionChanges(before, connection)
+	entry.Summary = services.ChangeSummary(entry.Changes)
+	h.AuditService.Record(entry)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(contracts.NoteConnectionResponse{Connection: *connection})
+}
+
+// DeleteConnectionHandler handles removing a single connection
+func (h *ConnectionHandler) DeleteConnectionHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := extractUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	connectionID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid connection ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.ConnectionService.DeleteConnection(connectionID, userID); err != nil {
+		if err.Error() == "connection not found" {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.AuditService.Record(auditEntry(r, userID, services.AuditConnectionDelete, services.AuditTargetConnection, connectionID))
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetNotesMindmapHandler handles retrieving notes for mindmap visualization
+func (h *ConnectionHandler) GetNotesMindmapHandler(w http.ResponseWriter, r *http.Request) {
+	// Extract user ID from token
+	userID, err := extractUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	page, err := parsePage(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Get notes for mindmap
+	mindmapNotes, err := h.ConnectionService.GetNotesMindmap(userID, page, r.URL.Query().Get("layout"))
+	if err != nil {
+		if errors.Is(err, repositories.ErrInvalidCursor) || strings.HasPrefix(err.Error(), "invalid layout") {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return notes for mindmap
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(mindmapNotes)
+}
+
+// SaveMindmapPositionsHandler handles saving where the user placed notes on the mind map
+func (h *ConnectionHandler) SaveMindmapPositionsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := extractUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	var req contracts.MindmapPositionsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	positions, err := h.ConnectionService.SaveMindmapPositions(models.MindmapViewNotes, &req, userID)
+	if err != nil {
+		writeMindmapPositionsError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(positions)
+}
+
+// ResetMindmapPositionsHandler handles forgetting the positions saved on the mind map
+func (h *ConnectionHandler) ResetMindmapPositionsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := extractUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.ConnectionService.ResetMindmapPositions(models.MindmapViewNotes, userID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeMindmapPositionsError maps errors from saving mind map positions to HTTP statuses
+func writeMindmapPositionsError(w http.ResponseWriter, err error) {
+	switch {
+	case err.Error() == "note not found" || err.Error() == "collection not found":
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case strings.HasPrefix(err.Error(), "failed to"):
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	default:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	}
+}
+
+// CreateConnectionTypeHandler handles defining a new connection type
+func (h *ConnectionHandler) CreateConnectionTypeHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := extractUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	var req contracts.ConnectionTypeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	definition, err := h.ConnectionService.CreateConnectionType(&req, userID)
+	if err != nil {
+		if strings.HasPrefix(err.Error(), "connection type already exists") {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(contracts.ConnectionTypeResponse{ConnectionType: *definition})
+}
+
+// GetConnectionTypesHandler handles listing the connection types available to the user
+func (h *ConnectionHandler) GetConnectionTypesHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := extractUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	definitions, err := h.ConnectionService.GetConnectionTypes(userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(contracts.ConnectionTypesResponse{ConnectionTypes: definitions})
+}
+
+// UpdateConnectionTypeHandler handles changing a connection type
+func (h *ConnectionHandler) UpdateConnectionTypeHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := extractUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	definitionID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid connection type ID", http.StatusBadRequest)
+		return
+	}
+
+	var req contracts.ConnectionTypeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	definition, err := h.ConnectionService.UpdateConnectionType(definitionID, &req, userID)
+	if err != nil {
+		writeConnectionTypeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(contracts.ConnectionTypeResponse{ConnectionType: *definition})
+}
+
+// DeleteConnectionTypeHandler handles removing an unused connection type
+func (h *ConnectionHandler) DeleteConnectionTypeHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := extractUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	definitionID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid connection type ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.ConnectionService.DeleteConnectionType(definitionID, userID); err != nil {
+		writeConnectionTypeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeConnectionTypeError maps connection type errors to HTTP statuses
+func writeConnectionTypeError(w http.ResponseWriter, err error) {
+	switch {
+	case err.Error() == "connection type not found":
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case err.Error() == "only the connection type owner can modify it",
+		strings.HasPrefix(err.Error(), "only admins"):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case strings.HasPrefix(err.Error(), "connection type is used by"):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case strings.HasPrefix(err.Error(), "failed to"):
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	default:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	}
+}
@@ -2,43 +2,36 @@ package controllers
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
+	"mime"
 	"net/http"
-	"path/filepath"
 	"strings"
 
 	"NoteSense/services"
 
 	"github.com/google/uuid"
+	"github.com/gorilla/mux"
 )
 
 type FileHandler struct {
 	uploadService *services.FileUploadService
+	auditService  *services.AuditService
 }
 
-func NewFileHandler(service *services.FileUploadService) *FileHandler {
+func NewFileHandler(service *services.FileUploadService, auditService *services.AuditService) *FileHandler {
 	return &FileHandler{
 		uploadService: service,
+		auditService:  auditService,
 	}
 }
 
-func isValidFileType(filename string) bool {
-	ext := strings.ToLower(filepath.Ext(filename))
-	validExtensions := map[string]bool{
-		".jpg":  true,
-		".jpeg": true,
-		".png":  true,
-		".gif":  true,
-		".mp3":  true,
-		".wav":  true,
-		".ogg":  true,
-		".pdf":  true,
-		".doc":  true,
-		".docx": true,
-		".txt":  true,
-	}
-	return validExtensions[ext]
-}
+// multipartOverhead allows for the form fields and part headers around an uploaded file
+const multipartOverhead = 1 << 20
+
+// uploadMemory is how much of a multipart form is kept in memory; the rest goes to temporary files
+const uploadMemory = 10 << 20
 
 func (h *FileHandler) UploadFileHandler(w http.ResponseWriter, r *http.Request) {
 	// Extract user ID from context with better error handling
@@ -48,9 +41,15 @@ func (h *FileHandler) UploadFileHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// Parse multipart form
-	if err := r.ParseMultipartForm(10 << 20); err != nil { // 10 MB max
-		http.Error(w, "File too large", http.StatusBadRequest)
+	// Parse multipart form, refusing bodies larger than the largest file allowed
+	r.Body = http.MaxBytesReader(w, r.Body, services.MaxUploadSize()+multipartOverhead)
+	if err := r.ParseMultipartForm(uploadMemory); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "File too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "Invalid multipart form", http.StatusBadRequest)
 		return
 	}
 
@@ -68,21 +67,139 @@ func (h *FileHandler) UploadFileHandler(w http.ResponseWriter, r *http.Request)
 	}
 	defer file.Close()
 
-	// Validate file type and size
-	if !isValidFileType(header.Filename) {
-		http.Error(w, "Unsupported file type", http.StatusBadRequest)
-		return
-	}
-
-	// Save file
+	// Save file; its type, content and size are checked against the file type registry
 	metadata, err := h.uploadService.SaveFile(header, userID, noteId)
 	if err != nil {
 		log.Printf("File upload error: %v", err)
-		http.Error(w, "Failed to upload file", http.StatusInternalServerError)
+		writeFileError(w, err)
 		return
 	}
+	entry := auditEntry(r, userID, services.AuditFileUpload, services.AuditTargetFile, metadata.ID)
+	entry.Summary = fmt.Sprintf("uploaded %s to note %s", metadata.FileName, noteId)
+	h.auditService.Record(entry)
 
 	// Respond with metadata
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(metadata)
 }
+
+// GetNoteAttachmentsHandler handles listing the files attached to a note
+func (h *FileHandler) GetNoteAttachmentsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := extractUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	noteID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid note ID", http.StatusBadRequest)
+		return
+	}
+
+	attachments, err := h.uploadService.GetAttachments(noteID, userID)
+	if err != nil {
+		writeFileError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(attachments)
+}
+
+// DownloadFileHandler handles downloading a file, in whole or in byte ranges. Files are sent
+// as attachments unless ?inline=true asks for them to be displayed.
+func (h *FileHandler) DownloadFileHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := extractUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	fileID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid file ID", http.StatusBadRequest)
+		return
+	}
+
+	file, contents, err := h.uploadService.ReadFile(fileID, userID)
+	if err != nil {
+		writeFileError(w, err)
+		return
+	}
+	defer contents.Close()
+
+	disposition := "attachment"
+	if r.URL.Query().Get("inline") == "true" {
+		disposition = "inline"
+	}
+	w.Header().Set("Content-Type", services.FileContentType(file))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": file.FileName}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "private, no-cache")
+
+	// ServeContent answers Range and conditional requests
+	http.ServeContent(w, r, file.FileName, file.CreatedAt, contents)
+}
+
+// DeleteFileHandler handles deleting a file and the text extracted from it
+func (h *FileHandler) DeleteFileHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := extractUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	fileID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid file ID", http.StatusBadRequest)
+		return
+	}
+
+	file, err := h.uploadService.DeleteFile(fileID, userID)
+	if err != nil {
+		writeFileError(w, err)
+		return
+	}
+	entry := auditEntry(r, userID, services.AuditFileDelete, services.AuditTargetFile, fileID)
+	entry.Summary = fmt.Sprintf("deleted %s", file.FileName)
+	h.auditService.Record(entry)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetStorageUsageHandler handles retrieving how much storage the user's files take up
+func (h *FileHandler) GetStorageUsageHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := extractUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	usage, err := h.uploadService.GetStorageUsage(userID)
+	if err != nil {
+		writeFileError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(usage)
+}
+
+// writeFileError maps file errors to HTTP statuses
+func writeFileError(w http.ResponseWriter, err error) {
+	switch {
+	case err.Error() == "file not found" || err.Error() == "note not found" || err.Error() == "file contents not found":
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case strings.HasPrefix(err.Error(), "unsupported file type") || strings.Contains(err.Error(), "does not match its extension"):
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+	case strings.HasPrefix(err.Error(), "file too large"):
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+	case strings.HasPrefix(err.Error(), "storage quota exceeded"):
+		http.Error(w, err.Error(), http.StatusInsufficientStorage)
+	case strings.HasPrefix(err.Error(), "failed to"):
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	default:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	}
+}
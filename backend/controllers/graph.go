@@ -0,0 +1,205 @@
+package controllers
+
+import (
+	"NoteSense/repositories"
+	"NoteSense/services"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// GraphHandler holds the graph service
+type GraphHandler struct {
+	GraphService *services.GraphService
+}
+
+func NewGraphHandler(graphService *services.GraphService) *GraphHandler {
+	return &GraphHandler{
+		GraphService: graphService,
+	}
+}
+
+// GetNeighborhoodHandler handles retrieving the notes within a few hops of a note
+func (h *GraphHandler) GetNeighborhoodHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := extractUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	noteID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid note ID", http.StatusBadRequest)
+		return
+	}
+
+	depth, err := queryInt(r, "depth", 1)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	graph, err := h.GraphService.Neighborhood(noteID, depth, walkDirection(r), graphFilter(r), userID)
+	if err != nil {
+		writeGraphError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(graph)
+}
+
+// GetPathHandler handles retrieving the shortest path between two notes
+func (h *GraphHandler) GetPathHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := extractUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	noteID, err := uuid.Parse(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid note ID", http.StatusBadRequest)
+		return
+	}
+
+	targetID, err := uuid.Parse(vars["targetId"])
+	if err != nil {
+		http.Error(w, "Invalid target note ID", http.StatusBadRequest)
+		return
+	}
+
+	path, err := h.GraphService.ShortestPath(noteID, targetID, walkDirection(r), graphFilter(r), userID)
+	if err != nil {
+		writeGraphError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(path)
+}
+
+// GetClustersHandler handles retrieving the groups of connected notes
+func (h *GraphHandler) GetClustersHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := extractUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	minSize, err := queryInt(r, "minSize", 2)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	clusters, err := h.GraphService.Clusters(graphFilter(r), minSize, userID)
+	if err != nil {
+		writeGraphError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(clusters)
+}
+
+// GetOrphansHandler handles retrieving the notes without connections
+func (h *GraphHandler) GetOrphansHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := extractUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	orphans, err := h.GraphService.Orphans(graphFilter(r), userID)
+	if err != nil {
+		writeGraphError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(orphans)
+}
+
+// GetHubsHandler handles retrieving the most connected notes
+func (h *GraphHandler) GetHubsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := extractUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	limit, err := queryInt(r, "limit", services.DefaultHubCount)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	hubs, err := h.GraphService.Hubs(graphFilter(r), limit, userID)
+	if err != nil {
+		writeGraphError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(hubs)
+}
+
+// graphFilter reads the comma-separated types and categories query parameters
+func graphFilter(r *http.Request) repositories.GraphFilter {
+	query := r.URL.Query()
+	return repositories.GraphFilter{
+		Types:      splitList(query.Get("types")),
+		Categories: splitList(query.Get("categories")),
+	}
+}
+
+// splitList splits a comma-separated query parameter, dropping blank entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range splitFields(value) {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// walkDirection reads the direction query parameter, following connections both ways by default
+func walkDirection(r *http.Request) string {
+	if direction := r.URL.Query().Get("direction"); direction != "" {
+		return direction
+	}
+	return repositories.WalkBoth
+}
+
+// queryInt reads an integer query parameter, falling back to a default when it is absent
+func queryInt(r *http.Request, name string, fallback int) (int, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return fallback, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be a number", name)
+	}
+	return n, nil
+}
+
+// writeGraphError maps graph query errors to HTTP statuses
+func writeGraphError(w http.ResponseWriter, err error) {
+	switch {
+	case err.Error() == "note not found" || err.Error() == "no path between notes":
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case strings.HasPrefix(err.Error(), "failed to"):
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	default:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	}
+}
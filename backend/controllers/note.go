@@ -2,14 +2,18 @@ package controllers
 
 import (
 	"NoteSense/contracts"
+	"NoteSense/models"
+	"NoteSense/repositories"
 	"NoteSense/services"
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -19,12 +23,14 @@ import (
 
 // NoteHandler holds the note service
 type NoteHandler struct {
-	NoteService *services.NoteService
+	NoteService  *services.NoteService
+	AuditService *services.AuditService
 }
 
-func NewNoteHandler(noteService *services.NoteService) *NoteHandler {
+func NewNoteHandler(noteService *services.NoteService, auditService *services.AuditService) *NoteHandler {
 	return &NoteHandler{
-		NoteService: noteService,
+		NoteService:  noteService,
+		AuditService: auditService,
 	}
 }
 
@@ -44,12 +50,20 @@ func (h *NoteHandler) CreateNoteHandler(w http.ResponseWriter, r *http.Request)
 	}
 	defer r.Body.Close()
 
-	// Create note
-	note, err := h.NoteService.CreateNote(req.Title, req.Content, req.Categories, userID)
+	// Create note; locked notes carry client-side ciphertext
+	var note *models.Note
+	if req.Encrypted {
+		note, err = h.NoteService.CreateLockedNote(req.Title, req.Content, req.KeyEnvelope, req.Categories, userID)
+	} else {
+		note, err = h.NoteService.CreateNote(req.Title, req.Content, req.Categories, userID)
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	entry := auditEntry(r, userID, services.AuditNoteCreate, services.AuditTargetNote, note.ID)
+	entry.Summary = fmt.Sprintf("created note %q", note.Title)
+	h.AuditService.Record(entry)
 
 	// Return created note
 	w.Header().Set("Content-Type", "application/json")
@@ -66,16 +80,80 @@ func (h *NoteHandler) GetNotesHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Parse list options: ?archived=exclude|only|include&pinned=&favorite=&sort=&order=asc|desc
+	// plus paging (limit=&cursor=) and a field selection (fields=id,title,...)
+	query := r.URL.Query()
+	opts := repositories.NoteListOptions{
+		Archived:   query.Get("archived"),
+		SortBy:     query.Get("sort"),
+		Descending: query.Get("order") == "desc",
+	}
+	switch opts.Archived {
+	case "true":
+		opts.Archived = "only"
+	case "false":
+		opts.Archived = "exclude"
+	}
+	for name, target := range map[string]**bool{"pinned": &opts.Pinned, "favorite": &opts.Favorite} {
+		if value := query.Get(name); value != "" {
+			parsed, err := strconv.ParseBool(value)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Invalid %s filter", name), http.StatusBadRequest)
+				return
+			}
+			*target = &parsed
+		}
+	}
+	if opts.Page, err = parsePage(r); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if opts.Page.Limit == 0 {
+		opts.Page.Limit = services.DefaultNotePageSize
+	}
+	fields, err := parseNoteFields(splitFields(query.Get("fields")))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	opts.OmitContent = fields != nil && !fields["content"]
+
 	// Get notes
-	notes, err := h.NoteService.GetNotesByUserID(userID.String())
+	notes, next, err := h.NoteService.ListNotes(userID, opts)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		if strings.HasPrefix(err.Error(), "failed to") {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
 	// Return notes
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(contracts.NotesResponse{Notes: notes})
+	writeNotesJSON(w, contracts.NotesResponse{Notes: notes, NextCursor: next}, fields)
+}
+
+// ReorderNotesHandler handles saving the manual order of the notes list
+func (h *NoteHandler) ReorderNotesHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := extractUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	var req contracts.ReorderNotesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	if err := h.NoteService.ReorderNotes(req.NoteIDs, userID); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
 }
 
 // GetNoteHandler handles retrieving a single note by ID
@@ -111,6 +189,113 @@ func (h *NoteHandler) GetNoteHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(contracts.NoteResponse{Note: *note})
 }
 
+// RenderNoteHandler handles rendering a note's Markdown content as sanitized HTML
+func (h *NoteHandler) RenderNoteHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := extractUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	noteID, err := uuid.Parse(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid note ID", http.StatusBadRequest)
+		return
+	}
+
+	rendered, err := h.NoteService.RenderNote(noteID, r.URL.Query().Get("format"), userID)
+	if err != nil {
+		if err.Error() == "note not found" {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rendered)
+}
+
+// SimilarNotesHandler returns the notes closest in meaning to a note
+func (h *NoteHandler) SimilarNotesHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := extractUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	noteID, err := uuid.Parse(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid note ID", http.StatusBadRequest)
+		return
+	}
+
+	limit := 10
+	if value := r.URL.Query().Get("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > 50 {
+			http.Error(w, "limit must be between 1 and 50", http.StatusBadRequest)
+			return
+		}
+	}
+
+	similar, err := h.NoteService.SimilarNotes(noteID, limit, userID)
+	if err != nil {
+		switch err.Error() {
+		case "note not found":
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case "semantic search is not available":
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(similar)
+}
+
+// DependencyTreeHandler returns the notes a note depends on, or with ?direction=dependents
+// the notes depending on it, as a tree
+func (h *NoteHandler) DependencyTreeHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := extractUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	noteID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid note ID", http.StatusBadRequest)
+		return
+	}
+
+	direction := r.URL.Query().Get("direction")
+	if direction == "" {
+		direction = services.DependencyTreeDependencies
+	}
+
+	tree, err := h.NoteService.GetDependencyTree(noteID, direction, userID)
+	if err != nil {
+		switch {
+		case err.Error() == "note not found":
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case strings.HasPrefix(err.Error(), "invalid direction"):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tree)
+}
+
 func (h *NoteHandler) UpdateNoteHandler(w http.ResponseWriter, r *http.Request) {
 	// Get note ID from URL
 	vars := mux.Vars(r)
@@ -136,12 +321,23 @@ func (h *NoteHandler) UpdateNoteHandler(w http.ResponseWriter, r *http.Request)
 	}
 
 	req.NoteID = noteID
+	// Keep the note as it was for the audit diff
+	before, err := h.NoteService.GetNoteByID(noteID, userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	// Update note
 	note, err := h.NoteService.UpdateNote(&req, userID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	entry := auditEntry(r, userID, services.AuditNoteUpdate, services.AuditTargetNote, note.ID)
+	entry.Changes = services.NoteChanges(before, note)
+	entry.Summary = services.ChangeSummary(entry.Changes)
+	h.AuditService.Record(entry)
 
 	// Return updated note
 	w.Header().Set("Content-Type", "application/json")
@@ -149,6 +345,80 @@ func (h *NoteHandler) UpdateNoteHandler(w http.ResponseWriter, r *http.Request)
 	json.NewEncoder(w).Encode(contracts.NoteResponse{Note: *note})
 }
 
+// LockNoteHandler handles replacing a note's content with client-side ciphertext
+func (h *NoteHandler) LockNoteHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := extractUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	noteID, err := uuid.Parse(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid note ID", http.StatusBadRequest)
+		return
+	}
+
+	var req contracts.LockNoteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	note, err := h.NoteService.LockNote(noteID, &req, userID)
+	if err != nil {
+		if err.Error() == "note not found" {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	h.AuditService.Record(auditEntry(r, userID, services.AuditNoteLock, services.AuditTargetNote, note.ID))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(contracts.NoteResponse{Note: *note})
+}
+
+// UnlockNoteHandler handles storing a locked note's decrypted content as plaintext
+func (h *NoteHandler) UnlockNoteHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := extractUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	noteID, err := uuid.Parse(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid note ID", http.StatusBadRequest)
+		return
+	}
+
+	var req contracts.UnlockNoteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	note, err := h.NoteService.UnlockNote(noteID, &req, userID)
+	if err != nil {
+		if err.Error() == "note not found" {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	h.AuditService.Record(auditEntry(r, userID, services.AuditNoteUnlock, services.AuditTargetNote, note.ID))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(contracts.NoteResponse{Note: *note})
+}
+
 // DeleteNoteHandler handles deleting a note
 func (h *NoteHandler) DeleteNoteHandler(w http.ResponseWriter, r *http.Request) {
 	// Get note ID from URL
@@ -165,11 +435,21 @@ func (h *NoteHandler) DeleteNoteHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	// Keep the title for the audit log
+	note, err := h.NoteService.GetNoteByID(noteID, userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	// Delete note
 	if err := h.NoteService.DeleteNote(noteID, userID); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	entry := auditEntry(r, userID, services.AuditNoteDelete, services.AuditTargetNote, noteID)
+	entry.Summary = fmt.Sprintf("deleted note %q", note.Title)
+	h.AuditService.Record(entry)
 
 	// Return success
 	w.WriteHeader(http.StatusNoContent)
@@ -247,26 +527,25 @@ func (c *NoteHandler) UpdateNoteStateAndPriorityHandler(w http.ResponseWriter, r
 	r.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
 
 	// Decode request body
-	var updateRequest struct {
-		Status   *string `json:"status,omitempty"`
-		Priority *int    `json:"priority,omitempty"`
-	}
+	var updateRequest contracts.KanbanUpdateRequest
 	if err := json.NewDecoder(r.Body).Decode(&updateRequest); err != nil {
 		log.Printf("JSON decoding error: %v", err)
 		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
 		return
 	}
 
-	log.Printf("Update Request: Status=%v, Priority=%v",
+	log.Printf("Update Request: Status=%v, Priority=%v, Position=%v, Force=%v",
 		updateRequest.Status,
 		updateRequest.Priority,
+		updateRequest.Position,
+		updateRequest.Force,
 	)
 
 	// Update note in service
-	note, err := c.NoteService.UpdateNoteStateAndPriority(noteID, updateRequest.Status, updateRequest.Priority, userID)
+	note, err := c.NoteService.UpdateNoteStateAndPriority(noteID, &updateRequest, userID)
 	if err != nil {
 		log.Printf("Note update error: %v", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeKanbanMoveError(w, err)
 		return
 	}
 
@@ -280,6 +559,29 @@ func (c *NoteHandler) UpdateNoteStateAndPriorityHandler(w http.ResponseWriter, r
 	}
 }
 
+// writeKanbanMoveError maps the errors of moving a card to HTTP statuses. Moves blocked by
+// dependencies list the blocking notes.
+func writeKanbanMoveError(w http.ResponseWriter, err error) {
+	var blocked *services.DependencyBlockedError
+	if errors.As(err, &blocked) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(contracts.DependencyBlockedResponse{Error: err.Error(), BlockedBy: blocked.Blockers})
+		return
+	}
+	switch {
+	case err.Error() == "note not found" || err.Error() == "board not found" || err.Error() == "note is not on this board":
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case strings.HasPrefix(err.Error(), "invalid note state") || strings.HasPrefix(err.Error(), "priority must be"):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case strings.HasSuffix(err.Error(), "is not allowed") || strings.Contains(err.Error(), "WIP limit of"):
+		// The board's rules refuse the move
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
 // GetKanbanNotesHandler handles retrieving notes in Kanban-style organization
 func (h *NoteHandler) GetKanbanNotesHandler(w http.ResponseWriter, r *http.Request) {
 	// Log incoming request details
@@ -303,103 +605,43 @@ func (h *NoteHandler) GetKanbanNotesHandler(w http.ResponseWriter, r *http.Reque
 
 	log.Printf("Extracted User ID: %s", userID)
 
-	// Get Kanban notes
-	kanbanNotes, err := h.NoteService.GetKanbanNotes(userID)
-	if err != nil {
-		log.Printf("Error fetching Kanban notes: %v", err)
-		http.Error(w, fmt.Sprintf("Failed to retrieve notes: %v", err), http.StatusInternalServerError)
-		return
-	}
-
-	// Return Kanban notes
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	if err := json.NewEncoder(w).Encode(kanbanNotes); err != nil {
-		log.Printf("Error encoding Kanban notes: %v", err)
-		http.Error(w, "Failed to encode notes", http.StatusInternalServerError)
-		return
-	}
-}
-
-// SearchNotesHandler handles searching notes
-func (h *NoteHandler) SearchNotesHandler(w http.ResponseWriter, r *http.Request) {
-	// Extract user ID from token
-	userID, err := extractUserID(r)
+	// Paging is per column: ?limit= pages every column, ?column=&cursor= continues one of them
+	page, err := parsePage(r)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusUnauthorized)
-		return
-	}
-
-	// Decode search request
-	var req contracts.SearchNotesRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
-		return
-	}
-	defer r.Body.Close()
-
-	// Perform search
-	notes, err := h.NoteService.SearchNotes(req.Query, req.Categories, userID)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-
-	// Return search results
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(contracts.NotesResponse{Notes: notes})
-}
-
-// GetNoteConnectionsHandler handles retrieving all connections for a specific note
-func (h *NoteHandler) GetNoteConnectionsHandler(w http.ResponseWriter, r *http.Request) {
-	// Extract user ID from token
-	userID, err := extractUserID(r)
+	fields, err := parseNoteFields(splitFields(r.URL.Query().Get("fields")))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusUnauthorized)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-
-	// Get note ID from URL parameters
-	vars := mux.Vars(r)
-	noteID, err := uuid.Parse(vars["id"])
-	if err != nil {
-		http.Error(w, "Invalid note ID", http.StatusBadRequest)
-		return
+	opts := repositories.KanbanPageOptions{
+		Column:      r.URL.Query().Get("column"),
+		Page:        page,
+		OmitContent: fields != nil && !fields["content"],
+		Order:       r.URL.Query().Get("order"),
 	}
 
-	// Get note from service to ensure user owns the note
-	note, err := h.NoteService.GetNoteByID(noteID, userID)
+	// Get Kanban notes
+	kanbanNotes, err := h.NoteService.GetKanbanNotes(userID, opts)
 	if err != nil {
-		if err.Error() == "note not found" {
-			http.Error(w, err.Error(), http.StatusNotFound)
+		log.Printf("Error fetching Kanban notes: %v", err)
+		if errors.Is(err, repositories.ErrInvalidCursor) || strings.HasPrefix(err.Error(), "invalid kanban") ||
+			err.Error() == "cursor requires a kanban column" || err.Error() == "critical path order cannot be paged" {
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, fmt.Sprintf("Failed to retrieve notes: %v", err), http.StatusInternalServerError)
 		return
 	}
 
-	// Prepare connections response
-	connections := make([]contracts.Connection, 0)
-	for _, conn := range note.ConnectedNoteIDs {
-		connNoteID, err := uuid.Parse(conn)
-		if err == nil {
-			connections = append(connections, contracts.Connection{
-				NoteID:         connNoteID,
-				ConnectionType: "", // You might want to add logic to get connection type
-			})
-		}
-	}
-
-	// Return connections
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(contracts.ConnectionResponse{
-		NoteID:      note.ID,
-		Connections: connections,
-	})
+	// Return Kanban notes
+	writeNotesJSON(w, kanbanNotes, fields)
 }
 
-// ConnectNoteHandler handles creating a connection between notes
-func (h *NoteHandler) ConnectNoteHandler(w http.ResponseWriter, r *http.Request) {
+// SearchNotesHandler handles searching notes
+func (h *NoteHandler) SearchNotesHandler(w http.ResponseWriter, r *http.Request) {
 	// Extract user ID from token
 	userID, err := extractUserID(r)
 	if err != nil {
@@ -407,97 +649,48 @@ func (h *NoteHandler) ConnectNoteHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// Get note ID from URL parameters
-	vars := mux.Vars(r)
-	noteID, err := uuid.Parse(vars["id"])
-	if err != nil {
-		http.Error(w, "Invalid note ID", http.StatusBadRequest)
-		return
-	}
-
-	// Decode connection request
-	var req contracts.ConnectionRequest
+	// Decode search request
+	var req contracts.SearchNotesRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 	defer r.Body.Close()
 
-	// Parse connected note ID
-	connectedNoteID, err := uuid.Parse(req.ConnectedNoteID)
-	if err != nil {
-		http.Error(w, "Invalid connected note ID", http.StatusBadRequest)
-		return
-	}
-
-	// Validate connection
-	if err := h.NoteService.ConnectNotes(noteID, connectedNoteID, req.ConnectionType, userID); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if req.FuzzyThreshold != nil && (*req.FuzzyThreshold <= 0 || *req.FuzzyThreshold > 1) {
+		http.Error(w, "fuzzyThreshold must be between 0 and 1", http.StatusBadRequest)
 		return
 	}
-
-	// Return success response
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(map[string]string{
-		"message": "Notes connected successfully",
-	})
-}
-
-// UnlinkNoteHandler handles removing a connection between notes
-func (h *NoteHandler) UnlinkNoteHandler(w http.ResponseWriter, r *http.Request) {
-	// Extract user ID from token
-	userID, err := extractUserID(r)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusUnauthorized)
+	if req.Limit < 0 || req.Limit > repositories.MaxPageSize {
+		http.Error(w, fmt.Sprintf("limit must be between 1 and %d", repositories.MaxPageSize), http.StatusBadRequest)
 		return
 	}
-
-	// Get note IDs from URL parameters
-	vars := mux.Vars(r)
-	noteID, err := uuid.Parse(vars["id"])
-	if err != nil {
-		http.Error(w, "Invalid note ID", http.StatusBadRequest)
-		return
+	if req.Limit == 0 {
+		req.Limit = services.DefaultNotePageSize
 	}
-
-	connectedNoteID, err := uuid.Parse(vars["connectedNoteId"])
+	fields, err := parseNoteFields(req.Fields)
 	if err != nil {
-		http.Error(w, "Invalid connected note ID", http.StatusBadRequest)
-		return
-	}
-
-	// Remove connection
-	if err := h.NoteService.UnlinkNotes(noteID, connectedNoteID, userID); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	// Return success response
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{
-		"message": "Notes unlinked successfully",
-	})
-}
-
-// GetNotesMindmapHandler handles retrieving notes for mindmap visualization
-func (h *NoteHandler) GetNotesMindmapHandler(w http.ResponseWriter, r *http.Request) {
-	// Extract user ID from token
-	userID, err := extractUserID(r)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusUnauthorized)
-		return
-	}
-
-	// Get notes for mindmap
-	mindmapNotes, err := h.NoteService.GetNotesMindmap(userID.String())
+	// Perform search
+	results, err := h.NoteService.SearchNotes(&req, userID)
 	if err != nil {
+		var queryErr *repositories.SearchQueryError
+		if errors.As(err, &queryErr) || errors.Is(err, repositories.ErrInvalidCursor) ||
+			strings.HasPrefix(err.Error(), "invalid search mode") || strings.HasPrefix(err.Error(), "invalid search scope") {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err.Error() == "semantic search is not available" {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	// Return notes for mindmap
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(mindmapNotes)
+	// Return search results
+	writeNotesJSON(w, results, fields)
 }
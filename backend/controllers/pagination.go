@@ -0,0 +1,110 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"NoteSense/repositories"
+)
+
+// noteFields are the note properties that can be selected with fields=
+var noteFields = map[string]bool{
+	"id": true, "userId": true, "title": true, "content": true, "emoji": true,
+	"categories": true, "status": true, "priority": true, "encrypted": true,
+	"keyEnvelope": true, "pinned": true, "favorite": true, "archived": true,
+	"archivedAt": true, "position": true, "kanbanPosition": true, "createdAt": true, "updatedAt": true,
+}
+
+// noteContainers are the response keys whose values are a note or a list of notes
+var noteContainers = map[string]bool{
+	"note": true, "notes": true,
+}
+
+// parsePage reads the limit and cursor query parameters
+func parsePage(r *http.Request) (repositories.PageRequest, error) {
+	query := r.URL.Query()
+	page := repositories.PageRequest{Cursor: query.Get("cursor")}
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > repositories.MaxPageSize {
+			return page, fmt.Errorf("limit must be between 1 and %d", repositories.MaxPageSize)
+		}
+		page.Limit = limit
+	}
+	return page, nil
+}
+
+// parseNoteFields validates a field selection. The note ID is always included;
+// nil means every field.
+func parseNoteFields(names []string) (map[string]bool, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	fields := map[string]bool{"id": true}
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if !noteFields[name] {
+			return nil, fmt.Errorf("unknown field: %s", name)
+		}
+		fields[name] = true
+	}
+	return fields, nil
+}
+
+// splitFields splits a comma-separated fields query parameter
+func splitFields(value string) []string {
+	if value == "" {
+		return nil
+	}
+	return strings.Split(value, ",")
+}
+
+// writeNotesJSON encodes a response, keeping only the selected fields of the notes it contains
+func writeNotesJSON(w http.ResponseWriter, response interface{}, fields map[string]bool) {
+	w.Header().Set("Content-Type", "application/json")
+	if fields == nil {
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	data, err := json.Marshal(response)
+	if err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+	var generic interface{}
+	if err := json.Unmarshal(data, &generic); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(projectNotes(generic, fields, false))
+}
+
+// projectNotes walks a decoded response and drops unselected fields from every note in it
+func projectNotes(value interface{}, fields map[string]bool, isNote bool) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if isNote {
+			for key := range v {
+				if !fields[key] {
+					delete(v, key)
+				}
+			}
+			return v
+		}
+		for key, child := range v {
+			v[key] = projectNotes(child, fields, noteContainers[key])
+		}
+	case []interface{}:
+		for i, child := range v {
+			v[i] = projectNotes(child, fields, isNote)
+		}
+	}
+	return value
+}
@@ -0,0 +1,202 @@
+package controllers
+
+import (
+	"NoteSense/contracts"
+	"NoteSense/services"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// TemplateHandler holds the template service
+type TemplateHandler struct {
+	TemplateService *services.TemplateService
+}
+
+func NewTemplateHandler(templateService *services.TemplateService) *TemplateHandler {
+	return &TemplateHandler{
+		TemplateService: templateService,
+	}
+}
+
+// CreateTemplateHandler handles creating a new template
+func (h *TemplateHandler) CreateTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := extractUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	var req contracts.TemplateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	template, err := h.TemplateService.CreateTemplate(&req, userID)
+	if err != nil {
+		if strings.HasPrefix(err.Error(), "only admins") {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(contracts.TemplateResponse{Template: *template})
+}
+
+// GetTemplatesHandler handles listing the templates available to a user
+func (h *TemplateHandler) GetTemplatesHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := extractUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	templates, err := h.TemplateService.GetTemplates(userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(contracts.TemplatesResponse{Templates: templates})
+}
+
+// GetTemplateHandler handles retrieving a single template
+func (h *TemplateHandler) GetTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := extractUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	templateID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid template ID", http.StatusBadRequest)
+		return
+	}
+
+	template, err := h.TemplateService.GetTemplateByID(templateID, userID)
+	if err != nil {
+		if err.Error() == "template not found" {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(contracts.TemplateResponse{Template: *template})
+}
+
+// UpdateTemplateHandler handles updating a template
+func (h *TemplateHandler) UpdateTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := extractUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	templateID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid template ID", http.StatusBadRequest)
+		return
+	}
+
+	var req contracts.TemplateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	template, err := h.TemplateService.UpdateTemplate(templateID, &req, userID)
+	if err != nil {
+		if err.Error() == "template not found" {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if strings.HasPrefix(err.Error(), "only admins") {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(contracts.TemplateResponse{Template: *template})
+}
+
+// DeleteTemplateHandler handles deleting a template
+func (h *TemplateHandler) DeleteTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := extractUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	templateID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid template ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.TemplateService.DeleteTemplate(templateID, userID); err != nil {
+		if err.Error() == "template not found" {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// CreateNoteFromTemplateHandler handles rendering a template into a new note
+func (h *TemplateHandler) CreateNoteFromTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := extractUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	templateID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid template ID", http.StatusBadRequest)
+		return
+	}
+
+	// The body is optional when the template has no custom prompts
+	var req contracts.CreateNoteFromTemplateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	note, err := h.TemplateService.CreateNoteFromTemplate(templateID, req.Values, userID)
+	if err != nil {
+		if err.Error() == "template not found" {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(contracts.NoteResponse{Note: *note})
+}
@@ -0,0 +1,193 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"NoteSense/contracts"
+	"NoteSense/services"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// UploadHandler serves resumable uploads: a client creates an upload, sends the file in chunks
+// with PATCH, resuming from the offset GET reports after a broken connection, and completes it
+type UploadHandler struct {
+	uploadService *services.ResumableUploadService
+	auditService  *services.AuditService
+}
+
+func NewUploadHandler(uploadService *services.ResumableUploadService, auditService *services.AuditService) *UploadHandler {
+	return &UploadHandler{
+		uploadService: uploadService,
+		auditService:  auditService,
+	}
+}
+
+// CreateUploadHandler handles starting a resumable upload
+func (h *UploadHandler) CreateUploadHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := extractUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	var req contracts.CreateUploadRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	session, err := h.uploadService.CreateUpload(&req, userID)
+	if err != nil {
+		writeUploadError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Upload-Offset", "0")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(contracts.UploadResponse{Upload: *session})
+}
+
+// GetUploadHandler handles retrieving an upload and the offset to resume it from
+func (h *UploadHandler) GetUploadHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := extractUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	sessionID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid upload ID", http.StatusBadRequest)
+		return
+	}
+
+	session, err := h.uploadService.GetUpload(sessionID, userID)
+	if err != nil {
+		writeUploadError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Upload-Offset", strconv.FormatInt(session.Offset, 10))
+	json.NewEncoder(w).Encode(contracts.UploadResponse{Upload: *session})
+}
+
+// AppendChunkHandler handles receiving a chunk of an upload. The Upload-Offset header says where
+// the chunk starts and an optional Upload-Checksum header ("sha256 <base64 digest>") protects it.
+func (h *UploadHandler) AppendChunkHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := extractUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	sessionID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid upload ID", http.StatusBadRequest)
+		return
+	}
+
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		http.Error(w, "Invalid Upload-Offset header", http.StatusBadRequest)
+		return
+	}
+
+	var checksum string
+	if header := r.Header.Get("Upload-Checksum"); header != "" {
+		algorithm, digest, found := strings.Cut(header, " ")
+		if !found || !strings.EqualFold(algorithm, "sha256") {
+			http.Error(w, "Upload-Checksum must be \"sha256 <base64 digest>\"", http.StatusBadRequest)
+			return
+		}
+		checksum = digest
+	}
+
+	session, err := h.uploadService.AppendChunk(sessionID, offset, r.Body, checksum, userID)
+	if err != nil {
+		var offsetErr *services.UploadOffsetError
+		if errors.As(err, &offsetErr) {
+			w.Header().Set("Upload-Offset", strconv.FormatInt(offsetErr.Expected, 10))
+		}
+		writeUploadError(w, err)
+		return
+	}
+
+	w.Header().Set("Upload-Offset", strconv.FormatInt(session.Offset, 10))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// CompleteUploadHandler handles finishing an upload; the file is then attached to its note
+func (h *UploadHandler) CompleteUploadHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := extractUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	sessionID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid upload ID", http.StatusBadRequest)
+		return
+	}
+
+	metadata, err := h.uploadService.CompleteUpload(sessionID, userID)
+	if err != nil {
+		writeUploadError(w, err)
+		return
+	}
+	entry := auditEntry(r, userID, services.AuditFileUpload, services.AuditTargetFile, metadata.ID)
+	entry.Summary = fmt.Sprintf("uploaded %s to note %s", metadata.FileName, *metadata.NoteID)
+	h.auditService.Record(entry)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(metadata)
+}
+
+// AbortUploadHandler handles cancelling an upload
+func (h *UploadHandler) AbortUploadHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := extractUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	sessionID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid upload ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.uploadService.AbortUpload(sessionID, userID); err != nil {
+		writeUploadError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeUploadError maps resumable upload errors to HTTP statuses, and file errors as
+// writeFileError does
+func writeUploadError(w http.ResponseWriter, err error) {
+	var offsetErr *services.UploadOffsetError
+	switch {
+	case errors.As(err, &offsetErr):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case err.Error() == "upload not found":
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case strings.HasPrefix(err.Error(), "chunk exceeds"):
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+	case strings.HasPrefix(err.Error(), "upload is incomplete"):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		writeFileError(w, err)
+	}
+}
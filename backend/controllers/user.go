@@ -13,12 +13,13 @@ import (
 type UserHandler struct {
 	UserService          *services.UserService
 	AuthorizationService *middleware.AuthMiddleware
+	AuditService         *services.AuditService
 }
 
 // LogoutHandler handles user logout
 func (h *UserHandler) LogoutHandler(w http.ResponseWriter, r *http.Request) {
 	// Authenticate the user and get their token
-	_, err := h.AuthorizationService.Authenticate(r)
+	user, err := h.AuthorizationService.Authenticate(r)
 	if err != nil {
 		http.Error(w, "Authentication failed", http.StatusUnauthorized)
 		return
@@ -34,6 +35,10 @@ func (h *UserHandler) LogoutHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Failed to logout", http.StatusInternalServerError)
 		return
 	}
+	entry := auditEntry(r, user.ID, services.AuditTokenRevoke, services.AuditTargetUser, user.ID)
+	entry.Summary = "revoked session token"
+	h.AuditService.Record(entry)
+	h.AuditService.Record(auditEntry(r, user.ID, services.AuditLogout, services.AuditTargetUser, user.ID))
 
 	// Clear the session cookie
 	http.SetCookie(w, &http.Cookie{
@@ -66,6 +71,7 @@ func (h *UserHandler) SignUpHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	h.AuditService.Record(auditEntry(r, resp.User.ID, services.AuditSignUp, services.AuditTargetUser, resp.User.ID))
 
 	// Set content type and write response
 	w.Header().Set("Content-Type", "application/json")
@@ -86,12 +92,39 @@ func (h *UserHandler) LoginHandler(w http.ResponseWriter, r *http.Request) {
 	// Call the user service to handle login
 	resp, err := h.UserService.Login(req.Email, req.Password)
 	if err != nil {
+		h.AuditService.RecordLoginFailure(req.Email, clientIP(r), err.Error())
 		http.Error(w, err.Error(), http.StatusUnauthorized)
 		return
 	}
+	h.AuditService.Record(auditEntry(r, resp.User.ID, services.AuditLogin, services.AuditTargetUser, resp.User.ID))
 
 	// Set content type and write response
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(resp)
 }
+
+// UpdateSettingsHandler updates the authenticated user's preferences
+func (h *UserHandler) UpdateSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := extractUserID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	var req contracts.UserSettingsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	user, err := h.UserService.UpdateSettings(&req, userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
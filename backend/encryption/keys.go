@@ -0,0 +1,122 @@
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// KeySize is the size in bytes of master and data keys (AES-256)
+const KeySize = 32
+
+// MasterKey wraps and unwraps per-user data keys
+type MasterKey struct {
+	ID  string
+	key []byte
+}
+
+// NewMasterKey creates a master key from raw key bytes
+func NewMasterKey(key []byte) (*MasterKey, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("master key must be %d bytes, got %d", KeySize, len(key))
+	}
+	sum := sha256.Sum256(key)
+	return &MasterKey{
+		ID:  hex.EncodeToString(sum[:8]),
+		key: append([]byte(nil), key...),
+	}, nil
+}
+
+// LoadMasterKey reads a master key from the given environment variables. valueVar holds a
+// base64 key and fileVar a path to a key file. It returns nil when neither is set.
+func LoadMasterKey(valueVar, fileVar string) (*MasterKey, error) {
+	if value := strings.TrimSpace(os.Getenv(valueVar)); value != "" {
+		key, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s must be base64 encoded: %v", valueVar, err)
+		}
+		return NewMasterKey(key)
+	}
+
+	if path := strings.TrimSpace(os.Getenv(fileVar)); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read master key file: %v", err)
+		}
+		// Key files may hold either the raw key or its base64 encoding
+		if len(data) == KeySize {
+			return NewMasterKey(data)
+		}
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+		if err != nil {
+			return nil, fmt.Errorf("master key file must contain %d raw bytes or base64: %v", KeySize, err)
+		}
+		return NewMasterKey(key)
+	}
+
+	return nil, nil
+}
+
+// Wrap encrypts a data key with the master key
+func (m *MasterKey) Wrap(dataKey []byte) ([]byte, error) {
+	return Seal(m.key, dataKey)
+}
+
+// Unwrap decrypts a data key wrapped by this master key
+func (m *MasterKey) Unwrap(wrapped []byte) ([]byte, error) {
+	dataKey, err := Open(m.key, wrapped)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key: %v", err)
+	}
+	return dataKey, nil
+}
+
+// NewDataKey generates a random data key
+func NewDataKey() ([]byte, error) {
+	key := make([]byte, KeySize)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, fmt.Errorf("failed to generate data key: %v", err)
+	}
+	return key, nil
+}
+
+// Seal encrypts plaintext with AES-256-GCM. The random nonce is prepended to the output.
+func Seal(key, plaintext []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %v", err)
+	}
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// Open decrypts data produced by Seal
+func Open(key, sealed []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, fmt.Errorf("ciphertext too short")
+	}
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, nil)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key: %v", err)
+	}
+	return cipher.NewGCM(block)
+}
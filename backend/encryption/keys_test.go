@@ -0,0 +1,192 @@
+package encryption
+
+import (
+	"bytes"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func testKey(fill byte) []byte {
+	return bytes.Repeat([]byte{fill}, KeySize)
+}
+
+func TestNewMasterKey(t *testing.T) {
+	for _, size := range []int{0, 16, KeySize - 1, KeySize + 1} {
+		if _, err := NewMasterKey(make([]byte, size)); err == nil {
+			t.Errorf("NewMasterKey of %d bytes succeeded, want an error", size)
+		}
+	}
+
+	key := testKey(1)
+	master, err := NewMasterKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := NewMasterKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := NewMasterKey(testKey(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if master.ID != again.ID || master.ID == other.ID || len(master.ID) != 16 {
+		t.Errorf("IDs = %q, %q, %q; want a 16 character ID per key", master.ID, again.ID, other.ID)
+	}
+
+	// The master key keeps its own copy of the key bytes
+	key[0] = 9
+	wrapped, err := master.Wrap(testKey(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := again.Unwrap(wrapped); err != nil {
+		t.Errorf("Unwrap after the caller changed its key bytes: %v", err)
+	}
+}
+
+func TestWrapUnwrap(t *testing.T) {
+	master, err := NewMasterKey(testKey(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dataKey, err := NewDataKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dataKey) != KeySize {
+		t.Fatalf("NewDataKey returned %d bytes, want %d", len(dataKey), KeySize)
+	}
+
+	wrapped, err := master.Wrap(dataKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(wrapped, dataKey) {
+		t.Error("wrapped data key contains the data key")
+	}
+	unwrapped, err := master.Unwrap(wrapped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(unwrapped, dataKey) {
+		t.Errorf("Unwrap = %x, want %x", unwrapped, dataKey)
+	}
+
+	other, err := NewMasterKey(testKey(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.Unwrap(wrapped); err == nil {
+		t.Error("Unwrap with another master key succeeded")
+	}
+}
+
+func TestSealOpen(t *testing.T) {
+	key := testKey(1)
+	plaintext := []byte("note contents")
+
+	sealed, err := Seal(key, plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := Seal(key, plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(sealed, again) {
+		t.Error("sealing twice gave the same output; nonces must be random")
+	}
+	opened, err := Open(key, sealed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(opened, plaintext) {
+		t.Errorf("Open = %q, want %q", opened, plaintext)
+	}
+
+	tests := []struct {
+		name   string
+		key    []byte
+		sealed []byte
+	}{
+		{"wrong key", testKey(2), sealed},
+		{"flipped bit", key, flipBit(sealed, len(sealed)-1)},
+		{"flipped nonce", key, flipBit(sealed, 0)},
+		{"truncated", key, sealed[:len(sealed)-1]},
+		{"shorter than a nonce", key, sealed[:5]},
+		{"invalid key", key[:5], sealed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Open(tt.key, tt.sealed); err == nil {
+				t.Error("Open succeeded, want an error")
+			}
+		})
+	}
+}
+
+func TestLoadMasterKey(t *testing.T) {
+	key := testKey(7)
+	encoded := base64.StdEncoding.EncodeToString(key)
+	want, err := NewMasterKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	writeFile := func(name string, data []byte) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	rawFile := writeFile("raw.key", key)
+	encodedFile := writeFile("encoded.key", []byte(encoded+"\n"))
+	badFile := writeFile("bad.key", []byte("not a key"))
+
+	tests := []struct {
+		name    string
+		value   string
+		file    string
+		want    *MasterKey
+		wantErr bool
+	}{
+		{"neither set", "", "", nil, false},
+		{"base64 value", encoded, "", want, false},
+		{"value with whitespace", " " + encoded + "\n", "", want, false},
+		{"value wins over file", encoded, badFile, want, false},
+		{"invalid base64 value", "not base64!", "", nil, true},
+		{"value of the wrong size", base64.StdEncoding.EncodeToString(key[:16]), "", nil, true},
+		{"raw key file", "", rawFile, want, false},
+		{"base64 key file", "", encodedFile, want, false},
+		{"invalid key file", "", badFile, nil, true},
+		{"missing key file", "", filepath.Join(dir, "missing.key"), nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TEST_MASTER_KEY", tt.value)
+			t.Setenv("TEST_MASTER_KEY_FILE", tt.file)
+			got, err := LoadMasterKey("TEST_MASTER_KEY", "TEST_MASTER_KEY_FILE")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadMasterKey error = %v, want error %v", err, tt.wantErr)
+			}
+			switch {
+			case tt.want == nil && got != nil:
+				t.Errorf("LoadMasterKey = key %s, want nil", got.ID)
+			case tt.want != nil && (got == nil || got.ID != tt.want.ID):
+				t.Errorf("LoadMasterKey = %v, want key %s", got, tt.want.ID)
+			}
+		})
+	}
+}
+
+// flipBit returns a copy of data with the lowest bit of data[i] flipped
+func flipBit(data []byte, i int) []byte {
+	flipped := append([]byte(nil), data...)
+	flipped[i] ^= 1
+	return flipped
+}
@@ -0,0 +1,354 @@
+package encryption
+
+import (
+	"bufio"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// SegmentSize is the amount of plaintext sealed in each segment of a stream
+const SegmentSize = 64 << 10
+
+// streamPrefixSize is the size of the random nonce prefix that heads a stream. Each segment's
+// nonce is the prefix, the segment's index and a byte marking the last segment, so segments
+// cannot be reordered, dropped or cut off at the end without failing to open.
+const streamPrefixSize = 7
+
+// NewEncryptingReader returns a reader of the stream sealing everything read from r with
+// AES-256-GCM, one segment at a time. Only one segment is held in memory.
+func NewEncryptingReader(key []byte, r io.Reader) (io.Reader, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	prefix := make([]byte, streamPrefixSize)
+	if _, err := io.ReadFull(rand.Reader, prefix); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %v", err)
+	}
+	return &encryptingReader{
+		gcm:     gcm,
+		prefix:  prefix,
+		src:     bufio.NewReaderSize(r, SegmentSize),
+		plain:   make([]byte, SegmentSize),
+		pending: append([]byte(nil), prefix...),
+	}, nil
+}
+
+type encryptingReader struct {
+	gcm     cipher.AEAD
+	prefix  []byte
+	src     *bufio.Reader
+	plain   []byte
+	pending []byte // Sealed bytes not yet read
+	index   uint32
+	done    bool
+}
+
+func (e *encryptingReader) Read(p []byte) (int, error) {
+	for len(e.pending) == 0 {
+		if e.done {
+			return 0, io.EOF
+		}
+		if err := e.sealNext(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, e.pending)
+	e.pending = e.pending[n:]
+	return n, nil
+}
+
+// sealNext seals the next segment. A segment is the last one when nothing follows it, which
+// makes a stream of empty plaintext a single empty final segment.
+func (e *encryptingReader) sealNext() error {
+	n, err := io.ReadFull(e.src, e.plain)
+	final := err == io.EOF || err == io.ErrUnexpectedEOF
+	if err != nil && !final {
+		return err
+	}
+	if !final {
+		if _, err := e.src.Peek(1); err == io.EOF {
+			final = true
+		} else if err != nil {
+			return err
+		}
+	}
+	e.pending = e.gcm.Seal(e.pending[:0], segmentNonce(e.prefix, e.index, final), e.plain[:n], nil)
+	e.index++
+	e.done = final
+	return nil
+}
+
+// NewDecryptingReader opens a stream written by NewEncryptingReader that starts at src's
+// current position and runs to its end. The returned reader seeks within the plaintext and
+// decrypts only the segments it reads.
+func NewDecryptingReader(key []byte, src io.ReadSeeker) (io.ReadSeeker, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	start, err := src.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	end, err := src.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := src.Seek(start, io.SeekStart); err != nil {
+		return nil, err
+	}
+	prefix := make([]byte, streamPrefixSize)
+	if _, err := io.ReadFull(src, prefix); err != nil {
+		return nil, fmt.Errorf("encrypted stream too short")
+	}
+
+	sealedSize := int64(SegmentSize + gcm.Overhead())
+	length := end - start - streamPrefixSize
+	segments := (length + sealedSize - 1) / sealedSize
+	size := length - segments*int64(gcm.Overhead())
+	if segments == 0 || size < 0 || segments > 1<<32 {
+		return nil, fmt.Errorf("encrypted stream too short")
+	}
+
+	d := &decryptingReader{
+		gcm:      gcm,
+		prefix:   prefix,
+		src:      src,
+		base:     start + streamPrefixSize,
+		segments: segments,
+		size:     size,
+		loaded:   -1,
+		sealed:   make([]byte, sealedSize),
+	}
+	// The last segment is checked up front so a truncated stream fails before anything is read
+	if err := d.load(segments - 1); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+type decryptingReader struct {
+	gcm      cipher.AEAD
+	prefix   []byte
+	src      io.ReadSeeker
+	base     int64 // Position in src of the first segment
+	segments int64
+	size     int64 // Plaintext size
+	offset   int64 // Plaintext position
+	loaded   int64 // Index of the segment in plain, or -1
+	plain    []byte
+	sealed   []byte
+}
+
+func (d *decryptingReader) Read(p []byte) (int, error) {
+	if d.offset >= d.size {
+		return 0, io.EOF
+	}
+	index := d.offset / SegmentSize
+	if index != d.loaded {
+		if err := d.load(index); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, d.plain[d.offset%SegmentSize:])
+	d.offset += int64(n)
+	return n, nil
+}
+
+func (d *decryptingReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += d.offset
+	case io.SeekEnd:
+		offset += d.size
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	d.offset = offset
+	return offset, nil
+}
+
+// load reads and opens one segment
+func (d *decryptingReader) load(index int64) error {
+	sealedSize := int64(len(d.sealed))
+	if _, err := d.src.Seek(d.base+index*sealedSize, io.SeekStart); err != nil {
+		return err
+	}
+	n, err := io.ReadFull(d.src, d.sealed)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	final := index == d.segments-1
+	plain, err := d.gcm.Open(d.plain[:0], segmentNonce(d.prefix, uint32(index), final), d.sealed[:n], nil)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt segment %d: %v", index, err)
+	}
+	d.plain = plain
+	d.loaded = index
+	return nil
+}
+
+func segmentNonce(prefix []byte, index uint32, final bool) []byte {
+	nonce := make([]byte, streamPrefixSize+5)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[streamPrefixSize:], index)
+	if final {
+		nonce[streamPrefixSize+4] = 1
+	}
+	return nonce
+}
+
+// Frames are the sealed form of data that grows by appends and may be cut back, such as the
+// staging file of a resumable upload. Each frame holds up to SegmentSize bytes behind their
+// length and a random nonce of its own, so appending never reuses a nonce. The length is
+// authenticated along with where the frame's bytes start in the data, so frames cannot be
+// reordered, dropped from the middle or repeated.
+const (
+	frameHeaderSize = 4  // Plaintext length, big-endian
+	frameNonceSize  = 12 // GCM's standard nonce size
+	frameTagSize    = 16 // GCM's tag size
+)
+
+// FrameWriter seals what is written to it in frames. Close seals the last, partial frame.
+type FrameWriter struct {
+	gcm    cipher.AEAD
+	w      io.Writer
+	buf    []byte
+	offset int64 // Where the bytes in buf start in the data
+}
+
+// NewFrameWriter returns a writer sealing frames onto w, after frames already holding the
+// first offset bytes of the data
+func NewFrameWriter(key []byte, w io.Writer, offset int64) (*FrameWriter, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	return &FrameWriter{gcm: gcm, w: w, buf: make([]byte, 0, SegmentSize), offset: offset}, nil
+}
+
+func (f *FrameWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := copy(f.buf[len(f.buf):SegmentSize], p)
+		f.buf = f.buf[:len(f.buf)+n]
+		p = p[n:]
+		written += n
+		if len(f.buf) == SegmentSize {
+			if err := f.flush(); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+// Close seals any bytes written since the last full frame. It does not close w.
+func (f *FrameWriter) Close() error {
+	if len(f.buf) == 0 {
+		return nil
+	}
+	return f.flush()
+}
+
+func (f *FrameWriter) flush() error {
+	frame := make([]byte, frameHeaderSize+frameNonceSize, frameHeaderSize+frameNonceSize+len(f.buf)+frameTagSize)
+	binary.BigEndian.PutUint32(frame, uint32(len(f.buf)))
+	nonce := frame[frameHeaderSize:]
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return fmt.Errorf("failed to generate nonce: %v", err)
+	}
+	frame = f.gcm.Seal(frame, nonce, f.buf, frameAAD(frame[:frameHeaderSize], f.offset))
+	f.offset += int64(len(f.buf))
+	f.buf = f.buf[:0]
+	_, err := f.w.Write(frame)
+	return err
+}
+
+// frameAAD returns the data a frame authenticates besides its bytes: its header and the offset
+// of its first byte
+func frameAAD(header []byte, offset int64) []byte {
+	aad := make([]byte, frameHeaderSize+8)
+	copy(aad, header)
+	binary.BigEndian.PutUint64(aad[frameHeaderSize:], uint64(offset))
+	return aad
+}
+
+// NewFrameReader returns a reader of the bytes sealed in the frames read from r
+func NewFrameReader(key []byte, r io.Reader) (io.Reader, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	return &frameReader{gcm: gcm, src: r, sealed: make([]byte, frameNonceSize+SegmentSize+frameTagSize)}, nil
+}
+
+type frameReader struct {
+	gcm     cipher.AEAD
+	src     io.Reader
+	sealed  []byte
+	plain   []byte
+	pending []byte
+	offset  int64 // Where the next frame's bytes start in the data
+}
+
+func (f *frameReader) Read(p []byte) (int, error) {
+	for len(f.pending) == 0 {
+		header := make([]byte, frameHeaderSize)
+		if _, err := io.ReadFull(f.src, header); err != nil {
+			if err == io.ErrUnexpectedEOF {
+				err = fmt.Errorf("truncated frame")
+			}
+			return 0, err
+		}
+		length := binary.BigEndian.Uint32(header)
+		if length > SegmentSize {
+			return 0, fmt.Errorf("invalid frame length %d", length)
+		}
+		sealed := f.sealed[:frameNonceSize+int(length)+frameTagSize]
+		if _, err := io.ReadFull(f.src, sealed); err != nil {
+			return 0, fmt.Errorf("truncated frame")
+		}
+		plain, err := f.gcm.Open(f.plain[:0], sealed[:frameNonceSize], sealed[frameNonceSize:], frameAAD(header, f.offset))
+		if err != nil {
+			return 0, fmt.Errorf("failed to decrypt frame: %v", err)
+		}
+		f.offset += int64(len(plain))
+		f.plain = plain
+		f.pending = plain
+	}
+	n := copy(p, f.pending)
+	f.pending = f.pending[n:]
+	return n, nil
+}
+
+// FramePosition returns where in r, from its start, the frames holding the first offset bytes
+// end. offset must fall between frames.
+func FramePosition(r io.ReadSeeker, offset int64) (int64, error) {
+	var position, plain int64
+	header := make([]byte, frameHeaderSize)
+	for plain < offset {
+		if _, err := r.Seek(position, io.SeekStart); err != nil {
+			return 0, err
+		}
+		if _, err := io.ReadFull(r, header); err != nil {
+			return 0, fmt.Errorf("truncated frame")
+		}
+		length := int64(binary.BigEndian.Uint32(header))
+		plain += length
+		position += frameHeaderSize + frameNonceSize + length + frameTagSize
+	}
+	if plain != offset {
+		return 0, fmt.Errorf("offset %d falls inside a frame", offset)
+	}
+	return position, nil
+}
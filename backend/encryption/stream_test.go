@@ -0,0 +1,346 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	"strings"
+	"testing"
+)
+
+// streamOverhead is what sealing adds to each segment of a stream
+const streamOverhead = 16
+
+func randomBytes(t *testing.T, n int) []byte {
+	t.Helper()
+	data := make([]byte, n)
+	if _, err := io.ReadFull(rand.Reader, data); err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func sealStream(t *testing.T, key, plaintext []byte) []byte {
+	t.Helper()
+	sealing, err := NewEncryptingReader(key, bytes.NewReader(plaintext))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := io.ReadAll(sealing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sealed
+}
+
+func TestStreamRoundTrip(t *testing.T) {
+	key := testKey(1)
+	for _, size := range []int{0, 1, SegmentSize - 1, SegmentSize, SegmentSize + 1, 3*SegmentSize + 5} {
+		plaintext := randomBytes(t, size)
+		sealed := sealStream(t, key, plaintext)
+
+		segments := (size + SegmentSize) / SegmentSize
+		if size > 0 && size%SegmentSize == 0 {
+			segments = size / SegmentSize
+		}
+		if want := streamPrefixSize + size + segments*streamOverhead; len(sealed) != want {
+			t.Errorf("sealed %d bytes into %d, want %d", size, len(sealed), want)
+		}
+
+		opened, err := NewDecryptingReader(key, bytes.NewReader(sealed))
+		if err != nil {
+			t.Fatalf("NewDecryptingReader of %d bytes: %v", size, err)
+		}
+		got, err := io.ReadAll(opened)
+		if err != nil {
+			t.Fatalf("reading %d bytes: %v", size, err)
+		}
+		if !bytes.Equal(got, plaintext) {
+			t.Errorf("round trip of %d bytes returned %d different bytes", size, len(got))
+		}
+	}
+}
+
+// TestStreamAfterHeader checks that a stream is opened from the reader's current position
+func TestStreamAfterHeader(t *testing.T) {
+	key := testKey(1)
+	plaintext := randomBytes(t, SegmentSize+10)
+	header := []byte("HEADER\n")
+	src := bytes.NewReader(append(append([]byte(nil), header...), sealStream(t, key, plaintext)...))
+	if _, err := src.Seek(int64(len(header)), io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+
+	opened, err := NewDecryptingReader(key, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(opened)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, plaintext) {
+		t.Error("stream after a header did not round trip")
+	}
+}
+
+func TestStreamSeek(t *testing.T) {
+	key := testKey(1)
+	plaintext := randomBytes(t, 3*SegmentSize+100)
+	opened, err := NewDecryptingReader(key, bytes.NewReader(sealStream(t, key, plaintext)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	size := int64(len(plaintext))
+
+	tests := []struct {
+		name   string
+		offset int64
+		whence int
+		want   int64
+	}{
+		{"start", 0, io.SeekStart, 0},
+		{"inside the second segment", SegmentSize + 7, io.SeekStart, SegmentSize + 7},
+		{"last byte of a segment", SegmentSize - 1, io.SeekStart, SegmentSize - 1},
+		{"back from current", -8, io.SeekCurrent, SegmentSize - 9},
+		{"from the end", -50, io.SeekEnd, size - 50},
+		{"end", 0, io.SeekEnd, size},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			position, err := opened.Seek(tt.offset, tt.whence)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if position != tt.want {
+				t.Fatalf("Seek = %d, want %d", position, tt.want)
+			}
+			got := make([]byte, 16)
+			n, err := io.ReadFull(opened, got)
+			if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+				t.Fatal(err)
+			}
+			want := plaintext[position:min(position+16, size)]
+			if !bytes.Equal(got[:n], want) {
+				t.Errorf("read %x at %d, want %x", got[:n], position, want)
+			}
+			// Put the position back for the next relative seek
+			if _, err := opened.Seek(position, io.SeekStart); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+
+	if _, err := opened.Seek(-1, io.SeekStart); err == nil {
+		t.Error("seeking before the start succeeded")
+	}
+	if _, err := opened.Seek(0, 3); err == nil {
+		t.Error("seeking with an invalid whence succeeded")
+	}
+	if _, err := opened.Seek(size+10, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := opened.Read(make([]byte, 1)); n != 0 || err != io.EOF {
+		t.Errorf("Read past the end = %d, %v; want 0, EOF", n, err)
+	}
+}
+
+func TestStreamTampering(t *testing.T) {
+	key := testKey(1)
+	plaintext := randomBytes(t, 2*SegmentSize+10)
+	sealed := sealStream(t, key, plaintext)
+	segment := SegmentSize + streamOverhead
+	first := sealed[streamPrefixSize : streamPrefixSize+segment]
+	second := sealed[streamPrefixSize+segment : streamPrefixSize+2*segment]
+
+	join := func(parts ...[]byte) []byte {
+		return bytes.Join(parts, nil)
+	}
+	tests := []struct {
+		name   string
+		key    []byte
+		sealed []byte
+	}{
+		{"wrong key", testKey(2), sealed},
+		{"flipped bit in a segment", key, flipBit(sealed, streamPrefixSize+segment+3)},
+		{"flipped bit in the prefix", key, flipBit(sealed, 0)},
+		{"last segment cut short", key, sealed[:len(sealed)-1]},
+		{"last segment dropped", key, sealed[:streamPrefixSize+2*segment]},
+		{"cut inside a segment", key, sealed[:streamPrefixSize+segment+100]},
+		{"segments swapped", key, join(sealed[:streamPrefixSize], second, first, sealed[streamPrefixSize+2*segment:])},
+		{"segment repeated", key, join(sealed[:streamPrefixSize], first, first, sealed[streamPrefixSize+2*segment:])},
+		{"only the prefix", key, sealed[:streamPrefixSize]},
+		{"shorter than the prefix", key, sealed[:3]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opened, err := NewDecryptingReader(tt.key, bytes.NewReader(tt.sealed))
+			if err == nil {
+				_, err = io.ReadAll(opened)
+			}
+			if err == nil {
+				t.Error("tampered stream opened without an error")
+			}
+		})
+	}
+}
+
+// TestStreamFinalFlag checks that a stream cut at a segment boundary fails to open: the segment
+// left last was not sealed as the final one
+func TestStreamFinalFlag(t *testing.T) {
+	key := testKey(1)
+	plaintext := randomBytes(t, 2*SegmentSize)
+	sealed := sealStream(t, key, plaintext)
+	segment := SegmentSize + streamOverhead
+	if len(sealed) != streamPrefixSize+2*segment {
+		t.Fatalf("sealed %d bytes, want two full segments", len(sealed))
+	}
+
+	cut := sealed[:streamPrefixSize+segment]
+	if _, err := NewDecryptingReader(key, bytes.NewReader(cut)); err == nil {
+		t.Error("stream cut after its first segment opened without an error")
+	}
+
+	// The same segment sealed as the last one opens
+	single := sealStream(t, key, plaintext[:SegmentSize])
+	opened, err := NewDecryptingReader(key, bytes.NewReader(single))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(opened)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, plaintext[:SegmentSize]) {
+		t.Error("single full segment did not round trip")
+	}
+}
+
+// appendFrames seals chunks onto staged one writer at a time, as resumable uploads do
+func appendFrames(t *testing.T, key []byte, staged *bytes.Buffer, offset int64, chunks ...[]byte) int64 {
+	t.Helper()
+	for _, chunk := range chunks {
+		writer, err := NewFrameWriter(key, staged, offset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := writer.Write(chunk); err != nil {
+			t.Fatal(err)
+		}
+		if err := writer.Close(); err != nil {
+			t.Fatal(err)
+		}
+		offset += int64(len(chunk))
+	}
+	return offset
+}
+
+func readFrames(key, staged []byte) ([]byte, error) {
+	reader, err := NewFrameReader(key, bytes.NewReader(staged))
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(reader)
+}
+
+func TestFramesRoundTrip(t *testing.T) {
+	key := testKey(1)
+	chunks := [][]byte{randomBytes(t, 10), randomBytes(t, SegmentSize+3), {}, randomBytes(t, 2*SegmentSize)}
+	var staged bytes.Buffer
+	appendFrames(t, key, &staged, 0, chunks...)
+
+	got, err := readFrames(key, staged.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := bytes.Join(chunks, nil); !bytes.Equal(got, want) {
+		t.Errorf("frames returned %d bytes, want %d", len(got), len(want))
+	}
+	if empty, err := readFrames(key, nil); err != nil || len(empty) != 0 {
+		t.Errorf("no frames = %d bytes, %v; want none", len(empty), err)
+	}
+}
+
+func TestFramePosition(t *testing.T) {
+	key := testKey(1)
+	var staged bytes.Buffer
+	first := appendFrames(t, key, &staged, 0, randomBytes(t, 100))
+	afterFirst := int64(staged.Len())
+	second := appendFrames(t, key, &staged, first, randomBytes(t, SegmentSize+1))
+	total := int64(staged.Len())
+
+	tests := []struct {
+		offset  int64
+		want    int64
+		wantErr bool
+	}{
+		{0, 0, false},
+		{first, afterFirst, false},
+		{first + SegmentSize, afterFirst + frameHeaderSize + frameNonceSize + SegmentSize + frameTagSize, false},
+		{second, total, false},
+		{50, 0, true},
+		{second + 1, 0, true},
+	}
+	for _, tt := range tests {
+		position, err := FramePosition(bytes.NewReader(staged.Bytes()), tt.offset)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("FramePosition(%d) error = %v, want error %v", tt.offset, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && position != tt.want {
+			t.Errorf("FramePosition(%d) = %d, want %d", tt.offset, position, tt.want)
+		}
+	}
+
+	// Cutting the frames back to a position leaves the bytes before it readable
+	cut := staged.Bytes()[:afterFirst]
+	got, err := readFrames(key, cut)
+	if err != nil || int64(len(got)) != first {
+		t.Errorf("frames cut at %d = %d bytes, %v; want %d", afterFirst, len(got), err, first)
+	}
+}
+
+func TestFramesTampering(t *testing.T) {
+	key := testKey(1)
+	a, b := bytes.Repeat([]byte("a"), 100), bytes.Repeat([]byte("b"), 100)
+	var staged bytes.Buffer
+	appendFrames(t, key, &staged, 0, a, b)
+	frames := staged.Bytes()
+	frameSize := frameHeaderSize + frameNonceSize + 100 + frameTagSize
+	first, second := frames[:frameSize], frames[frameSize:]
+
+	// A frame appended as if it started elsewhere in the data
+	var misplaced bytes.Buffer
+	appendFrames(t, key, &misplaced, 0, a)
+	appendFrames(t, key, &misplaced, 0, b)
+
+	// A header claiming a different length
+	relabeled := append([]byte(nil), frames...)
+	binary.BigEndian.PutUint32(relabeled, 99)
+
+	tests := []struct {
+		name   string
+		key    []byte
+		staged []byte
+		want   string
+	}{
+		{"wrong key", testKey(2), frames, "failed to decrypt frame"},
+		{"flipped bit", key, flipBit(frames, frameSize+frameHeaderSize+frameNonceSize+1), "failed to decrypt frame"},
+		{"frames swapped", key, bytes.Join([][]byte{second, first}, nil), "failed to decrypt frame"},
+		{"frame repeated", key, bytes.Join([][]byte{first, first}, nil), "failed to decrypt frame"},
+		{"first frame dropped", key, second, "failed to decrypt frame"},
+		{"wrong offset", key, misplaced.Bytes(), "failed to decrypt frame"},
+		{"length changed", key, relabeled, "failed to decrypt frame"},
+		{"cut inside a frame", key, frames[:frameSize+10], "truncated frame"},
+		{"cut inside a header", key, frames[:frameSize+2], "truncated frame"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := readFrames(tt.key, tt.staged)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("reading frames error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
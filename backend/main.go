@@ -14,10 +14,12 @@ import (
 	"gorm.io/gorm"             // Import GORM
 
 	"NoteSense/controllers"
+	"NoteSense/encryption"
 	"NoteSense/middleware"
 	"NoteSense/models" // Import models for migration
 	"NoteSense/repositories"
 	"NoteSense/services"
+	"NoteSense/storage"
 
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
@@ -75,6 +77,46 @@ func connectWithRetry(ctx context.Context, connectionString string, maxRetries i
 	return nil, fmt.Errorf("failed to connect to database after %d attempts: %v", maxRetries, err)
 }
 
+// rotateMasterKey re-wraps all per-user data keys from the current master key to a new one.
+// The server must be stopped meanwhile, and ENCRYPTION_MASTER_KEY replaced with the new key
+// before it starts again.
+func rotateMasterKey(dataKeyRepo *repositories.DataKeyRepository, currentKey *encryption.MasterKey) {
+	if currentKey == nil {
+		log.Fatal("Key rotation requires ENCRYPTION_MASTER_KEY or ENCRYPTION_MASTER_KEY_FILE")
+	}
+	newKey, err := encryption.LoadMasterKey("ENCRYPTION_NEW_MASTER_KEY", "ENCRYPTION_NEW_MASTER_KEY_FILE")
+	if err != nil {
+		log.Fatalf("Error loading new master key: %v", err)
+	}
+	if newKey == nil {
+		log.Fatal("Key rotation requires ENCRYPTION_NEW_MASTER_KEY or ENCRYPTION_NEW_MASTER_KEY_FILE")
+	}
+	if newKey.ID == currentKey.ID {
+		log.Fatal("The new master key is the same as the current one")
+	}
+
+	rotated, err := dataKeyRepo.RewrapAll(context.Background(), currentKey, newKey)
+	if err != nil {
+		log.Fatalf("Key rotation failed: %v", err)
+	}
+	log.Printf("Re-wrapped %d data keys from master key %s to %s", rotated, currentKey.ID, newKey.ID)
+}
+
+// encryptExisting encrypts what was stored before at-rest encryption was enabled: note content,
+// extracted file text and file blobs. New writes are encrypted by the repositories already.
+func encryptExisting(noteRepo *repositories.NoteRepository, fileMetadataRepo *repositories.FileMetadataRepository, blobStore storage.BlobStore) {
+	ctx := context.Background()
+	notes, err := noteRepo.EncryptExisting(ctx)
+	if err != nil {
+		log.Fatalf("Encrypting notes failed after %d notes: %v", notes, err)
+	}
+	texts, blobs, err := fileMetadataRepo.EncryptExisting(ctx, blobStore)
+	if err != nil {
+		log.Fatalf("Encrypting files failed after %d texts and %d blobs: %v", texts, blobs, err)
+	}
+	log.Printf("Encrypted %d notes, %d extracted texts and %d file blobs", notes, texts, blobs)
+}
+
 func main() {
 	// Load environment variables from .env file
 	if err := godotenv.Load(); err != nil {
@@ -89,12 +131,13 @@ func main() {
 
 	connectionString := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable", dbHost, dbPort, dbUser, dbPassword, dbName)
 
-	// Create a context with cancellation
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	// Connecting gives up after two minutes
+	connectCtx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
 	defer cancel()
 
 	// Initialize GORM DB connection with retry and context
-	db, err := connectWithRetry(ctx, connectionString, 5)
+	db, err := connectWithRetry(connectCtx, connectionString, 5)
+	cancel()
 	if err != nil {
 		log.Fatalf("Critical error: Unable to establish database connection: %v", err)
 	}
@@ -108,30 +151,125 @@ func main() {
 	}()
 
 	// Automigrate the models
-	if err := db.AutoMigrate(&models.User{}, &models.Note{}, &models.TokenBlacklist{}, &models.FileMetadata{}); err != nil {
+	if err := db.AutoMigrate(&models.User{}, &models.Note{}, &models.TokenBlacklist{}, &models.FileMetadata{}, &models.NoteTemplate{}, &models.UserDataKey{}, &models.NoteEmbedding{}, &models.SavedSearch{}, &models.NoteConnection{}, &models.ConnectionTypeDefinition{}, &models.MindmapPosition{}, &models.Board{}, &models.BoardCard{}, &models.StatusEvent{}, &models.AuditEntry{}, &models.AuditSettings{}, &models.UploadSession{}); err != nil {
 		log.Fatal("Error during migration:", err)
 	}
 	log.Println("Database migration completed")
 
+	// Load the at-rest encryption master key; encryption stays disabled when none is configured
+	masterKey, err := encryption.LoadMasterKey("ENCRYPTION_MASTER_KEY", "ENCRYPTION_MASTER_KEY_FILE")
+	if err != nil {
+		log.Fatalf("Error loading encryption master key: %v", err)
+	}
+	dataKeyRepo := repositories.NewDataKeyRepository(db)
+
+	// "rotate-keys" re-wraps every data key with ENCRYPTION_NEW_MASTER_KEY and exits
+	if len(os.Args) > 1 && os.Args[1] == "rotate-keys" {
+		rotateMasterKey(dataKeyRepo, masterKey)
+		return
+	}
+
+	if masterKey != nil {
+		log.Printf("At-rest encryption enabled with master key %s", masterKey.ID)
+	}
+	contentCipher := repositories.NewContentCipher(masterKey, dataKeyRepo)
+
 	// Initialize repositories
 	userRepo := repositories.NewUserRepository(db)
-	noteRepo := repositories.NewNoteRepository(db)
+	noteRepo := repositories.NewNoteRepository(db, contentCipher)
 	tokenBlacklistRepo := repositories.NewTokenBlacklistRepository(db)
-	fileMetadataRepo := repositories.NewFileMetadataRepository(db)
+	fileMetadataRepo := repositories.NewFileMetadataRepository(db, contentCipher)
+	templateRepo := repositories.NewTemplateRepository(db)
+	embeddingRepo := repositories.NewEmbeddingRepository(db, contentCipher)
+	collectionRepo := repositories.NewCollectionRepository(db)
+	connectionRepo := repositories.NewConnectionRepository(db)
+	connectionTypeRepo := repositories.NewConnectionTypeRepository(db)
+	mindmapPositionRepo := repositories.NewMindmapPositionRepository(db)
+	boardRepo := repositories.NewBoardRepository(db)
+	statusEventRepo := repositories.NewStatusEventRepository(db)
+	auditRepo := repositories.NewAuditRepository(db)
+	uploadSessionRepo := repositories.NewUploadSessionRepository(db)
+
+	// Data migrations run to completion however long they take on a large database
+	ctx := context.Background()
+
+	// Connections used to be stored as arrays on the source note
+	if err := connectionRepo.MigrateLegacyConnections(ctx); err != nil {
+		log.Fatal("Error migrating note connections:", err)
+	}
+
+	// Statuses used to be free text; boards rely on canonical state names
+	if err := noteRepo.MigrateCanonicalStatuses(ctx); err != nil {
+		log.Fatal("Error migrating note statuses:", err)
+	}
+
+	// Uploaded files are kept in the blob store BLOB_STORE selects
+	blobStore, err := storage.NewBlobStoreFromEnv()
+	if err != nil {
+		log.Fatalf("Error configuring blob storage: %v", err)
+	}
+	if err := fileMetadataRepo.MigrateFilePaths(ctx, blobStore); err != nil {
+		log.Fatal("Error moving files into blob storage:", err)
+	}
+	// Storage quotas count file sizes, which older uploads did not record
+	if err := fileMetadataRepo.BackfillSizes(ctx, blobStore); err != nil {
+		log.Fatal("Error recording file sizes:", err)
+	}
+
+	// Full-text search vectors are computed from plaintext, so they are maintained by the repository.
+	// With encryption enabled they hold keyed hashes of words, and switching reindexes every note.
+	if err := noteRepo.MigrateSearchIndex(ctx); err != nil {
+		log.Fatal("Error creating search index:", err)
+	}
+	if err := noteRepo.BackfillSearchVectors(ctx); err != nil {
+		log.Fatal("Error indexing notes for search:", err)
+	}
+
+	// "encrypt-existing" encrypts rows and files stored before the master key was set, and exits
+	if len(os.Args) > 1 && os.Args[1] == "encrypt-existing" {
+		if masterKey == nil {
+			log.Fatal("Encrypting existing data requires ENCRYPTION_MASTER_KEY or ENCRYPTION_MASTER_KEY_FILE")
+		}
+		encryptExisting(noteRepo, fileMetadataRepo, blobStore)
+		return
+	}
 
 	// Initialize Speech-to-Text Service
 	speechService := services.NewSpeechToTextService()
 	ocrService := services.NewOCRService()
 
 	// Initialize services
-	userService := services.NewUserService(userRepo)
-	noteService := services.NewNoteService(noteRepo)
+	userService := services.NewUserService(userRepo, noteRepo)
+	auditService := services.NewAuditService(auditRepo, userRepo)
+	auditService.Start(context.Background())
+	// Semantic search runs only once the local embedding environment is installed
+	var embeddingService *services.EmbeddingService
+	embedder := services.NewLocalEmbedder()
+	if err := embedder.Available(); err != nil {
+		log.Printf("Semantic search disabled: %v", err)
+	} else {
+		embeddingService = services.NewEmbeddingService(embedder, embeddingRepo, noteRepo)
+		embeddingService.Start(context.Background())
+		log.Printf("Semantic search enabled with model %s", embedder.Model())
+	}
+
+	noteService := services.NewNoteService(noteRepo, connectionRepo, boardRepo, statusEventRepo, embeddingService, blobStore)
+	templateService := services.NewTemplateService(templateRepo, userRepo, noteService)
+	connectionService := services.NewConnectionService(connectionRepo, connectionTypeRepo, mindmapPositionRepo, userRepo, noteService)
+	graphService := services.NewGraphService(connectionRepo, noteService)
+	collectionService := services.NewCollectionService(collectionRepo, connectionService, noteService)
+	boardService := services.NewBoardService(boardRepo, collectionService, noteService)
+	analyticsService := services.NewAnalyticsService(statusEventRepo, boardService)
 	fileUploadService := services.NewFileUploadService(
 		fileMetadataRepo,
 		speechService,
 		ocrService,
 		noteService,
+		contentCipher,
+		blobStore,
 	)
+	resumableUploadService := services.NewResumableUploadService(uploadSessionRepo, fileUploadService)
+	resumableUploadService.Start(context.Background())
 
 	// Initialize middleware
 	authMiddleware := middleware.NewAuthMiddleware(userRepo, tokenBlacklistRepo)
@@ -140,9 +278,18 @@ func main() {
 	userHandler := &controllers.UserHandler{
 		UserService:          userService,
 		AuthorizationService: authMiddleware,
+		AuditService:         auditService,
 	}
-	noteHandler := controllers.NewNoteHandler(noteService)
-	fileHandler := controllers.NewFileHandler(fileUploadService)
+	noteHandler := controllers.NewNoteHandler(noteService, auditService)
+	fileHandler := controllers.NewFileHandler(fileUploadService, auditService)
+	uploadHandler := controllers.NewUploadHandler(resumableUploadService, auditService)
+	templateHandler := controllers.NewTemplateHandler(templateService)
+	collectionHandler := controllers.NewCollectionHandler(collectionService)
+	connectionHandler := controllers.NewConnectionHandler(connectionService, auditService)
+	graphHandler := controllers.NewGraphHandler(graphService)
+	boardHandler := controllers.NewBoardHandler(boardService)
+	analyticsHandler := controllers.NewAnalyticsHandler(analyticsService)
+	auditHandler := controllers.NewAuditHandler(auditService)
 
 	// Set up the router
 	r := mux.NewRouter()
@@ -154,33 +301,106 @@ func main() {
 	r.HandleFunc("/signup", userHandler.SignUpHandler).Methods("POST")
 	r.HandleFunc("/login", userHandler.LoginHandler).Methods("POST")
 	r.HandleFunc("/logout", userHandler.LogoutHandler).Methods("POST")
+	r.HandleFunc("/users/me/settings", userHandler.UpdateSettingsHandler).Methods("PATCH")
 
 	// Note Connection Routes
-	r.HandleFunc("/notes/mindmap", noteHandler.GetNotesMindmapHandler).Methods("GET")
-	r.HandleFunc("/notes/{id}/connections", noteHandler.GetNoteConnectionsHandler).Methods("GET")
-	r.HandleFunc("/notes/{id}/connect", noteHandler.ConnectNoteHandler).Methods("POST")
-	r.HandleFunc("/notes/{id}/unlink/{connectedNoteId}", noteHandler.UnlinkNoteHandler).Methods("DELETE")
+	r.HandleFunc("/notes/mindmap", connectionHandler.GetNotesMindmapHandler).Methods("GET")
+	r.HandleFunc("/notes/mindmap/positions", connectionHandler.SaveMindmapPositionsHandler).Methods("PUT")
+	r.HandleFunc("/notes/mindmap/positions", connectionHandler.ResetMindmapPositionsHandler).Methods("DELETE")
+	r.HandleFunc("/notes/{id}/connections", connectionHandler.GetNoteConnectionsHandler).Methods("GET")
+	r.HandleFunc("/notes/{id}/connect", connectionHandler.ConnectNoteHandler).Methods("POST")
+	r.HandleFunc("/notes/{id}/unlink/{connectedNoteId}", connectionHandler.UnlinkNoteHandler).Methods("DELETE")
+	r.HandleFunc("/connections/{id}", connectionHandler.UpdateConnectionHandler).Methods("PATCH")
+	r.HandleFunc("/connections/{id}", connectionHandler.DeleteConnectionHandler).Methods("DELETE")
+	r.HandleFunc("/connection-types", connectionHandler.CreateConnectionTypeHandler).Methods("POST")
+	r.HandleFunc("/connection-types", connectionHandler.GetConnectionTypesHandler).Methods("GET")
+	r.HandleFunc("/connection-types/{id}", connectionHandler.UpdateConnectionTypeHandler).Methods("PATCH")
+	r.HandleFunc("/connection-types/{id}", connectionHandler.DeleteConnectionTypeHandler).Methods("DELETE")
+
+	// Graph query routes
+	r.HandleFunc("/notes/{id}/neighborhood", graphHandler.GetNeighborhoodHandler).Methods("GET")
+	r.HandleFunc("/notes/{id}/path/{targetId}", graphHandler.GetPathHandler).Methods("GET")
+	r.HandleFunc("/graph/clusters", graphHandler.GetClustersHandler).Methods("GET")
+	r.HandleFunc("/graph/orphans", graphHandler.GetOrphansHandler).Methods("GET")
+	r.HandleFunc("/graph/hubs", graphHandler.GetHubsHandler).Methods("GET")
 
 	// Note routes
 	r.HandleFunc("/notes", noteHandler.CreateNoteHandler).Methods("POST")
 	r.HandleFunc("/notes", noteHandler.GetNotesHandler).Methods("GET") // List all notes
+	r.HandleFunc("/notes/order", noteHandler.ReorderNotesHandler).Methods("PUT")
 	r.HandleFunc("/notes/search", noteHandler.SearchNotesHandler).Methods("POST")
 	r.HandleFunc("/notes/kanban", noteHandler.GetKanbanNotesHandler).Methods("GET")
 	r.HandleFunc("/notes/kanban/note/{id}", noteHandler.UpdateNoteStateAndPriorityHandler).Methods("PATCH")
-	r.HandleFunc("/notes/mindmap", noteHandler.GetNotesMindmapHandler).Methods("GET") // Add mindmap route
 
+	r.HandleFunc("/notes/{id}/render", noteHandler.RenderNoteHandler).Methods("GET")
+	r.HandleFunc("/notes/{id}/similar", noteHandler.SimilarNotesHandler).Methods("GET")
+	r.HandleFunc("/notes/{id}/dependency-tree", noteHandler.DependencyTreeHandler).Methods("GET")
+	r.HandleFunc("/notes/{id}/lock", noteHandler.LockNoteHandler).Methods("POST")
+	r.HandleFunc("/notes/{id}/unlock", noteHandler.UnlockNoteHandler).Methods("POST")
 	r.HandleFunc("/notes/{id}", noteHandler.GetNoteHandler).Methods("GET") // Get single note
 	r.HandleFunc("/notes/{id}", noteHandler.UpdateNoteHandler).Methods("PATCH")
 	r.HandleFunc("/notes/{id}", noteHandler.DeleteNoteHandler).Methods("DELETE")
 
-	// File upload route
+	// Kanban board routes
+	r.HandleFunc("/boards", boardHandler.CreateBoardHandler).Methods("POST")
+	r.HandleFunc("/boards", boardHandler.GetBoardsHandler).Methods("GET")
+	r.HandleFunc("/boards/{id}", boardHandler.GetBoardHandler).Methods("GET")
+	r.HandleFunc("/boards/{id}", boardHandler.UpdateBoardHandler).Methods("PATCH")
+	r.HandleFunc("/boards/{id}", boardHandler.DeleteBoardHandler).Methods("DELETE")
+	r.HandleFunc("/boards/{id}/cards/{noteId}", boardHandler.MoveCardHandler).Methods("PATCH")
+
+	// Flow analytics routes
+	r.HandleFunc("/analytics/flow-times", analyticsHandler.GetFlowTimesHandler).Methods("GET")
+	r.HandleFunc("/analytics/throughput", analyticsHandler.GetThroughputHandler).Methods("GET")
+	r.HandleFunc("/analytics/cumulative-flow", analyticsHandler.GetCumulativeFlowHandler).Methods("GET")
+	r.HandleFunc("/analytics/wip-age", analyticsHandler.GetWorkItemAgeHandler).Methods("GET")
+
+	// Activity feed and audit log routes
+	r.HandleFunc("/activity", auditHandler.GetActivityHandler).Methods("GET")
+	r.HandleFunc("/admin/audit/export", auditHandler.ExportAuditHandler).Methods("GET")
+	r.HandleFunc("/admin/audit/settings", auditHandler.GetAuditSettingsHandler).Methods("GET")
+	r.HandleFunc("/admin/audit/settings", auditHandler.UpdateAuditSettingsHandler).Methods("PUT")
+
+	// Template routes
+	r.HandleFunc("/templates", templateHandler.CreateTemplateHandler).Methods("POST")
+	r.HandleFunc("/templates", templateHandler.GetTemplatesHandler).Methods("GET")
+	r.HandleFunc("/templates/{id}", templateHandler.GetTemplateHandler).Methods("GET")
+	r.HandleFunc("/templates/{id}", templateHandler.UpdateTemplateHandler).Methods("PATCH")
+	r.HandleFunc("/templates/{id}", templateHandler.DeleteTemplateHandler).Methods("DELETE")
+	r.HandleFunc("/notes/from-template/{id}", templateHandler.CreateNoteFromTemplateHandler).Methods("POST")
+
+	// Collection (saved search) routes
+	r.HandleFunc("/collections", collectionHandler.CreateCollectionHandler).Methods("POST")
+	r.HandleFunc("/collections", collectionHandler.GetCollectionsHandler).Methods("GET")
+	r.HandleFunc("/collections/{id}", collectionHandler.GetCollectionHandler).Methods("GET")
+	r.HandleFunc("/collections/{id}", collectionHandler.UpdateCollectionHandler).Methods("PATCH")
+	r.HandleFunc("/collections/{id}", collectionHandler.DeleteCollectionHandler).Methods("DELETE")
+	r.HandleFunc("/collections/{id}/notes", collectionHandler.GetCollectionNotesHandler).Methods("GET")
+	r.HandleFunc("/collections/{id}/kanban", collectionHandler.GetCollectionKanbanHandler).Methods("GET")
+	r.HandleFunc("/collections/{id}/mindmap", collectionHandler.GetCollectionMindmapHandler).Methods("GET")
+	r.HandleFunc("/collections/{id}/mindmap/positions", collectionHandler.SaveCollectionMindmapPositionsHandler).Methods("PUT")
+	r.HandleFunc("/collections/{id}/mindmap/positions", collectionHandler.ResetCollectionMindmapPositionsHandler).Methods("DELETE")
+
+	// File routes
 	r.HandleFunc("/api/files", fileHandler.UploadFileHandler).Methods("POST")
+	r.HandleFunc("/files/usage", fileHandler.GetStorageUsageHandler).Methods("GET")
+	r.HandleFunc("/files/{id}", fileHandler.DownloadFileHandler).Methods("GET")
+	r.HandleFunc("/files/{id}", fileHandler.DeleteFileHandler).Methods("DELETE")
+	r.HandleFunc("/notes/{id}/attachments", fileHandler.GetNoteAttachmentsHandler).Methods("GET")
+
+	// Resumable upload routes
+	r.HandleFunc("/uploads", uploadHandler.CreateUploadHandler).Methods("POST")
+	r.HandleFunc("/uploads/{id}", uploadHandler.GetUploadHandler).Methods("GET")
+	r.HandleFunc("/uploads/{id}", uploadHandler.AppendChunkHandler).Methods("PATCH")
+	r.HandleFunc("/uploads/{id}", uploadHandler.AbortUploadHandler).Methods("DELETE")
+	r.HandleFunc("/uploads/{id}/complete", uploadHandler.CompleteUploadHandler).Methods("POST")
 
 	// Enable CORS with more permissive settings
 	corsHandler := handlers.CORS(
 		handlers.AllowedOrigins([]string{"*"}),
 		handlers.AllowedMethods([]string{"GET", "POST", "PUT", "DELETE", "OPTIONS", "PATCH"}),
-		handlers.AllowedHeaders([]string{"Content-Type", "Authorization"}),
+		handlers.AllowedHeaders([]string{"Content-Type", "Authorization", "Upload-Offset", "Upload-Checksum"}),
+		handlers.ExposedHeaders([]string{"Upload-Offset"}),
 	)
 
 	// Use structured logging
@@ -189,12 +409,36 @@ func main() {
 	log.Printf("  - POST /signup")
 	log.Printf("  - POST /login")
 	log.Printf("  - POST /logout")
+	log.Printf("  - PATCH /users/me/settings")
 	log.Printf("  - POST /api/notes")
 	log.Printf("  - GET /api/notes")
 	log.Printf("  - PATCH /api/notes/{id}")
 	log.Printf("  - DELETE /api/notes/{id}")
 	log.Printf("  - POST /api/notes/search")
 	log.Printf("  - GET /api/notes/kanban")
+	log.Printf("  - GET/POST /boards")
+	log.Printf("  - GET/PATCH/DELETE /boards/{id}")
+	log.Printf("  - PATCH /boards/{id}/cards/{noteId}")
+	log.Printf("  - GET /analytics/flow-times, /analytics/throughput, /analytics/cumulative-flow, /analytics/wip-age")
+	log.Printf("  - GET /activity")
+	log.Printf("  - GET /admin/audit/export, GET/PUT /admin/audit/settings")
+	log.Printf("  - GET /notes/{id}/attachments")
+	log.Printf("  - GET /files/usage")
+	log.Printf("  - GET/DELETE /files/{id}")
+	log.Printf("  - POST /uploads, GET/PATCH/DELETE /uploads/{id}, POST /uploads/{id}/complete")
+	log.Printf("  - GET /notes/{id}/similar")
+	log.Printf("  - GET /notes/{id}/dependency-tree")
+	log.Printf("  - GET/POST /templates")
+	log.Printf("  - POST /notes/from-template/{id}")
+	log.Printf("  - GET/POST /collections")
+	log.Printf("  - GET /collections/{id}/notes")
+	log.Printf("  - GET /notes/{id}/connections")
+	log.Printf("  - PUT/DELETE /notes/mindmap/positions")
+	log.Printf("  - PATCH/DELETE /connections/{id}")
+	log.Printf("  - GET/POST /connection-types")
+	log.Printf("  - GET /notes/{id}/neighborhood")
+	log.Printf("  - GET /notes/{id}/path/{targetId}")
+	log.Printf("  - GET /graph/clusters, /graph/orphans, /graph/hubs")
 
 	if err := http.ListenAndServe(":8080", corsHandler(r)); err != nil {
 		log.Fatal("Error starting server:", err)
@@ -0,0 +1,66 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// AuditChange is the old and new value of one changed field. Fields that are never stored in
+// the audit log, such as note content, are recorded as changed without values.
+type AuditChange struct {
+	From interface{} `json:"from,omitempty"`
+	To   interface{} `json:"to,omitempty"`
+}
+
+// AuditChanges maps a field name to its change
+type AuditChanges map[string]AuditChange
+
+// Value implements driver.Valuer
+func (c AuditChanges) Value() (driver.Value, error) {
+	if c == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(c)
+	return string(data), err
+}
+
+// Scan implements sql.Scanner
+func (c *AuditChanges) Scan(value interface{}) error {
+	return scanJSONColumn(value, c)
+}
+
+// AuditEntry records one action taken on an account or its data. UserID is the account the
+// entry belongs to and ActorID who acted; the actor is unset for requests that were not
+// authenticated, such as failed logins.
+type AuditEntry struct {
+	ID         uuid.UUID    `gorm:"type:uuid;primaryKey" json:"id"`
+	UserID     *uuid.UUID   `gorm:"type:uuid;index:idx_audit_user_created" json:"userId,omitempty"`
+	ActorID    *uuid.UUID   `gorm:"type:uuid" json:"actorId,omitempty"`
+	Action     string       `gorm:"not null;index" json:"action"`
+	TargetType string       `json:"targetType,omitempty"`
+	TargetID   *uuid.UUID   `gorm:"type:uuid" json:"targetId,omitempty"`
+	IP         string       `json:"ip,omitempty"`
+	Summary    string       `json:"summary,omitempty"`
+	Changes    AuditChanges `gorm:"type:jsonb" json:"changes,omitempty"`
+
+	CreatedAt time.Time `gorm:"index;index:idx_audit_user_created" json:"createdAt"`
+}
+
+func (e *AuditEntry) BeforeCreate(tx *gorm.DB) error {
+	if e.ID == uuid.Nil {
+		e.ID = uuid.New()
+	}
+	return nil
+}
+
+// AuditSettings holds the audit log settings; there is a single row
+type AuditSettings struct {
+	ID            int       `gorm:"primaryKey" json:"-"`
+	RetentionDays int       `gorm:"not null" json:"retentionDays"` // Entries older than this are deleted; 0 keeps them forever
+	UpdatedBy     uuid.UUID `gorm:"type:uuid" json:"updatedBy"`
+	UpdatedAt     time.Time `json:"updatedAt"`
+}
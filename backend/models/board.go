@@ -0,0 +1,199 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// BoardColumn is one column of a Kanban board. Its key is the status of the notes it holds.
+type BoardColumn struct {
+	Key      string `json:"key"`
+	Name     string `json:"name"`
+	State    string `json:"state"`              // Canonical state the column belongs to
+	Color    string `json:"color"`              // Hex color such as #22c55e
+	WIPLimit int    `json:"wipLimit,omitempty"` // Most notes the column may hold; 0 for no limit
+}
+
+// BoardColumns are the columns of a board in display order
+type BoardColumns []BoardColumn
+
+// Value implements driver.Valuer
+func (c BoardColumns) Value() (driver.Value, error) {
+	data, err := json.Marshal(c)
+	return string(data), err
+}
+
+// Scan implements sql.Scanner
+func (c *BoardColumns) Scan(value interface{}) error {
+	return scanJSONColumn(value, c)
+}
+
+// BoardTransitions maps a column key to the keys notes may move to from it.
+// Columns without an entry allow every move.
+type BoardTransitions map[string][]string
+
+// Value implements driver.Valuer
+func (t BoardTransitions) Value() (driver.Value, error) {
+	if t == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(t)
+	return string(data), err
+}
+
+// Scan implements sql.Scanner
+func (t *BoardTransitions) Scan(value interface{}) error {
+	return scanJSONColumn(value, t)
+}
+
+// BoardFilter selects the notes a board shows. Every set field must match; an empty filter
+// shows all of the user's notes.
+type BoardFilter struct {
+	Categories   []string   `json:"categories,omitempty"`   // Notes in any of these categories
+	Query        string     `json:"query,omitempty"`        // Notes matching this search query
+	CollectionID *uuid.UUID `json:"collectionId,omitempty"` // Notes matching this saved search
+}
+
+// IsEmpty reports whether the filter shows every note
+func (f BoardFilter) IsEmpty() bool {
+	return len(f.Categories) == 0 && f.Query == "" && f.CollectionID == nil
+}
+
+// Value implements driver.Valuer
+func (f BoardFilter) Value() (driver.Value, error) {
+	data, err := json.Marshal(f)
+	return string(data), err
+}
+
+// Scan implements sql.Scanner
+func (f *BoardFilter) Scan(value interface{}) error {
+	return scanJSONColumn(value, f)
+}
+
+// scanJSONColumn decodes a json or jsonb column into dest
+func scanJSONColumn(value interface{}, dest interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case []byte:
+		return json.Unmarshal(v, dest)
+	case string:
+		return json.Unmarshal([]byte(v), dest)
+	default:
+		return fmt.Errorf("unsupported JSON column type %T", value)
+	}
+}
+
+// Board is a Kanban board: ordered columns, the moves allowed between them and the notes it shows.
+// The columns of the user's default board lay out all their notes at /notes/kanban; without one,
+// DefaultBoard is used.
+type Board struct {
+	ID          uuid.UUID        `gorm:"type:uuid;primaryKey" json:"id"`
+	UserID      uuid.UUID        `gorm:"type:uuid;not null;index" json:"userId"`
+	Name        string           `gorm:"not null" json:"name"`
+	Columns     BoardColumns     `gorm:"type:jsonb;not null" json:"columns"`
+	Transitions BoardTransitions `gorm:"type:jsonb" json:"transitions,omitempty"`
+	Filter      BoardFilter      `gorm:"type:jsonb" json:"filter"`
+	IsDefault   bool             `gorm:"default:false" json:"isDefault"`
+
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+func (b *Board) BeforeCreate(tx *gorm.DB) error {
+	if b.ID == uuid.Nil {
+		b.ID = uuid.New()
+	}
+	return nil
+}
+
+// BoardCard is a note's manual position within its column on one board. Cards without one
+// follow the positioned cards in their Kanban order.
+type BoardCard struct {
+	ID       uuid.UUID `gorm:"type:uuid;primaryKey" json:"id"`
+	BoardID  uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_board_card" json:"boardId"`
+	NoteID   uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_board_card" json:"noteId"`
+	Position int       `gorm:"not null" json:"position"`
+
+	UpdatedAt time.Time `json:"updatedAt"`
+
+	Board *Board `gorm:"foreignKey:BoardID;constraint:OnDelete:CASCADE" json:"-"`
+	Note  *Note  `gorm:"foreignKey:NoteID;constraint:OnDelete:CASCADE" json:"-"`
+}
+
+func (c *BoardCard) BeforeCreate(tx *gorm.DB) error {
+	if c.ID == uuid.Nil {
+		c.ID = uuid.New()
+	}
+	return nil
+}
+
+// StateColors are the default colors of columns in each canonical state
+var StateColors = map[string]string{
+	StateBacklog:    "#94a3b8",
+	StateTodo:       "#3b82f6",
+	StateInProgress: "#f59e0b",
+	StateDone:       "#22c55e",
+}
+
+// DefaultBoard returns the built-in board: one column per canonical state and no restrictions.
+// It is not stored and has no ID.
+func DefaultBoard(userID uuid.UUID) *Board {
+	board := &Board{UserID: userID, Name: "Kanban", IsDefault: true}
+	names := map[string]string{StateBacklog: "Backlog", StateTodo: "To Do", StateInProgress: "In Progress", StateDone: "Done"}
+	for _, state := range CanonicalStates {
+		board.Columns = append(board.Columns, BoardColumn{Key: state, Name: names[state], State: state, Color: StateColors[state]})
+	}
+	return board
+}
+
+// Column returns the column with the given key, or nil
+func (b *Board) Column(key string) *BoardColumn {
+	for i := range b.Columns {
+		if b.Columns[i].Key == key {
+			return &b.Columns[i]
+		}
+	}
+	return nil
+}
+
+// FirstColumnIn returns the first column in the given canonical state, or nil
+func (b *Board) FirstColumnIn(state string) *BoardColumn {
+	for i := range b.Columns {
+		if b.Columns[i].State == state {
+			return &b.Columns[i]
+		}
+	}
+	return nil
+}
+
+// ColumnFor returns the column a note with the given status appears in: the column keyed by the
+// status, else the first column in the status's state, else the first column
+func (b *Board) ColumnFor(status, state string) *BoardColumn {
+	if column := b.Column(status); column != nil {
+		return column
+	}
+	if column := b.FirstColumnIn(state); column != nil {
+		return column
+	}
+	return &b.Columns[0]
+}
+
+// Allows reports whether notes may move from one column to another
+func (b *Board) Allows(from, to string) bool {
+	targets, ok := b.Transitions[from]
+	if !ok || from == to {
+		return true
+	}
+	for _, target := range targets {
+		if target == to {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,78 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// SavedSearch is a named search that is evaluated live whenever it is opened,
+// so its notes always reflect the current state. It is exposed as a collection.
+type SavedSearch struct {
+	ID       uuid.UUID    `gorm:"type:uuid;primaryKey" json:"id"`
+	UserID   uuid.UUID    `gorm:"type:uuid;not null;index" json:"userId"`
+	Name     string       `gorm:"not null" json:"name"`
+	Query    string       `json:"query"`                         // Search query language
+	Filters  JSONDocument `gorm:"type:jsonb" json:"filters"`     // Structured search filters
+	Mode     string       `gorm:"default:'keyword'" json:"mode"` // keyword, semantic or hybrid
+	Fuzzy    bool         `gorm:"default:false" json:"fuzzy"`    // Match misspellings
+	Pinned   bool         `gorm:"default:false" json:"pinned"`   // Shown in the sidebar
+	Position int          `gorm:"default:0" json:"position"`     // Order among pinned searches
+
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+func (s *SavedSearch) BeforeCreate(tx *gorm.DB) error {
+	if s.ID == uuid.Nil {
+		s.ID = uuid.New()
+	}
+	if s.Mode == "" {
+		s.Mode = "keyword"
+	}
+	return nil
+}
+
+// JSONDocument is a raw JSON value stored in a jsonb column
+type JSONDocument json.RawMessage
+
+// Value implements driver.Valuer
+func (d JSONDocument) Value() (driver.Value, error) {
+	if len(d) == 0 {
+		return nil, nil
+	}
+	return string(d), nil
+}
+
+// Scan implements sql.Scanner
+func (d *JSONDocument) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*d = nil
+	case []byte:
+		*d = append(JSONDocument(nil), v...)
+	case string:
+		*d = JSONDocument(v)
+	default:
+		return fmt.Errorf("unsupported JSON document type %T", value)
+	}
+	return nil
+}
+
+// MarshalJSON returns the document as-is, or null when empty
+func (d JSONDocument) MarshalJSON() ([]byte, error) {
+	if len(d) == 0 {
+		return []byte("null"), nil
+	}
+	return d, nil
+}
+
+// UnmarshalJSON stores a copy of the raw document
+func (d *JSONDocument) UnmarshalJSON(data []byte) error {
+	*d = append(JSONDocument(nil), data...)
+	return nil
+}
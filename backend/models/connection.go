@@ -0,0 +1,95 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ConnectionType defines the types of connections between notes
+type ConnectionType string
+
+// Predefined connection types
+const (
+	RelatedConnection     ConnectionType = "related"
+	DependsOnConnection   ConnectionType = "depends_on"
+	InspirationConnection ConnectionType = "inspiration"
+)
+
+// Connection type definition scopes
+const (
+	ConnectionTypeScopeUser      = "user"
+	ConnectionTypeScopeWorkspace = "workspace"
+)
+
+// ConnectionTypeDefinition describes a kind of connection. InverseName reads the connection
+// from its target, e.g. "blocks" / "blocked by". Workspace definitions are shared by admins
+// with every user.
+type ConnectionTypeDefinition struct {
+	ID          uuid.UUID      `gorm:"type:uuid;primaryKey" json:"id"`
+	UserID      uuid.UUID      `gorm:"type:uuid;not null;uniqueIndex:idx_connection_type_name" json:"userId"`
+	Scope       string         `gorm:"not null;default:'user'" json:"scope"` // "user" or "workspace"
+	Name        ConnectionType `gorm:"not null;uniqueIndex:idx_connection_type_name" json:"name"`
+	InverseName string         `json:"inverseName"`
+	Color       string         `json:"color"`    // Hex color such as #f97316
+	Directed    bool           `json:"directed"` // Undirected types read the same from both ends
+	Builtin     bool           `gorm:"-" json:"builtin"`
+
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+func (d *ConnectionTypeDefinition) BeforeCreate(tx *gorm.DB) error {
+	if d.ID == uuid.Nil {
+		d.ID = uuid.New()
+	}
+	if d.Scope == "" {
+		d.Scope = ConnectionTypeScopeUser
+	}
+	return nil
+}
+
+// BuiltinConnectionTypes are available to every user and cannot be changed
+var BuiltinConnectionTypes = []ConnectionTypeDefinition{
+	{Name: RelatedConnection, InverseName: "related", Color: "#94a3b8", Directed: false, Builtin: true},
+	{Name: DependsOnConnection, InverseName: "required by", Color: "#f97316", Directed: true, Builtin: true},
+	{Name: InspirationConnection, InverseName: "inspired by", Color: "#a855f7", Directed: true, Builtin: true},
+}
+
+// NoteConnection is a typed edge between two of a user's notes. A directed connection
+// points from Source to Target; an undirected one reads the same from both ends.
+// Edges are removed together with either of their notes.
+type NoteConnection struct {
+	ID       uuid.UUID      `gorm:"type:uuid;primaryKey" json:"id"`
+	UserID   uuid.UUID      `gorm:"type:uuid;not null;index" json:"userId"`
+	SourceID uuid.UUID      `gorm:"type:uuid;not null;uniqueIndex:idx_note_connections_edge" json:"sourceId"`
+	TargetID uuid.UUID      `gorm:"type:uuid;not null;uniqueIndex:idx_note_connections_edge;index" json:"targetId"`
+	Type     ConnectionType `gorm:"not null;uniqueIndex:idx_note_connections_edge" json:"type"`
+	Directed bool           `gorm:"not null" json:"directed"`
+	Label    string         `json:"label,omitempty"`
+	Weight   float64        `gorm:"not null;default:1" json:"weight"`
+
+	CreatedAt time.Time `json:"createdAt"`
+
+	Source *Note `gorm:"foreignKey:SourceID;constraint:OnDelete:CASCADE" json:"-"`
+	Target *Note `gorm:"foreignKey:TargetID;constraint:OnDelete:CASCADE" json:"-"`
+}
+
+func (c *NoteConnection) BeforeCreate(tx *gorm.DB) error {
+	if c.ID == uuid.Nil {
+		c.ID = uuid.New()
+	}
+	if c.Type == "" {
+		c.Type = RelatedConnection
+	}
+	return nil
+}
+
+// OtherEnd returns the note at the opposite end of the connection from noteID
+func (c *NoteConnection) OtherEnd(noteID uuid.UUID) uuid.UUID {
+	if c.SourceID == noteID {
+		return c.TargetID
+	}
+	return c.SourceID
+}
@@ -0,0 +1,17 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// UserDataKey is a per-user data encryption key, stored wrapped by the master key
+type UserDataKey struct {
+	ID          uint      `gorm:"primaryKey"`
+	UserID      uuid.UUID `gorm:"type:uuid;uniqueIndex;not null"`
+	WrappedKey  []byte    `gorm:"type:bytea;not null"`
+	MasterKeyID string    `gorm:"not null;index"` // Identifies the master key that wrapped this data key
+	CreatedAt   time.Time
+	RotatedAt   *time.Time
+}
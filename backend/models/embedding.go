@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// NoteEmbedding is the semantic vector of a note's title and content. With at-rest encryption
+// enabled the vector is stored sealed in SealedVector and Vector is left empty, since vectors
+// can be inverted to approximate the text they were computed from.
+type NoteEmbedding struct {
+	NoteID       uuid.UUID       `gorm:"type:uuid;primaryKey"`
+	UserID       uuid.UUID       `gorm:"type:uuid;not null;index"`
+	Model        string          `gorm:"not null;index"` // Embedding model that produced the vector
+	Vector       pq.Float32Array `gorm:"type:real[];not null"`
+	SealedVector string          `gorm:"type:text;not null;default:''"`
+	ContentHash  string          `gorm:"not null"` // Fingerprint of the embedded text, to skip unchanged notes
+	UpdatedAt    time.Time
+}
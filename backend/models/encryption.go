@@ -0,0 +1,105 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+)
+
+// Supported client-side encryption parameters for locked notes
+const (
+	EnvelopeAlgorithmAESGCM  = "AES-256-GCM"
+	EnvelopeKeySourcePass    = "passphrase"
+	EnvelopeKeySourceUserKey = "user-key"
+	EnvelopeKDFPBKDF2        = "PBKDF2-SHA256"
+	MinPBKDF2Iterations      = 100000
+)
+
+// KeyEnvelope describes how a locked note's content key was wrapped by the client.
+// The server never sees the passphrase or unwrapped key; every field is opaque to it
+// and only checked for shape so clients can decrypt consistently.
+type KeyEnvelope struct {
+	Algorithm     string `json:"algorithm"`               // Content cipher, "AES-256-GCM"
+	KeySource     string `json:"keySource"`               // "passphrase" or "user-key"
+	KDF           string `json:"kdf,omitempty"`           // "PBKDF2-SHA256" for passphrase keys
+	KDFIterations int    `json:"kdfIterations,omitempty"` // PBKDF2 iteration count
+	Salt          string `json:"salt,omitempty"`          // Base64 KDF salt
+	KeyID         string `json:"keyId,omitempty"`         // Client identifier of the per-user key
+	WrappedKey    string `json:"wrappedKey"`              // Base64 content key encrypted with the key-encryption key
+	WrapNonce     string `json:"wrapNonce"`               // Base64 nonce used to wrap the content key
+	Nonce         string `json:"nonce"`                   // Base64 nonce used to encrypt the content
+}
+
+// Validate checks that the envelope is complete and uses supported parameters
+func (e *KeyEnvelope) Validate() error {
+	if e == nil {
+		return fmt.Errorf("key envelope is required for encrypted notes")
+	}
+	if e.Algorithm != EnvelopeAlgorithmAESGCM {
+		return fmt.Errorf("unsupported encryption algorithm: %s", e.Algorithm)
+	}
+
+	switch e.KeySource {
+	case EnvelopeKeySourcePass:
+		if e.KDF != EnvelopeKDFPBKDF2 {
+			return fmt.Errorf("unsupported key derivation function: %s", e.KDF)
+		}
+		if e.KDFIterations < MinPBKDF2Iterations {
+			return fmt.Errorf("key derivation requires at least %d iterations", MinPBKDF2Iterations)
+		}
+		if err := validateBase64("salt", e.Salt); err != nil {
+			return err
+		}
+	case EnvelopeKeySourceUserKey:
+		if e.KeyID == "" {
+			return fmt.Errorf("keyId is required for user-key envelopes")
+		}
+	default:
+		return fmt.Errorf("unsupported key source: %s", e.KeySource)
+	}
+
+	if err := validateBase64("wrappedKey", e.WrappedKey); err != nil {
+		return err
+	}
+	if err := validateBase64("wrapNonce", e.WrapNonce); err != nil {
+		return err
+	}
+	return validateBase64("nonce", e.Nonce)
+}
+
+// Value implements driver.Valuer so the envelope is stored as JSONB
+func (e KeyEnvelope) Value() (driver.Value, error) {
+	return json.Marshal(e)
+}
+
+// Scan implements sql.Scanner for reading the JSONB envelope
+func (e *KeyEnvelope) Scan(value interface{}) error {
+	var data []byte
+	switch v := value.(type) {
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	case nil:
+		return nil
+	default:
+		return fmt.Errorf("unsupported key envelope type: %T", value)
+	}
+	return json.Unmarshal(data, e)
+}
+
+// ValidateCiphertext checks that content is non-empty base64, as produced by clients for locked notes
+func ValidateCiphertext(content string) error {
+	return validateBase64("content", content)
+}
+
+func validateBase64(field, value string) error {
+	if value == "" {
+		return fmt.Errorf("%s is required", field)
+	}
+	if _, err := base64.StdEncoding.DecodeString(value); err != nil {
+		return fmt.Errorf("%s must be base64 encoded", field)
+	}
+	return nil
+}
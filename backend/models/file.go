@@ -9,12 +9,15 @@ import (
 
 type FileMetadata struct {
 	gorm.Model
-	ID            uuid.UUID `gorm:"type:uuid;primary_key"`
-	UserID        uuid.UUID `gorm:"type:uuid;not null"`
-	FileName      string    `gorm:"not null"`
-	FileType      string    `gorm:"not null"` // "image" or "audio"
-	FilePath      string    `gorm:"not null"`
-	ExtractedText string    `gorm:"type:text"`
+	ID            uuid.UUID  `gorm:"type:uuid;primary_key"`
+	UserID        uuid.UUID  `gorm:"type:uuid;not null"`
+	NoteID        *uuid.UUID `gorm:"type:uuid;index"` // Note the file is attached to
+	FileName      string     `gorm:"not null"`
+	FileType      string     `gorm:"not null"` // "image", "audio" or "document"
+	ContentType   string     // Media type the content was verified as
+	StorageKey    string     `gorm:"index"`              // Key of the file's bytes in the blob store
+	Size          int64      `gorm:"not null;default:0"` // Size in bytes before encryption
+	ExtractedText string     `gorm:"type:text"`
 	ProcessedAt   time.Time
 }
 
@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// MindmapViewNotes is the view key of the mind map of all the user's notes
+const MindmapViewNotes = "notes"
+
+// CollectionMindmapView returns the view key of a collection's mind map
+func CollectionMindmapView(collectionID uuid.UUID) string {
+	return "collection:" + collectionID.String()
+}
+
+// MindmapPosition is a node position the user placed by hand in one mind map view.
+// Saved positions are kept when the rest of the map is laid out.
+type MindmapPosition struct {
+	ID     uuid.UUID `gorm:"type:uuid;primaryKey" json:"id"`
+	UserID uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_mindmap_position" json:"userId"`
+	View   string    `gorm:"not null;uniqueIndex:idx_mindmap_position" json:"view"`
+	NoteID uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_mindmap_position" json:"noteId"`
+	X      float64   `json:"x"`
+	Y      float64   `json:"y"`
+
+	UpdatedAt time.Time `json:"updatedAt"`
+
+	Note *Note `gorm:"foreignKey:NoteID;constraint:OnDelete:CASCADE" json:"-"`
+}
+
+func (p *MindmapPosition) BeforeCreate(tx *gorm.DB) error {
+	if p.ID == uuid.Nil {
+		p.ID = uuid.New()
+	}
+	return nil
+}
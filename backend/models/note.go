@@ -1,7 +1,7 @@
 package models
 
 import (
-	"fmt"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -9,16 +9,6 @@ import (
 	"gorm.io/gorm"
 )
 
-// ConnectionType defines the types of connections between notes
-type ConnectionType string
-
-// Predefined connection types
-const (
-	RelatedConnection     ConnectionType = "related"
-	DependsOnConnection   ConnectionType = "depends_on"
-	InspirationConnection ConnectionType = "inspiration"
-)
-
 type Note struct {
 	ID         uuid.UUID      `gorm:"primaryKey" json:"id"`
 	UserID     uuid.UUID      `json:"userId"`
@@ -29,20 +19,63 @@ type Note struct {
 	Status     string         `json:"status" gorm:"default:'backlog'"` // Kanban status
 	Priority   int            `json:"priority" gorm:"default:0"`
 
-	// New fields for note connections
-	ConnectedNoteIDs pq.StringArray `gorm:"type:uuid[]" json:"connectedNoteIds,omitempty"`
-	ConnectionTypes  pq.StringArray `gorm:"type:text[]" json:"connectionTypes,omitempty"`
+	// Locked notes are encrypted by the client. Content then holds base64 ciphertext
+	// and KeyEnvelope the wrapped key; both are opaque to the server.
+	Encrypted   bool         `json:"encrypted" gorm:"default:false"`
+	KeyEnvelope *KeyEnvelope `json:"keyEnvelope,omitempty" gorm:"type:jsonb"`
+
+	// Organization flags and manual ordering
+	Pinned         bool       `json:"pinned" gorm:"default:false"`
+	Favorite       bool       `json:"favorite" gorm:"default:false"`
+	Archived       bool       `json:"archived" gorm:"default:false;index"`
+	ArchivedAt     *time.Time `json:"archivedAt,omitempty"`
+	Position       int        `json:"position" gorm:"default:0"`       // Manual order in the notes list
+	KanbanPosition int        `json:"kanbanPosition" gorm:"default:0"` // Manual order within a Kanban column
 
 	CreatedAt time.Time `json:"createdAt"`
 	UpdatedAt time.Time `json:"updatedAt"`
 }
 
+// Canonical note states. Every Kanban column belongs to one of them, so notes in custom
+// columns are still known to be waiting, planned, started or finished.
 const (
+	StateBacklog    = "backlog"
 	StateTodo       = "todo"
 	StateInProgress = "in_progress"
 	StateDone       = "done"
 )
 
+// CanonicalStates lists the canonical states in workflow order
+var CanonicalStates = []string{StateBacklog, StateTodo, StateInProgress, StateDone}
+
+// stateSpellings maps the status spellings older clients wrote to canonical states
+var stateSpellings = map[string]string{
+	"backlog":     StateBacklog,
+	"draft":       StateBacklog,
+	"todo":        StateTodo,
+	"to_do":       StateTodo,
+	"in_progress": StateInProgress,
+	"inprogress":  StateInProgress,
+	"in progress": StateInProgress,
+	"in-progress": StateInProgress,
+	"done":        StateDone,
+	"completed":   StateDone,
+}
+
+// CanonicalState returns the canonical state a status spells, or "" when it spells none
+func CanonicalState(status string) string {
+	return stateSpellings[strings.ToLower(strings.TrimSpace(status))]
+}
+
+// StateSpellings returns the spellings of each canonical state, the state itself included
+func StateSpellings() map[string][]string {
+	spellings := make(map[string][]string, len(CanonicalStates))
+	for spelling, state := range stateSpellings {
+		spellings[state] = append(spellings[state], spelling)
+	}
+	return spellings
+}
+
 func (n *Note) BeforeCreate(tx *gorm.DB) error {
 	// Existing initializations
 	if n.Categories == nil {
@@ -51,79 +84,8 @@ func (n *Note) BeforeCreate(tx *gorm.DB) error {
 
 	// Set default status if not provided
 	if n.Status == "" {
-		n.Status = "Backlog"
-	}
-
-	// Initialize connection-related fields
-	if n.ConnectedNoteIDs == nil {
-		n.ConnectedNoteIDs = []string{}
-	}
-	if n.ConnectionTypes == nil {
-		n.ConnectionTypes = []string{}
+		n.Status = StateBacklog
 	}
 
 	return nil
 }
-
-// AddConnection adds a connection to the note
-func (n *Note) AddConnection(noteID uuid.UUID, connectionType ConnectionType) error {
-	// Prevent duplicate connections
-	noteIDStr := noteID.String()
-	for _, existingID := range n.ConnectedNoteIDs {
-		if existingID == noteIDStr {
-			return fmt.Errorf("note already connected")
-		}
-	}
-
-	// Limit connections to 10
-	if len(n.ConnectedNoteIDs) >= 10 {
-		return fmt.Errorf("maximum number of connections reached")
-	}
-
-	// Add connection
-	n.ConnectedNoteIDs = append(n.ConnectedNoteIDs, noteIDStr)
-	n.ConnectionTypes = append(n.ConnectionTypes, string(connectionType))
-
-	return nil
-}
-
-// GetConnections returns the connected notes and their connection types
-func (n *Note) GetConnections() []struct {
-	NoteID         uuid.UUID
-	ConnectionType ConnectionType
-} {
-	var connections []struct {
-		NoteID         uuid.UUID
-		ConnectionType ConnectionType
-	}
-
-	for i, idStr := range n.ConnectedNoteIDs {
-		noteID, err := uuid.Parse(idStr)
-		if err == nil {
-			connections = append(connections, struct {
-				NoteID         uuid.UUID
-				ConnectionType ConnectionType
-			}{
-				NoteID:         noteID,
-				ConnectionType: ConnectionType(n.ConnectionTypes[i]),
-			})
-		}
-	}
-
-	return connections
-}
-
-// RemoveConnection removes a specific connection
-func (n *Note) RemoveConnection(noteID uuid.UUID) error {
-	noteIDStr := noteID.String()
-	for i, existingID := range n.ConnectedNoteIDs {
-		if existingID == noteIDStr {
-			// Remove the connection
-			n.ConnectedNoteIDs = append(n.ConnectedNoteIDs[:i], n.ConnectedNoteIDs[i+1:]...)
-			n.ConnectionTypes = append(n.ConnectionTypes[:i], n.ConnectionTypes[i+1:]...)
-			return nil
-		}
-	}
-
-	return fmt.Errorf("connection not found")
-}
@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// StatusEvent records a note moving from one status to another. The canonical states are those
+// of the statuses at the time of the move, so later board changes do not rewrite history.
+type StatusEvent struct {
+	ID         uuid.UUID  `gorm:"type:uuid;primaryKey" json:"id"`
+	UserID     uuid.UUID  `gorm:"type:uuid;not null;index" json:"userId"`
+	NoteID     uuid.UUID  `gorm:"type:uuid;not null;index" json:"noteId"`
+	BoardID    *uuid.UUID `gorm:"type:uuid" json:"boardId,omitempty"` // Board the card was moved on; nil for /notes/kanban
+	FromStatus string     `json:"fromStatus"`
+	FromState  string     `json:"fromState"`
+	ToStatus   string     `gorm:"not null" json:"toStatus"`
+	ToState    string     `gorm:"not null" json:"toState"`
+
+	CreatedAt time.Time `gorm:"index" json:"createdAt"`
+
+	Note *Note `gorm:"foreignKey:NoteID;constraint:OnDelete:CASCADE" json:"-"`
+}
+
+func (e *StatusEvent) BeforeCreate(tx *gorm.DB) error {
+	if e.ID == uuid.Nil {
+		e.ID = uuid.New()
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+)
+
+// Template scopes
+const (
+	TemplateScopeUser      = "user"
+	TemplateScopeWorkspace = "workspace"
+)
+
+// NoteTemplate holds a reusable note structure. Title and Content may contain
+// placeholders such as {{date}}, {{user.name}} or custom prompts listed in Prompts.
+type NoteTemplate struct {
+	ID            uuid.UUID      `gorm:"type:uuid;primaryKey" json:"id"`
+	UserID        uuid.UUID      `gorm:"type:uuid;not null;index" json:"userId"`
+	Name          string         `gorm:"not null" json:"name"`
+	Scope         string         `gorm:"not null;default:'user'" json:"scope"` // "user" or "workspace"
+	Title         string         `json:"title"`
+	Content       string         `gorm:"type:text" json:"content"`
+	Categories    pq.StringArray `gorm:"type:text[]" json:"categories"`
+	DefaultStatus string         `json:"defaultStatus"`
+	Prompts       pq.StringArray `gorm:"type:text[]" json:"prompts"` // Custom variables the caller must supply
+
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+func (t *NoteTemplate) BeforeCreate(tx *gorm.DB) error {
+	if t.ID == uuid.Nil {
+		t.ID = uuid.New()
+	}
+	if t.Scope == "" {
+		t.Scope = TemplateScopeUser
+	}
+	if t.Categories == nil {
+		t.Categories = []string{}
+	}
+	if t.Prompts == nil {
+		t.Prompts = []string{}
+	}
+	return nil
+}
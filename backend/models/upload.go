@@ -0,0 +1,34 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// UploadSession tracks a resumable upload. Chunks are staged on the server's disk until the
+// upload is completed, encrypted when Sealed; Offset is how many bytes have been received.
+type UploadSession struct {
+	ID        uuid.UUID `gorm:"type:uuid;primaryKey" json:"id"`
+	UserID    uuid.UUID `gorm:"type:uuid;not null;index" json:"userId"`
+	NoteID    uuid.UUID `gorm:"type:uuid;not null" json:"noteId"`
+	FileName  string    `gorm:"not null" json:"fileName"`
+	Size      int64     `gorm:"not null" json:"size"`
+	Offset    int64     `gorm:"not null;default:0" json:"offset"`
+	Checksum  string    `json:"checksum,omitempty"` // Hex SHA-256 of the whole file, verified on completion
+	Sealed    bool      `gorm:"not null;default:false" json:"-"`
+	ExpiresAt time.Time `gorm:"not null;index" json:"expiresAt"`
+
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+
+	Note *Note `gorm:"foreignKey:NoteID;constraint:OnDelete:CASCADE" json:"-"`
+}
+
+func (u *UploadSession) BeforeCreate(tx *gorm.DB) error {
+	if u.ID == uuid.Nil {
+		u.ID = uuid.New()
+	}
+	return nil
+}
@@ -7,10 +7,14 @@ import (
 )
 
 type User struct {
-	ID        uuid.UUID `gorm:"primaryKey" json:"id"`
-	Name      string    `json:"name"`
-	Email     string    `json:"email"`
-	Password  string    `json:"-"` // "-" prevents password from being included in JSON
+	ID       uuid.UUID `gorm:"primaryKey" json:"id"`
+	Name     string    `json:"name"`
+	Email    string    `json:"email"`
+	Password string    `json:"-"` // "-" prevents password from being included in JSON
+
+	// Postgres text search configuration used to index and query this user's notes
+	SearchLanguage string `json:"searchLanguage" gorm:"default:'english'"`
+
 	CreatedAt time.Time `json:"createdAt"`
 	UpdatedAt time.Time `json:"updatedAt"`
 }
@@ -0,0 +1,171 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"NoteSense/models"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+)
+
+// maxAttachmentOffsets caps the match positions reported per attachment
+const maxAttachmentOffsets = 50
+
+// AttachmentMatch is an attached file whose extracted text matched a search
+type AttachmentMatch struct {
+	FileID   uuid.UUID
+	FileName string
+	FileType string
+	Snippet  string      // HTML-escaped, with matches wrapped in <mark>
+	Offsets  []TextRange // Matched words in the extracted text
+}
+
+// TextRange is a [Start, End) range of character (not byte) offsets
+type TextRange struct {
+	Start int
+	End   int
+}
+
+// updateAttachmentSearchVector indexes a file's extracted text with its owner's text search
+// configuration. Like note vectors, it is computed from plaintext passed in by the application
+// and blinded when the extracted text is encrypted at rest.
+func updateAttachmentSearchVector(ctx context.Context, db *gorm.DB, cipher *ContentCipher, fileID, userID uuid.UUID, text string) error {
+	config, err := userSearchConfig(ctx, db, userID)
+	if err != nil {
+		return err
+	}
+	vector, blinded, err := searchVector(ctx, db, cipher, userID, config, weightedText{text, "D"})
+	if err != nil {
+		return err
+	}
+	return db.WithContext(ctx).Exec(
+		"UPDATE file_metadata SET search_vector = ?::tsvector, search_blinded = ? WHERE id = ?",
+		vector, blinded, fileID,
+	).Error
+}
+
+// reindexAttachments recomputes the search vectors of a user's attached files. With
+// missingOnly, files that are already indexed the way encryption calls for are skipped.
+func (r *NoteRepository) reindexAttachments(ctx context.Context, userID uuid.UUID, missingOnly bool) error {
+	tx := r.db.WithContext(ctx).Where("user_id = ?", userID)
+	if missingOnly {
+		tx = tx.Where("search_vector IS NULL OR search_blinded IS DISTINCT FROM ?", r.cipher.Enabled())
+	}
+	var files []models.FileMetadata
+	if err := tx.Find(&files).Error; err != nil {
+		return err
+	}
+	for _, file := range files {
+		text, err := r.cipher.DecryptString(ctx, userID, file.ExtractedText)
+		if err != nil {
+			return fmt.Errorf("file %s: %v", file.ID, err)
+		}
+		if err := updateAttachmentSearchVector(ctx, r.db, r.cipher, file.ID, userID, text); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// matchAttachments lists, for each hit, the attached files whose extracted text matches the
+// query, with a snippet and the offsets of every matched word. textQuery matches the stored
+// vectors; snippets are highlighted from the decrypted text with the plain query.
+func (r *NoteRepository) matchAttachments(ctx context.Context, config, query string, textQuery tsQuery, hits []SearchHit, userID uuid.UUID) error {
+	noteIDs := make([]uuid.UUID, len(hits))
+	for i, hit := range hits {
+		noteIDs[i] = hit.Note.ID
+	}
+
+	var files []models.FileMetadata
+	if err := r.db.WithContext(ctx).
+		Where("user_id = ? AND note_id IN ?", userID, noteIDs).
+		Where("search_vector @@ "+textQuery.SQL, textQuery.Args...).
+		Order("created_at").
+		Find(&files).Error; err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return nil
+	}
+
+	texts := make([]string, len(files))
+	for i, file := range files {
+		text, err := r.cipher.DecryptString(ctx, userID, file.ExtractedText)
+		if err != nil {
+			return fmt.Errorf("file %s: %v", file.ID, err)
+		}
+		texts[i] = stripSentinels(text)
+	}
+
+	// HighlightAll marks every match in the full text, from which offsets are recovered
+	var headlines []struct {
+		Marked  string
+		Snippet string
+	}
+	if err := r.db.WithContext(ctx).Raw(`
+		SELECT
+			ts_headline(?::regconfig, t.doc, q.query, 'HighlightAll=true, StartSel="`+highlightStart+`", StopSel="`+highlightStop+`"') AS marked,
+			ts_headline(?::regconfig, t.doc, q.query, ?) AS snippet
+		FROM unnest(?::text[]) WITH ORDINALITY AS t(doc, ord),
+			(SELECT websearch_to_tsquery(?::regconfig, ?) AS query) q
+		ORDER BY t.ord`,
+		config, config, headlineOptions, pq.StringArray(texts), config, query,
+	).Scan(&headlines).Error; err != nil {
+		return err
+	}
+
+	byNote := make(map[uuid.UUID][]AttachmentMatch)
+	for i, file := range files {
+		if i >= len(headlines) || file.NoteID == nil {
+			continue
+		}
+		byNote[*file.NoteID] = append(byNote[*file.NoteID], AttachmentMatch{
+			FileID:   file.ID,
+			FileName: file.FileName,
+			FileType: file.FileType,
+			Snippet:  markHighlights(headlines[i].Snippet),
+			Offsets:  matchOffsets(texts[i], headlines[i].Marked),
+		})
+	}
+	for i := range hits {
+		hits[i].Attachments = byNote[hits[i].Note.ID]
+	}
+	return nil
+}
+
+// matchOffsets converts the sentinels of a HighlightAll headline into offsets into the
+// original text. It returns nil if the headline does not reproduce the text exactly.
+func matchOffsets(original, marked string) []TextRange {
+	var ranges []TextRange
+	var plain strings.Builder
+	position, start := 0, -1
+
+	for len(marked) > 0 {
+		switch {
+		case strings.HasPrefix(marked, highlightStart):
+			start = position
+			marked = marked[len(highlightStart):]
+		case strings.HasPrefix(marked, highlightStop):
+			if start >= 0 && len(ranges) < maxAttachmentOffsets {
+				ranges = append(ranges, TextRange{Start: start, End: position})
+			}
+			start = -1
+			marked = marked[len(highlightStop):]
+		default:
+			r, size := utf8.DecodeRuneInString(marked)
+			plain.WriteRune(r)
+			position++
+			marked = marked[size:]
+		}
+	}
+
+	if plain.String() != original {
+		return nil
+	}
+	return ranges
+}
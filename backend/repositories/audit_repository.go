@@ -0,0 +1,105 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"NoteSense/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// auditExportBatch is how many entries an export reads at a time
+const auditExportBatch = 500
+
+// auditSortColumns orders audit entries newest first
+var auditSortColumns = []sortColumn{
+	{expr: "created_at", desc: true, kind: kindTime},
+	{expr: "id", desc: true, kind: kindUUID},
+}
+
+// AuditRepository handles the audit log
+type AuditRepository struct {
+	db *gorm.DB
+}
+
+func NewAuditRepository(db *gorm.DB) *AuditRepository {
+	return &AuditRepository{db: db}
+}
+
+func (r *AuditRepository) Create(ctx context.Context, entry *models.AuditEntry) error {
+	return r.db.WithContext(ctx).Create(entry).Error
+}
+
+// ListForUser returns a page of the entries belonging to a user, newest first, optionally only
+// those with the given actions
+func (r *AuditRepository) ListForUser(ctx context.Context, userID uuid.UUID, actions []string, page PageRequest) ([]models.AuditEntry, string, error) {
+	tx := r.db.WithContext(ctx).Where("user_id = ?", userID)
+	if len(actions) > 0 {
+		tx = tx.Where("action IN ?", actions)
+	}
+	tx, err := paginate(tx, "audit", auditSortColumns, page)
+	if err != nil {
+		return nil, "", err
+	}
+
+	entries := []models.AuditEntry{}
+	if err := tx.Find(&entries).Error; err != nil {
+		return nil, "", err
+	}
+	if page.Limit <= 0 || len(entries) <= page.Limit {
+		return entries, "", nil
+	}
+	entries = entries[:page.Limit]
+	last := entries[len(entries)-1]
+	return entries, encodeCursor("audit", []interface{}{last.CreatedAt, last.ID}), nil
+}
+
+// Export passes every entry created in [from, to) to fn in batches, oldest first.
+// Either bound may be nil.
+func (r *AuditRepository) Export(ctx context.Context, from, to *time.Time, fn func([]models.AuditEntry) error) error {
+	tx := r.db.WithContext(ctx).Model(&models.AuditEntry{})
+	if from != nil {
+		tx = tx.Where("created_at >= ?", *from)
+	}
+	if to != nil {
+		tx = tx.Where("created_at < ?", *to)
+	}
+	var entries []models.AuditEntry
+	return tx.Order("created_at ASC").Order("id ASC").
+		FindInBatches(&entries, auditExportBatch, func(_ *gorm.DB, _ int) error {
+			return fn(entries)
+		}).Error
+}
+
+// DeleteBefore removes the entries created before cutoff and returns how many were removed
+func (r *AuditRepository) DeleteBefore(ctx context.Context, cutoff time.Time) (int64, error) {
+	result := r.db.WithContext(ctx).Where("created_at < ?", cutoff).Delete(&models.AuditEntry{})
+	return result.RowsAffected, result.Error
+}
+
+// GetSettings returns the audit settings, or nil if none were saved
+func (r *AuditRepository) GetSettings(ctx context.Context) (*models.AuditSettings, error) {
+	var settings models.AuditSettings
+	result := r.db.WithContext(ctx).First(&settings)
+	if result.Error != nil {
+		if result.Error == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, result.Error
+	}
+	return &settings, nil
+}
+
+// SaveSettings stores the audit settings
+func (r *AuditRepository) SaveSettings(ctx context.Context, settings *models.AuditSettings) error {
+	settings.ID = 1
+	return r.db.WithContext(ctx).
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"retention_days", "updated_by", "updated_at"}),
+		}).
+		Create(settings).Error
+}
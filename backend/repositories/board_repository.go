@@ -0,0 +1,142 @@
+package repositories
+
+import (
+	"context"
+
+	"NoteSense/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// BoardRepository handles Kanban board definitions
+type BoardRepository struct {
+	db *gorm.DB
+}
+
+func NewBoardRepository(db *gorm.DB) *BoardRepository {
+	return &BoardRepository{db: db}
+}
+
+// WithTx returns a copy of the repository working within tx
+func (r *BoardRepository) WithTx(tx *gorm.DB) *BoardRepository {
+	return &BoardRepository{db: tx}
+}
+
+// Create stores a board; a default board replaces the user's previous default
+func (r *BoardRepository) Create(ctx context.Context, board *models.Board) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := clearDefaultBoard(tx, board); err != nil {
+			return err
+		}
+		return tx.Create(board).Error
+	})
+}
+
+// Update saves a board; a default board replaces the user's previous default
+func (r *BoardRepository) Update(ctx context.Context, board *models.Board) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := clearDefaultBoard(tx, board); err != nil {
+			return err
+		}
+		return tx.Save(board).Error
+	})
+}
+
+func clearDefaultBoard(tx *gorm.DB, board *models.Board) error {
+	if !board.IsDefault {
+		return nil
+	}
+	return tx.Model(&models.Board{}).
+		Where("user_id = ? AND id <> ? AND is_default", board.UserID, board.ID).
+		Update("is_default", false).Error
+}
+
+func (r *BoardRepository) Delete(ctx context.Context, boardID uuid.UUID, userID uuid.UUID) error {
+	return r.db.WithContext(ctx).
+		Where("id = ? AND user_id = ?", boardID, userID).
+		Delete(&models.Board{}).Error
+}
+
+// ListByUser returns the user's boards, the default one first
+func (r *BoardRepository) ListByUser(ctx context.Context, userID uuid.UUID) ([]models.Board, error) {
+	boards := []models.Board{}
+	if err := r.db.WithContext(ctx).
+		Where("user_id = ?", userID).
+		Order("is_default DESC").
+		Order("name").
+		Find(&boards).Error; err != nil {
+		return nil, err
+	}
+	return boards, nil
+}
+
+// GetByID returns one of the user's boards, or nil if it does not exist
+func (r *BoardRepository) GetByID(ctx context.Context, boardID uuid.UUID, userID uuid.UUID) (*models.Board, error) {
+	var board models.Board
+	result := r.db.WithContext(ctx).
+		Where("id = ? AND user_id = ?", boardID, userID).
+		First(&board)
+	if result.Error != nil {
+		if result.Error == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, result.Error
+	}
+	return &board, nil
+}
+
+// GetDefault returns the user's default board, or nil if they have not chosen one
+func (r *BoardRepository) GetDefault(ctx context.Context, userID uuid.UUID) (*models.Board, error) {
+	var board models.Board
+	result := r.db.WithContext(ctx).
+		Where("user_id = ? AND is_default", userID).
+		First(&board)
+	if result.Error != nil {
+		if result.Error == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, result.Error
+	}
+	return &board, nil
+}
+
+// ClearCollectionFilter stops the user's boards from filtering by a saved search that is deleted
+func (r *BoardRepository) ClearCollectionFilter(ctx context.Context, collectionID uuid.UUID, userID uuid.UUID) error {
+	return r.db.WithContext(ctx).Model(&models.Board{}).
+		Where("user_id = ? AND filter->>'collectionId' = ?", userID, collectionID.String()).
+		UpdateColumn("filter", gorm.Expr("filter - 'collectionId'")).Error
+}
+
+// CardPositions returns the manual positions of the cards placed on a board
+func (r *BoardRepository) CardPositions(ctx context.Context, boardID uuid.UUID) (map[uuid.UUID]int, error) {
+	var cards []models.BoardCard
+	if err := r.db.WithContext(ctx).
+		Where("board_id = ?", boardID).
+		Find(&cards).Error; err != nil {
+		return nil, err
+	}
+	positions := make(map[uuid.UUID]int, len(cards))
+	for _, card := range cards {
+		positions[card.NoteID] = card.Position
+	}
+	return positions, nil
+}
+
+// SetCardPositions numbers the given notes in order as the cards of one board column
+func (r *BoardRepository) SetCardPositions(ctx context.Context, boardID uuid.UUID, noteIDs []uuid.UUID) error {
+	if len(noteIDs) == 0 {
+		return nil
+	}
+	cards := make([]models.BoardCard, 0, len(noteIDs))
+	for index, id := range noteIDs {
+		cards = append(cards, models.BoardCard{BoardID: boardID, NoteID: id, Position: index})
+	}
+	return r.db.WithContext(ctx).
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "board_id"}, {Name: "note_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"position", "updated_at"}),
+		}).
+		Create(&cards).Error
+}
@@ -0,0 +1,62 @@
+package repositories
+
+import (
+	"context"
+
+	"NoteSense/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// CollectionRepository handles saved searches
+type CollectionRepository struct {
+	db *gorm.DB
+}
+
+func NewCollectionRepository(db *gorm.DB) *CollectionRepository {
+	return &CollectionRepository{db: db}
+}
+
+func (r *CollectionRepository) Create(ctx context.Context, search *models.SavedSearch) error {
+	return r.db.WithContext(ctx).Create(search).Error
+}
+
+func (r *CollectionRepository) Update(ctx context.Context, search *models.SavedSearch) error {
+	return r.db.WithContext(ctx).Save(search).Error
+}
+
+func (r *CollectionRepository) Delete(ctx context.Context, searchID uuid.UUID, userID uuid.UUID) error {
+	return r.db.WithContext(ctx).
+		Where("id = ? AND user_id = ?", searchID, userID).
+		Delete(&models.SavedSearch{}).Error
+}
+
+// ListByUser returns the user's saved searches, pinned ones first in their sidebar order
+func (r *CollectionRepository) ListByUser(ctx context.Context, userID uuid.UUID) ([]models.SavedSearch, error) {
+	var searches []models.SavedSearch
+	if err := r.db.WithContext(ctx).
+		Where("user_id = ?", userID).
+		Order("pinned DESC").
+		Order("position ASC").
+		Order("name").
+		Find(&searches).Error; err != nil {
+		return nil, err
+	}
+	return searches, nil
+}
+
+// GetByID returns one of the user's saved searches, or nil if it does not exist
+func (r *CollectionRepository) GetByID(ctx context.Context, searchID uuid.UUID, userID uuid.UUID) (*models.SavedSearch, error) {
+	var search models.SavedSearch
+	result := r.db.WithContext(ctx).
+		Where("id = ? AND user_id = ?", searchID, userID).
+		First(&search)
+	if result.Error != nil {
+		if result.Error == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, result.Error
+	}
+	return &search, nil
+}
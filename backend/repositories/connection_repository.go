@@ -0,0 +1,159 @@
+package repositories
+
+import (
+	"context"
+	"log"
+
+	"NoteSense/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ConnectionRepository handles the edges between notes
+type ConnectionRepository struct {
+	db *gorm.DB
+}
+
+func NewConnectionRepository(db *gorm.DB) *ConnectionRepository {
+	return &ConnectionRepository{db: db}
+}
+
+// WithTx returns a copy of the repository working within tx
+func (r *ConnectionRepository) WithTx(tx *gorm.DB) *ConnectionRepository {
+	return &ConnectionRepository{db: tx}
+}
+
+func (r *ConnectionRepository) Create(ctx context.Context, connection *models.NoteConnection) error {
+	return r.db.WithContext(ctx).Create(connection).Error
+}
+
+func (r *ConnectionRepository) Update(ctx context.Context, connection *models.NoteConnection) error {
+	return r.db.WithContext(ctx).Save(connection).Error
+}
+
+func (r *ConnectionRepository) Delete(ctx context.Context, connectionID uuid.UUID, userID uuid.UUID) error {
+	return r.db.WithContext(ctx).
+		Where("id = ? AND user_id = ?", connectionID, userID).
+		Delete(&models.NoteConnection{}).Error
+}
+
+// GetByID returns one of the user's connections, or nil if it does not exist
+func (r *ConnectionRepository) GetByID(ctx context.Context, connectionID uuid.UUID, userID uuid.UUID) (*models.NoteConnection, error) {
+	var connection models.NoteConnection
+	result := r.db.WithContext(ctx).
+		Where("id = ? AND user_id = ?", connectionID, userID).
+		First(&connection)
+	if result.Error != nil {
+		if result.Error == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, result.Error
+	}
+	return &connection, nil
+}
+
+// ListForNote returns the connections that start or end at a note, oldest first
+func (r *ConnectionRepository) ListForNote(ctx context.Context, noteID uuid.UUID, userID uuid.UUID) ([]models.NoteConnection, error) {
+	var connections []models.NoteConnection
+	if err := r.db.WithContext(ctx).
+		Where("user_id = ? AND (source_id = ? OR target_id = ?)", userID, noteID, noteID).
+		Order("created_at ASC").
+		Find(&connections).Error; err != nil {
+		return nil, err
+	}
+	return connections, nil
+}
+
+// ListAmong returns the connections whose ends are both among noteIDs
+func (r *ConnectionRepository) ListAmong(ctx context.Context, noteIDs []uuid.UUID, userID uuid.UUID) ([]models.NoteConnection, error) {
+	connections := []models.NoteConnection{}
+	if len(noteIDs) == 0 {
+		return connections, nil
+	}
+	if err := r.db.WithContext(ctx).
+		Where("user_id = ? AND source_id IN ? AND target_id IN ?", userID, noteIDs, noteIDs).
+		Order("created_at ASC").
+		Find(&connections).Error; err != nil {
+		return nil, err
+	}
+	return connections, nil
+}
+
+// ListFrom returns the connections that start at any of noteIDs
+func (r *ConnectionRepository) ListFrom(ctx context.Context, noteIDs []uuid.UUID, userID uuid.UUID) ([]models.NoteConnection, error) {
+	connections := []models.NoteConnection{}
+	if len(noteIDs) == 0 {
+		return connections, nil
+	}
+	if err := r.db.WithContext(ctx).
+		Where("user_id = ? AND source_id IN ?", userID, noteIDs).
+		Order("created_at ASC").
+		Find(&connections).Error; err != nil {
+		return nil, err
+	}
+	return connections, nil
+}
+
+// Exists reports whether a connection of the given type already links the two notes.
+// Undirected connections match in either direction.
+func (r *ConnectionRepository) Exists(ctx context.Context, sourceID, targetID uuid.UUID, connectionType models.ConnectionType, userID uuid.UUID) (bool, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&models.NoteConnection{}).
+		Where("user_id = ? AND type = ?", userID, connectionType).
+		Where("(source_id = ? AND target_id = ?) OR (source_id = ? AND target_id = ? AND NOT directed)",
+			sourceID, targetID, targetID, sourceID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// DeleteBetween removes the connections from noteID to otherID, including undirected ones
+// stored the other way round, and returns how many were removed
+func (r *ConnectionRepository) DeleteBetween(ctx context.Context, noteID, otherID uuid.UUID, userID uuid.UUID) (int64, error) {
+	result := r.db.WithContext(ctx).
+		Where("user_id = ?", userID).
+		Where("(source_id = ? AND target_id = ?) OR (source_id = ? AND target_id = ? AND NOT directed)",
+			noteID, otherID, otherID, noteID).
+		Delete(&models.NoteConnection{})
+	return result.RowsAffected, result.Error
+}
+
+// MigrateLegacyConnections moves the connections stored as parallel arrays on notes into
+// the edge table and drops the arrays. Links to missing or foreign notes are discarded.
+// Each edge is directed as its type is: undirected built-in types such as related come
+// over undirected, and a link stored from both ends is kept once.
+func (r *ConnectionRepository) MigrateLegacyConnections(ctx context.Context) error {
+	if !r.db.Migrator().HasColumn(&models.Note{}, "connected_note_ids") {
+		return nil
+	}
+
+	undirected := []models.ConnectionType{}
+	for _, definition := range models.BuiltinConnectionTypes {
+		if !definition.Directed {
+			undirected = append(undirected, definition.Name)
+		}
+	}
+
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Exec(`INSERT INTO note_connections (id, user_id, source_id, target_id, type, directed, weight, created_at)
+			SELECT gen_random_uuid(), n.user_id, n.id, t.id, e.type, e.type NOT IN ?, 1, n.updated_at
+			FROM notes n
+			CROSS JOIN LATERAL unnest(n.connected_note_ids, COALESCE(n.connection_types, '{}')) AS c(target_id, type)
+			CROSS JOIN LATERAL (SELECT COALESCE(NULLIF(c.type, ''), ?) AS type) e
+			JOIN notes t ON t.id = c.target_id AND t.user_id = n.user_id AND t.id <> n.id
+			ON CONFLICT DO NOTHING`, undirected, models.RelatedConnection)
+		if result.Error != nil {
+			return result.Error
+		}
+		log.Printf("Migrated %d note connections into the edge table", result.RowsAffected)
+
+		// An undirected link stored on both notes would otherwise appear twice
+		if err := tx.Exec(`DELETE FROM note_connections a USING note_connections b
+			WHERE NOT a.directed AND NOT b.directed AND a.user_id = b.user_id AND a.type = b.type
+				AND a.source_id = b.target_id AND a.target_id = b.source_id AND a.source_id > a.target_id`).Error; err != nil {
+			return err
+		}
+
+		return tx.Exec(`ALTER TABLE notes DROP COLUMN connected_note_ids, DROP COLUMN IF EXISTS connection_types`).Error
+	})
+}
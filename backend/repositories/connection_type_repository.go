@@ -0,0 +1,101 @@
+package repositories
+
+import (
+	"context"
+
+	"NoteSense/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ConnectionTypeRepository handles user-defined connection types
+type ConnectionTypeRepository struct {
+	db *gorm.DB
+}
+
+func NewConnectionTypeRepository(db *gorm.DB) *ConnectionTypeRepository {
+	return &ConnectionTypeRepository{db: db}
+}
+
+func (r *ConnectionTypeRepository) Create(ctx context.Context, definition *models.ConnectionTypeDefinition) error {
+	return r.db.WithContext(ctx).Create(definition).Error
+}
+
+func (r *ConnectionTypeRepository) Delete(ctx context.Context, definitionID uuid.UUID, userID uuid.UUID) error {
+	return r.db.WithContext(ctx).
+		Where("id = ? AND user_id = ?", definitionID, userID).
+		Delete(&models.ConnectionTypeDefinition{}).Error
+}
+
+// Update saves a definition and, when its direction changed, applies the new direction to the
+// connections of that type it governs
+func (r *ConnectionTypeRepository) Update(ctx context.Context, definition *models.ConnectionTypeDefinition, directionChanged bool) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(definition).Error; err != nil {
+			return err
+		}
+		if !directionChanged {
+			return nil
+		}
+		return connectionsOfType(tx, definition).Update("directed", definition.Directed).Error
+	})
+}
+
+// ListVisible returns the user's own connection types plus the workspace types of the admins
+// listed in adminEmails, by name
+func (r *ConnectionTypeRepository) ListVisible(ctx context.Context, userID uuid.UUID, adminEmails []string) ([]models.ConnectionTypeDefinition, error) {
+	var definitions []models.ConnectionTypeDefinition
+	if err := r.visible(ctx, userID, adminEmails).
+		Order("name").
+		Find(&definitions).Error; err != nil {
+		return nil, err
+	}
+	return definitions, nil
+}
+
+// GetVisibleByID returns a connection type the user owns or that an admin shared with the
+// workspace, or nil if there is none
+func (r *ConnectionTypeRepository) GetVisibleByID(ctx context.Context, definitionID uuid.UUID, userID uuid.UUID, adminEmails []string) (*models.ConnectionTypeDefinition, error) {
+	var definition models.ConnectionTypeDefinition
+	result := r.visible(ctx, userID, adminEmails).
+		Where("id = ?", definitionID).
+		First(&definition)
+	if result.Error != nil {
+		if result.Error == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, result.Error
+	}
+	return &definition, nil
+}
+
+// visible selects the connection types a user may see. As with templates, a workspace type is
+// only shared while its owner is an admin.
+func (r *ConnectionTypeRepository) visible(ctx context.Context, userID uuid.UUID, adminEmails []string) *gorm.DB {
+	query := r.db.WithContext(ctx)
+	if len(adminEmails) == 0 {
+		return query.Where("user_id = ?", userID)
+	}
+	return query.Where("user_id = ? OR (scope = ? AND user_id IN (SELECT id FROM users WHERE lower(email) IN ?))",
+		userID, models.ConnectionTypeScopeWorkspace, adminEmails)
+}
+
+// CountUsage returns how many connections use a definition's type
+func (r *ConnectionTypeRepository) CountUsage(ctx context.Context, definition *models.ConnectionTypeDefinition) (int64, error) {
+	var count int64
+	err := connectionsOfType(r.db.WithContext(ctx), definition).Count(&count).Error
+	return count, err
+}
+
+// connectionsOfType selects the connections a definition governs: its owner's connections of
+// that type and, for a workspace type, those of every user without a type of that name of
+// their own, which would hide it
+func connectionsOfType(db *gorm.DB, definition *models.ConnectionTypeDefinition) *gorm.DB {
+	query := db.Model(&models.NoteConnection{})
+	if definition.Scope != models.ConnectionTypeScopeWorkspace {
+		return query.Where("user_id = ? AND type = ?", definition.UserID, definition.Name)
+	}
+	return query.Where("type = ? AND (user_id = ? OR user_id NOT IN (SELECT user_id FROM connection_type_definitions WHERE name = ?))",
+		definition.Name, definition.UserID, definition.Name)
+}
@@ -0,0 +1,287 @@
+package repositories
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"NoteSense/encryption"
+	"NoteSense/models"
+
+	"github.com/google/uuid"
+)
+
+// encryptedPrefix marks text columns that hold at-rest ciphertext. Values without it are
+// treated as plaintext, so rows written before encryption was enabled stay readable.
+const encryptedPrefix = "enc:v1:"
+
+// encryptedStreamMagic marks stored files sealed in segments by encryption.NewEncryptingReader
+var encryptedStreamMagic = []byte("NSENC2\n")
+
+// ContentCipher transparently encrypts note content, extracted text and stored files
+// with per-user data keys wrapped by the master key. A nil master key disables it.
+type ContentCipher struct {
+	masterKey   *encryption.MasterKey
+	dataKeyRepo *DataKeyRepository
+
+	mu      sync.Mutex
+	cache   map[uuid.UUID][]byte
+	loading map[uuid.UUID]*sync.Mutex // Held while a user's data key is loaded
+}
+
+func NewContentCipher(masterKey *encryption.MasterKey, dataKeyRepo *DataKeyRepository) *ContentCipher {
+	return &ContentCipher{
+		masterKey:   masterKey,
+		dataKeyRepo: dataKeyRepo,
+		cache:       make(map[uuid.UUID][]byte),
+		loading:     make(map[uuid.UUID]*sync.Mutex),
+	}
+}
+
+// Enabled reports whether at-rest encryption is configured
+func (c *ContentCipher) Enabled() bool {
+	return c != nil && c.masterKey != nil
+}
+
+// EncryptString encrypts a text value for storage
+func (c *ContentCipher) EncryptString(ctx context.Context, userID uuid.UUID, plaintext string) (string, error) {
+	if !c.Enabled() || plaintext == "" {
+		return plaintext, nil
+	}
+	key, err := c.dataKey(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := encryption.Seal(key, []byte(plaintext))
+	if err != nil {
+		return "", err
+	}
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// DecryptString decrypts a stored text value; plaintext values are returned unchanged
+func (c *ContentCipher) DecryptString(ctx context.Context, userID uuid.UUID, stored string) (string, error) {
+	if !strings.HasPrefix(stored, encryptedPrefix) {
+		return stored, nil
+	}
+	if !c.Enabled() {
+		return "", fmt.Errorf("encrypted content found but no master key is configured")
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(stored, encryptedPrefix))
+	if err != nil {
+		return "", fmt.Errorf("malformed encrypted content: %v", err)
+	}
+	key, err := c.dataKey(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := encryption.Open(key, sealed)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt content: %v", err)
+	}
+	return string(plaintext), nil
+}
+
+// EncryptFile returns a reader of file contents as they are stored, encrypted as they are read
+func (c *ContentCipher) EncryptFile(ctx context.Context, userID uuid.UUID, r io.Reader) (io.Reader, error) {
+	if !c.Enabled() {
+		return r, nil
+	}
+	key, err := c.dataKey(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := encryption.NewEncryptingReader(key, r)
+	if err != nil {
+		return nil, err
+	}
+	return io.MultiReader(bytes.NewReader(encryptedStreamMagic), sealed), nil
+}
+
+// OpenFile returns a reader of the decrypted contents of a stored file, decrypted a segment at
+// a time as it is read. Unencrypted files are read as they are.
+func (c *ContentCipher) OpenFile(ctx context.Context, userID uuid.UUID, stored io.ReadSeeker) (io.ReadSeeker, error) {
+	sealed, err := isStreamSealed(stored)
+	if err != nil {
+		return nil, err
+	}
+	if !sealed {
+		if _, err := stored.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		return stored, nil
+	}
+	if !c.Enabled() {
+		return nil, fmt.Errorf("encrypted file found but no master key is configured")
+	}
+	key, err := c.dataKey(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return encryption.NewDecryptingReader(key, stored)
+}
+
+// isStreamSealed reports whether a stored file is sealed in segments, as files are stored now
+func isStreamSealed(stored io.Reader) (bool, error) {
+	magic := make([]byte, len(encryptedStreamMagic))
+	n, err := io.ReadFull(stored, magic)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return false, err
+	}
+	return bytes.Equal(magic[:n], encryptedStreamMagic), nil
+}
+
+// SealStaging returns a writer that encrypts the bytes of a resumable upload onto its staging
+// file in frames, so the file can be appended to and cut back at frame boundaries. offset is how
+// many bytes the file already holds. Closing it seals the bytes buffered since the last full frame.
+func (c *ContentCipher) SealStaging(ctx context.Context, userID uuid.UUID, w io.Writer, offset int64) (io.WriteCloser, error) {
+	if !c.Enabled() {
+		return nil, fmt.Errorf("at-rest encryption is not enabled")
+	}
+	key, err := c.dataKey(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return encryption.NewFrameWriter(key, w, offset)
+}
+
+// OpenStaging returns a reader of the bytes SealStaging encrypted onto a staging file
+func (c *ContentCipher) OpenStaging(ctx context.Context, userID uuid.UUID, r io.Reader) (io.Reader, error) {
+	if !c.Enabled() {
+		return nil, fmt.Errorf("encrypted upload found but no master key is configured")
+	}
+	key, err := c.dataKey(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return encryption.NewFrameReader(key, r)
+}
+
+// SearchKey returns the user's key for blinding search index terms, derived from their data key
+func (c *ContentCipher) SearchKey(ctx context.Context, userID uuid.UUID) ([]byte, error) {
+	if !c.Enabled() {
+		return nil, fmt.Errorf("at-rest encryption is not enabled")
+	}
+	key, err := c.dataKey(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("notesense search index"))
+	return mac.Sum(nil), nil
+}
+
+// Fingerprint returns a hash of a text for recognizing it unchanged. With encryption enabled it
+// is keyed by the user's data key, so it cannot be used to confirm a guess of the text.
+func (c *ContentCipher) Fingerprint(ctx context.Context, userID uuid.UUID, text string) (string, error) {
+	if !c.Enabled() {
+		sum := sha256.Sum256([]byte(text))
+		return hex.EncodeToString(sum[:]), nil
+	}
+	key, err := c.dataKey(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	derived := hmac.New(sha256.New, key)
+	derived.Write([]byte("notesense fingerprint"))
+	mac := hmac.New(sha256.New, derived.Sum(nil))
+	mac.Write([]byte(text))
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// SealNote encrypts the note's content in place and returns a func restoring the plaintext
+func (c *ContentCipher) SealNote(ctx context.Context, note *models.Note) (func(), error) {
+	plaintext := note.Content
+	sealed, err := c.EncryptString(ctx, note.UserID, plaintext)
+	if err != nil {
+		return nil, err
+	}
+	note.Content = sealed
+	return func() { note.Content = plaintext }, nil
+}
+
+// OpenNotes decrypts the content of each note in place
+func (c *ContentCipher) OpenNotes(ctx context.Context, notes []models.Note) error {
+	for i := range notes {
+		content, err := c.DecryptString(ctx, notes[i].UserID, notes[i].Content)
+		if err != nil {
+			return fmt.Errorf("note %s: %v", notes[i].ID, err)
+		}
+		notes[i].Content = content
+	}
+	return nil
+}
+
+// dataKey returns the user's unwrapped data key, creating one on first use. A key is loaded
+// under a lock of its user's, so concurrent first uses load it once without holding up other
+// users behind the database.
+func (c *ContentCipher) dataKey(ctx context.Context, userID uuid.UUID) ([]byte, error) {
+	c.mu.Lock()
+	key, ok := c.cache[userID]
+	lock := c.loading[userID]
+	if !ok && lock == nil {
+		lock = &sync.Mutex{}
+		c.loading[userID] = lock
+	}
+	c.mu.Unlock()
+	if ok {
+		return key, nil
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	c.mu.Lock()
+	key, ok = c.cache[userID]
+	c.mu.Unlock()
+	if ok {
+		return key, nil
+	}
+
+	key, err := c.loadDataKey(ctx, userID)
+	c.mu.Lock()
+	if err == nil {
+		c.cache[userID] = key
+	}
+	delete(c.loading, userID)
+	c.mu.Unlock()
+	return key, err
+}
+
+// loadDataKey reads and unwraps the user's data key, storing a new one if they have none
+func (c *ContentCipher) loadDataKey(ctx context.Context, userID uuid.UUID) ([]byte, error) {
+	stored, err := c.dataKeyRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load data key: %v", err)
+	}
+
+	if stored == nil {
+		key, err := encryption.NewDataKey()
+		if err != nil {
+			return nil, err
+		}
+		wrapped, err := c.masterKey.Wrap(key)
+		if err != nil {
+			return nil, err
+		}
+		stored, err = c.dataKeyRepo.CreateIfMissing(ctx, &models.UserDataKey{
+			UserID:      userID,
+			WrappedKey:  wrapped,
+			MasterKeyID: c.masterKey.ID,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to store data key: %v", err)
+		}
+	}
+
+	if stored.MasterKeyID != c.masterKey.ID {
+		return nil, fmt.Errorf("data key for user %s is wrapped by master key %s; run key rotation", userID, stored.MasterKeyID)
+	}
+	return c.masterKey.Unwrap(stored.WrappedKey)
+}
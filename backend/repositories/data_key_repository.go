@@ -0,0 +1,92 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"NoteSense/encryption"
+	"NoteSense/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DataKeyRepository handles wrapped per-user data keys
+type DataKeyRepository struct {
+	db *gorm.DB
+}
+
+func NewDataKeyRepository(db *gorm.DB) *DataKeyRepository {
+	return &DataKeyRepository{db: db}
+}
+
+// GetByUserID returns the user's wrapped data key, or nil if none exists yet
+func (r *DataKeyRepository) GetByUserID(ctx context.Context, userID uuid.UUID) (*models.UserDataKey, error) {
+	var key models.UserDataKey
+	result := r.db.WithContext(ctx).Where("user_id = ?", userID).First(&key)
+	if result.Error != nil {
+		if result.Error == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, result.Error
+	}
+	return &key, nil
+}
+
+// CreateIfMissing stores a new wrapped key unless another request created one first,
+// and returns whichever key ended up persisted
+func (r *DataKeyRepository) CreateIfMissing(ctx context.Context, key *models.UserDataKey) (*models.UserDataKey, error) {
+	if err := r.db.WithContext(ctx).
+		Clauses(clause.OnConflict{Columns: []clause.Column{{Name: "user_id"}}, DoNothing: true}).
+		Create(key).Error; err != nil {
+		return nil, err
+	}
+	return r.GetByUserID(ctx, key.UserID)
+}
+
+// RewrapAll re-wraps every data key from oldKey to newKey in a single transaction.
+// Keys already wrapped by newKey are skipped, so an interrupted rotation can be re-run.
+func (r *DataKeyRepository) RewrapAll(ctx context.Context, oldKey, newKey *encryption.MasterKey) (int, error) {
+	rotated := 0
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var keys []models.UserDataKey
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("master_key_id <> ?", newKey.ID).
+			Find(&keys).Error; err != nil {
+			return err
+		}
+
+		now := time.Now()
+		for _, key := range keys {
+			if key.MasterKeyID != oldKey.ID {
+				return fmt.Errorf("data key for user %s is wrapped by unknown master key %s", key.UserID, key.MasterKeyID)
+			}
+			dataKey, err := oldKey.Unwrap(key.WrappedKey)
+			if err != nil {
+				return fmt.Errorf("user %s: %v", key.UserID, err)
+			}
+			wrapped, err := newKey.Wrap(dataKey)
+			if err != nil {
+				return fmt.Errorf("user %s: %v", key.UserID, err)
+			}
+
+			if err := tx.Model(&models.UserDataKey{}).
+				Where("id = ?", key.ID).
+				Updates(map[string]interface{}{
+					"wrapped_key":   wrapped,
+					"master_key_id": newKey.ID,
+					"rotated_at":    now,
+				}).Error; err != nil {
+				return err
+			}
+			rotated++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return rotated, nil
+}
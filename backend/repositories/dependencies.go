@@ -0,0 +1,55 @@
+package repositories
+
+import (
+	"context"
+
+	"NoteSense/models"
+
+	"github.com/google/uuid"
+)
+
+// A note depends on the targets of its depends_on connections, and cannot be started
+// or finished while any of them is unfinished.
+
+// UnfinishedDependencies returns the notes a note directly depends on whose status is none of doneStatuses
+func (r *ConnectionRepository) UnfinishedDependencies(ctx context.Context, noteID uuid.UUID, doneStatuses []string, userID uuid.UUID) ([]models.Note, error) {
+	notes := []models.Note{}
+	err := r.db.WithContext(ctx).
+		Table("notes AS n").
+		Select("n.id", "n.title", "n.emoji", "n.status").
+		Joins("JOIN note_connections c ON c.target_id = n.id").
+		Where("c.user_id = ? AND c.source_id = ? AND c.type = ? AND c.directed", userID, noteID, models.DependsOnConnection).
+		Where("LOWER(TRIM(n.status)) NOT IN ?", doneStatuses).
+		Order("n.created_at ASC").
+		Find(&notes).Error
+	if err != nil {
+		return nil, err
+	}
+	return notes, nil
+}
+
+// DependsOn reports whether a note depends on another, directly or through other notes
+func (r *ConnectionRepository) DependsOn(ctx context.Context, noteID, dependencyID uuid.UUID, userID uuid.UUID) (bool, error) {
+	var found bool
+	err := r.db.WithContext(ctx).Raw(`WITH RECURSIVE reachable(id) AS (
+			SELECT ?::uuid
+			UNION
+			SELECT c.target_id FROM note_connections c JOIN reachable r ON c.source_id = r.id
+			WHERE c.user_id = ? AND c.type = ? AND c.directed
+		)
+		SELECT EXISTS (SELECT 1 FROM reachable WHERE id = ?)`,
+		noteID, userID, models.DependsOnConnection, dependencyID).Scan(&found).Error
+	return found, err
+}
+
+// DependencyEdges returns all the user's depends_on connections
+func (r *ConnectionRepository) DependencyEdges(ctx context.Context, userID uuid.UUID) ([]models.NoteConnection, error) {
+	edges := []models.NoteConnection{}
+	if err := r.db.WithContext(ctx).
+		Where("user_id = ? AND type = ? AND directed", userID, models.DependsOnConnection).
+		Order("created_at ASC").
+		Find(&edges).Error; err != nil {
+		return nil, err
+	}
+	return edges, nil
+}
@@ -0,0 +1,149 @@
+package repositories
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math"
+
+	"NoteSense/models"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// EmbeddingRepository handles stored note embeddings. Vectors are sealed with the owner's data
+// key when at-rest encryption is enabled; the caller always sees them in the clear.
+type EmbeddingRepository struct {
+	db     *gorm.DB
+	cipher *ContentCipher
+}
+
+func NewEmbeddingRepository(db *gorm.DB, cipher *ContentCipher) *EmbeddingRepository {
+	return &EmbeddingRepository{db: db, cipher: cipher}
+}
+
+// Fingerprint returns the hash of an embedded text stored as an embedding's ContentHash
+func (r *EmbeddingRepository) Fingerprint(ctx context.Context, userID uuid.UUID, model, text string) (string, error) {
+	return r.cipher.Fingerprint(ctx, userID, model+"\x00"+text)
+}
+
+// NoteRef identifies a note together with its owner
+type NoteRef struct {
+	ID     uuid.UUID
+	UserID uuid.UUID
+}
+
+// Get returns a note's embedding, or nil if it has not been embedded since encryption was
+// last switched on or off
+func (r *EmbeddingRepository) Get(ctx context.Context, noteID uuid.UUID) (*models.NoteEmbedding, error) {
+	var embedding models.NoteEmbedding
+	result := r.current(ctx).Where("note_id = ?", noteID).First(&embedding)
+	if result.Error != nil {
+		if result.Error == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, result.Error
+	}
+	if err := r.open(ctx, &embedding); err != nil {
+		return nil, err
+	}
+	return &embedding, nil
+}
+
+// Upsert stores a note's embedding, replacing any previous one
+func (r *EmbeddingRepository) Upsert(ctx context.Context, embedding *models.NoteEmbedding) error {
+	stored := *embedding
+	if r.cipher.Enabled() {
+		sealed, err := r.cipher.EncryptString(ctx, embedding.UserID, encodeVector(embedding.Vector))
+		if err != nil {
+			return err
+		}
+		stored.Vector = pq.Float32Array{}
+		stored.SealedVector = sealed
+	}
+	return r.db.WithContext(ctx).
+		Clauses(clause.OnConflict{Columns: []clause.Column{{Name: "note_id"}}, UpdateAll: true}).
+		Create(&stored).Error
+}
+
+// Delete removes a note's embedding
+func (r *EmbeddingRepository) Delete(ctx context.Context, noteID uuid.UUID) error {
+	return r.db.WithContext(ctx).Where("note_id = ?", noteID).Delete(&models.NoteEmbedding{}).Error
+}
+
+// ListByUser returns the user's embeddings produced by the given model
+func (r *EmbeddingRepository) ListByUser(ctx context.Context, userID uuid.UUID, model string) ([]models.NoteEmbedding, error) {
+	var embeddings []models.NoteEmbedding
+	if err := r.current(ctx).
+		Where("user_id = ? AND model = ?", userID, model).
+		Find(&embeddings).Error; err != nil {
+		return nil, err
+	}
+	for i := range embeddings {
+		if err := r.open(ctx, &embeddings[i]); err != nil {
+			return nil, err
+		}
+	}
+	return embeddings, nil
+}
+
+// MissingNotes lists unlocked notes without an embedding from the given model, counting those
+// stored while encryption was switched the other way as missing
+func (r *EmbeddingRepository) MissingNotes(ctx context.Context, model string) ([]NoteRef, error) {
+	var refs []NoteRef
+	if err := r.db.WithContext(ctx).Table("notes").
+		Select("notes.id, notes.user_id").
+		Joins("LEFT JOIN note_embeddings e ON e.note_id = notes.id AND e.model = ? AND (e.sealed_vector <> '') = ?", model, r.cipher.Enabled()).
+		Where("e.note_id IS NULL AND NOT notes.encrypted").
+		Scan(&refs).Error; err != nil {
+		return nil, err
+	}
+	return refs, nil
+}
+
+// current selects the embeddings stored the way encryption is configured now. The others are
+// re-embedded in the background and overwritten.
+func (r *EmbeddingRepository) current(ctx context.Context) *gorm.DB {
+	return r.db.WithContext(ctx).Where("(sealed_vector <> '') = ?", r.cipher.Enabled())
+}
+
+// open decrypts a sealed embedding's vector in place
+func (r *EmbeddingRepository) open(ctx context.Context, embedding *models.NoteEmbedding) error {
+	if embedding.SealedVector == "" {
+		return nil
+	}
+	encoded, err := r.cipher.DecryptString(ctx, embedding.UserID, embedding.SealedVector)
+	if err != nil {
+		return fmt.Errorf("embedding of note %s: %v", embedding.NoteID, err)
+	}
+	vector, err := decodeVector(encoded)
+	if err != nil {
+		return fmt.Errorf("embedding of note %s: %v", embedding.NoteID, err)
+	}
+	embedding.Vector = vector
+	embedding.SealedVector = ""
+	return nil
+}
+
+// encodeVector packs a vector into little-endian float32s for sealing
+func encodeVector(vector []float32) string {
+	encoded := make([]byte, 4*len(vector))
+	for i, v := range vector {
+		binary.LittleEndian.PutUint32(encoded[4*i:], math.Float32bits(v))
+	}
+	return string(encoded)
+}
+
+func decodeVector(encoded string) ([]float32, error) {
+	if len(encoded)%4 != 0 {
+		return nil, fmt.Errorf("invalid vector encoding")
+	}
+	vector := make([]float32, len(encoded)/4)
+	for i := range vector {
+		vector[i] = math.Float32frombits(binary.LittleEndian.Uint32([]byte(encoded[4*i : 4*i+4])))
+	}
+	return vector, nil
+}
@@ -1,19 +1,432 @@
 package repositories
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
 	"NoteSense/models"
+	"NoteSense/storage"
 
+	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
 type FileMetadataRepository struct {
-	db *gorm.DB
+	db     *gorm.DB
+	cipher *ContentCipher
+}
+
+func NewFileMetadataRepository(db *gorm.DB, cipher *ContentCipher) *FileMetadataRepository {
+	return &FileMetadataRepository{db: db, cipher: cipher}
+}
+
+// ErrBlobMissing is returned when saving a file whose blob is no longer in the store
+var ErrBlobMissing = errors.New("blob missing from the store")
+
+// Create saves a file's metadata once its blob is in the store. Under the blob's lock the blob
+// is checked to still be there: deleting the last other file with the same bytes may have
+// removed it after it was stored. ErrBlobMissing is returned then, and the caller stores the
+// file again.
+func (r *FileMetadataRepository) Create(ctx context.Context, metadata *models.FileMetadata, store storage.BlobStore) error {
+	// Extracted text is encrypted at rest; the caller keeps seeing plaintext
+	plaintext := metadata.ExtractedText
+	sealed, err := r.cipher.EncryptString(ctx, metadata.UserID, plaintext)
+	if err != nil {
+		return err
+	}
+	metadata.ExtractedText = sealed
+	defer func() { metadata.ExtractedText = plaintext }()
+
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := lockBlob(tx, metadata.StorageKey); err != nil {
+			return err
+		}
+		blob, err := store.Open(ctx, metadata.StorageKey)
+		if err == storage.ErrNotFound {
+			return ErrBlobMissing
+		}
+		if err != nil {
+			return err
+		}
+		blob.Close()
+
+		if err := tx.Create(metadata).Error; err != nil {
+			return err
+		}
+		return updateAttachmentSearchVector(ctx, tx, r.cipher, metadata.ID, metadata.UserID, plaintext)
+	})
+}
+
+// ListByNote returns the files attached to a note, oldest first, without their extracted text
+func (r *FileMetadataRepository) ListByNote(ctx context.Context, noteID, userID uuid.UUID) ([]models.FileMetadata, error) {
+	var files []models.FileMetadata
+	err := r.db.WithContext(ctx).
+		Omit("extracted_text").
+		Where("note_id = ? AND user_id = ?", noteID, userID).
+		Order("created_at ASC").
+		Find(&files).Error
+	return files, err
+}
+
+// GetByID returns one of the user's files with its extracted text, or nil if it does not exist
+func (r *FileMetadataRepository) GetByID(ctx context.Context, fileID, userID uuid.UUID) (*models.FileMetadata, error) {
+	var file models.FileMetadata
+	result := r.db.WithContext(ctx).Where("id = ? AND user_id = ?", fileID, userID).First(&file)
+	if result.Error != nil {
+		if result.Error == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, result.Error
+	}
+	text, err := r.cipher.DecryptString(ctx, userID, file.ExtractedText)
+	if err != nil {
+		return nil, err
+	}
+	file.ExtractedText = text
+	return &file, nil
+}
+
+// Delete removes a file's metadata for good, and its blob unless other files have the same
+// bytes. The blob's lock is held throughout, so a file saved with the same bytes meanwhile
+// either counts as a reference or finds the blob gone and stores it again.
+func (r *FileMetadataRepository) Delete(ctx context.Context, file *models.FileMetadata, store storage.BlobStore) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if file.StorageKey != "" {
+			if err := lockBlob(tx, file.StorageKey); err != nil {
+				return err
+			}
+		}
+		if err := tx.Unscoped().
+			Where("id = ? AND user_id = ?", file.ID, file.UserID).
+			Delete(&models.FileMetadata{}).Error; err != nil {
+			return err
+		}
+		if file.StorageKey == "" {
+			return nil
+		}
+		return releaseBlob(ctx, tx, store, file.StorageKey)
+	})
+}
+
+// deleteNoteFiles removes every file attached to a note for good, within the transaction that
+// deletes the note. The locks of their blobs are taken in order, so two deletions sharing blobs
+// cannot deadlock, and held until the note is gone.
+func deleteNoteFiles(ctx context.Context, tx *gorm.DB, store storage.BlobStore, noteID, userID uuid.UUID) error {
+	var keys []string
+	if err := tx.Unscoped().Model(&models.FileMetadata{}).
+		Distinct("storage_key").
+		Where("note_id = ? AND user_id = ? AND storage_key <> ''", noteID, userID).
+		Order("storage_key").
+		Pluck("storage_key", &keys).Error; err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err := lockBlob(tx, key); err != nil {
+			return err
+		}
+	}
+	if err := tx.Unscoped().
+		Where("note_id = ? AND user_id = ?", noteID, userID).
+		Delete(&models.FileMetadata{}).Error; err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err := releaseBlob(ctx, tx, store, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// releaseBlob deletes a blob from the store once no file refers to it. The caller holds its lock.
+func releaseBlob(ctx context.Context, tx *gorm.DB, store storage.BlobStore, key string) error {
+	var remaining int64
+	if err := tx.Unscoped().Model(&models.FileMetadata{}).
+		Where("storage_key = ?", key).
+		Count(&remaining).Error; err != nil {
+		return err
+	}
+	if remaining == 0 {
+		if err := store.Delete(ctx, key); err != nil {
+			// The file is gone for the user either way; the blob is only left unreferenced
+			log.Printf("Failed to delete blob %s: %v", key, err)
+		}
+	}
+	return nil
+}
+
+// lockBlob takes a lock on a blob key until the transaction ends. Saving a file and deleting
+// one both hold it, so a blob is never removed while a file referring to it is being saved.
+func lockBlob(tx *gorm.DB, key string) error {
+	return tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", key).Error
 }
 
-func NewFileMetadataRepository(db *gorm.DB) *FileMetadataRepository {
-	return &FileMetadataRepository{db: db}
+// StorageUsage is how much storage a user's files take up
+type StorageUsage struct {
+	Bytes  int64
+	Files  int64
+	ByKind map[string]int64 // Bytes per file type
+}
+
+// UsageByUser sums the sizes of a user's files
+func (r *FileMetadataRepository) UsageByUser(ctx context.Context, userID uuid.UUID) (*StorageUsage, error) {
+	var rows []struct {
+		FileType string
+		Bytes    int64
+		Files    int64
+	}
+	if err := r.db.WithContext(ctx).Model(&models.FileMetadata{}).
+		Select("file_type, COALESCE(SUM(size), 0) AS bytes, COUNT(*) AS files").
+		Where("user_id = ?", userID).
+		Group("file_type").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	usage := &StorageUsage{ByKind: make(map[string]int64, len(rows))}
+	for _, row := range rows {
+		usage.Bytes += row.Bytes
+		usage.Files += row.Files
+		usage.ByKind[row.FileType] = row.Bytes
+	}
+	return usage, nil
+}
+
+// BackfillSizes records the size of files uploaded before sizes were, by reading them back
+func (r *FileMetadataRepository) BackfillSizes(ctx context.Context, store storage.BlobStore) error {
+	var files []models.FileMetadata
+	if err := r.db.WithContext(ctx).
+		Select("id, user_id, storage_key").
+		Where("size = 0 AND storage_key <> ''").
+		Find(&files).Error; err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		blob, err := store.Open(ctx, file.StorageKey)
+		if err != nil {
+			log.Printf("Skipping size of file %s: %v", file.ID, err)
+			continue
+		}
+		size, err := plaintextSize(ctx, r.cipher, file.UserID, blob)
+		blob.Close()
+		if err != nil {
+			return fmt.Errorf("file %s: %v", file.ID, err)
+		}
+		if err := r.db.WithContext(ctx).Model(&models.FileMetadata{}).
+			Where("id = ?", file.ID).
+			Update("size", size).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// plaintextSize returns the size of a stored file once decrypted, which encrypted files know
+// from their length without being read
+func plaintextSize(ctx context.Context, cipher *ContentCipher, userID uuid.UUID, blob io.ReadSeeker) (int64, error) {
+	contents, err := cipher.OpenFile(ctx, userID, blob)
+	if err != nil {
+		return 0, err
+	}
+	return contents.Seek(0, io.SeekEnd)
+}
+
+// EncryptExisting encrypts the extracted text and stored bytes of files saved before at-rest
+// encryption was enabled, and returns how many texts and blobs it encrypted. Each user's files
+// get a blob of their own sealed with their data key; the old blob is deleted once no file
+// refers to it.
+func (r *FileMetadataRepository) EncryptExisting(ctx context.Context, store storage.BlobStore) (int, int, error) {
+	if !r.cipher.Enabled() {
+		return 0, 0, fmt.Errorf("at-rest encryption is not enabled")
+	}
+
+	texts := 0
+	var files []models.FileMetadata
+	if err := r.db.WithContext(ctx).Unscoped().
+		Select("id, user_id, extracted_text").
+		Where("COALESCE(extracted_text, '') NOT LIKE ?", encryptedPrefix+"%").
+		FindInBatches(&files, 100, func(tx *gorm.DB, batch int) error {
+			for _, file := range files {
+				sealed, err := r.cipher.EncryptString(ctx, file.UserID, file.ExtractedText)
+				if err != nil {
+					return fmt.Errorf("file %s: %v", file.ID, err)
+				}
+				result := r.db.WithContext(ctx).Unscoped().Model(&models.FileMetadata{}).
+					Where("id = ? AND extracted_text = ?", file.ID, file.ExtractedText).
+					UpdateColumn("extracted_text", sealed)
+				if result.Error != nil {
+					return result.Error
+				}
+				texts += int(result.RowsAffected)
+			}
+			return nil
+		}).Error; err != nil {
+		return texts, 0, err
+	}
+
+	var blobs []struct {
+		UserID     uuid.UUID
+		StorageKey string
+	}
+	if err := r.db.WithContext(ctx).Unscoped().Model(&models.FileMetadata{}).
+		Distinct("user_id", "storage_key").
+		Where("storage_key <> ''").
+		Scan(&blobs).Error; err != nil {
+		return texts, 0, err
+	}
+	encrypted := 0
+	for _, blob := range blobs {
+		done, err := r.encryptBlob(ctx, store, blob.UserID, blob.StorageKey)
+		if err != nil {
+			return texts, encrypted, fmt.Errorf("blob %s of user %s: %v", blob.StorageKey, blob.UserID, err)
+		}
+		if done {
+			encrypted++
+		}
+	}
+	return texts, encrypted, nil
+}
+
+// encryptBlob stores a user's copy of a blob sealed with their data key, unless it already is
+// encrypted, and points their files at it
+func (r *FileMetadataRepository) encryptBlob(ctx context.Context, store storage.BlobStore, userID uuid.UUID, key string) (bool, error) {
+	stored, err := store.Open(ctx, key)
+	if err == storage.ErrNotFound {
+		log.Printf("Skipping blob %s of user %s: missing from the store", key, userID)
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer stored.Close()
+	if sealed, err := isStreamSealed(stored); err != nil || sealed {
+		return false, err
+	}
+	if _, err := stored.Seek(0, io.SeekStart); err != nil {
+		return false, err
+	}
+	contents, err := r.cipher.OpenFile(ctx, userID, stored)
+	if err != nil {
+		return false, err
+	}
+	sealed, err := r.cipher.EncryptFile(ctx, userID, contents)
+	if err != nil {
+		return false, err
+	}
+	newKey, _, err := store.Put(ctx, sealed)
+	if err != nil {
+		return false, err
+	}
+
+	// As in Delete, the old blob is only removed under its lock once nothing refers to it
+	return true, r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := lockBlob(tx, key); err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Model(&models.FileMetadata{}).
+			Where("user_id = ? AND storage_key = ?", userID, key).
+			UpdateColumn("storage_key", newKey).Error; err != nil {
+			return err
+		}
+		var remaining int64
+		if err := tx.Unscoped().Model(&models.FileMetadata{}).
+			Where("storage_key = ?", key).
+			Count(&remaining).Error; err != nil {
+			return err
+		}
+		if remaining == 0 {
+			if err := store.Delete(ctx, key); err != nil {
+				log.Printf("Failed to delete unencrypted blob %s: %v", key, err)
+			}
+		}
+		return nil
+	})
+}
+
+// MigrateFilePaths moves files saved before the blob store existed into it. They were kept at
+// the path in the file_path column, which is dropped once every file has a storage key. Until
+// then the column is kept and an error is returned, so startup stops rather than losing the
+// paths of files that could not be read. Each original is deleted once its row points at the
+// blob, and its file_path cleared, so an interrupted run picks up where it stopped.
+func (r *FileMetadataRepository) MigrateFilePaths(ctx context.Context, store storage.BlobStore) error {
+	if !r.db.Migrator().HasColumn(&models.FileMetadata{}, "file_path") {
+		return nil
+	}
+
+	type legacyFile struct {
+		ID         string
+		FilePath   string
+		StorageKey string
+	}
+	var files []legacyFile
+	if err := r.db.WithContext(ctx).Unscoped().Model(&models.FileMetadata{}).
+		Select("id, file_path, COALESCE(storage_key, '') AS storage_key").
+		Where("storage_key IS NULL OR storage_key = '' OR file_path <> ''").
+		Find(&files).Error; err != nil {
+		return err
+	}
+
+	var failed []string
+	moved := 0
+	for _, file := range files {
+		if file.StorageKey == "" {
+			// Stored bytes are copied as they are, so files encrypted at rest stay encrypted
+			src, err := os.Open(file.FilePath)
+			if err != nil {
+				log.Printf("Cannot move file %s into the blob store: %v", file.ID, err)
+				failed = append(failed, file.ID)
+				continue
+			}
+			key, _, err := store.Put(ctx, src)
+			src.Close()
+			if err != nil {
+				return err
+			}
+			if err := r.db.WithContext(ctx).Unscoped().Model(&models.FileMetadata{}).
+				Where("id = ?", file.ID).
+				Update("storage_key", key).Error; err != nil {
+				return err
+			}
+			moved++
+		}
+		if err := r.removeLegacyFile(ctx, file.ID, file.FilePath); err != nil {
+			return err
+		}
+	}
+	log.Printf("Moved %d of %d files into the blob store", moved, moved+len(failed))
+	if len(failed) > 0 {
+		return fmt.Errorf("%d files could not be moved and keep their file_path (%s); restore them at that path or delete their rows, then restart",
+			len(failed), strings.Join(failed, ", "))
+	}
+
+	return r.db.WithContext(ctx).Migrator().DropColumn(&models.FileMetadata{}, "file_path")
 }
 
-func (r *FileMetadataRepository) Create(metadata *models.FileMetadata) error {
-	return r.db.Create(metadata).Error
+// removeLegacyFile deletes the original of a file moved into the blob store, unless a file
+// still waiting to be moved was saved at the same path, and then clears its file_path
+func (r *FileMetadataRepository) removeLegacyFile(ctx context.Context, id, path string) error {
+	if path == "" {
+		return nil
+	}
+	var waiting int64
+	if err := r.db.WithContext(ctx).Unscoped().Model(&models.FileMetadata{}).
+		Where("file_path = ? AND (storage_key IS NULL OR storage_key = '')", path).
+		Count(&waiting).Error; err != nil {
+		return err
+	}
+	if waiting > 0 {
+		return nil
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete moved file %s: %v", path, err)
+	}
+	return r.db.WithContext(ctx).Unscoped().Model(&models.FileMetadata{}).
+		Where("id = ?", id).
+		Update("file_path", "").Error
 }
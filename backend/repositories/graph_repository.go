@@ -0,0 +1,201 @@
+package repositories
+
+import (
+	"context"
+	"strings"
+
+	"NoteSense/models"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+)
+
+// Directions a graph walk may follow connections in. Undirected connections are followed either way.
+const (
+	WalkBoth     = "both"
+	WalkOutgoing = "outgoing"
+	WalkIncoming = "incoming"
+)
+
+// GraphFilter restricts a graph query to some connection types and to notes in some categories.
+// Empty fields do not filter; archived notes are always left out.
+type GraphFilter struct {
+	Types      []string
+	Categories []string
+}
+
+// nodeCondition selects the notes that are part of the filtered graph
+func (f GraphFilter) nodeCondition(userID uuid.UUID) (string, []interface{}) {
+	condition := "n.user_id = ? AND NOT n.archived"
+	args := []interface{}{userID}
+	if len(f.Categories) > 0 {
+		condition += " AND n.categories && ?"
+		args = append(args, pq.Array(f.Categories))
+	}
+	return condition, args
+}
+
+// edgeCondition selects the connections that are part of the filtered graph
+func (f GraphFilter) edgeCondition(userID uuid.UUID) (string, []interface{}) {
+	condition := "c.user_id = ?"
+	args := []interface{}{userID}
+	if len(f.Types) > 0 {
+		condition += " AND c.type IN ?"
+		args = append(args, f.Types)
+	}
+	return condition, args
+}
+
+// graphNoteColumns are the note columns graph responses describe nodes with
+var graphNoteColumns = []string{"id", "title", "emoji", "categories", "status"}
+
+// Neighborhood walks the filtered graph from a note with a recursive query and returns the notes
+// within depth hops, with the number of hops to reach each. The start note has depth 0.
+func (r *ConnectionRepository) Neighborhood(ctx context.Context, noteID uuid.UUID, depth int, direction string, filter GraphFilter, userID uuid.UUID) (map[uuid.UUID]int, error) {
+	nodeCondition, nodeArgs := filter.nodeCondition(userID)
+	edgeCondition, edgeArgs := filter.edgeCondition(userID)
+
+	// Each step is one traversable (a -> b) hop
+	forward := "SELECT c.source_id AS a, c.target_id AS b FROM note_connections c WHERE " + edgeCondition
+	backward := "SELECT c.target_id AS a, c.source_id AS b FROM note_connections c WHERE " + edgeCondition
+	var steps []string
+	var stepArgs []interface{}
+	switch direction {
+	case WalkOutgoing:
+		steps = []string{forward, backward + " AND NOT c.directed"}
+	case WalkIncoming:
+		steps = []string{backward, forward + " AND NOT c.directed"}
+	default:
+		steps = []string{forward, backward}
+	}
+	for range steps {
+		stepArgs = append(stepArgs, edgeArgs...)
+	}
+
+	query := `WITH RECURSIVE
+		nodes AS (SELECT n.id FROM notes n WHERE ` + nodeCondition + ` UNION SELECT ?::uuid),
+		steps AS (
+			SELECT s.a, s.b FROM (` + strings.Join(steps, " UNION ALL ") + `) s
+			WHERE s.a IN (SELECT id FROM nodes) AND s.b IN (SELECT id FROM nodes)
+		),
+		walk(id, depth) AS (
+			SELECT ?::uuid, 0
+			UNION
+			SELECT s.b, w.depth + 1 FROM walk w JOIN steps s ON s.a = w.id WHERE w.depth < ?
+		)
+		SELECT id, MIN(depth) AS depth FROM walk GROUP BY id`
+
+	// The start note is always walked from, even when the filter leaves it out
+	args := append(append(append(nodeArgs, noteID), stepArgs...), noteID, depth)
+	var rows []struct {
+		ID    uuid.UUID
+		Depth int
+	}
+	if err := r.db.WithContext(ctx).Raw(query, args...).Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	depths := make(map[uuid.UUID]int, len(rows))
+	for _, row := range rows {
+		depths[row.ID] = row.Depth
+	}
+	return depths, nil
+}
+
+// GraphNotes returns the notes of the filtered graph, or only those among ids when ids is not nil,
+// without their content
+func (r *ConnectionRepository) GraphNotes(ctx context.Context, ids []uuid.UUID, filter GraphFilter, userID uuid.UUID) ([]models.Note, error) {
+	notes := []models.Note{}
+	if ids != nil && len(ids) == 0 {
+		return notes, nil
+	}
+	condition, args := filter.nodeCondition(userID)
+	tx := r.db.WithContext(ctx).Table("notes AS n").Select(graphNoteColumns).Where(condition, args...)
+	if ids != nil {
+		tx = tx.Where("n.id IN ?", ids)
+	}
+	if err := tx.Order("n.created_at ASC").Find(&notes).Error; err != nil {
+		return nil, err
+	}
+	return notes, nil
+}
+
+// GraphEdges returns the filtered connections between notes of the filtered graph, or only those
+// with both ends among ids when ids is not nil
+func (r *ConnectionRepository) GraphEdges(ctx context.Context, ids []uuid.UUID, filter GraphFilter, userID uuid.UUID) ([]models.NoteConnection, error) {
+	edges := []models.NoteConnection{}
+	if ids != nil && len(ids) == 0 {
+		return edges, nil
+	}
+	nodeCondition, nodeArgs := filter.nodeCondition(userID)
+	edgeCondition, edgeArgs := filter.edgeCondition(userID)
+
+	nodes := func() *gorm.DB {
+		tx := r.db.Table("notes AS n").Select("n.id").Where(nodeCondition, nodeArgs...)
+		if ids != nil {
+			tx = tx.Where("n.id IN ?", ids)
+		}
+		return tx
+	}
+	err := r.db.WithContext(ctx).Table("note_connections AS c").
+		Where(edgeCondition, edgeArgs...).
+		Where("c.source_id IN (?) AND c.target_id IN (?)", nodes(), nodes()).
+		Order("c.created_at ASC").
+		Find(&edges).Error
+	if err != nil {
+		return nil, err
+	}
+	return edges, nil
+}
+
+// NoteSummaries returns the user's notes among ids, archived or not, without their content
+func (r *ConnectionRepository) NoteSummaries(ctx context.Context, ids []uuid.UUID, userID uuid.UUID) ([]models.Note, error) {
+	notes := []models.Note{}
+	if len(ids) == 0 {
+		return notes, nil
+	}
+	if err := r.db.WithContext(ctx).
+		Select(graphNoteColumns).
+		Where("user_id = ? AND id IN ?", userID, ids).
+		Order("created_at ASC").
+		Find(&notes).Error; err != nil {
+		return nil, err
+	}
+	return notes, nil
+}
+
+// NodeDegree counts the connections of a note. Undirected connections count as both incoming and outgoing.
+type NodeDegree struct {
+	InDegree  int
+	OutDegree int
+	Degree    int
+}
+
+// Degrees counts all the user's connections of the given notes, whatever their type
+func (r *ConnectionRepository) Degrees(ctx context.Context, ids []uuid.UUID, userID uuid.UUID) (map[uuid.UUID]NodeDegree, error) {
+	degrees := make(map[uuid.UUID]NodeDegree, len(ids))
+	if len(ids) == 0 {
+		return degrees, nil
+	}
+	var rows []struct {
+		ID uuid.UUID
+		NodeDegree
+	}
+	err := r.db.WithContext(ctx).Raw(`SELECT id, SUM(in_degree) AS in_degree, SUM(out_degree) AS out_degree, COUNT(*) AS degree
+		FROM (
+			SELECT source_id AS id, CASE WHEN directed THEN 0 ELSE 1 END AS in_degree, 1 AS out_degree
+			FROM note_connections WHERE user_id = ? AND source_id IN ?
+			UNION ALL
+			SELECT target_id AS id, 1 AS in_degree, CASE WHEN directed THEN 0 ELSE 1 END AS out_degree
+			FROM note_connections WHERE user_id = ? AND target_id IN ?
+		) ends
+		GROUP BY id`, userID, ids, userID, ids).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		degrees[row.ID] = row.NodeDegree
+	}
+	return degrees, nil
+}
@@ -0,0 +1,56 @@
+package repositories
+
+import (
+	"context"
+
+	"NoteSense/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// MindmapPositionRepository handles the node positions users saved in their mind maps
+type MindmapPositionRepository struct {
+	db *gorm.DB
+}
+
+func NewMindmapPositionRepository(db *gorm.DB) *MindmapPositionRepository {
+	return &MindmapPositionRepository{db: db}
+}
+
+// ListForNotes returns the user's saved positions of the given notes in a view
+func (r *MindmapPositionRepository) ListForNotes(ctx context.Context, view string, noteIDs []uuid.UUID, userID uuid.UUID) ([]models.MindmapPosition, error) {
+	positions := []models.MindmapPosition{}
+	if len(noteIDs) == 0 {
+		return positions, nil
+	}
+	if err := r.db.WithContext(ctx).
+		Where("user_id = ? AND view = ? AND note_id IN ?", userID, view, noteIDs).
+		Find(&positions).Error; err != nil {
+		return nil, err
+	}
+	return positions, nil
+}
+
+// Upsert saves positions, replacing those already saved for the same notes in the same view
+func (r *MindmapPositionRepository) Upsert(ctx context.Context, positions []models.MindmapPosition) error {
+	if len(positions) == 0 {
+		return nil
+	}
+	return r.db.WithContext(ctx).
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "user_id"}, {Name: "view"}, {Name: "note_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"x", "y", "updated_at"}),
+		}).
+		Create(&positions).Error
+}
+
+// Delete removes the user's saved positions in a view, or only those of noteIDs when given
+func (r *MindmapPositionRepository) Delete(ctx context.Context, view string, noteIDs []uuid.UUID, userID uuid.UUID) error {
+	tx := r.db.WithContext(ctx).Where("user_id = ? AND view = ?", userID, view)
+	if len(noteIDs) > 0 {
+		tx = tx.Where("note_id IN ?", noteIDs)
+	}
+	return tx.Delete(&models.MindmapPosition{}).Error
+}
@@ -2,37 +2,75 @@ package repositories
 
 import (
 	"context"
-	"log"
-	"strings"
+	"fmt"
 
 	"NoteSense/models"
+	"NoteSense/storage"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 	"gorm.io/gorm"
 )
 
 // NoteRepository will handle note data operations
 type NoteRepository struct {
-	db *gorm.DB
+	db     *gorm.DB
+	cipher *ContentCipher
 }
 
-// KanbanColumns represents the different columns for organizing notes
-type KanbanColumns struct {
-	Backlog    []models.Note
-	Todo       []models.Note
-	InProgress []models.Note
-	Done       []models.Note
+// Note list sort keys
+const (
+	SortPinned   = "pinned"
+	SortUpdated  = "updated"
+	SortCreated  = "created"
+	SortTitle    = "title"
+	SortPriority = "priority"
+	SortManual   = "manual"
+)
+
+// NoteListOptions filters, orders and pages the notes returned by ListNotes
+type NoteListOptions struct {
+	Archived    string // "exclude" (default), "only" or "include"
+	Pinned      *bool
+	Favorite    *bool
+	SortBy      string
+	Descending  bool
+	Page        PageRequest
+	OmitContent bool // Skip loading note bodies for list views that don't show them
+}
+
+func NewNoteRepository(db *gorm.DB, cipher *ContentCipher) *NoteRepository {
+	return &NoteRepository{db: db, cipher: cipher}
+}
+
+// Transaction runs fn in a database transaction, committed when fn returns nil. Repositories
+// take part in it through their WithTx copies.
+func (r *NoteRepository) Transaction(ctx context.Context, fn func(tx *gorm.DB) error) error {
+	return r.db.WithContext(ctx).Transaction(fn)
 }
 
-func NewNoteRepository(db *gorm.DB) *NoteRepository {
-	return &NoteRepository{db: db}
+// WithTx returns a copy of the repository working within tx
+func (r *NoteRepository) WithTx(tx *gorm.DB) *NoteRepository {
+	return &NoteRepository{db: tx, cipher: r.cipher}
+}
+
+// LockKanban takes a lock on the user's Kanban notes until the transaction ends, so moves
+// checked against WIP limits and dependencies are made one at a time
+func (r *NoteRepository) LockKanban(ctx context.Context, userID uuid.UUID) error {
+	return r.db.WithContext(ctx).Exec("SELECT pg_advisory_xact_lock(hashtext(?))", "kanban:"+userID.String()).Error
 }
 
 func (r *NoteRepository) Create(ctx context.Context, note *models.Note) error {
-	if err := r.db.WithContext(ctx).Create(note).Error; err != nil {
+	restore, err := r.cipher.SealNote(ctx, note)
+	if err != nil {
+		return err
+	}
+	err = r.db.WithContext(ctx).Create(note).Error
+	restore()
+	if err != nil {
 		return err
 	}
-	return nil
+	return r.updateSearchVector(ctx, note)
 }
 
 func (r *NoteRepository) GetByUserID(ctx context.Context, userID string) ([]models.Note, error) {
@@ -40,21 +78,130 @@ func (r *NoteRepository) GetByUserID(ctx context.Context, userID string) ([]mode
 	if err := r.db.WithContext(ctx).Where("user_id = ?", userID).Find(&notes).Error; err != nil {
 		return nil, err
 	}
+	if err := r.cipher.OpenNotes(ctx, notes); err != nil {
+		return nil, err
+	}
 	return notes, nil
 }
 
-func (r *NoteRepository) Update(ctx context.Context, note *models.Note) error {
-	if err := r.db.WithContext(ctx).Save(note).Error; err != nil {
-		return err
+// ListNotes returns a user's notes filtered by flags and ordered by the requested sort key,
+// together with the cursor of the next page when the listing is paged
+func (r *NoteRepository) ListNotes(ctx context.Context, userID uuid.UUID, opts NoteListOptions) ([]models.Note, string, error) {
+	tx := r.db.WithContext(ctx).Where("user_id = ?", userID)
+
+	switch opts.Archived {
+	case "only":
+		tx = tx.Where("archived")
+	case "include":
+	default:
+		tx = tx.Where("NOT archived")
+	}
+	if opts.Pinned != nil {
+		tx = tx.Where("pinned = ?", *opts.Pinned)
+	}
+	if opts.Favorite != nil {
+		tx = tx.Where("favorite = ?", *opts.Favorite)
+	}
+	if opts.OmitContent {
+		tx = tx.Omit("content")
+	}
+
+	// The cursor is tied to the sort key and direction it was issued for
+	order := "notes:" + opts.SortBy
+	if opts.Descending {
+		order += ":desc"
+	}
+	columns := noteSortColumns(opts.SortBy, opts.Descending)
+	tx, err := paginate(tx, order, columns, opts.Page)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var notes []models.Note
+	if err := tx.Find(&notes).Error; err != nil {
+		return nil, "", err
 	}
-	return nil
+	notes, next := notePage(notes, order, columns, opts.Page)
+	if err := r.cipher.OpenNotes(ctx, notes); err != nil {
+		return nil, "", err
+	}
+	return notes, next, nil
+}
+
+// SetPositions stores the manual list order; noteIDs[i] gets position i
+func (r *NoteRepository) SetPositions(ctx context.Context, userID uuid.UUID, noteIDs []uuid.UUID) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for position, noteID := range noteIDs {
+			result := tx.Model(&models.Note{}).
+				Where("id = ? AND user_id = ?", noteID, userID).
+				UpdateColumn("position", position)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return fmt.Errorf("note %s not found", noteID)
+			}
+		}
+		return nil
+	})
 }
 
-func (r *NoteRepository) Delete(noteID uuid.UUID, userID uuid.UUID) error {
-	if err := r.db.Where("id = ? AND user_id = ?", noteID, userID).Delete(&models.Note{}).Error; err != nil {
+// MoveInKanbanColumn places a note at the given index of the Kanban column holding the given
+// statuses and renumbers the column
+func (r *NoteRepository) MoveInKanbanColumn(ctx context.Context, userID uuid.UUID, noteID uuid.UUID, statuses []string, position int) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var columnIDs []uuid.UUID
+		if err := tx.Model(&models.Note{}).
+			Where("user_id = ? AND LOWER(TRIM(status)) IN ? AND id <> ? AND NOT archived", userID, statuses, noteID).
+			Order("kanban_position ASC").Order("created_at ASC").
+			Pluck("id", &columnIDs).Error; err != nil {
+			return err
+		}
+
+		if position < 0 {
+			position = 0
+		}
+		if position > len(columnIDs) {
+			position = len(columnIDs)
+		}
+		ordered := make([]uuid.UUID, 0, len(columnIDs)+1)
+		ordered = append(ordered, columnIDs[:position]...)
+		ordered = append(ordered, noteID)
+		ordered = append(ordered, columnIDs[position:]...)
+
+		for index, id := range ordered {
+			if err := tx.Model(&models.Note{}).
+				Where("id = ? AND user_id = ?", id, userID).
+				UpdateColumn("kanban_position", index).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (r *NoteRepository) Update(ctx context.Context, note *models.Note) error {
+	restore, err := r.cipher.SealNote(ctx, note)
+	if err != nil {
 		return err
 	}
-	return nil
+	err = r.db.WithContext(ctx).Save(note).Error
+	restore()
+	if err != nil {
+		return err
+	}
+	return r.updateSearchVector(ctx, note)
+}
+
+// Delete removes a note along with its attached files, releasing their blobs in the store
+func (r *NoteRepository) Delete(noteID uuid.UUID, userID uuid.UUID, store storage.BlobStore) error {
+	ctx := context.Background()
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("id = ? AND user_id = ?", noteID, userID).Delete(&models.Note{}).Error; err != nil {
+			return err
+		}
+		return deleteNoteFiles(ctx, tx, store, noteID, userID)
+	})
 }
 
 func (r *NoteRepository) GetByID(noteID uuid.UUID, userID uuid.UUID) (*models.Note, error) {
@@ -67,7 +214,11 @@ func (r *NoteRepository) GetByID(noteID uuid.UUID, userID uuid.UUID) (*models.No
 		}
 		return nil, result.Error
 	}
-	return &note, nil
+	notes := []models.Note{note}
+	if err := r.cipher.OpenNotes(context.Background(), notes); err != nil {
+		return nil, err
+	}
+	return &notes[0], nil
 }
 
 func (r *NoteRepository) GetNotesByState(userID uuid.UUID) (map[string][]models.Note, error) {
@@ -76,6 +227,9 @@ func (r *NoteRepository) GetNotesByState(userID uuid.UUID) (map[string][]models.
 	if result.Error != nil {
 		return nil, result.Error
 	}
+	if err := r.cipher.OpenNotes(context.Background(), notes); err != nil {
+		return nil, err
+	}
 
 	groupedNotes := make(map[string][]models.Note)
 	for _, note := range notes {
@@ -93,105 +247,160 @@ func (r *NoteRepository) UpdateNoteState(noteID uuid.UUID, state string, priorit
 		}).Error
 }
 
-func (r *NoteRepository) SearchNotes(ctx context.Context, query string, categories []string, userID uuid.UUID) ([]models.Note, error) {
+// GetKanbanNotes returns the user's notes that are on the Kanban board, in board order.
+// When categories are given, only notes in any of them are returned.
+func (r *NoteRepository) GetKanbanNotes(ctx context.Context, userID uuid.UUID, categories []string, omitContent bool) ([]models.Note, error) {
 	var notes []models.Note
-
-	// Base query
-	tx := r.db.WithContext(ctx).Where("user_id = ?", userID)
-
-	// Add text search condition
-	if query != "" {
-		searchQuery := "%" + query + "%"
-		tx = tx.Where("title ILIKE ? OR content ILIKE ?", searchQuery, searchQuery)
-	}
-
-	// Filter by categories if provided
+	tx := r.db.WithContext(ctx).
+		Where("user_id = ? AND NOT archived", userID).
+		Order("kanban_position ASC").
+		Order("created_at ASC")
 	if len(categories) > 0 {
-		tx = tx.Where("? && categories", categories)
+		tx = tx.Where("categories && ?", pq.Array(categories))
+	}
+	if omitContent {
+		tx = tx.Omit("content")
 	}
-
 	if err := tx.Find(&notes).Error; err != nil {
 		return nil, err
 	}
-
+	if err := r.cipher.OpenNotes(ctx, notes); err != nil {
+		return nil, err
+	}
 	return notes, nil
 }
 
-func (r *NoteRepository) GetKanbanNotes(userID string) (*KanbanColumns, error) {
-	// Fetch notes for the user
-	var notes []models.Note
-	result := r.db.Where("user_id = ?", userID).Find(&notes)
-
-	// Log total number of notes and any errors
-	log.Printf("Total notes found: %d", len(notes))
-	log.Printf("Database query error: %v", result.Error)
+// KanbanPageOptions pages the Kanban board column by column
+type KanbanPageOptions struct {
+	Column      string // Only load the column with this key; required to continue from a cursor
+	Page        PageRequest
+	OmitContent bool
+	Order       string // Card order computed by the service, such as critical_path; empty keeps board order
+}
 
-	if result.Error != nil {
-		return nil, result.Error
+// GetKanbanColumn returns one page of the Kanban column with the given key, which holds the notes
+// with the given statuses, in board order
+func (r *NoteRepository) GetKanbanColumn(ctx context.Context, userID uuid.UUID, column string, statuses []string, page PageRequest, omitContent bool) ([]models.Note, string, error) {
+	tx := r.db.WithContext(ctx).
+		Where("user_id = ? AND NOT archived", userID).
+		Where("LOWER(TRIM(status)) IN ?", statuses)
+	if omitContent {
+		tx = tx.Omit("content")
 	}
 
-	// Initialize kanban columns
-	kanbanNotes := &KanbanColumns{
-		Backlog:    []models.Note{},
-		Todo:       []models.Note{},
-		InProgress: []models.Note{},
-		Done:       []models.Note{},
+	order := "kanban:" + column
+	tx, err := paginate(tx, order, kanbanSortColumns, page)
+	if err != nil {
+		return nil, "", err
 	}
 
-	// Categorize notes into columns
-	for _, note := range notes {
-		status := strings.TrimSpace(strings.ToLower(note.Status))
-
-		// Log each note's details
-		log.Printf("Note ID: %s, Title: %s, Status: %s", note.ID, note.Title, status)
-
-		// Map notes to appropriate columns
-		switch status {
-		case "backlog":
-			kanbanNotes.Backlog = append(kanbanNotes.Backlog, note)
-		case "todo":
-			kanbanNotes.Todo = append(kanbanNotes.Todo, note)
-		case "in_progress", "inprogress", "in progress":
-			kanbanNotes.InProgress = append(kanbanNotes.InProgress, note)
-		case "done", "completed":
-			kanbanNotes.Done = append(kanbanNotes.Done, note)
-		}
+	var notes []models.Note
+	if err := tx.Find(&notes).Error; err != nil {
+		return nil, "", err
 	}
+	notes, next := notePage(notes, order, kanbanSortColumns, page)
+	if err := r.cipher.OpenNotes(ctx, notes); err != nil {
+		return nil, "", err
+	}
+	return notes, next, nil
+}
 
-	return kanbanNotes, nil
+// CountWithStatuses counts the user's notes on the board with one of the given statuses
+func (r *NoteRepository) CountWithStatuses(ctx context.Context, userID uuid.UUID, statuses []string) (int64, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&models.Note{}).
+		Where("user_id = ? AND NOT archived AND LOWER(TRIM(status)) IN ?", userID, statuses).
+		Count(&count).Error
+	return count, err
 }
 
-// GetNotesMindmap retrieves notes and their connections for mindmap visualization
-func (r *NoteRepository) GetNotesMindmap(ctx context.Context, userID uuid.UUID) (map[uuid.UUID][]uuid.UUID, error) {
-	var notes []models.Note
+// RenameStatus moves the user's notes from one status to another
+func (r *NoteRepository) RenameStatus(ctx context.Context, userID uuid.UUID, from, to string) error {
+	return r.db.WithContext(ctx).Model(&models.Note{}).
+		Where("user_id = ? AND status = ?", userID, from).
+		UpdateColumn("status", to).Error
+}
 
-	// Retrieve all notes for the user
-	result := r.db.WithContext(ctx).
-		Where("user_id = ?", userID).
-		Order("created_at DESC").
-		Find(&notes)
+// MigrateCanonicalStatuses rewrites the status spellings older clients stored, such as "BACKLOG",
+// "in progress" or "completed", to canonical states. Other statuses are board column keys and
+// are left alone.
+func (r *NoteRepository) MigrateCanonicalStatuses(ctx context.Context) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for state, spellings := range models.StateSpellings() {
+			if err := tx.Model(&models.Note{}).
+				Where("LOWER(TRIM(status)) IN ? AND status <> ?", spellings, state).
+				UpdateColumn("status", state).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Model(&models.Note{}).
+			Where("status IS NULL OR TRIM(status) = ''").
+			UpdateColumn("status", models.StateBacklog).Error
+	})
+}
 
-	if result.Error != nil {
-		return nil, result.Error
+// EncryptExisting encrypts the content of notes written before at-rest encryption was enabled
+// and returns how many it encrypted. Timestamps are left alone.
+func (r *NoteRepository) EncryptExisting(ctx context.Context) (int, error) {
+	if !r.cipher.Enabled() {
+		return 0, fmt.Errorf("at-rest encryption is not enabled")
 	}
-
-	// Create a map of note connections
-	noteConnections := make(map[uuid.UUID][]uuid.UUID)
-	for _, note := range notes {
-		// Convert connected note IDs to UUIDs
-		var connectedNoteIDs []uuid.UUID
-		for _, idStr := range note.ConnectedNoteIDs {
-			connID, err := uuid.Parse(idStr)
-			if err == nil {
-				connectedNoteIDs = append(connectedNoteIDs, connID)
+	encrypted := 0
+	var notes []models.Note
+	err := r.db.WithContext(ctx).
+		Select("id, user_id, content").
+		Where("COALESCE(content, '') NOT LIKE ?", encryptedPrefix+"%").
+		FindInBatches(&notes, 100, func(tx *gorm.DB, batch int) error {
+			for _, note := range notes {
+				sealed, err := r.cipher.EncryptString(ctx, note.UserID, note.Content)
+				if err != nil {
+					return fmt.Errorf("note %s: %v", note.ID, err)
+				}
+				// A note edited meanwhile was encrypted by the edit
+				result := r.db.WithContext(ctx).Model(&models.Note{}).
+					Where("id = ? AND content = ?", note.ID, note.Content).
+					UpdateColumn("content", sealed)
+				if result.Error != nil {
+					return result.Error
+				}
+				encrypted += int(result.RowsAffected)
 			}
-		}
+			return nil
+		}).Error
+	return encrypted, err
+}
+
+// GetNotesMindmap retrieves a page of the user's note IDs and the connections starting at those notes
+// for mindmap visualization. Paged requests walk the notes newest first and return the cursor of the next page.
+func (r *NoteRepository) GetNotesMindmap(ctx context.Context, userID uuid.UUID, page PageRequest) ([]uuid.UUID, []models.NoteConnection, string, error) {
+	// Only the keys are needed, never the note bodies
+	tx := r.db.WithContext(ctx).
+		Select("id", "created_at").
+		Where("user_id = ?", userID)
+	tx, err := paginate(tx, "mindmap", newestFirstColumns, page)
+	if err != nil {
+		return nil, nil, "", err
+	}
 
-		// Only add to map if there are connections
-		if len(connectedNoteIDs) > 0 {
-			noteConnections[note.ID] = connectedNoteIDs
+	var notes []models.Note
+	if err := tx.Find(&notes).Error; err != nil {
+		return nil, nil, "", err
+	}
+	notes, next := notePage(notes, "mindmap", newestFirstColumns, page)
+
+	ids := make([]uuid.UUID, len(notes))
+	for i, note := range notes {
+		ids[i] = note.ID
+	}
+	edges := []models.NoteConnection{}
+	if len(ids) > 0 {
+		if err := r.db.WithContext(ctx).
+			Where("user_id = ? AND source_id IN ?", userID, ids).
+			Order("created_at ASC").
+			Find(&edges).Error; err != nil {
+			return nil, nil, "", err
 		}
 	}
 
-	return noteConnections, nil
+	return ids, edges, next, nil
 }
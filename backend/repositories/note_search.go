@@ -0,0 +1,447 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"NoteSense/models"
+	"NoteSense/utils"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+)
+
+// SearchHit is a note matched by full-text search with its relevance and highlighted snippets
+type SearchHit struct {
+	Note           models.Note
+	Rank           float64
+	TitleHighlight string
+	Snippet        string            // From the note body
+	Attachments    []AttachmentMatch // Attached files whose extracted text matched
+}
+
+// Sentinels passed to ts_headline; they are swapped for <mark> tags after HTML-escaping
+const (
+	highlightStart = "\uE000"
+	highlightStop  = "\uE001"
+)
+
+var headlineOptions = fmt.Sprintf(`StartSel="%s", StopSel="%s", MaxWords=35, MinWords=12, MaxFragments=2, FragmentDelimiter=" … "`, highlightStart, highlightStop)
+
+// extractedBannerPattern matches the banners FileUploadService writes around OCR and transcript text
+var extractedBannerPattern = regexp.MustCompile(`(?m)^-+ Data extracted from \w+ -+$`)
+
+// DefaultFuzzyThreshold is the word similarity a fuzzy match needs when no threshold is given
+const DefaultFuzzyThreshold = 0.3
+
+// Weights of full-text rank and trigram similarity in the hybrid score of fuzzy searches
+const (
+	fullTextWeight   = 0.6
+	similarityWeight = 0.4
+)
+
+// SearchOptions tunes how free text is matched
+type SearchOptions struct {
+	Fuzzy     bool    // Also match misspellings by trigram similarity
+	Threshold float64 // Minimum word similarity of a fuzzy match, between 0 and 1
+	Page      PageRequest
+}
+
+// MigrateSearchIndex adds the weighted tsvector column, the word list used for trigram
+// matching and their indexes
+func (r *NoteRepository) MigrateSearchIndex(ctx context.Context) error {
+	statements := []string{
+		`CREATE EXTENSION IF NOT EXISTS pg_trgm`,
+		`ALTER TABLE notes ADD COLUMN IF NOT EXISTS search_vector tsvector`,
+		`ALTER TABLE notes ADD COLUMN IF NOT EXISTS search_words text`,
+		`ALTER TABLE notes ADD COLUMN IF NOT EXISTS search_blinded boolean`,
+		`CREATE INDEX IF NOT EXISTS idx_notes_search_vector ON notes USING GIN (search_vector)`,
+		`CREATE INDEX IF NOT EXISTS idx_notes_title_trgm ON notes USING GIN (title gin_trgm_ops)`,
+		`CREATE INDEX IF NOT EXISTS idx_notes_search_words_trgm ON notes USING GIN (search_words gin_trgm_ops)`,
+		`ALTER TABLE file_metadata ADD COLUMN IF NOT EXISTS search_vector tsvector`,
+		`ALTER TABLE file_metadata ADD COLUMN IF NOT EXISTS search_blinded boolean`,
+		`CREATE INDEX IF NOT EXISTS idx_file_metadata_search_vector ON file_metadata USING GIN (search_vector)`,
+	}
+	for _, statement := range statements {
+		if err := r.db.WithContext(ctx).Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// BackfillSearchVectors indexes notes and attachments that have no search vector yet, e.g.
+// after the column was added, and reindexes notes whose vector was built with encryption
+// switched the other way
+func (r *NoteRepository) BackfillSearchVectors(ctx context.Context) error {
+	var userIDs []uuid.UUID
+	if err := r.db.WithContext(ctx).Model(&models.Note{}).
+		Where("search_vector IS NULL OR search_words IS NULL OR search_blinded IS DISTINCT FROM ?", r.cipher.Enabled()).
+		Distinct("user_id").
+		Pluck("user_id", &userIDs).Error; err != nil {
+		return err
+	}
+	for _, userID := range userIDs {
+		if err := r.ReindexUser(ctx, userID); err != nil {
+			return fmt.Errorf("failed to index notes for user %s: %v", userID, err)
+		}
+	}
+
+	userIDs = nil
+	if err := r.db.WithContext(ctx).Model(&models.FileMetadata{}).
+		Where("search_vector IS NULL OR search_blinded IS DISTINCT FROM ?", r.cipher.Enabled()).
+		Distinct("user_id").
+		Pluck("user_id", &userIDs).Error; err != nil {
+		return err
+	}
+	for _, userID := range userIDs {
+		if err := r.reindexAttachments(ctx, userID, true); err != nil {
+			return fmt.Errorf("failed to index attachments for user %s: %v", userID, err)
+		}
+	}
+	return nil
+}
+
+// ReindexUser recomputes the search vectors of all of a user's notes and attachments,
+// e.g. after a language change
+func (r *NoteRepository) ReindexUser(ctx context.Context, userID uuid.UUID) error {
+	notes, err := r.GetByUserID(ctx, userID.String())
+	if err != nil {
+		return err
+	}
+	for i := range notes {
+		if err := r.updateSearchVector(ctx, &notes[i]); err != nil {
+			return err
+		}
+	}
+	return r.reindexAttachments(ctx, userID, false)
+}
+
+// updateSearchVector indexes a note from its plaintext: title (A) > categories (B) > body (C) >
+// extracted attachment text (D). The vector is computed here rather than by a generated column
+// because content may be encrypted at rest, in which case it is blinded (see searchBlinder).
+// Locked notes only index their title and categories. The distinct words are stored alongside
+// for trigram matching of misspellings; trigrams need the words themselves, so with encryption
+// enabled only the words of the title and categories, which are stored in the clear, are kept.
+func (r *NoteRepository) updateSearchVector(ctx context.Context, note *models.Note) error {
+	body, extracted := "", ""
+	if !note.Encrypted {
+		body, extracted = splitExtractedText(utils.PlainText(note.Content))
+	}
+	categories := strings.Join(note.Categories, " ")
+	words := distinctWords(note.Title, categories)
+	if !r.cipher.Enabled() {
+		words = distinctWords(note.Title, categories, body, extracted)
+	}
+
+	config, err := r.searchConfig(ctx, note.UserID)
+	if err != nil {
+		return err
+	}
+	vector, blinded, err := searchVector(ctx, r.db, r.cipher, note.UserID, config,
+		weightedText{note.Title, "A"}, weightedText{categories, "B"}, weightedText{body, "C"}, weightedText{extracted, "D"})
+	if err != nil {
+		return err
+	}
+	return r.db.WithContext(ctx).Exec(
+		"UPDATE notes SET search_vector = ?::tsvector, search_words = ?, search_blinded = ? WHERE id = ?",
+		vector, words, blinded, note.ID,
+	).Error
+}
+
+// distinctWords returns the lowercased words of the texts that are long enough to
+// produce useful trigrams, each listed once
+func distinctWords(texts ...string) string {
+	seen := make(map[string]bool)
+	var words []string
+	for _, text := range texts {
+		for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		}) {
+			if length := utf8.RuneCountInString(word); length < 3 || length > 64 || seen[word] {
+				continue
+			}
+			seen[word] = true
+			words = append(words, word)
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// splitExtractedText separates the note body from text appended under extraction banners
+func splitExtractedText(content string) (body, extracted string) {
+	loc := extractedBannerPattern.FindStringIndex(content)
+	if loc == nil {
+		return content, ""
+	}
+	return content[:loc[0]], extractedBannerPattern.ReplaceAllString(content[loc[0]:], "")
+}
+
+// searchConfig returns the text search configuration chosen by the user
+func (r *NoteRepository) searchConfig(ctx context.Context, userID uuid.UUID) (string, error) {
+	return userSearchConfig(ctx, r.db, userID)
+}
+
+// SearchNotes returns the user's notes matching a parsed query. Notes matching free text are
+// ranked by relevance; filter-only queries are ordered by last update. Fuzzy searches also match
+// titles and words similar to the query and rank by a blend of full-text rank and similarity.
+// Paged searches also return the cursor of the next page.
+func (r *NoteRepository) SearchNotes(ctx context.Context, query *SearchQuery, opts SearchOptions, userID uuid.UUID) ([]SearchHit, string, error) {
+	config, err := r.searchConfig(ctx, userID)
+	if err != nil {
+		return nil, "", err
+	}
+	text := query.TextQuery()
+	fuzzyText := strings.Join(query.Words(), " ")
+	fuzzy := opts.Fuzzy && fuzzyText != ""
+	var textQuery tsQuery
+	if text != "" {
+		if textQuery, err = r.textSearchQuery(ctx, userID, config, text); err != nil {
+			return nil, "", err
+		}
+	}
+	var excludedQuery tsQuery
+	if excluded := query.excludedTextQuery(); excluded != "" {
+		if excludedQuery, err = r.textSearchQuery(ctx, userID, config, excluded); err != nil {
+			return nil, "", err
+		}
+	}
+
+	var ranked []struct {
+		ID        uuid.UUID
+		Rank      float64
+		UpdatedAt time.Time
+	}
+	err = r.db.WithContext(ctx).Transaction(func(db *gorm.DB) error {
+		tx := query.apply(db.Table("notes").Where("user_id = ?", userID))
+
+		switch {
+		case fuzzy:
+			// The <% operators use the index and read their threshold from this setting
+			if err := db.Exec("SELECT set_config('pg_trgm.word_similarity_threshold', ?, true)", strconv.FormatFloat(opts.Threshold, 'f', -1, 64)).Error; err != nil {
+				return err
+			}
+			match, args := query.textMatch(textQuery)
+			if query.Scope != ScopeAttachments {
+				// Titles and the word list describe the note itself, not its attachments
+				match = "(" + match + " OR ? <% title OR ? <% search_words)"
+				args = append(args, fuzzyText, fuzzyText)
+			}
+			tx = tx.Where(match, args...)
+			if excludedQuery.SQL != "" {
+				tx = tx.Where("NOT (search_vector @@ "+excludedQuery.SQL+")", excludedQuery.Args...)
+			}
+			args = append([]interface{}{fullTextWeight}, textQuery.Args...)
+			args = append(args, similarityWeight, fuzzyText, fuzzyText)
+			tx = tx.Select(`id, updated_at, ? * ts_rank_cd(`+query.rankedVector()+`, `+textQuery.SQL+`, 32) +
+				? * GREATEST(word_similarity(?, title), word_similarity(?, COALESCE(search_words, ''))) AS rank`, args...)
+		case text != "":
+			// Rank matches using the weighted vector
+			match, args := query.textMatch(textQuery)
+			tx = tx.Where(match, args...).
+				Select("id, updated_at, ts_rank_cd("+query.rankedVector()+", "+textQuery.SQL+") AS rank", textQuery.Args...)
+		default:
+			tx = tx.Select("id, updated_at, 0 AS rank")
+		}
+
+		// Page over the ranked rows so the cursor can refer to the computed rank
+		paged, err := paginate(db.Table("(?) AS ranked", tx), "search", searchSortColumns, opts.Page)
+		if err != nil {
+			return err
+		}
+		return paged.Scan(&ranked).Error
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	next := ""
+	if opts.Page.Limit > 0 && len(ranked) > opts.Page.Limit {
+		ranked = ranked[:opts.Page.Limit]
+		last := ranked[len(ranked)-1]
+		next = encodeCursor("search", []interface{}{last.Rank, last.UpdatedAt, last.ID})
+	}
+	if len(ranked) == 0 {
+		return []SearchHit{}, "", nil
+	}
+
+	ids := make([]uuid.UUID, len(ranked))
+	for i, row := range ranked {
+		ids[i] = row.ID
+	}
+	var notes []models.Note
+	if err := r.db.WithContext(ctx).Where("user_id = ? AND id IN ?", userID, ids).Find(&notes).Error; err != nil {
+		return nil, "", err
+	}
+	if err := r.cipher.OpenNotes(ctx, notes); err != nil {
+		return nil, "", err
+	}
+	byID := make(map[uuid.UUID]models.Note, len(notes))
+	for _, note := range notes {
+		byID[note.ID] = note
+	}
+
+	hits := make([]SearchHit, 0, len(ranked))
+	for _, row := range ranked {
+		if note, ok := byID[row.ID]; ok {
+			hits = append(hits, SearchHit{Note: note, Rank: row.Rank, TitleHighlight: html.EscapeString(note.Title)})
+		}
+	}
+
+	if text == "" {
+		return hits, next, nil
+	}
+	if err := r.highlight(ctx, config, text, hits); err != nil {
+		return nil, "", err
+	}
+	if query.Scope != ScopeBody {
+		if err := r.matchAttachments(ctx, config, text, textQuery, hits, userID); err != nil {
+			return nil, "", err
+		}
+	}
+	return hits, next, nil
+}
+
+// FilterNotes returns the notes among ids that satisfy the query's filters and exclusions,
+// e.g. to narrow down semantic matches
+func (r *NoteRepository) FilterNotes(ctx context.Context, query *SearchQuery, ids []uuid.UUID, userID uuid.UUID) ([]models.Note, error) {
+	tx := query.apply(r.db.WithContext(ctx).Where("user_id = ? AND id IN ?", userID, ids))
+	if excluded := query.excludedTextQuery(); excluded != "" {
+		config, err := r.searchConfig(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		excludedQuery, err := r.textSearchQuery(ctx, userID, config, excluded)
+		if err != nil {
+			return nil, err
+		}
+		tx = tx.Where("NOT (search_vector @@ "+excludedQuery.SQL+")", excludedQuery.Args...)
+	}
+
+	var notes []models.Note
+	if err := tx.Find(&notes).Error; err != nil {
+		return nil, err
+	}
+	if err := r.cipher.OpenNotes(ctx, notes); err != nil {
+		return nil, err
+	}
+	return notes, nil
+}
+
+// highlight fills in title highlights and content snippets with one ts_headline query.
+// Plaintext is passed in from the application since the stored content may be encrypted.
+func (r *NoteRepository) highlight(ctx context.Context, config, query string, hits []SearchHit) error {
+	titles := make([]string, len(hits))
+	docs := make([]string, len(hits))
+	for i, hit := range hits {
+		titles[i] = stripSentinels(hit.Note.Title)
+		if !hit.Note.Encrypted {
+			// Extracted text is reported per attachment rather than in the body snippet
+			body, _ := splitExtractedText(utils.PlainText(hit.Note.Content))
+			docs[i] = stripSentinels(body)
+		}
+	}
+
+	var headlines []struct {
+		TitleHighlight string
+		Snippet        string
+	}
+	if err := r.db.WithContext(ctx).Raw(`
+		SELECT
+			ts_headline(?::regconfig, t.title, q.query, 'HighlightAll=true, StartSel="`+highlightStart+`", StopSel="`+highlightStop+`"') AS title_highlight,
+			ts_headline(?::regconfig, t.doc, q.query, ?) AS snippet
+		FROM unnest(?::text[], ?::text[]) WITH ORDINALITY AS t(title, doc, ord),
+			(SELECT websearch_to_tsquery(?::regconfig, ?) AS query) q
+		ORDER BY t.ord`,
+		config, config, headlineOptions, pq.StringArray(titles), pq.StringArray(docs), config, query,
+	).Scan(&headlines).Error; err != nil {
+		return err
+	}
+
+	for i := range hits {
+		if i >= len(headlines) {
+			break
+		}
+		hits[i].TitleHighlight = markHighlights(headlines[i].TitleHighlight)
+		if docs[i] != "" {
+			hits[i].Snippet = markHighlights(headlines[i].Snippet)
+		}
+	}
+	return nil
+}
+
+// markHighlights escapes a ts_headline result and turns the sentinels into <mark> tags
+func markHighlights(headline string) string {
+	escaped := html.EscapeString(headline)
+	escaped = strings.ReplaceAll(escaped, highlightStart, "<mark>")
+	return strings.ReplaceAll(escaped, highlightStop, "</mark>")
+}
+
+func stripSentinels(s string) string {
+	return strings.NewReplacer(highlightStart, "", highlightStop, "").Replace(s)
+}
+
+// SuggestQuery proposes a corrected query when some of its words do not occur in the user's
+// notes but similar words do. It returns "" when there is nothing to correct. With encryption
+// enabled, suggestions only come from titles and categories (see updateSearchVector).
+func (r *NoteRepository) SuggestQuery(ctx context.Context, query *SearchQuery, threshold float64, userID uuid.UUID) (string, error) {
+	words := query.Words()
+	if len(words) == 0 {
+		return "", nil
+	}
+
+	changed := false
+	suggested := make([]string, len(words))
+	err := r.db.WithContext(ctx).Transaction(func(db *gorm.DB) error {
+		if err := db.Exec("SELECT set_config('pg_trgm.word_similarity_threshold', ?, true)", strconv.FormatFloat(threshold, 'f', -1, 64)).Error; err != nil {
+			return err
+		}
+		for i, word := range words {
+			suggested[i] = word
+			lower := strings.ToLower(word)
+			if utf8.RuneCountInString(lower) < 3 {
+				continue
+			}
+
+			var candidates []struct {
+				Word  string
+				Score float64
+			}
+			if err := db.Raw(`
+				SELECT w.word, similarity(w.word, ?) AS score
+				FROM (
+					SELECT DISTINCT regexp_split_to_table(search_words, ' ') AS word
+					FROM notes
+					WHERE user_id = ? AND NOT archived AND search_words <> '' AND ? <% search_words
+				) w
+				WHERE similarity(w.word, ?) >= ?
+				ORDER BY score DESC, w.word
+				LIMIT 1`,
+				lower, userID, lower, lower, threshold,
+			).Scan(&candidates).Error; err != nil {
+				return err
+			}
+			if len(candidates) == 0 || candidates[0].Word == lower {
+				continue
+			}
+			suggested[i] = candidates[0].Word
+			changed = true
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if !changed {
+		return "", nil
+	}
+	return strings.Join(suggested, " "), nil
+}
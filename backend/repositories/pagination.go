@@ -0,0 +1,292 @@
+package repositories
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"NoteSense/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// MaxPageSize caps the number of items a single page may return
+const MaxPageSize = 200
+
+// ErrInvalidCursor is returned for cursors that are malformed or belong to another listing
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// PageRequest asks for one page of a listing. A zero Limit returns every item.
+type PageRequest struct {
+	Limit  int
+	Cursor string // Opaque cursor from a previous page; empty for the first page
+}
+
+// Kinds of values a cursor stores, so they decode back into comparable types
+type cursorKind int
+
+const (
+	kindBool cursorKind = iota
+	kindInt
+	kindFloat
+	kindString
+	kindTime
+	kindUUID
+)
+
+// sortColumn is one key of a stable ordering. Every ordering ends with a unique key
+// so that keyset pagination never skips or repeats rows.
+type sortColumn struct {
+	expr  string // SQL expression the rows are ordered by
+	arg   string // How the cursor value is compared, "?" unless set
+	desc  bool
+	kind  cursorKind
+	value func(note *models.Note) interface{} // Reads the key from a note
+}
+
+// pageCursor is the decoded form of an opaque cursor
+type pageCursor struct {
+	Order  string            `json:"o"` // Identifies the ordering the cursor belongs to
+	Values []json.RawMessage `json:"v"`
+}
+
+// encodeCursor builds an opaque cursor pointing after a row with the given key values
+func encodeCursor(order string, values []interface{}) string {
+	raw := make([]json.RawMessage, len(values))
+	for i, value := range values {
+		encoded, _ := json.Marshal(value)
+		raw[i] = encoded
+	}
+	data, _ := json.Marshal(pageCursor{Order: order, Values: raw})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor returns the key values stored in a cursor for the given ordering
+func decodeCursor(cursor, order string, columns []sortColumn) ([]interface{}, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var decoded pageCursor
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	if decoded.Order != order || len(decoded.Values) != len(columns) {
+		return nil, ErrInvalidCursor
+	}
+
+	values := make([]interface{}, len(columns))
+	for i, column := range columns {
+		var target interface{}
+		switch column.kind {
+		case kindBool:
+			target = new(bool)
+		case kindInt:
+			target = new(int)
+		case kindFloat:
+			target = new(float64)
+		case kindString:
+			target = new(string)
+		case kindTime:
+			target = new(time.Time)
+		case kindUUID:
+			target = new(uuid.UUID)
+		}
+		if err := json.Unmarshal(decoded.Values[i], target); err != nil {
+			return nil, ErrInvalidCursor
+		}
+		switch v := target.(type) {
+		case *bool:
+			values[i] = *v
+		case *int:
+			values[i] = *v
+		case *float64:
+			values[i] = *v
+		case *string:
+			values[i] = *v
+		case *time.Time:
+			values[i] = *v
+		case *uuid.UUID:
+			values[i] = *v
+		}
+	}
+	return values, nil
+}
+
+// keysetCondition selects the rows that come after the given key values in the ordering:
+// (a > ?) OR (a = ? AND b > ?) OR ..., with < for descending keys
+func keysetCondition(columns []sortColumn, values []interface{}) (string, []interface{}) {
+	var disjuncts []string
+	var args []interface{}
+	for i, column := range columns {
+		var parts []string
+		for j := 0; j < i; j++ {
+			parts = append(parts, columns[j].expr+" = "+columns[j].placeholder())
+			args = append(args, values[j])
+		}
+		op := " > "
+		if column.desc {
+			op = " < "
+		}
+		parts = append(parts, column.expr+op+column.placeholder())
+		args = append(args, values[i])
+		disjuncts = append(disjuncts, "("+strings.Join(parts, " AND ")+")")
+	}
+	return "(" + strings.Join(disjuncts, " OR ") + ")", args
+}
+
+func (c sortColumn) placeholder() string {
+	if c.arg == "" {
+		return "?"
+	}
+	return c.arg
+}
+
+// orderBy applies the ordering to tx
+func orderBy(tx *gorm.DB, columns []sortColumn) *gorm.DB {
+	for _, column := range columns {
+		direction := " ASC"
+		if column.desc {
+			direction = " DESC"
+		}
+		tx = tx.Order(column.expr + direction)
+	}
+	return tx
+}
+
+// paginate orders tx and, for paged requests, restricts it to the rows after the cursor.
+// One extra row is fetched to tell whether another page follows.
+func paginate(tx *gorm.DB, order string, columns []sortColumn, page PageRequest) (*gorm.DB, error) {
+	if page.Cursor != "" {
+		values, err := decodeCursor(page.Cursor, order, columns)
+		if err != nil {
+			return nil, err
+		}
+		condition, args := keysetCondition(columns, values)
+		tx = tx.Where(condition, args...)
+	}
+	tx = orderBy(tx, columns)
+	if page.Limit > 0 {
+		tx = tx.Limit(page.Limit + 1)
+	}
+	return tx, nil
+}
+
+// notePage trims the extra row fetched by paginate and returns the cursor for the next page
+func notePage(notes []models.Note, order string, columns []sortColumn, page PageRequest) ([]models.Note, string) {
+	if page.Limit <= 0 || len(notes) <= page.Limit {
+		return notes, ""
+	}
+	notes = notes[:page.Limit]
+	last := &notes[len(notes)-1]
+	values := make([]interface{}, len(columns))
+	for i, column := range columns {
+		values[i] = column.value(last)
+	}
+	return notes, encodeCursor(order, values)
+}
+
+// idColumn is the unique tie-breaker that ends every note ordering
+var idColumn = sortColumn{expr: "id", kind: kindUUID, value: func(n *models.Note) interface{} { return n.ID }}
+
+// noteSortColumns returns the stable ordering for a notes list sort key
+func noteSortColumns(sortBy string, desc bool) []sortColumn {
+	updated := func(desc bool) sortColumn {
+		return sortColumn{expr: "updated_at", desc: desc, kind: kindTime, value: func(n *models.Note) interface{} { return n.UpdatedAt }}
+	}
+	created := func(desc bool) sortColumn {
+		return sortColumn{expr: "created_at", desc: desc, kind: kindTime, value: func(n *models.Note) interface{} { return n.CreatedAt }}
+	}
+
+	switch sortBy {
+	case SortUpdated:
+		return []sortColumn{updated(desc), idColumn}
+	case SortCreated:
+		return []sortColumn{created(desc), idColumn}
+	case SortTitle:
+		return []sortColumn{
+			{expr: "LOWER(title)", arg: "LOWER(?)", desc: desc, kind: kindString, value: func(n *models.Note) interface{} { return n.Title }},
+			idColumn,
+		}
+	case SortPriority:
+		return []sortColumn{
+			{expr: "priority", desc: desc, kind: kindInt, value: func(n *models.Note) interface{} { return n.Priority }},
+			updated(true),
+			idColumn,
+		}
+	case SortManual:
+		return []sortColumn{
+			{expr: "position", desc: desc, kind: kindInt, value: func(n *models.Note) interface{} { return n.Position }},
+			created(false),
+			idColumn,
+		}
+	default:
+		// Pinned notes first, most recently updated first within each group
+		return []sortColumn{
+			{expr: "pinned", desc: true, kind: kindBool, value: func(n *models.Note) interface{} { return n.Pinned }},
+			updated(true),
+			idColumn,
+		}
+	}
+}
+
+// kanbanSortColumns is the order of notes within a Kanban column
+var kanbanSortColumns = []sortColumn{
+	{expr: "kanban_position", kind: kindInt, value: func(n *models.Note) interface{} { return n.KanbanPosition }},
+	{expr: "created_at", kind: kindTime, value: func(n *models.Note) interface{} { return n.CreatedAt }},
+	idColumn,
+}
+
+// newestFirstColumns orders notes by creation, newest first
+var newestFirstColumns = []sortColumn{
+	{expr: "created_at", desc: true, kind: kindTime, value: func(n *models.Note) interface{} { return n.CreatedAt }},
+	idColumn,
+}
+
+// searchSortColumns order ranked search results: best match first, then most recently updated
+var searchSortColumns = []sortColumn{
+	{expr: "rank", desc: true, kind: kindFloat},
+	{expr: "updated_at", desc: true, kind: kindTime},
+	{expr: "id", kind: kindUUID},
+}
+
+// PageHits orders search hits that were ranked in memory by rank and then note ID, and returns
+// the requested page of them
+func PageHits(hits []SearchHit, order string, page PageRequest) ([]SearchHit, string, error) {
+	sort.SliceStable(hits, func(i, j int) bool {
+		if hits[i].Rank != hits[j].Rank {
+			return hits[i].Rank > hits[j].Rank
+		}
+		return hits[i].Note.ID.String() < hits[j].Note.ID.String()
+	})
+
+	columns := []sortColumn{{expr: "rank", desc: true, kind: kindFloat}, {expr: "id", kind: kindUUID}}
+
+	start := 0
+	if page.Cursor != "" {
+		values, err := decodeCursor(page.Cursor, order, columns)
+		if err != nil {
+			return nil, "", err
+		}
+		rank, id := values[0].(float64), values[1].(uuid.UUID)
+		start = len(hits)
+		for i, hit := range hits {
+			if hit.Rank < rank || (hit.Rank == rank && hit.Note.ID.String() > id.String()) {
+				start = i
+				break
+			}
+		}
+	}
+	hits = hits[start:]
+
+	if page.Limit <= 0 || len(hits) <= page.Limit {
+		return hits, "", nil
+	}
+	hits = hits[:page.Limit]
+	last := hits[len(hits)-1]
+	return hits, encodeCursor(order, []interface{}{last.Rank, last.Note.ID}), nil
+}
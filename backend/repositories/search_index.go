@@ -0,0 +1,155 @@
+package repositories
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"NoteSense/models"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+)
+
+// blindTokenBytes is how much of each keyed lexeme hash a blinded index keeps
+const blindTokenBytes = 12
+
+// tsqueryLexemePattern matches the quoted lexemes of a tsquery's text form and their markers
+var tsqueryLexemePattern = regexp.MustCompile(`'((?:[^']|'')*)'(:[*A-Da-d]+)?`)
+
+// weightedText is a text indexed with a tsvector weight
+type weightedText struct {
+	Text   string
+	Weight string // "A" to "D"
+}
+
+// tsQuery is the SQL expression of a text search query and its arguments
+type tsQuery struct {
+	SQL  string
+	Args []interface{}
+}
+
+// searchBlinder replaces lexemes with keyed hashes. With at-rest encryption enabled, search
+// vectors hold these tokens instead of words, so they do not give away the encrypted text;
+// queries are blinded the same way to match them. The price is that matching is limited to
+// whole lexemes: the index keeps which tokens occur where, but not what they spell.
+type searchBlinder struct {
+	key []byte
+}
+
+// newSearchBlinder returns the user's search blinder, or nil when encryption is disabled and
+// indexes hold plain lexemes
+func newSearchBlinder(ctx context.Context, cipher *ContentCipher, userID uuid.UUID) (*searchBlinder, error) {
+	if !cipher.Enabled() {
+		return nil, nil
+	}
+	key, err := cipher.SearchKey(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &searchBlinder{key: key}, nil
+}
+
+func (b *searchBlinder) token(lexeme string) string {
+	mac := hmac.New(sha256.New, b.key)
+	mac.Write([]byte(lexeme))
+	return hex.EncodeToString(mac.Sum(nil)[:blindTokenBytes])
+}
+
+// userSearchConfig returns the text search configuration chosen by the user
+func userSearchConfig(ctx context.Context, db *gorm.DB, userID uuid.UUID) (string, error) {
+	var config string
+	if err := db.WithContext(ctx).Model(&models.User{}).
+		Where("id = ?", userID).
+		Select("COALESCE(NULLIF(search_language, ''), 'english')").
+		Scan(&config).Error; err != nil {
+		return "", err
+	}
+	if config == "" {
+		config = "english"
+	}
+	return config, nil
+}
+
+// searchVector computes the tsvector of weighted texts with the user's text search
+// configuration and returns it in text form, blinded when encryption is enabled. Postgres
+// parses and stems the texts but stores nothing; the caller writes the result.
+func searchVector(ctx context.Context, db *gorm.DB, cipher *ContentCipher, userID uuid.UUID, config string, parts ...weightedText) (string, bool, error) {
+	expressions := make([]string, len(parts))
+	args := make([]interface{}, 0, 2*len(parts))
+	for i, part := range parts {
+		expressions[i] = fmt.Sprintf("setweight(to_tsvector(?::regconfig, ?), '%s')", part.Weight)
+		args = append(args, config, part.Text)
+	}
+	vector := strings.Join(expressions, " || ")
+
+	blinder, err := newSearchBlinder(ctx, cipher, userID)
+	if err != nil {
+		return "", false, err
+	}
+	if blinder == nil {
+		var plain string
+		err := db.WithContext(ctx).Raw("SELECT ("+vector+")::text", args...).Scan(&plain).Error
+		return plain, false, err
+	}
+
+	var lexemes []struct {
+		Lexeme    string
+		Positions pq.Int64Array
+		Weights   pq.StringArray
+	}
+	if err := db.WithContext(ctx).Raw("SELECT lexeme, positions, weights FROM unnest("+vector+")", args...).
+		Scan(&lexemes).Error; err != nil {
+		return "", false, err
+	}
+	entries := make([]string, 0, len(lexemes))
+	for _, lexeme := range lexemes {
+		entry := "'" + blinder.token(lexeme.Lexeme) + "'"
+		for i, position := range lexeme.Positions {
+			separator := ","
+			if i == 0 {
+				separator = ":"
+			}
+			entry += fmt.Sprintf("%s%d", separator, position)
+			if i < len(lexeme.Weights) {
+				entry += lexeme.Weights[i]
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return strings.Join(entries, " "), true, nil
+}
+
+// textSearchQuery turns free text in websearch_to_tsquery syntax into a query for the user's
+// search vectors
+func (r *NoteRepository) textSearchQuery(ctx context.Context, userID uuid.UUID, config, text string) (tsQuery, error) {
+	blinder, err := newSearchBlinder(ctx, r.cipher, userID)
+	if err != nil {
+		return tsQuery{}, err
+	}
+	if blinder == nil {
+		return tsQuery{SQL: "websearch_to_tsquery(?::regconfig, ?)", Args: []interface{}{config, text}}, nil
+	}
+
+	var plain string
+	if err := r.db.WithContext(ctx).Raw("SELECT websearch_to_tsquery(?::regconfig, ?)::text", config, text).
+		Scan(&plain).Error; err != nil {
+		return tsQuery{}, err
+	}
+	blinded := tsqueryLexemePattern.ReplaceAllStringFunc(plain, func(match string) string {
+		parts := tsqueryLexemePattern.FindStringSubmatch(match)
+		lexeme := strings.ReplaceAll(parts[1], "''", "'")
+		// Prefix matching cannot work on hashes, so only weight markers are kept
+		markers := strings.ReplaceAll(strings.TrimPrefix(parts[2], ":"), "*", "")
+		if markers != "" {
+			markers = ":" + markers
+		}
+		return "'" + blinder.token(lexeme) + "'" + markers
+	})
+	return tsQuery{SQL: "?::tsquery", Args: []interface{}{blinded}}, nil
+}
@@ -0,0 +1,536 @@
+package repositories
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"NoteSense/contracts"
+
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+)
+
+// Fields understood by the search query language
+const (
+	FieldStatus   = "status"
+	FieldPriority = "priority"
+	FieldTag      = "tag"
+	FieldTitle    = "title"
+	FieldCreated  = "created"
+	FieldUpdated  = "updated"
+	FieldIs       = "is"
+	FieldHas      = "has"
+	FieldIn       = "in"
+)
+
+// Search scopes: where free-text terms must match
+const (
+	ScopeAll         = "all"
+	ScopeBody        = "body"        // Title, categories and note body
+	ScopeAttachments = "attachments" // Text extracted from attached images and audio
+)
+
+// searchFieldNames maps accepted field names, including aliases, to their canonical field
+var searchFieldNames = map[string]string{
+	"status":   FieldStatus,
+	"state":    FieldStatus,
+	"priority": FieldPriority,
+	"tag":      FieldTag,
+	"category": FieldTag,
+	"title":    FieldTitle,
+	"created":  FieldCreated,
+	"updated":  FieldUpdated,
+	"is":       FieldIs,
+	"has":      FieldHas,
+	"in":       FieldIn,
+}
+
+// searchScopes maps accepted in: values to their scope
+var searchScopes = map[string]string{
+	"all":         ScopeAll,
+	"body":        ScopeBody,
+	"note":        ScopeBody,
+	"attachment":  ScopeAttachments,
+	"attachments": ScopeAttachments,
+}
+
+// SearchOp is a comparison operator of a field filter
+type SearchOp string
+
+const (
+	OpEq  SearchOp = "="
+	OpGt  SearchOp = ">"
+	OpGte SearchOp = ">="
+	OpLt  SearchOp = "<"
+	OpLte SearchOp = "<="
+)
+
+// Values accepted by the is: and has: fields
+var (
+	searchFlags = map[string]string{
+		"pinned":   "pinned",
+		"favorite": "favorite",
+		"archived": "archived",
+		"locked":   "encrypted",
+	}
+	searchPresence = map[string]string{
+		"attachment":  "length(ts_filter(search_vector, '{d}')) > 0",
+		"attachments": "length(ts_filter(search_vector, '{d}')) > 0",
+		"connection":  "EXISTS (SELECT 1 FROM note_connections c WHERE c.source_id = notes.id OR c.target_id = notes.id)",
+		"connections": "EXISTS (SELECT 1 FROM note_connections c WHERE c.source_id = notes.id OR c.target_id = notes.id)",
+	}
+)
+
+// SearchQuery is the parsed form of a search: free-text terms and field filters, all of which must match
+type SearchQuery struct {
+	Terms   []SearchTerm
+	Filters []SearchFilter
+	Scope   string // Where terms must match; empty means ScopeAll
+}
+
+// SearchTerm is a word or quoted phrase matched against the full-text index
+type SearchTerm struct {
+	Text    string
+	Phrase  bool
+	Negated bool
+	Or      bool // The term is the OR operator between its neighbours
+	Pos     int
+}
+
+// SearchFilter restricts results on a note field
+type SearchFilter struct {
+	Field    string
+	Op       SearchOp
+	Values   []string  // status, tag, title, is and has
+	Number   int       // priority
+	Time     time.Time // created and updated
+	DateOnly bool      // Time names a whole (UTC) day
+	Negated  bool
+	Pos      int
+}
+
+// SearchQueryError reports a malformed search query and the token that caused it
+type SearchQueryError struct {
+	Position int // 1-based character offset of the token
+	Token    string
+	Message  string
+}
+
+func (e *SearchQueryError) Error() string {
+	return fmt.Sprintf("invalid search query at position %d (%q): %s", e.Position, e.Token, e.Message)
+}
+
+func newSearchQueryError(input string, offset int, token, message string) *SearchQueryError {
+	return &SearchQueryError{
+		Position: utf8.RuneCountInString(input[:offset]) + 1,
+		Token:    token,
+		Message:  message,
+	}
+}
+
+// ParseSearchQuery parses queries such as
+//
+//	status:todo priority:>=2 tag:infra created:>2026-01-01 has:attachment "exact phrase" -draft
+//
+// Bare words and quoted phrases are full-text terms, "-" negates a term or filter and
+// OR joins two terms. Comma-separated values (status:todo,done) match any of them, and
+// in:body or in:attachments limits where the terms must match.
+func ParseSearchQuery(input string) (*SearchQuery, error) {
+	query := &SearchQuery{}
+
+	i := 0
+	for i < len(input) {
+		if isQuerySpace(input[i]) {
+			i++
+			continue
+		}
+		start := i
+
+		negated := false
+		if input[i] == '-' {
+			negated = true
+			i++
+			if i >= len(input) || isQuerySpace(input[i]) {
+				return nil, newSearchQueryError(input, start, "-", "expected a term after '-'")
+			}
+		}
+
+		if input[i] == '"' {
+			phrase, next, err := readQuoted(input, i)
+			if err != nil {
+				return nil, err
+			}
+			i = next
+			if strings.TrimSpace(phrase) == "" {
+				continue
+			}
+			query.Terms = append(query.Terms, SearchTerm{Text: phrase, Phrase: true, Negated: negated, Pos: start})
+			continue
+		}
+
+		end := i
+		for end < len(input) && !isQuerySpace(input[end]) && input[end] != '"' {
+			end++
+		}
+		word := input[i:end]
+
+		colon := strings.IndexByte(word, ':')
+		if colon > 0 && isFieldName(word[:colon]) && !strings.HasPrefix(word[colon+1:], "//") {
+			name := strings.ToLower(word[:colon])
+			field, ok := searchFieldNames[name]
+			if !ok {
+				return nil, newSearchQueryError(input, start, input[start:end], fmt.Sprintf("unknown field %q; expected one of status, priority, tag, title, created, updated, is, has, in", name))
+			}
+
+			if field == FieldIn {
+				scope, ok := searchScopes[strings.ToLower(word[colon+1:])]
+				if !ok || negated {
+					return nil, newSearchQueryError(input, start, input[start:end], "in: expects body, attachments or all")
+				}
+				query.Scope = scope
+				i = end
+				continue
+			}
+
+			raw, quoted := word[colon+1:], false
+			if raw == "" && end < len(input) && input[end] == '"' {
+				value, next, err := readQuoted(input, end)
+				if err != nil {
+					return nil, err
+				}
+				raw, quoted, end = value, true, next
+			}
+
+			filter, message := parseSearchFilter(field, raw, quoted)
+			if message != "" {
+				return nil, newSearchQueryError(input, start, input[start:end], message)
+			}
+			filter.Negated = negated
+			filter.Pos = start
+			query.Filters = append(query.Filters, filter)
+			i = end
+			continue
+		}
+
+		i = end
+		if word == "OR" && !negated {
+			query.Terms = append(query.Terms, SearchTerm{Text: word, Or: true, Pos: start})
+			continue
+		}
+		query.Terms = append(query.Terms, SearchTerm{Text: word, Negated: negated, Pos: start})
+	}
+
+	return query, nil
+}
+
+// AddFilters adds the structured filters of a search request to a parsed query, as if they
+// had been written in the query language
+func (q *SearchQuery) AddFilters(filters *contracts.SearchFilters) {
+	add := func(field string, op SearchOp, values []string, negated bool) {
+		q.Filters = append(q.Filters, SearchFilter{Field: field, Op: op, Values: values, Negated: negated})
+	}
+
+	if len(filters.Status) > 0 {
+		statuses := make([]string, len(filters.Status))
+		for i, status := range filters.Status {
+			statuses[i] = strings.ToLower(status)
+		}
+		add(FieldStatus, OpEq, statuses, false)
+	}
+	if len(filters.Tags) > 0 {
+		add(FieldTag, OpEq, filters.Tags, false)
+	}
+	if len(filters.ExcludeTags) > 0 {
+		add(FieldTag, OpEq, filters.ExcludeTags, true)
+	}
+	if filters.Title != "" {
+		add(FieldTitle, OpEq, []string{filters.Title}, false)
+	}
+
+	if filters.MinPriority != nil {
+		q.Filters = append(q.Filters, SearchFilter{Field: FieldPriority, Op: OpGte, Number: *filters.MinPriority})
+	}
+	if filters.MaxPriority != nil {
+		q.Filters = append(q.Filters, SearchFilter{Field: FieldPriority, Op: OpLte, Number: *filters.MaxPriority})
+	}
+
+	addTime := func(field string, op SearchOp, t *time.Time) {
+		if t != nil {
+			q.Filters = append(q.Filters, SearchFilter{Field: field, Op: op, Time: *t})
+		}
+	}
+	addTime(FieldCreated, OpGt, filters.CreatedAfter)
+	addTime(FieldCreated, OpLt, filters.CreatedBefore)
+	addTime(FieldUpdated, OpGt, filters.UpdatedAfter)
+	addTime(FieldUpdated, OpLt, filters.UpdatedBefore)
+
+	addFlag := func(field, value string, set *bool) {
+		if set != nil {
+			add(field, OpEq, []string{value}, !*set)
+		}
+	}
+	addFlag(FieldHas, "attachment", filters.HasAttachment)
+	addFlag(FieldIs, "pinned", filters.Pinned)
+	addFlag(FieldIs, "favorite", filters.Favorite)
+	addFlag(FieldIs, "archived", filters.Archived)
+	addFlag(FieldIs, "locked", filters.Locked)
+
+	for _, phrase := range filters.Phrases {
+		q.Terms = append(q.Terms, SearchTerm{Text: phrase, Phrase: true})
+	}
+	for _, excluded := range filters.Exclude {
+		q.Terms = append(q.Terms, SearchTerm{Text: excluded, Phrase: true, Negated: true})
+	}
+}
+
+// parseSearchFilter builds a filter from a field's raw value, returning an error message if it is invalid
+func parseSearchFilter(field, raw string, quoted bool) (SearchFilter, string) {
+	filter := SearchFilter{Field: field, Op: OpEq}
+
+	value := raw
+	if !quoted {
+		for _, op := range []SearchOp{OpGte, OpLte, OpGt, OpLt, OpEq} {
+			if strings.HasPrefix(value, string(op)) {
+				filter.Op = op
+				value = value[len(op):]
+				break
+			}
+		}
+	}
+	if value == "" {
+		return filter, fmt.Sprintf("missing value for %s", field)
+	}
+
+	switch field {
+	case FieldPriority, FieldCreated, FieldUpdated:
+	default:
+		if filter.Op != OpEq {
+			return filter, fmt.Sprintf("%s does not support comparisons", field)
+		}
+	}
+
+	switch field {
+	case FieldStatus, FieldTag:
+		for _, part := range strings.Split(value, ",") {
+			part = strings.TrimSpace(part)
+			if part == "" {
+				return filter, fmt.Sprintf("empty value in %s list", field)
+			}
+			if field == FieldStatus {
+				part = strings.ToLower(part)
+			}
+			filter.Values = append(filter.Values, part)
+		}
+
+	case FieldTitle:
+		filter.Values = []string{value}
+
+	case FieldPriority:
+		number, err := strconv.Atoi(value)
+		if err != nil {
+			return filter, "priority must be a whole number"
+		}
+		filter.Number = number
+
+	case FieldCreated, FieldUpdated:
+		if day, err := time.Parse("2006-01-02", value); err == nil {
+			filter.Time, filter.DateOnly = day, true
+		} else if moment, err := time.Parse(time.RFC3339, value); err == nil {
+			filter.Time = moment
+		} else {
+			return filter, "expected a date like 2026-01-31 or an RFC 3339 timestamp"
+		}
+
+	case FieldIs:
+		value = strings.ToLower(value)
+		if _, ok := searchFlags[value]; !ok {
+			return filter, "is: expects pinned, favorite, archived or locked"
+		}
+		filter.Values = []string{value}
+
+	case FieldHas:
+		value = strings.ToLower(value)
+		if _, ok := searchPresence[value]; !ok {
+			return filter, "has: expects attachment or connection"
+		}
+		filter.Values = []string{value}
+	}
+
+	return filter, ""
+}
+
+// readQuoted reads the quoted string starting at input[start] and returns its content and the offset after it
+func readQuoted(input string, start int) (string, int, error) {
+	end := strings.IndexByte(input[start+1:], '"')
+	if end < 0 {
+		return "", 0, newSearchQueryError(input, start, input[start:], "unterminated quote")
+	}
+	return input[start+1 : start+1+end], start + end + 2, nil
+}
+
+func isQuerySpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+// isFieldName reports whether s looks like a field name rather than text such as "10:30"
+func isFieldName(s string) bool {
+	for _, r := range s {
+		if (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+// TextQuery returns the free-text terms in websearch_to_tsquery syntax
+func (q *SearchQuery) TextQuery() string {
+	parts := make([]string, 0, len(q.Terms))
+	for _, term := range q.Terms {
+		switch {
+		case term.Or:
+			parts = append(parts, "or")
+			continue
+		case term.Phrase:
+			// Structured filters may pass phrases containing quotes, which would end the phrase early
+			parts = append(parts, negation(term.Negated)+`"`+strings.ReplaceAll(term.Text, `"`, " ")+`"`)
+		default:
+			parts = append(parts, negation(term.Negated)+term.Text)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+func negation(negated bool) string {
+	if negated {
+		return "-"
+	}
+	return ""
+}
+
+// filtersArchived reports whether the query explicitly asks about archived notes
+func (q *SearchQuery) filtersArchived() bool {
+	for _, filter := range q.Filters {
+		if filter.Field == FieldIs && filter.Values[0] == "archived" {
+			return true
+		}
+	}
+	return false
+}
+
+// textMatch returns the clause matching the free text within the query's scope. Attachment
+// text is indexed per file and also, for older uploads, as the D weight of the note's vector.
+func (q *SearchQuery) textMatch(text tsQuery) (string, []interface{}) {
+	switch q.Scope {
+	case ScopeBody:
+		return "ts_filter(search_vector, '{a,b,c}') @@ " + text.SQL, text.Args
+	case ScopeAttachments:
+		return `(ts_filter(search_vector, '{d}') @@ ` + text.SQL + ` OR EXISTS (
+			SELECT 1 FROM file_metadata f
+			WHERE f.note_id = notes.id AND f.deleted_at IS NULL
+				AND f.search_vector @@ ` + text.SQL + `))`, append(append([]interface{}{}, text.Args...), text.Args...)
+	}
+	return "search_vector @@ " + text.SQL, text.Args
+}
+
+// rankedVector returns the part of the note vector that ranking should consider for the scope
+func (q *SearchQuery) rankedVector() string {
+	switch q.Scope {
+	case ScopeBody:
+		return "ts_filter(search_vector, '{a,b,c}')"
+	case ScopeAttachments:
+		return "ts_filter(search_vector, '{d}')"
+	}
+	return "search_vector"
+}
+
+// Words returns the text of the positive terms, e.g. for similarity matching
+func (q *SearchQuery) Words() []string {
+	var words []string
+	for _, term := range q.Terms {
+		if !term.Or && !term.Negated {
+			words = append(words, strings.Fields(term.Text)...)
+		}
+	}
+	return words
+}
+
+// excludedTextQuery returns the negated terms as a websearch_to_tsquery matching any of them
+func (q *SearchQuery) excludedTextQuery() string {
+	var parts []string
+	for _, term := range q.Terms {
+		if !term.Negated {
+			continue
+		}
+		if term.Phrase {
+			parts = append(parts, `"`+strings.ReplaceAll(term.Text, `"`, " ")+`"`)
+		} else {
+			parts = append(parts, term.Text)
+		}
+	}
+	return strings.Join(parts, " or ")
+}
+
+// apply adds the query's field filters to tx as parameterized clauses.
+// Archived notes are excluded unless the query filters on them.
+func (q *SearchQuery) apply(tx *gorm.DB) *gorm.DB {
+	if !q.filtersArchived() {
+		tx = tx.Where("NOT archived")
+	}
+	for _, filter := range q.Filters {
+		clause, args := filter.clause()
+		if filter.Negated {
+			clause = "NOT (" + clause + ")"
+		}
+		tx = tx.Where(clause, args...)
+	}
+	return tx
+}
+
+// clause translates the filter into SQL. Only validated operators and fixed column names are
+// interpolated; every value is passed as a parameter.
+func (f SearchFilter) clause() (string, []interface{}) {
+	switch f.Field {
+	case FieldStatus:
+		return "LOWER(status) IN ?", []interface{}{f.Values}
+	case FieldTag:
+		return "categories && ?", []interface{}{pq.StringArray(f.Values)}
+	case FieldTitle:
+		return `title ILIKE ? ESCAPE '\'`, []interface{}{"%" + escapeLike(f.Values[0]) + "%"}
+	case FieldPriority:
+		return "priority " + string(f.Op) + " ?", []interface{}{f.Number}
+	case FieldCreated, FieldUpdated:
+		column := "created_at"
+		if f.Field == FieldUpdated {
+			column = "updated_at"
+		}
+		if !f.DateOnly {
+			return column + " " + string(f.Op) + " ?", []interface{}{f.Time}
+		}
+		nextDay := f.Time.AddDate(0, 0, 1)
+		switch f.Op {
+		case OpGt:
+			return column + " >= ?", []interface{}{nextDay}
+		case OpGte:
+			return column + " >= ?", []interface{}{f.Time}
+		case OpLt:
+			return column + " < ?", []interface{}{f.Time}
+		case OpLte:
+			return column + " < ?", []interface{}{nextDay}
+		default:
+			return column + " >= ? AND " + column + " < ?", []interface{}{f.Time, nextDay}
+		}
+	case FieldIs:
+		return searchFlags[f.Values[0]], nil
+	case FieldHas:
+		return searchPresence[f.Values[0]], nil
+	}
+	return "TRUE", nil
+}
+
+// escapeLike escapes LIKE wildcards so user input matches literally
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
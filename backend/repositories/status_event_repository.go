@@ -0,0 +1,43 @@
+package repositories
+
+import (
+	"context"
+
+	"NoteSense/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// StatusEventRepository handles the history of note status changes
+type StatusEventRepository struct {
+	db *gorm.DB
+}
+
+func NewStatusEventRepository(db *gorm.DB) *StatusEventRepository {
+	return &StatusEventRepository{db: db}
+}
+
+// WithTx returns a copy of the repository working within tx
+func (r *StatusEventRepository) WithTx(tx *gorm.DB) *StatusEventRepository {
+	return &StatusEventRepository{db: tx}
+}
+
+func (r *StatusEventRepository) Create(ctx context.Context, event *models.StatusEvent) error {
+	return r.db.WithContext(ctx).Create(event).Error
+}
+
+// ListForNotes returns the user's status changes of the given notes, oldest first
+func (r *StatusEventRepository) ListForNotes(ctx context.Context, noteIDs []uuid.UUID, userID uuid.UUID) ([]models.StatusEvent, error) {
+	events := []models.StatusEvent{}
+	if len(noteIDs) == 0 {
+		return events, nil
+	}
+	if err := r.db.WithContext(ctx).
+		Where("user_id = ? AND note_id IN ?", userID, noteIDs).
+		Order("created_at ASC").
+		Find(&events).Error; err != nil {
+		return nil, err
+	}
+	return events, nil
+}
@@ -0,0 +1,71 @@
+package repositories
+
+import (
+	"context"
+
+	"NoteSense/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// TemplateRepository handles note template data operations
+type TemplateRepository struct {
+	db *gorm.DB
+}
+
+func NewTemplateRepository(db *gorm.DB) *TemplateRepository {
+	return &TemplateRepository{db: db}
+}
+
+func (r *TemplateRepository) Create(ctx context.Context, template *models.NoteTemplate) error {
+	return r.db.WithContext(ctx).Create(template).Error
+}
+
+func (r *TemplateRepository) Update(ctx context.Context, template *models.NoteTemplate) error {
+	return r.db.WithContext(ctx).Save(template).Error
+}
+
+func (r *TemplateRepository) Delete(ctx context.Context, templateID uuid.UUID, userID uuid.UUID) error {
+	return r.db.WithContext(ctx).
+		Where("id = ? AND user_id = ?", templateID, userID).
+		Delete(&models.NoteTemplate{}).Error
+}
+
+// ListVisible returns the user's own templates plus the workspace templates of the admins
+// listed in adminEmails
+func (r *TemplateRepository) ListVisible(ctx context.Context, userID uuid.UUID, adminEmails []string) ([]models.NoteTemplate, error) {
+	var templates []models.NoteTemplate
+	if err := r.visible(ctx, userID, adminEmails).
+		Order("name").
+		Find(&templates).Error; err != nil {
+		return nil, err
+	}
+	return templates, nil
+}
+
+// GetVisibleByID returns a template the user owns or that an admin shared with the workspace
+func (r *TemplateRepository) GetVisibleByID(ctx context.Context, templateID uuid.UUID, userID uuid.UUID, adminEmails []string) (*models.NoteTemplate, error) {
+	var template models.NoteTemplate
+	result := r.visible(ctx, userID, adminEmails).
+		Where("id = ?", templateID).
+		First(&template)
+	if result.Error != nil {
+		if result.Error == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, result.Error
+	}
+	return &template, nil
+}
+
+// visible selects the templates a user may see. A workspace template is only shared while its
+// owner is an admin, so one left over from a former admin goes back to being private.
+func (r *TemplateRepository) visible(ctx context.Context, userID uuid.UUID, adminEmails []string) *gorm.DB {
+	query := r.db.WithContext(ctx)
+	if len(adminEmails) == 0 {
+		return query.Where("user_id = ?", userID)
+	}
+	return query.Where("user_id = ? OR (scope = ? AND user_id IN (SELECT id FROM users WHERE lower(email) IN ?))",
+		userID, models.TemplateScopeWorkspace, adminEmails)
+}
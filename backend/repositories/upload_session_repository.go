@@ -0,0 +1,77 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"NoteSense/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// UploadSessionRepository handles resumable uploads in progress
+type UploadSessionRepository struct {
+	db *gorm.DB
+}
+
+func NewUploadSessionRepository(db *gorm.DB) *UploadSessionRepository {
+	return &UploadSessionRepository{db: db}
+}
+
+// UploadReservation is what a user's uploads in progress have claimed
+type UploadReservation struct {
+	Uploads int64
+	Bytes   int64 // Declared sizes, counted against the storage quota until the uploads end
+}
+
+// Create saves a new upload once check accepts what the user's other unexpired uploads reserve.
+// A lock per user is held meanwhile, so uploads started at the same time count each other.
+func (r *UploadSessionRepository) Create(ctx context.Context, session *models.UploadSession, check func(UploadReservation) error) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", "upload:"+session.UserID.String()).Error; err != nil {
+			return err
+		}
+		var reserved UploadReservation
+		if err := tx.Model(&models.UploadSession{}).
+			Select("COUNT(*) AS uploads, COALESCE(SUM(size), 0) AS bytes").
+			Where("user_id = ? AND expires_at >= ?", session.UserID, time.Now()).
+			Scan(&reserved).Error; err != nil {
+			return err
+		}
+		if err := check(reserved); err != nil {
+			return err
+		}
+		return tx.Create(session).Error
+	})
+}
+
+// GetByID returns one of the user's uploads, or nil if it does not exist
+func (r *UploadSessionRepository) GetByID(ctx context.Context, sessionID, userID uuid.UUID) (*models.UploadSession, error) {
+	var session models.UploadSession
+	result := r.db.WithContext(ctx).Where("id = ? AND user_id = ?", sessionID, userID).First(&session)
+	if result.Error != nil {
+		if result.Error == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, result.Error
+	}
+	return &session, nil
+}
+
+// SetOffset records how many bytes of an upload have been received and when it now expires
+func (r *UploadSessionRepository) SetOffset(ctx context.Context, session *models.UploadSession) error {
+	return r.db.WithContext(ctx).Model(session).
+		Updates(map[string]interface{}{"offset": session.Offset, "expires_at": session.ExpiresAt}).Error
+}
+
+func (r *UploadSessionRepository) Delete(ctx context.Context, sessionID uuid.UUID) error {
+	return r.db.WithContext(ctx).Delete(&models.UploadSession{}, "id = ?", sessionID).Error
+}
+
+// ListExpired returns the uploads that expired before now
+func (r *UploadSessionRepository) ListExpired(ctx context.Context, now time.Time) ([]models.UploadSession, error) {
+	var sessions []models.UploadSession
+	err := r.db.WithContext(ctx).Where("expires_at < ?", now).Find(&sessions).Error
+	return sessions, err
+}
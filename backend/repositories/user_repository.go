@@ -6,6 +6,7 @@ import (
 
 	"NoteSense/models"
 
+	"github.com/google/uuid"
 	"github.com/lib/pq"
 	"gorm.io/gorm"
 )
@@ -54,6 +55,13 @@ func (r *UserRepository) FindByID(id string) (*models.User, error) {
 	return &user, nil
 }
 
+// UpdateSearchLanguage stores the user's text search configuration
+func (r *UserRepository) UpdateSearchLanguage(ctx context.Context, userID uuid.UUID, language string) error {
+	return r.db.WithContext(ctx).Model(&models.User{}).
+		Where("id = ?", userID).
+		Update("search_language", language).Error
+}
+
 // BlacklistToken adds a token to the blacklist
 func (r *UserRepository) BlacklistToken(token *models.TokenBlacklist) error {
 	return r.db.Create(token).Error
@@ -0,0 +1,35 @@
+#!/usr/bin/env python3
+"""Embed texts read from stdin as a JSON array and print the vectors as a JSON array."""
+import argparse
+import json
+import logging
+import sys
+
+logging.basicConfig(level=logging.INFO,
+                    format='%(asctime)s - %(levelname)s - %(message)s',
+                    handlers=[logging.StreamHandler(sys.stderr)])
+
+try:
+    from sentence_transformers import SentenceTransformer
+except ImportError as e:
+    logging.error(f"Import Error: {e}")
+    sys.exit(1)
+
+
+def main():
+    parser = argparse.ArgumentParser()
+    parser.add_argument("--model", default="sentence-transformers/all-MiniLM-L6-v2")
+    args = parser.parse_args()
+
+    texts = json.load(sys.stdin)
+    if not isinstance(texts, list):
+        logging.error("Expected a JSON array of texts")
+        sys.exit(1)
+
+    model = SentenceTransformer(args.model, device="cpu")
+    vectors = model.encode(texts, batch_size=16, normalize_embeddings=True, show_progress_bar=False)
+    json.dump([vector.tolist() for vector in vectors], sys.stdout)
+
+
+if __name__ == "__main__":
+    main()
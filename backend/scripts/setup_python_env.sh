@@ -50,6 +50,7 @@ pip install SpeechRecognition
 # Optional: Install additional NLP libraries
 pip install transformers
 pip install torch
+pip install sentence-transformers
 
 # Verify Tesseract installation
 echo "Tesseract Version:"
@@ -0,0 +1,39 @@
+package services
+
+import (
+	"os"
+	"sort"
+	"strings"
+
+	"NoteSense/models"
+)
+
+// adminList holds the lowercased emails of the users listed in ADMIN_EMAILS. Admins administer
+// the audit log and are the only users who may share templates and connection types with the
+// workspace.
+type adminList map[string]bool
+
+func adminListFromEnv() adminList {
+	admins := make(adminList)
+	for _, email := range strings.Split(os.Getenv("ADMIN_EMAILS"), ",") {
+		if email = strings.ToLower(strings.TrimSpace(email)); email != "" {
+			admins[email] = true
+		}
+	}
+	return admins
+}
+
+// includes reports whether a user is an admin
+func (a adminList) includes(user *models.User) bool {
+	return user != nil && a[strings.ToLower(user.Email)]
+}
+
+// emails returns the admins' emails in order
+func (a adminList) emails() []string {
+	emails := make([]string, 0, len(a))
+	for email := range a {
+		emails = append(emails, email)
+	}
+	sort.Strings(emails)
+	return emails
+}
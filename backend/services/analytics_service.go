@@ -0,0 +1,354 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"NoteSense/contracts"
+	"NoteSense/models"
+	"NoteSense/repositories"
+
+	"github.com/google/uuid"
+)
+
+// Bounds of the analytics periods
+const (
+	DefaultThroughputWeeks = 12
+	MaxThroughputWeeks     = 104
+	DefaultFlowDays        = 30
+	MaxFlowDays            = 365
+)
+
+const analyticsDateLayout = "2006-01-02"
+
+// AnalyticsFilter selects the notes flow analytics cover
+type AnalyticsFilter struct {
+	BoardID    *uuid.UUID // Only the notes a board shows, in its columns; default board columns otherwise
+	Categories []string   // Only notes in any of these categories
+}
+
+// AnalyticsService computes flow metrics from the recorded status changes of notes. Notes moved
+// before changes were recorded only count from their first recorded move.
+type AnalyticsService struct {
+	EventRepo    *repositories.StatusEventRepository
+	BoardService *BoardService
+}
+
+// NewAnalyticsService creates a new AnalyticsService
+func NewAnalyticsService(eventRepo *repositories.StatusEventRepository, boardService *BoardService) *AnalyticsService {
+	return &AnalyticsService{
+		EventRepo:    eventRepo,
+		BoardService: boardService,
+	}
+}
+
+// analyticsScope is the board, notes and status history an analytics query covers
+type analyticsScope struct {
+	board  *models.Board
+	flow   *workflow
+	notes  []models.Note
+	events map[uuid.UUID][]models.StatusEvent // Per note, oldest first
+}
+
+func (s *AnalyticsService) scope(filter AnalyticsFilter, userID uuid.UUID) (*analyticsScope, error) {
+	if userID == uuid.Nil {
+		return nil, fmt.Errorf("user ID is required")
+	}
+	noteService := s.BoardService.NoteService
+	ctx := context.Background()
+
+	scope := &analyticsScope{}
+	var err error
+	if filter.BoardID != nil {
+		scope.board, err = s.BoardService.GetBoardByID(*filter.BoardID, userID)
+		if err != nil {
+			return nil, err
+		}
+		scope.notes, err = s.BoardService.boardCards(scope.board, true, userID)
+		if err != nil {
+			return nil, err
+		}
+		if len(filter.Categories) > 0 {
+			scope.notes = notesInCategories(scope.notes, filter.Categories)
+		}
+	} else {
+		scope.board, err = noteService.kanbanBoard(userID)
+		if err != nil {
+			return nil, err
+		}
+		scope.notes, err = noteService.NoteRepo.GetKanbanNotes(ctx, userID, filter.Categories, true)
+		if err != nil {
+			return nil, fmt.Errorf("failed to retrieve notes: %v", err)
+		}
+	}
+	scope.flow, err = noteService.loadWorkflow(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]uuid.UUID, 0, len(scope.notes))
+	for _, note := range scope.notes {
+		ids = append(ids, note.ID)
+	}
+	events, err := s.EventRepo.ListForNotes(ctx, ids, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve status history: %v", err)
+	}
+	scope.events = make(map[uuid.UUID][]models.StatusEvent, len(ids))
+	for _, event := range events {
+		scope.events[event.NoteID] = append(scope.events[event.NoteID], event)
+	}
+	return scope, nil
+}
+
+// FlowTimes returns the lead and cycle times of the notes finished at or after from and before to,
+// either of which may be nil. A note reopened and finished again counts from its last finish.
+func (s *AnalyticsService) FlowTimes(filter AnalyticsFilter, from, to *time.Time, userID uuid.UUID) (*contracts.FlowTimesResponse, error) {
+	scope, err := s.scope(filter, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &contracts.FlowTimesResponse{Notes: []contracts.NoteFlowTime{}}
+	var leadTimes, cycleTimes []float64
+	for _, note := range scope.notes {
+		if scope.flow.stateOf(note.Status) != models.StateDone {
+			continue
+		}
+		events := scope.events[note.ID]
+		doneAt := finishedAt(events)
+		if doneAt == nil || (from != nil && doneAt.Before(*from)) || (to != nil && !doneAt.Before(*to)) {
+			continue
+		}
+
+		item := contracts.NoteFlowTime{
+			ID:            note.ID,
+			Title:         note.Title,
+			Status:        note.Status,
+			CreatedAt:     note.CreatedAt,
+			DoneAt:        *doneAt,
+			LeadTimeHours: hours(doneAt.Sub(note.CreatedAt)),
+		}
+		if startedAt := workStartedAt(events); startedAt != nil && !startedAt.After(*doneAt) {
+			cycle := hours(doneAt.Sub(*startedAt))
+			item.StartedAt = startedAt
+			item.CycleTimeHours = &cycle
+			cycleTimes = append(cycleTimes, cycle)
+		}
+		leadTimes = append(leadTimes, item.LeadTimeHours)
+		response.Notes = append(response.Notes, item)
+	}
+
+	sort.Slice(response.Notes, func(i, j int) bool { return response.Notes[i].DoneAt.Before(response.Notes[j].DoneAt) })
+	response.LeadTime = durationStats(leadTimes)
+	response.CycleTime = durationStats(cycleTimes)
+	return response, nil
+}
+
+// Throughput counts the notes finished in each of the last weeks, the current week included.
+// Every move into done counts, so a note reopened and finished again counts twice.
+func (s *AnalyticsService) Throughput(filter AnalyticsFilter, weeks int, userID uuid.UUID) (*contracts.ThroughputResponse, error) {
+	if weeks < 1 || weeks > MaxThroughputWeeks {
+		return nil, fmt.Errorf("weeks must be between 1 and %d", MaxThroughputWeeks)
+	}
+	scope, err := s.scope(filter, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	first := weekStart(time.Now().UTC()).AddDate(0, 0, -7*(weeks-1))
+	response := &contracts.ThroughputResponse{Weeks: make([]contracts.ThroughputWeek, weeks)}
+	for i := range response.Weeks {
+		response.Weeks[i].WeekStart = first.AddDate(0, 0, 7*i).Format(analyticsDateLayout)
+	}
+	for _, events := range scope.events {
+		for _, event := range events {
+			if !finishes(event) || event.CreatedAt.Before(first) {
+				continue
+			}
+			week := int(event.CreatedAt.UTC().Sub(first).Hours() / (24 * 7))
+			if week < weeks {
+				response.Weeks[week].Count++
+			}
+		}
+	}
+	return response, nil
+}
+
+// CumulativeFlow counts the notes in each board column at the end of each of the last days, today
+// included. Notes are placed by the status they had then, in today's board layout.
+func (s *AnalyticsService) CumulativeFlow(filter AnalyticsFilter, days int, userID uuid.UUID) (*contracts.CumulativeFlowResponse, error) {
+	if days < 1 || days > MaxFlowDays {
+		return nil, fmt.Errorf("days must be between 1 and %d", MaxFlowDays)
+	}
+	scope, err := s.scope(filter, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &contracts.CumulativeFlowResponse{
+		Series: make([]contracts.FlowSeries, 0, len(scope.board.Columns)),
+		Days:   make([]contracts.FlowDay, 0, days),
+	}
+	for _, column := range scope.board.Columns {
+		response.Series = append(response.Series, contracts.FlowSeries{Key: column.Key, Name: column.Name})
+	}
+
+	now := time.Now().UTC()
+	today := now.Truncate(24 * time.Hour)
+	for i := days - 1; i >= 0; i-- {
+		day := today.AddDate(0, 0, -i)
+		end := day.AddDate(0, 0, 1)
+		if end.After(now) {
+			end = now
+		}
+		counts := make(map[string]int, len(scope.board.Columns))
+		for _, column := range scope.board.Columns {
+			counts[column.Key] = 0
+		}
+		for _, note := range scope.notes {
+			if status, ok := statusAt(&note, scope.events[note.ID], end); ok {
+				counts[scope.flow.columnOf(scope.board, status).Key]++
+			}
+		}
+		response.Days = append(response.Days, contracts.FlowDay{Date: day.Format(analyticsDateLayout), Counts: counts})
+	}
+	return response, nil
+}
+
+// WorkItemAge returns how long each note in progress has been in progress. Notes that entered
+// progress before moves were recorded count from their creation.
+func (s *AnalyticsService) WorkItemAge(filter AnalyticsFilter, userID uuid.UUID) (*contracts.WorkItemAgeResponse, error) {
+	scope, err := s.scope(filter, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	response := &contracts.WorkItemAgeResponse{Notes: []contracts.WorkItemAge{}}
+	var ages []float64
+	for _, note := range scope.notes {
+		if scope.flow.stateOf(note.Status) != models.StateInProgress {
+			continue
+		}
+		since := note.CreatedAt
+		for _, event := range scope.events[note.ID] {
+			if event.ToState == models.StateInProgress && event.FromState != models.StateInProgress {
+				since = event.CreatedAt
+			}
+		}
+		item := contracts.WorkItemAge{
+			ID:       note.ID,
+			Title:    note.Title,
+			Status:   note.Status,
+			Column:   scope.flow.columnOf(scope.board, note.Status).Key,
+			Since:    since,
+			AgeHours: hours(now.Sub(since)),
+		}
+		ages = append(ages, item.AgeHours)
+		response.Notes = append(response.Notes, item)
+	}
+
+	sort.Slice(response.Notes, func(i, j int) bool { return response.Notes[i].Since.Before(response.Notes[j].Since) })
+	response.Age = durationStats(ages)
+	return response, nil
+}
+
+// finishes reports whether a status change moved a note into done
+func finishes(event models.StatusEvent) bool {
+	return event.ToState == models.StateDone && event.FromState != models.StateDone
+}
+
+// finishedAt returns when a note was last moved into done
+func finishedAt(events []models.StatusEvent) *time.Time {
+	for i := len(events) - 1; i >= 0; i-- {
+		if finishes(events[i]) {
+			return &events[i].CreatedAt
+		}
+	}
+	return nil
+}
+
+// workStartedAt returns when a note was first moved into progress, or straight into done
+func workStartedAt(events []models.StatusEvent) *time.Time {
+	for i := range events {
+		if events[i].ToState == models.StateInProgress || events[i].ToState == models.StateDone {
+			return &events[i].CreatedAt
+		}
+	}
+	return nil
+}
+
+// statusAt returns the status a note had at a moment; false if it did not exist yet
+func statusAt(note *models.Note, events []models.StatusEvent, at time.Time) (string, bool) {
+	if note.CreatedAt.After(at) {
+		return "", false
+	}
+	status := note.Status
+	if len(events) > 0 {
+		status = events[0].FromStatus
+	}
+	for _, event := range events {
+		if event.CreatedAt.After(at) {
+			break
+		}
+		status = event.ToStatus
+	}
+	return status, true
+}
+
+// weekStart returns midnight of the Monday starting the week of t
+func weekStart(t time.Time) time.Time {
+	day := t.Truncate(24 * time.Hour)
+	return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+}
+
+// notesInCategories returns the notes in any of the given categories
+func notesInCategories(notes []models.Note, categories []string) []models.Note {
+	wanted := make(map[string]bool, len(categories))
+	for _, category := range categories {
+		wanted[category] = true
+	}
+	var kept []models.Note
+	for _, note := range notes {
+		for _, category := range note.Categories {
+			if wanted[category] {
+				kept = append(kept, note)
+				break
+			}
+		}
+	}
+	return kept
+}
+
+// hours converts a duration to hours, rounded to hundredths
+func hours(d time.Duration) float64 {
+	return math.Round(d.Hours()*100) / 100
+}
+
+// durationStats summarizes durations in hours; the percentile is by nearest rank
+func durationStats(values []float64) contracts.DurationStats {
+	stats := contracts.DurationStats{Count: len(values)}
+	if len(values) == 0 {
+		return stats
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+
+	total := 0.0
+	for _, value := range sorted {
+		total += value
+	}
+	stats.Average = math.Round(total/float64(len(sorted))*100) / 100
+	middle := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		stats.Median = math.Round((sorted[middle-1]+sorted[middle])/2*100) / 100
+	} else {
+		stats.Median = sorted[middle]
+	}
+	stats.Percentile85 = sorted[int(math.Ceil(0.85*float64(len(sorted))))-1]
+	return stats
+}
@@ -0,0 +1,272 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"NoteSense/contracts"
+	"NoteSense/models"
+	"NoteSense/repositories"
+
+	"github.com/google/uuid"
+)
+
+// Audited actions
+const (
+	AuditNoteCreate       = "note.create"
+	AuditNoteUpdate       = "note.update"
+	AuditNoteDelete       = "note.delete"
+	AuditNoteLock         = "note.lock"
+	AuditNoteUnlock       = "note.unlock"
+	AuditConnectionCreate = "connection.create"
+	AuditConnectionUpdate = "connection.update"
+	AuditConnectionDelete = "connection.delete"
+	AuditFileUpload       = "file.upload"
+	AuditFileDelete       = "file.delete"
+	AuditSignUp           = "user.signup"
+	AuditLogin            = "user.login"
+	AuditLoginFailed      = "user.login_failed"
+	AuditLogout           = "user.logout"
+	AuditTokenRevoke      = "token.revoke"
+)
+
+// Kinds of audit targets
+const (
+	AuditTargetNote       = "note"
+	AuditTargetConnection = "connection"
+	AuditTargetFile       = "file"
+	AuditTargetUser       = "user"
+)
+
+// DefaultActivityPageSize is the page size of the activity feed when none is given
+const DefaultActivityPageSize = 50
+
+const (
+	defaultAuditRetentionDays = 365
+	auditPruneInterval        = 24 * time.Hour
+)
+
+// AuditService records who did what to which account and serves the activity feed. Admins,
+// listed by email in ADMIN_EMAILS, may export the whole log and set how long it is kept.
+type AuditService struct {
+	AuditRepo *repositories.AuditRepository
+	UserRepo  *repositories.UserRepository
+	admins    adminList
+}
+
+// NewAuditService creates a new AuditService
+func NewAuditService(auditRepo *repositories.AuditRepository, userRepo *repositories.UserRepository) *AuditService {
+	return &AuditService{AuditRepo: auditRepo, UserRepo: userRepo, admins: adminListFromEnv()}
+}
+
+// Record stores an audit entry. The action it describes has already happened, so a failure
+// is logged rather than returned. A nil service records nothing.
+func (s *AuditService) Record(entry *models.AuditEntry) {
+	if s == nil {
+		return
+	}
+	if err := s.AuditRepo.Create(context.Background(), entry); err != nil {
+		log.Printf("Failed to record audit entry %s: %v", entry.Action, err)
+	}
+}
+
+// RecordLoginFailure records a failed login against the account with the given email, if any
+func (s *AuditService) RecordLoginFailure(email, ip, reason string) {
+	if s == nil {
+		return
+	}
+	entry := &models.AuditEntry{
+		Action:     AuditLoginFailed,
+		TargetType: AuditTargetUser,
+		IP:         ip,
+		Summary:    reason,
+	}
+	if user, err := s.UserRepo.FindByEmail(email); err == nil {
+		entry.UserID = &user.ID
+		entry.TargetID = &user.ID
+	}
+	s.Record(entry)
+}
+
+// GetActivity returns a page of the user's activity feed, newest first
+func (s *AuditService) GetActivity(userID uuid.UUID, actions []string, page repositories.PageRequest) (*contracts.ActivityResponse, error) {
+	if userID == uuid.Nil {
+		return nil, fmt.Errorf("user ID is required")
+	}
+	if err := validatePage(page); err != nil {
+		return nil, err
+	}
+	if page.Limit == 0 {
+		page.Limit = DefaultActivityPageSize
+	}
+	entries, next, err := s.AuditRepo.ListForUser(context.Background(), userID, actions, page)
+	if err != nil {
+		if err == repositories.ErrInvalidCursor {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to retrieve activity: %v", err)
+	}
+	return &contracts.ActivityResponse{Entries: entries, NextCursor: next}, nil
+}
+
+// IsAdmin reports whether a user may administer the audit log
+func (s *AuditService) IsAdmin(userID uuid.UUID) (bool, error) {
+	user, err := s.UserRepo.FindByID(userID.String())
+	if err != nil {
+		return false, fmt.Errorf("failed to retrieve user: %v", err)
+	}
+	return s.admins.includes(user), nil
+}
+
+// ExportAudit passes the entries created in [from, to) to fn in batches, oldest first
+func (s *AuditService) ExportAudit(from, to *time.Time, userID uuid.UUID, fn func([]models.AuditEntry) error) error {
+	if err := s.requireAdmin(userID); err != nil {
+		return err
+	}
+	return s.AuditRepo.Export(context.Background(), from, to, fn)
+}
+
+// GetAuditSettings returns the audit settings
+func (s *AuditService) GetAuditSettings(userID uuid.UUID) (*models.AuditSettings, error) {
+	if err := s.requireAdmin(userID); err != nil {
+		return nil, err
+	}
+	return s.settings()
+}
+
+// UpdateAuditSettings changes how long audit entries are kept
+func (s *AuditService) UpdateAuditSettings(req *contracts.AuditSettingsRequest, userID uuid.UUID) (*models.AuditSettings, error) {
+	if err := s.requireAdmin(userID); err != nil {
+		return nil, err
+	}
+	if req.RetentionDays < 0 {
+		return nil, fmt.Errorf("retention days cannot be negative")
+	}
+	settings := &models.AuditSettings{RetentionDays: req.RetentionDays, UpdatedBy: userID, UpdatedAt: time.Now()}
+	if err := s.AuditRepo.SaveSettings(context.Background(), settings); err != nil {
+		return nil, fmt.Errorf("failed to save audit settings: %v", err)
+	}
+	return settings, nil
+}
+
+// Start deletes expired entries now and then once a day until ctx is done
+func (s *AuditService) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(auditPruneInterval)
+		defer ticker.Stop()
+		for {
+			if err := s.prune(ctx); err != nil {
+				log.Printf("Failed to prune audit log: %v", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (s *AuditService) prune(ctx context.Context) error {
+	settings, err := s.settings()
+	if err != nil {
+		return err
+	}
+	if settings.RetentionDays == 0 {
+		return nil
+	}
+	removed, err := s.AuditRepo.DeleteBefore(ctx, time.Now().AddDate(0, 0, -settings.RetentionDays))
+	if err != nil {
+		return err
+	}
+	if removed > 0 {
+		log.Printf("Pruned %d audit entries older than %d days", removed, settings.RetentionDays)
+	}
+	return nil
+}
+
+// settings returns the saved audit settings, or the defaults taken from AUDIT_RETENTION_DAYS
+func (s *AuditService) settings() (*models.AuditSettings, error) {
+	settings, err := s.AuditRepo.GetSettings(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve audit settings: %v", err)
+	}
+	if settings != nil {
+		return settings, nil
+	}
+	days := defaultAuditRetentionDays
+	if value := os.Getenv("AUDIT_RETENTION_DAYS"); value != "" {
+		if parsed, err := strconv.Atoi(value); err == nil && parsed >= 0 {
+			days = parsed
+		}
+	}
+	return &models.AuditSettings{RetentionDays: days}, nil
+}
+
+func (s *AuditService) requireAdmin(userID uuid.UUID) error {
+	admin, err := s.IsAdmin(userID)
+	if err != nil {
+		return err
+	}
+	if !admin {
+		return fmt.Errorf("admin access required")
+	}
+	return nil
+}
+
+// NoteChanges summarizes how a note changed. Content is only marked as changed, never stored.
+func NoteChanges(before, after *models.Note) models.AuditChanges {
+	changes := models.AuditChanges{}
+	compare := func(field string, from, to interface{}) {
+		if !reflect.DeepEqual(from, to) {
+			changes[field] = models.AuditChange{From: from, To: to}
+		}
+	}
+	compare("title", before.Title, after.Title)
+	compare("status", before.Status, after.Status)
+	compare("priority", before.Priority, after.Priority)
+	compare("categories", []string(before.Categories), []string(after.Categories))
+	compare("pinned", before.Pinned, after.Pinned)
+	compare("favorite", before.Favorite, after.Favorite)
+	compare("archived", before.Archived, after.Archived)
+	compare("encrypted", before.Encrypted, after.Encrypted)
+	if before.Content != after.Content {
+		changes["content"] = models.AuditChange{}
+	}
+	return changes
+}
+
+// ConnectionChanges summarizes how a connection changed
+func ConnectionChanges(before, after *models.NoteConnection) models.AuditChanges {
+	changes := models.AuditChanges{}
+	compare := func(field string, from, to interface{}) {
+		if from != to {
+			changes[field] = models.AuditChange{From: from, To: to}
+		}
+	}
+	compare("type", string(before.Type), string(after.Type))
+	compare("directed", before.Directed, after.Directed)
+	compare("label", before.Label, after.Label)
+	compare("weight", before.Weight, after.Weight)
+	return changes
+}
+
+// ChangeSummary lists the changed fields, e.g. "changed title, content"
+func ChangeSummary(changes models.AuditChanges) string {
+	if len(changes) == 0 {
+		return "no changes"
+	}
+	fields := make([]string, 0, len(changes))
+	for field := range changes {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return "changed " + strings.Join(fields, ", ")
+}
@@ -0,0 +1,373 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	"NoteSense/contracts"
+	"NoteSense/models"
+	"NoteSense/repositories"
+
+	"github.com/google/uuid"
+)
+
+// MaxBoardColumns caps the columns of one board
+const MaxBoardColumns = 20
+
+// boardColumnKeyPattern restricts column keys to short lowercase identifiers such as "review"
+var boardColumnKeyPattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,39}$`)
+
+// BoardService handles the user's Kanban boards. A column key is the status of the notes in
+// the column, so it means the same thing, and belongs to the same state, on every board.
+type BoardService struct {
+	BoardRepo         *repositories.BoardRepository
+	CollectionService *CollectionService // Evaluates the saved searches boards filter by
+	NoteService       *NoteService
+}
+
+// NewBoardService creates a new BoardService
+func NewBoardService(boardRepo *repositories.BoardRepository, collectionService *CollectionService, noteService *NoteService) *BoardService {
+	return &BoardService{
+		BoardRepo:         boardRepo,
+		CollectionService: collectionService,
+		NoteService:       noteService,
+	}
+}
+
+// CreateBoard saves a new board for the user
+func (s *BoardService) CreateBoard(req *contracts.BoardRequest, userID uuid.UUID) (*models.Board, error) {
+	if userID == uuid.Nil {
+		return nil, fmt.Errorf("user ID is required")
+	}
+	if req.Name == "" {
+		return nil, fmt.Errorf("board name is required")
+	}
+
+	board := &models.Board{
+		UserID:      userID,
+		Name:        req.Name,
+		Columns:     req.Columns,
+		Transitions: req.Transitions,
+	}
+	if req.Filter != nil {
+		board.Filter = *req.Filter
+	}
+	if req.IsDefault != nil {
+		board.IsDefault = *req.IsDefault
+	}
+
+	boards, err := s.BoardRepo.ListByUser(context.Background(), userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve boards: %v", err)
+	}
+	if len(boards) == 0 {
+		// The first board replaces the built-in one
+		board.IsDefault = true
+	}
+	if err := validateBoard(board, boards); err != nil {
+		return nil, err
+	}
+	if err := s.validateFilter(&board.Filter, userID); err != nil {
+		return nil, err
+	}
+
+	if err := s.BoardRepo.Create(context.Background(), board); err != nil {
+		return nil, fmt.Errorf("failed to create board: %v", err)
+	}
+	return board, nil
+}
+
+// GetBoards returns the user's boards, or the built-in board when they have none
+func (s *BoardService) GetBoards(userID uuid.UUID) ([]models.Board, error) {
+	if userID == uuid.Nil {
+		return nil, fmt.Errorf("user ID is required")
+	}
+	boards, err := s.BoardRepo.ListByUser(context.Background(), userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve boards: %v", err)
+	}
+	if len(boards) == 0 {
+		boards = append(boards, *models.DefaultBoard(userID))
+	}
+	return boards, nil
+}
+
+// GetBoardByID returns one of the user's boards
+func (s *BoardService) GetBoardByID(boardID, userID uuid.UUID) (*models.Board, error) {
+	if boardID == uuid.Nil {
+		return nil, fmt.Errorf("board ID is required")
+	}
+	board, err := s.BoardRepo.GetByID(context.Background(), boardID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve board: %v", err)
+	}
+	if board == nil {
+		return nil, fmt.Errorf("board not found")
+	}
+	return board, nil
+}
+
+// GetBoard returns a board with the notes it shows laid out in its columns, cards placed on the
+// board by hand first. The order may be KanbanOrderCriticalPath.
+func (s *BoardService) GetBoard(boardID uuid.UUID, order string, omitContent bool, userID uuid.UUID) (*contracts.KanbanNotesResponse, error) {
+	if order != "" && order != KanbanOrderCriticalPath {
+		return nil, fmt.Errorf("invalid kanban order: %s", order)
+	}
+	board, err := s.GetBoardByID(boardID, userID)
+	if err != nil {
+		return nil, err
+	}
+	cards, err := s.boardCards(board, omitContent, userID)
+	if err != nil {
+		return nil, err
+	}
+	flow, err := s.NoteService.loadWorkflow(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	response := groupBoard(board, cards, flow)
+	if order == KanbanOrderCriticalPath {
+		if err := s.NoteService.orderByCriticalPath(response, userID); err != nil {
+			return nil, err
+		}
+	}
+	return response, nil
+}
+
+// MoveCard moves a note shown on a board, following the board's transitions and WIP limits.
+// A position places the card within its column on this board only.
+func (s *BoardService) MoveCard(boardID, noteID uuid.UUID, req *contracts.KanbanUpdateRequest, userID uuid.UUID) (*contracts.KanbanUpdateResponse, error) {
+	board, err := s.GetBoardByID(boardID, userID)
+	if err != nil {
+		return nil, err
+	}
+	cards, err := s.boardCards(board, true, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, card := range cards {
+		if card.ID == noteID {
+			return s.NoteService.moveCard(board, cards, noteID, req, userID)
+		}
+	}
+	return nil, fmt.Errorf("note is not on this board")
+}
+
+// boardCards returns the notes a board shows, in board order. The categories are matched in the
+// database; the search query and saved search narrow the result down.
+func (s *BoardService) boardCards(board *models.Board, omitContent bool, userID uuid.UUID) ([]models.Note, error) {
+	ctx := context.Background()
+	filter := board.Filter
+	notes, err := s.NoteService.NoteRepo.GetKanbanNotes(ctx, userID, filter.Categories, omitContent)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve board notes: %v", err)
+	}
+
+	if filter.Query != "" {
+		results, err := s.NoteService.SearchNotes(&contracts.SearchNotesRequest{Query: filter.Query}, userID)
+		if err != nil {
+			return nil, err
+		}
+		notes = keepNotes(notes, resultNotes(results))
+	}
+	if filter.CollectionID != nil {
+		_, results, err := s.CollectionService.evaluate(*filter.CollectionID, userID)
+		if err != nil {
+			return nil, err
+		}
+		notes = keepNotes(notes, resultNotes(results))
+	}
+
+	positions, err := s.BoardRepo.CardPositions(ctx, board.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve card positions: %v", err)
+	}
+	sortBoardCards(notes, positions)
+	return notes, nil
+}
+
+// keepNotes returns the notes that are also among matches, in their original order
+func keepNotes(notes, matches []models.Note) []models.Note {
+	matched := make(map[uuid.UUID]bool, len(matches))
+	for _, note := range matches {
+		matched[note.ID] = true
+	}
+	kept := notes[:0]
+	for _, note := range notes {
+		if matched[note.ID] {
+			kept = append(kept, note)
+		}
+	}
+	return kept
+}
+
+// validateFilter checks that a board's search query parses and its saved search exists
+func (s *BoardService) validateFilter(filter *models.BoardFilter, userID uuid.UUID) error {
+	if filter.Query != "" {
+		if _, err := repositories.ParseSearchQuery(filter.Query); err != nil {
+			return err
+		}
+	}
+	if filter.CollectionID != nil {
+		if _, err := s.CollectionService.GetCollectionByID(*filter.CollectionID, userID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UpdateBoard changes a board. Notes whose status was a column key no board has any more move
+// to the canonical state of that column.
+func (s *BoardService) UpdateBoard(boardID uuid.UUID, req *contracts.BoardRequest, userID uuid.UUID) (*models.Board, error) {
+	board, err := s.GetBoardByID(boardID, userID)
+	if err != nil {
+		return nil, err
+	}
+	previous := board.Columns
+
+	if req.Name != "" {
+		board.Name = req.Name
+	}
+	if req.Columns != nil {
+		board.Columns = req.Columns
+	}
+	if req.Transitions != nil {
+		board.Transitions = req.Transitions
+	}
+	if req.Filter != nil {
+		board.Filter = *req.Filter
+	}
+	if req.IsDefault != nil {
+		board.IsDefault = *req.IsDefault
+	}
+
+	boards, err := s.BoardRepo.ListByUser(context.Background(), userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve boards: %v", err)
+	}
+	if err := validateBoard(board, boards); err != nil {
+		return nil, err
+	}
+	if err := s.validateFilter(&board.Filter, userID); err != nil {
+		return nil, err
+	}
+
+	if err := s.BoardRepo.Update(context.Background(), board); err != nil {
+		return nil, fmt.Errorf("failed to update board: %v", err)
+	}
+	if err := s.retireColumns(previous, userID); err != nil {
+		return nil, err
+	}
+	return board, nil
+}
+
+// DeleteBoard removes a board. Notes in columns no other board has move to the canonical state
+// of their column.
+func (s *BoardService) DeleteBoard(boardID, userID uuid.UUID) error {
+	board, err := s.GetBoardByID(boardID, userID)
+	if err != nil {
+		return err
+	}
+	if err := s.BoardRepo.Delete(context.Background(), boardID, userID); err != nil {
+		return fmt.Errorf("failed to delete board: %v", err)
+	}
+	return s.retireColumns(board.Columns, userID)
+}
+
+// retireColumns moves the notes out of columns that are no longer on any of the user's boards
+func (s *BoardService) retireColumns(columns models.BoardColumns, userID uuid.UUID) error {
+	ctx := context.Background()
+	boards, err := s.BoardRepo.ListByUser(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve boards: %v", err)
+	}
+	remaining := make(map[string]bool)
+	for _, board := range boards {
+		for _, column := range board.Columns {
+			remaining[column.Key] = true
+		}
+	}
+	for _, column := range columns {
+		if remaining[column.Key] || models.CanonicalState(column.Key) != "" {
+			continue
+		}
+		if err := s.NoteService.NoteRepo.RenameStatus(ctx, userID, column.Key, column.State); err != nil {
+			return fmt.Errorf("failed to move notes out of column %s: %v", column.Key, err)
+		}
+	}
+	return nil
+}
+
+// validateBoard checks a board's columns and transitions against each other and against the
+// user's other boards, filling in default column names and colors
+func validateBoard(board *models.Board, boards []models.Board) error {
+	if board.Name == "" {
+		return fmt.Errorf("board name is required")
+	}
+	if len(board.Columns) == 0 {
+		return fmt.Errorf("a board needs at least one column")
+	}
+	if len(board.Columns) > MaxBoardColumns {
+		return fmt.Errorf("a board can have at most %d columns", MaxBoardColumns)
+	}
+
+	// A key shared with another board must belong to the same state there
+	states := make(map[string]string)
+	for _, other := range boards {
+		if other.ID == board.ID {
+			continue
+		}
+		for _, column := range other.Columns {
+			states[column.Key] = column.State
+		}
+	}
+
+	keys := make(map[string]bool, len(board.Columns))
+	for i := range board.Columns {
+		column := &board.Columns[i]
+		if !boardColumnKeyPattern.MatchString(column.Key) {
+			return fmt.Errorf("invalid column key: %q", column.Key)
+		}
+		if keys[column.Key] {
+			return fmt.Errorf("duplicate column key: %s", column.Key)
+		}
+		keys[column.Key] = true
+
+		if models.CanonicalState(column.State) != column.State || column.State == "" {
+			return fmt.Errorf("invalid column state: %q", column.State)
+		}
+		if state := models.CanonicalState(column.Key); state != "" && state != column.State {
+			return fmt.Errorf("column %s must be in state %s", column.Key, state)
+		}
+		if state, ok := states[column.Key]; ok && state != column.State {
+			return fmt.Errorf("column %s is in state %s on another board", column.Key, state)
+		}
+
+		if column.Name == "" {
+			column.Name = column.Key
+		}
+		if column.Color == "" {
+			column.Color = models.StateColors[column.State]
+		}
+		if !colorPattern.MatchString(column.Color) {
+			return fmt.Errorf("invalid column color: %s", column.Color)
+		}
+		if column.WIPLimit < 0 {
+			return fmt.Errorf("WIP limit of column %s cannot be negative", column.Key)
+		}
+	}
+
+	for from, targets := range board.Transitions {
+		if !keys[from] {
+			return fmt.Errorf("transition from unknown column: %s", from)
+		}
+		for _, to := range targets {
+			if !keys[to] {
+				return fmt.Errorf("transition to unknown column: %s", to)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,234 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"NoteSense/contracts"
+	"NoteSense/models"
+	"NoteSense/repositories"
+
+	"github.com/google/uuid"
+)
+
+// CollectionService handles saved searches and evaluates them as live collections
+type CollectionService struct {
+	CollectionRepo    *repositories.CollectionRepository
+	ConnectionService *ConnectionService
+	NoteService       *NoteService
+}
+
+// NewCollectionService creates a new CollectionService
+func NewCollectionService(collectionRepo *repositories.CollectionRepository, connectionService *ConnectionService, noteService *NoteService) *CollectionService {
+	return &CollectionService{
+		CollectionRepo:    collectionRepo,
+		ConnectionService: connectionService,
+		NoteService:       noteService,
+	}
+}
+
+// CreateCollection saves a named search for the user
+func (s *CollectionService) CreateCollection(req *contracts.CollectionRequest, userID uuid.UUID) (*models.SavedSearch, error) {
+	if userID == uuid.Nil {
+		return nil, fmt.Errorf("user ID is required")
+	}
+	if req.Name == "" {
+		return nil, fmt.Errorf("collection name is required")
+	}
+
+	search := &models.SavedSearch{UserID: userID, Name: req.Name, Mode: SearchModeKeyword}
+	if err := applyCollectionRequest(search, req); err != nil {
+		return nil, err
+	}
+
+	if err := s.CollectionRepo.Create(context.Background(), search); err != nil {
+		return nil, fmt.Errorf("failed to create collection: %v", err)
+	}
+	return search, nil
+}
+
+// GetCollections returns the user's saved searches
+func (s *CollectionService) GetCollections(userID uuid.UUID) ([]models.SavedSearch, error) {
+	if userID == uuid.Nil {
+		return nil, fmt.Errorf("user ID is required")
+	}
+	return s.CollectionRepo.ListByUser(context.Background(), userID)
+}
+
+// GetCollectionByID returns one of the user's saved searches
+func (s *CollectionService) GetCollectionByID(searchID, userID uuid.UUID) (*models.SavedSearch, error) {
+	if searchID == uuid.Nil {
+		return nil, fmt.Errorf("collection ID is required")
+	}
+
+	search, err := s.CollectionRepo.GetByID(context.Background(), searchID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if search == nil {
+		return nil, fmt.Errorf("collection not found")
+	}
+	return search, nil
+}
+
+// UpdateCollection changes a saved search
+func (s *CollectionService) UpdateCollection(searchID uuid.UUID, req *contracts.CollectionRequest, userID uuid.UUID) (*models.SavedSearch, error) {
+	search, err := s.GetCollectionByID(searchID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Name != "" {
+		search.Name = req.Name
+	}
+	if err := applyCollectionRequest(search, req); err != nil {
+		return nil, err
+	}
+
+	if err := s.CollectionRepo.Update(context.Background(), search); err != nil {
+		return nil, fmt.Errorf("failed to update collection: %v", err)
+	}
+	return search, nil
+}
+
+// DeleteCollection deletes a saved search; the notes it matched are untouched
+func (s *CollectionService) DeleteCollection(searchID, userID uuid.UUID) error {
+	if _, err := s.GetCollectionByID(searchID, userID); err != nil {
+		return err
+	}
+	if err := s.CollectionRepo.Delete(context.Background(), searchID, userID); err != nil {
+		return err
+	}
+	if err := s.NoteService.BoardRepo.ClearCollectionFilter(context.Background(), searchID, userID); err != nil {
+		return fmt.Errorf("failed to update boards: %v", err)
+	}
+	return s.ConnectionService.ResetMindmapPositions(models.CollectionMindmapView(searchID), userID)
+}
+
+// GetCollectionNotes evaluates a saved search against the user's current notes
+func (s *CollectionService) GetCollectionNotes(searchID, userID uuid.UUID) (*contracts.CollectionNotesResponse, error) {
+	search, results, err := s.evaluate(searchID, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &contracts.CollectionNotesResponse{Collection: *search, SearchNotesResponse: *results}, nil
+}
+
+// GetCollectionKanban lays out the notes matching a saved search on the user's default board
+func (s *CollectionService) GetCollectionKanban(searchID, userID uuid.UUID) (*contracts.KanbanNotesResponse, error) {
+	_, results, err := s.evaluate(searchID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Boards keep their manual order rather than relevance
+	notes := resultNotes(results)
+	sort.SliceStable(notes, func(i, j int) bool {
+		if notes[i].KanbanPosition != notes[j].KanbanPosition {
+			return notes[i].KanbanPosition < notes[j].KanbanPosition
+		}
+		return notes[i].CreatedAt.Before(notes[j].CreatedAt)
+	})
+
+	board, err := s.NoteService.kanbanBoard(userID)
+	if err != nil {
+		return nil, err
+	}
+	flow, err := s.NoteService.loadWorkflow(userID)
+	if err != nil {
+		return nil, err
+	}
+	return groupBoard(board, notes, flow), nil
+}
+
+// GetCollectionMindmap returns the notes matching a saved search and the connections among them
+func (s *CollectionService) GetCollectionMindmap(searchID uuid.UUID, layout string, userID uuid.UUID) (*contracts.MindmapNotesResponse, error) {
+	_, results, err := s.evaluate(searchID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]uuid.UUID, len(results.Results))
+	for i, result := range results.Results {
+		ids[i] = result.Note.ID
+	}
+
+	// Only edges with both ends in the collection are kept so the map is self-contained
+	return s.ConnectionService.GetMindmapAmong(ids, models.CollectionMindmapView(searchID), layout, userID)
+}
+
+// SaveCollectionMindmapPositions stores where the user placed notes in a collection's mind map
+func (s *CollectionService) SaveCollectionMindmapPositions(searchID uuid.UUID, req *contracts.MindmapPositionsRequest, userID uuid.UUID) (*contracts.MindmapPositionsResponse, error) {
+	if _, err := s.GetCollectionByID(searchID, userID); err != nil {
+		return nil, err
+	}
+	return s.ConnectionService.SaveMindmapPositions(models.CollectionMindmapView(searchID), req, userID)
+}
+
+// ResetCollectionMindmapPositions forgets the positions the user saved in a collection's mind map
+func (s *CollectionService) ResetCollectionMindmapPositions(searchID, userID uuid.UUID) error {
+	if _, err := s.GetCollectionByID(searchID, userID); err != nil {
+		return err
+	}
+	return s.ConnectionService.ResetMindmapPositions(models.CollectionMindmapView(searchID), userID)
+}
+
+// evaluate runs a saved search through the regular search pipeline
+func (s *CollectionService) evaluate(searchID, userID uuid.UUID) (*models.SavedSearch, *contracts.SearchNotesResponse, error) {
+	search, err := s.GetCollectionByID(searchID, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	req := &contracts.SearchNotesRequest{
+		Query: search.Query,
+		Mode:  search.Mode,
+		Fuzzy: search.Fuzzy,
+	}
+	if len(search.Filters) > 0 {
+		if err := json.Unmarshal(search.Filters, &req.Filters); err != nil {
+			return nil, nil, fmt.Errorf("invalid filters stored for collection: %v", err)
+		}
+	}
+
+	results, err := s.NoteService.SearchNotes(req, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return search, results, nil
+}
+
+// applyCollectionRequest copies the provided fields onto a saved search and validates the search
+func applyCollectionRequest(search *models.SavedSearch, req *contracts.CollectionRequest) error {
+	if req.Query != nil {
+		if _, err := repositories.ParseSearchQuery(*req.Query); err != nil {
+			return err
+		}
+		search.Query = *req.Query
+	}
+	if req.Filters != nil {
+		filters, err := json.Marshal(req.Filters)
+		if err != nil {
+			return fmt.Errorf("invalid filters: %v", err)
+		}
+		search.Filters = filters
+	}
+	if req.Mode != "" {
+		if req.Mode != SearchModeKeyword && req.Mode != SearchModeSemantic && req.Mode != SearchModeHybrid {
+			return fmt.Errorf("invalid search mode: %s", req.Mode)
+		}
+		search.Mode = req.Mode
+	}
+	if req.Fuzzy != nil {
+		search.Fuzzy = *req.Fuzzy
+	}
+	if req.Pinned != nil {
+		search.Pinned = *req.Pinned
+	}
+	if req.Position != nil {
+		search.Position = *req.Position
+	}
+	return nil
+}
@@ -0,0 +1,690 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+
+	"NoteSense/contracts"
+	"NoteSense/models"
+	"NoteSense/repositories"
+
+	"github.com/google/uuid"
+)
+
+// Connection directions as seen from one of its notes
+const (
+	DirectionOutgoing   = "outgoing"
+	DirectionIncoming   = "incoming"
+	DirectionUndirected = "undirected"
+)
+
+var (
+	// connectionTypeNamePattern restricts type names to short lowercase identifiers such as "blocks"
+	connectionTypeNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,39}$`)
+	colorPattern              = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+)
+
+// defaultConnectionColor is used for types defined without a color
+const defaultConnectionColor = "#64748b"
+
+// ConnectionService handles the typed connections between notes and the definitions of their types
+type ConnectionService struct {
+	ConnectionRepo *repositories.ConnectionRepository
+	TypeRepo       *repositories.ConnectionTypeRepository
+	PositionRepo   *repositories.MindmapPositionRepository
+	UserRepo       *repositories.UserRepository
+	NoteService    *NoteService
+	admins         adminList
+}
+
+// NewConnectionService creates a new ConnectionService
+func NewConnectionService(connectionRepo *repositories.ConnectionRepository, typeRepo *repositories.ConnectionTypeRepository, positionRepo *repositories.MindmapPositionRepository, userRepo *repositories.UserRepository, noteService *NoteService) *ConnectionService {
+	return &ConnectionService{
+		ConnectionRepo: connectionRepo,
+		TypeRepo:       typeRepo,
+		PositionRepo:   positionRepo,
+		UserRepo:       userRepo,
+		NoteService:    noteService,
+		admins:         adminListFromEnv(),
+	}
+}
+
+// ConnectNotes connects a note to another of the user's notes
+func (s *ConnectionService) ConnectNotes(noteID uuid.UUID, req *contracts.ConnectionRequest, userID uuid.UUID) (*models.NoteConnection, error) {
+	// Validate input
+	if noteID == uuid.Nil {
+		return nil, fmt.Errorf("note ID is required")
+	}
+	if userID == uuid.Nil {
+		return nil, fmt.Errorf("user ID is required")
+	}
+	connectedNoteID, err := uuid.Parse(req.ConnectedNoteID)
+	if err != nil || connectedNoteID == uuid.Nil {
+		return nil, fmt.Errorf("connected note ID is required")
+	}
+
+	// Prevent self-linking
+	if noteID == connectedNoteID {
+		return nil, fmt.Errorf("cannot link a note to itself")
+	}
+
+	connection := &models.NoteConnection{
+		UserID:   userID,
+		SourceID: noteID,
+		TargetID: connectedNoteID,
+		Type:     models.ConnectionType(req.ConnectionType),
+		Label:    req.Label,
+		Weight:   1,
+	}
+	if connection.Type == "" {
+		connection.Type = models.RelatedConnection
+	}
+	if req.Weight != nil {
+		connection.Weight = *req.Weight
+	}
+	types, err := s.connectionTypeIndex(userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateConnection(connection, types, req.Directed); err != nil {
+		return nil, err
+	}
+
+	// Both notes must exist and belong to the user
+	if _, err := s.NoteService.GetNoteByID(noteID, userID); err != nil {
+		return nil, err
+	}
+	if _, err := s.NoteService.GetNoteByID(connectedNoteID, userID); err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	exists, err := s.ConnectionRepo.Exists(ctx, noteID, connectedNoteID, connection.Type, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check existing connections: %v", err)
+	}
+	if !exists && !connection.Directed {
+		// An undirected connection also duplicates any edge of the same type stored the other way
+		exists, err = s.ConnectionRepo.Exists(ctx, connectedNoteID, noteID, connection.Type, userID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check existing connections: %v", err)
+		}
+	}
+	if exists {
+		return nil, fmt.Errorf("notes are already connected")
+	}
+	if err := s.checkDependencyCycle(connection, userID); err != nil {
+		return nil, err
+	}
+
+	if err := s.ConnectionRepo.Create(ctx, connection); err != nil {
+		return nil, fmt.Errorf("failed to create connection: %v", err)
+	}
+	return connection, nil
+}
+
+// GetNoteConnections returns a note's incoming and outgoing connections
+func (s *ConnectionService) GetNoteConnections(noteID, userID uuid.UUID) (*contracts.ConnectionResponse, error) {
+	if _, err := s.NoteService.GetNoteByID(noteID, userID); err != nil {
+		return nil, err
+	}
+
+	connections, err := s.ConnectionRepo.ListForNote(context.Background(), noteID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve connections: %v", err)
+	}
+	types, err := s.connectionTypeIndex(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &contracts.ConnectionResponse{NoteID: noteID, Connections: make([]contracts.Connection, 0, len(connections))}
+	for i := range connections {
+		response.Connections = append(response.Connections, connectionFrom(&connections[i], noteID, types))
+	}
+	return response, nil
+}
+
+// UpdateConnection changes the type, direction, label or weight of a connection
+func (s *ConnectionService) UpdateConnection(connectionID uuid.UUID, req *contracts.ConnectionUpdateRequest, userID uuid.UUID) (*models.NoteConnection, error) {
+	connection, err := s.getConnection(connectionID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	previousType := connection.Type
+	if req.ConnectionType != nil {
+		connection.Type = models.ConnectionType(*req.ConnectionType)
+	}
+	if req.Label != nil {
+		connection.Label = *req.Label
+	}
+	if req.Weight != nil {
+		connection.Weight = *req.Weight
+	}
+	types, err := s.connectionTypeIndex(userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateConnection(connection, types, req.Directed); err != nil {
+		return nil, err
+	}
+	if previousType != connection.Type {
+		if err := s.checkDependencyCycle(connection, userID); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.ConnectionRepo.Update(context.Background(), connection); err != nil {
+		return nil, fmt.Errorf("failed to update connection: %v", err)
+	}
+	return connection, nil
+}
+
+// DeleteConnection removes a single connection
+func (s *ConnectionService) DeleteConnection(connectionID, userID uuid.UUID) error {
+	if _, err := s.getConnection(connectionID, userID); err != nil {
+		return err
+	}
+	return s.ConnectionRepo.Delete(context.Background(), connectionID, userID)
+}
+
+// UnlinkNotes removes the connections from a note to another
+func (s *ConnectionService) UnlinkNotes(noteID, connectedNoteID uuid.UUID, userID uuid.UUID) error {
+	// Validate input
+	if noteID == uuid.Nil {
+		return fmt.Errorf("note ID is required")
+	}
+	if connectedNoteID == uuid.Nil {
+		return fmt.Errorf("connected note ID is required")
+	}
+	if userID == uuid.Nil {
+		return fmt.Errorf("user ID is required")
+	}
+
+	removed, err := s.ConnectionRepo.DeleteBetween(context.Background(), noteID, connectedNoteID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to update note connections: %v", err)
+	}
+	if removed == 0 {
+		return fmt.Errorf("connection not found")
+	}
+	return nil
+}
+
+// checkDependencyCycle refuses a dependency whose target already depends on its source,
+// as neither note could then ever be finished
+func (s *ConnectionService) checkDependencyCycle(connection *models.NoteConnection, userID uuid.UUID) error {
+	if connection.Type != models.DependsOnConnection || !connection.Directed {
+		return nil
+	}
+	cycle, err := s.ConnectionRepo.DependsOn(context.Background(), connection.TargetID, connection.SourceID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to check dependencies: %v", err)
+	}
+	if cycle {
+		return fmt.Errorf("dependency cycle: the connected note already depends on this note")
+	}
+	return nil
+}
+
+// GetConnection returns one of the user's connections
+func (s *ConnectionService) GetConnection(connectionID, userID uuid.UUID) (*models.NoteConnection, error) {
+	return s.getConnection(connectionID, userID)
+}
+
+// getConnection loads one of the user's connections
+func (s *ConnectionService) getConnection(connectionID, userID uuid.UUID) (*models.NoteConnection, error) {
+	if connectionID == uuid.Nil {
+		return nil, fmt.Errorf("connection ID is required")
+	}
+	connection, err := s.ConnectionRepo.GetByID(context.Background(), connectionID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve connection: %v", err)
+	}
+	if connection == nil {
+		return nil, fmt.Errorf("connection not found")
+	}
+	return connection, nil
+}
+
+// validateConnection checks a connection against its type definition and takes the
+// direction from it. A requested direction must agree with the type.
+func validateConnection(connection *models.NoteConnection, types map[models.ConnectionType]models.ConnectionTypeDefinition, directed *bool) error {
+	definition, ok := types[connection.Type]
+	if !ok {
+		return fmt.Errorf("unknown connection type: %s", connection.Type)
+	}
+	if directed != nil && *directed != definition.Directed {
+		if definition.Directed {
+			return fmt.Errorf("connection type %s is directed", connection.Type)
+		}
+		return fmt.Errorf("connection type %s is undirected", connection.Type)
+	}
+	connection.Directed = definition.Directed
+
+	if connection.Weight <= 0 {
+		return fmt.Errorf("connection weight must be positive")
+	}
+	return nil
+}
+
+// connectionFrom describes a connection as seen from one of its notes. Relation is the type's
+// name, or its inverse name when the connection points at the note.
+func connectionFrom(connection *models.NoteConnection, noteID uuid.UUID, types map[models.ConnectionType]models.ConnectionTypeDefinition) contracts.Connection {
+	definition := types[connection.Type]
+	direction := DirectionOutgoing
+	relation := string(connection.Type)
+	switch {
+	case !connection.Directed:
+		direction = DirectionUndirected
+	case connection.TargetID == noteID:
+		direction = DirectionIncoming
+		if definition.InverseName != "" {
+			relation = definition.InverseName
+		}
+	}
+	return contracts.Connection{
+		ID:             connection.ID,
+		NoteID:         connection.OtherEnd(noteID),
+		ConnectionType: string(connection.Type),
+		Direction:      direction,
+		Relation:       relation,
+		Color:          definition.Color,
+		Label:          connection.Label,
+		Weight:         connection.Weight,
+		CreatedAt:      connection.CreatedAt,
+	}
+}
+
+// GetNotesMindmap returns a page of the user's notes with the connections starting at them, the notes at
+// the other end of those connections and the metadata of the connection types, for styling. With a layout,
+// node coordinates are computed around the positions the user saved.
+func (s *ConnectionService) GetNotesMindmap(userID uuid.UUID, page repositories.PageRequest, layout string) (*contracts.MindmapNotesResponse, error) {
+	if userID == uuid.Nil {
+		return nil, fmt.Errorf("user ID is required")
+	}
+	if err := validatePage(page); err != nil {
+		return nil, err
+	}
+	if err := validateLayout(layout); err != nil {
+		return nil, err
+	}
+
+	ids, edges, next, err := s.NoteService.NoteRepo.GetNotesMindmap(context.Background(), userID, page)
+	if err == repositories.ErrInvalidCursor {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve notes for mindmap: %v", err)
+	}
+
+	response, err := s.mindmap(ids, edges, models.MindmapViewNotes, layout, userID)
+	if err != nil {
+		return nil, err
+	}
+	response.NextCursor = next
+	return response, nil
+}
+
+// GetMindmapAmong returns the mind map of the given notes and the connections between them
+func (s *ConnectionService) GetMindmapAmong(noteIDs []uuid.UUID, view, layout string, userID uuid.UUID) (*contracts.MindmapNotesResponse, error) {
+	if err := validateLayout(layout); err != nil {
+		return nil, err
+	}
+	edges, err := s.ConnectionRepo.ListAmong(context.Background(), noteIDs, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve connections: %v", err)
+	}
+	return s.mindmap(noteIDs, edges, view, layout, userID)
+}
+
+// mindmap builds the mind map response for a set of notes and edges. Notes at the end of an edge
+// are added to the nodes when missing.
+func (s *ConnectionService) mindmap(noteIDs []uuid.UUID, edges []models.NoteConnection, view, layout string, userID uuid.UUID) (*contracts.MindmapNotesResponse, error) {
+	definitions, err := s.GetConnectionTypes(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &contracts.MindmapNotesResponse{
+		NoteConnections: make(map[uuid.UUID][]uuid.UUID),
+		Nodes:           []contracts.MindmapNode{},
+		Edges:           make([]contracts.GraphEdge, 0, len(edges)),
+		ConnectionTypes: definitions,
+		Layout:          layout,
+	}
+	ids := append([]uuid.UUID{}, noteIDs...)
+	seen := make(map[uuid.UUID]bool, len(ids))
+	for _, id := range ids {
+		seen[id] = true
+	}
+	for _, edge := range edges {
+		response.NoteConnections[edge.SourceID] = append(response.NoteConnections[edge.SourceID], edge.TargetID)
+		response.Edges = append(response.Edges, contracts.GraphEdge{
+			ID:       edge.ID,
+			Source:   edge.SourceID,
+			Target:   edge.TargetID,
+			Type:     string(edge.Type),
+			Directed: edge.Directed,
+			Label:    edge.Label,
+			Weight:   edge.Weight,
+		})
+		for _, id := range []uuid.UUID{edge.SourceID, edge.TargetID} {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+
+	ctx := context.Background()
+	notes, err := s.ConnectionRepo.NoteSummaries(ctx, ids, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve notes for mindmap: %v", err)
+	}
+	degrees, err := s.ConnectionRepo.Degrees(ctx, ids, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count connections: %v", err)
+	}
+	saved, err := s.PositionRepo.ListForNotes(ctx, view, ids, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve mindmap positions: %v", err)
+	}
+	positions := make(map[uuid.UUID]models.MindmapPosition, len(saved))
+	for _, position := range saved {
+		positions[position.NoteID] = position
+	}
+
+	for _, note := range notes {
+		degree := degrees[note.ID]
+		node := contracts.MindmapNode{GraphNode: contracts.GraphNode{
+			ID:         note.ID,
+			Title:      note.Title,
+			Emoji:      note.Emoji,
+			Categories: note.Categories,
+			Status:     note.Status,
+			InDegree:   degree.InDegree,
+			OutDegree:  degree.OutDegree,
+			Degree:     degree.Degree,
+		}}
+		if node.Categories == nil {
+			node.Categories = []string{}
+		}
+		if position, ok := positions[note.ID]; ok {
+			x, y := position.X, position.Y
+			node.X, node.Y, node.Pinned = &x, &y, true
+		}
+		response.Nodes = append(response.Nodes, node)
+	}
+	layoutMindmap(response.Nodes, response.Edges, layout)
+	return response, nil
+}
+
+// maxMindmapPositions caps how many positions one request may save
+const maxMindmapPositions = 1000
+
+// SaveMindmapPositions stores where the user placed notes in a mind map view
+func (s *ConnectionService) SaveMindmapPositions(view string, req *contracts.MindmapPositionsRequest, userID uuid.UUID) (*contracts.MindmapPositionsResponse, error) {
+	if userID == uuid.Nil {
+		return nil, fmt.Errorf("user ID is required")
+	}
+	if len(req.Positions) == 0 {
+		return nil, fmt.Errorf("at least one position is required")
+	}
+	if len(req.Positions) > maxMindmapPositions {
+		return nil, fmt.Errorf("at most %d positions can be saved at once", maxMindmapPositions)
+	}
+
+	// Later entries for the same note win
+	byNote := make(map[uuid.UUID]contracts.MindmapPosition, len(req.Positions))
+	var ids []uuid.UUID
+	for _, position := range req.Positions {
+		if position.NoteID == uuid.Nil {
+			return nil, fmt.Errorf("note ID is required")
+		}
+		if math.IsNaN(position.X) || math.IsInf(position.X, 0) || math.IsNaN(position.Y) || math.IsInf(position.Y, 0) {
+			return nil, fmt.Errorf("invalid position for note %s", position.NoteID)
+		}
+		if _, ok := byNote[position.NoteID]; !ok {
+			ids = append(ids, position.NoteID)
+		}
+		byNote[position.NoteID] = position
+	}
+
+	ctx := context.Background()
+	notes, err := s.ConnectionRepo.NoteSummaries(ctx, ids, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve notes: %v", err)
+	}
+	if len(notes) != len(ids) {
+		return nil, fmt.Errorf("note not found")
+	}
+
+	response := &contracts.MindmapPositionsResponse{View: view, Positions: make([]contracts.MindmapPosition, 0, len(ids))}
+	positions := make([]models.MindmapPosition, 0, len(ids))
+	for _, id := range ids {
+		position := byNote[id]
+		positions = append(positions, models.MindmapPosition{UserID: userID, View: view, NoteID: id, X: position.X, Y: position.Y})
+		response.Positions = append(response.Positions, position)
+	}
+	if err := s.PositionRepo.Upsert(ctx, positions); err != nil {
+		return nil, fmt.Errorf("failed to save mindmap positions: %v", err)
+	}
+	return response, nil
+}
+
+// ResetMindmapPositions forgets the positions the user saved in a mind map view
+func (s *ConnectionService) ResetMindmapPositions(view string, userID uuid.UUID) error {
+	if userID == uuid.Nil {
+		return fmt.Errorf("user ID is required")
+	}
+	if err := s.PositionRepo.Delete(context.Background(), view, nil, userID); err != nil {
+		return fmt.Errorf("failed to reset mindmap positions: %v", err)
+	}
+	return nil
+}
+
+// GetConnectionTypes returns the connection types available to the user: built-in types first,
+// then the user's and workspace types by name. A user's own type hides a workspace type of the
+// same name, and built-in types hide both.
+func (s *ConnectionService) GetConnectionTypes(userID uuid.UUID) ([]models.ConnectionTypeDefinition, error) {
+	if userID == uuid.Nil {
+		return nil, fmt.Errorf("user ID is required")
+	}
+	stored, err := s.TypeRepo.ListVisible(context.Background(), userID, s.admins.emails())
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve connection types: %v", err)
+	}
+
+	definitions := append([]models.ConnectionTypeDefinition{}, models.BuiltinConnectionTypes...)
+	seen := make(map[models.ConnectionType]int)
+	for i, definition := range definitions {
+		seen[definition.Name] = i
+	}
+	for _, definition := range stored {
+		i, ok := seen[definition.Name]
+		switch {
+		case !ok:
+			seen[definition.Name] = len(definitions)
+			definitions = append(definitions, definition)
+		case !definitions[i].Builtin && definition.UserID == userID:
+			definitions[i] = definition
+		}
+	}
+	rest := definitions[len(models.BuiltinConnectionTypes):]
+	sort.SliceStable(rest, func(i, j int) bool { return rest[i].Name < rest[j].Name })
+	return definitions, nil
+}
+
+// connectionTypeIndex returns the user's available connection types by name
+func (s *ConnectionService) connectionTypeIndex(userID uuid.UUID) (map[models.ConnectionType]models.ConnectionTypeDefinition, error) {
+	definitions, err := s.GetConnectionTypes(userID)
+	if err != nil {
+		return nil, err
+	}
+	index := make(map[models.ConnectionType]models.ConnectionTypeDefinition, len(definitions))
+	for _, definition := range definitions {
+		index[definition.Name] = definition
+	}
+	return index, nil
+}
+
+// CreateConnectionType defines a new connection type for the user or, for admins, the workspace
+func (s *ConnectionService) CreateConnectionType(req *contracts.ConnectionTypeRequest, userID uuid.UUID) (*models.ConnectionTypeDefinition, error) {
+	if userID == uuid.Nil {
+		return nil, fmt.Errorf("user ID is required")
+	}
+	if req.Name == "" {
+		return nil, fmt.Errorf("connection type name is required")
+	}
+
+	definition := &models.ConnectionTypeDefinition{
+		UserID:      userID,
+		Scope:       req.Scope,
+		Name:        models.ConnectionType(req.Name),
+		InverseName: req.InverseName,
+		Color:       req.Color,
+		Directed:    true,
+	}
+	if definition.Scope == "" {
+		definition.Scope = models.ConnectionTypeScopeUser
+	}
+	if definition.Color == "" {
+		definition.Color = defaultConnectionColor
+	}
+	if req.Directed != nil {
+		definition.Directed = *req.Directed
+	}
+	if err := validateConnectionType(definition); err != nil {
+		return nil, err
+	}
+	if err := s.checkScope(definition, userID); err != nil {
+		return nil, err
+	}
+
+	// A user's type may hide a workspace type, but the workspace has one type of each name
+	types, err := s.connectionTypeIndex(userID)
+	if err != nil {
+		return nil, err
+	}
+	if existing, ok := types[definition.Name]; ok &&
+		(existing.Builtin || existing.UserID == userID || definition.Scope == models.ConnectionTypeScopeWorkspace) {
+		return nil, fmt.Errorf("connection type already exists: %s", definition.Name)
+	}
+
+	if err := s.TypeRepo.Create(context.Background(), definition); err != nil {
+		return nil, fmt.Errorf("failed to create connection type: %v", err)
+	}
+	return definition, nil
+}
+
+// UpdateConnectionType changes a connection type. Only the owner may modify it, and its name
+// is fixed because connections refer to it. A new direction applies to existing connections,
+// of every user who sees the type when it is a workspace type.
+func (s *ConnectionService) UpdateConnectionType(definitionID uuid.UUID, req *contracts.ConnectionTypeRequest, userID uuid.UUID) (*models.ConnectionTypeDefinition, error) {
+	definition, err := s.getOwnedConnectionType(definitionID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Name != "" && models.ConnectionType(req.Name) != definition.Name {
+		return nil, fmt.Errorf("connection type name cannot be changed")
+	}
+	if req.Scope != "" {
+		definition.Scope = req.Scope
+	}
+	if req.InverseName != "" {
+		definition.InverseName = req.InverseName
+	}
+	if req.Color != "" {
+		definition.Color = req.Color
+	}
+	directionChanged := req.Directed != nil && *req.Directed != definition.Directed
+	if req.Directed != nil {
+		definition.Directed = *req.Directed
+	}
+	if err := validateConnectionType(definition); err != nil {
+		return nil, err
+	}
+	if err := s.checkScope(definition, userID); err != nil {
+		return nil, err
+	}
+
+	if err := s.TypeRepo.Update(context.Background(), definition, directionChanged); err != nil {
+		return nil, fmt.Errorf("failed to update connection type: %v", err)
+	}
+	return definition, nil
+}
+
+// DeleteConnectionType removes a connection type that no connection uses
+func (s *ConnectionService) DeleteConnectionType(definitionID, userID uuid.UUID) error {
+	definition, err := s.getOwnedConnectionType(definitionID, userID)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	count, err := s.TypeRepo.CountUsage(ctx, definition)
+	if err != nil {
+		return fmt.Errorf("failed to check connection type usage: %v", err)
+	}
+	if count > 0 {
+		return fmt.Errorf("connection type is used by %d connections", count)
+	}
+	return s.TypeRepo.Delete(ctx, definitionID, userID)
+}
+
+// getOwnedConnectionType loads a connection type the user may modify
+func (s *ConnectionService) getOwnedConnectionType(definitionID, userID uuid.UUID) (*models.ConnectionTypeDefinition, error) {
+	if definitionID == uuid.Nil {
+		return nil, fmt.Errorf("connection type ID is required")
+	}
+	definition, err := s.TypeRepo.GetVisibleByID(context.Background(), definitionID, userID, s.admins.emails())
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve connection type: %v", err)
+	}
+	if definition == nil {
+		return nil, fmt.Errorf("connection type not found")
+	}
+	if definition.UserID != userID {
+		return nil, fmt.Errorf("only the connection type owner can modify it")
+	}
+	return definition, nil
+}
+
+// checkScope makes sure only admins share connection types with the workspace; any user may
+// keep or make a type their own
+func (s *ConnectionService) checkScope(definition *models.ConnectionTypeDefinition, userID uuid.UUID) error {
+	if definition.Scope != models.ConnectionTypeScopeWorkspace {
+		return nil
+	}
+	user, err := s.UserRepo.FindByID(userID.String())
+	if err != nil {
+		return fmt.Errorf("failed to load user: %v", err)
+	}
+	if !s.admins.includes(user) {
+		return fmt.Errorf("only admins can share connection types with the workspace")
+	}
+	return nil
+}
+
+// validateConnectionType checks the name, scope, color and inverse name of a connection type
+func validateConnectionType(definition *models.ConnectionTypeDefinition) error {
+	if !connectionTypeNamePattern.MatchString(string(definition.Name)) {
+		return fmt.Errorf("invalid connection type name: %q", definition.Name)
+	}
+	if definition.Scope != models.ConnectionTypeScopeUser && definition.Scope != models.ConnectionTypeScopeWorkspace {
+		return fmt.Errorf("invalid connection type scope: %s", definition.Scope)
+	}
+	if !colorPattern.MatchString(definition.Color) {
+		return fmt.Errorf("invalid color: %s", definition.Color)
+	}
+	if !definition.Directed && definition.InverseName != "" && definition.InverseName != string(definition.Name) {
+		return fmt.Errorf("undirected connection types have no inverse name")
+	}
+	return nil
+}
@@ -0,0 +1,402 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"NoteSense/models"
+	"NoteSense/repositories"
+	"NoteSense/utils"
+
+	"github.com/google/uuid"
+)
+
+// defaultEmbeddingModel is a small sentence-transformers model that runs well on CPU
+const defaultEmbeddingModel = "sentence-transformers/all-MiniLM-L6-v2"
+
+const (
+	embeddingBatchSize = 16
+	maxEmbeddingText   = 8000 // Bytes of a note sent to the embedder
+)
+
+// Embedder turns texts into fixed-size vectors whose cosine similarity reflects their meaning
+type Embedder interface {
+	Model() string
+	Embed(texts []string) ([][]float32, error)
+}
+
+// LocalEmbedder computes embeddings on the CPU with the scripts/embed.py helper
+type LocalEmbedder struct {
+	model string
+}
+
+// NewLocalEmbedder creates an embedder using EMBEDDING_MODEL or the default model
+func NewLocalEmbedder() *LocalEmbedder {
+	model := os.Getenv("EMBEDDING_MODEL")
+	if model == "" {
+		model = defaultEmbeddingModel
+	}
+	return &LocalEmbedder{model: model}
+}
+
+// Available reports why the embedding script cannot run, e.g. before the Python environment is set up
+func (e *LocalEmbedder) Available() error {
+	scriptPath, err := filepath.Abs("./scripts/embed.py")
+	if err != nil {
+		return err
+	}
+	for _, path := range []string{scriptPath, filepath.Join(filepath.Dir(scriptPath), "venv", "bin", "python3")} {
+		if _, err := os.Stat(path); err != nil {
+			return fmt.Errorf("%s is missing", path)
+		}
+	}
+	return nil
+}
+
+func (e *LocalEmbedder) Model() string {
+	return e.model
+}
+
+func (e *LocalEmbedder) Embed(texts []string) ([][]float32, error) {
+	// Use absolute path to the script
+	scriptPath, err := filepath.Abs("./scripts/embed.py")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get script path: %v", err)
+	}
+
+	// Path to virtual environment python executable
+	pythonPath := filepath.Join(filepath.Dir(scriptPath), "venv", "bin", "python3")
+
+	input, err := json.Marshal(texts)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	// Texts are passed on stdin as a JSON array; vectors come back on stdout
+	cmd := exec.CommandContext(ctx, pythonPath, scriptPath, "--model", e.model)
+	cmd.Dir = filepath.Dir(scriptPath)
+	cmd.Stdin = bytes.NewReader(input)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	output, err := cmd.Output()
+	if err != nil {
+		log.Printf("Embedding error: %v", err)
+		log.Printf("Embedding output: %s", stderr.String())
+		return nil, fmt.Errorf("embedding failed: %v", err)
+	}
+
+	var vectors [][]float32
+	if err := json.Unmarshal(output, &vectors); err != nil {
+		return nil, fmt.Errorf("invalid embedding output: %v", err)
+	}
+	if len(vectors) != len(texts) {
+		return nil, fmt.Errorf("embedding returned %d vectors for %d texts", len(vectors), len(texts))
+	}
+	return vectors, nil
+}
+
+// ScoredNoteID is a note with its cosine similarity to a query
+type ScoredNoteID struct {
+	NoteID uuid.UUID
+	Score  float64
+}
+
+// EmbeddingService keeps note embeddings up to date in the background and answers
+// nearest-neighbour queries from an in-process index loaded per user
+type EmbeddingService struct {
+	embedder      Embedder
+	embeddingRepo *repositories.EmbeddingRepository
+	noteRepo      *repositories.NoteRepository
+
+	queueMu sync.Mutex
+	queue   map[uuid.UUID]uuid.UUID // Note ID to owner, deduplicating repeated edits
+	wake    chan struct{}
+
+	indexMu sync.RWMutex
+	index   map[uuid.UUID]map[uuid.UUID][]float32 // User ID to note vectors, normalized
+}
+
+// NewEmbeddingService creates a new EmbeddingService
+func NewEmbeddingService(embedder Embedder, embeddingRepo *repositories.EmbeddingRepository, noteRepo *repositories.NoteRepository) *EmbeddingService {
+	return &EmbeddingService{
+		embedder:      embedder,
+		embeddingRepo: embeddingRepo,
+		noteRepo:      noteRepo,
+		queue:         make(map[uuid.UUID]uuid.UUID),
+		wake:          make(chan struct{}, 1),
+		index:         make(map[uuid.UUID]map[uuid.UUID][]float32),
+	}
+}
+
+// Start runs the background worker until ctx is done and queues notes that were never embedded
+func (s *EmbeddingService) Start(ctx context.Context) {
+	go s.run(ctx)
+
+	go func() {
+		missing, err := s.embeddingRepo.MissingNotes(ctx, s.embedder.Model())
+		if err != nil {
+			log.Printf("Failed to list notes without embeddings: %v", err)
+			return
+		}
+		for _, ref := range missing {
+			s.Enqueue(ref.ID, ref.UserID)
+		}
+	}()
+}
+
+// Enqueue schedules a note to be (re-)embedded
+func (s *EmbeddingService) Enqueue(noteID, userID uuid.UUID) {
+	if s == nil {
+		return
+	}
+	s.queueMu.Lock()
+	s.queue[noteID] = userID
+	s.queueMu.Unlock()
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Forget drops a note's embedding, e.g. when it is deleted or locked
+func (s *EmbeddingService) Forget(noteID, userID uuid.UUID) {
+	if s == nil {
+		return
+	}
+	s.queueMu.Lock()
+	delete(s.queue, noteID)
+	s.queueMu.Unlock()
+
+	if err := s.embeddingRepo.Delete(context.Background(), noteID); err != nil {
+		log.Printf("Failed to delete embedding of note %s: %v", noteID, err)
+	}
+	s.indexMu.Lock()
+	if vectors, ok := s.index[userID]; ok {
+		delete(vectors, noteID)
+	}
+	s.indexMu.Unlock()
+}
+
+func (s *EmbeddingService) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.wake:
+		}
+
+		for {
+			batch := s.nextBatch()
+			if len(batch) == 0 {
+				break
+			}
+			if err := s.embedNotes(ctx, batch); err != nil {
+				log.Printf("Failed to embed %d notes: %v", len(batch), err)
+			}
+		}
+	}
+}
+
+// nextBatch takes up to embeddingBatchSize notes off the queue
+func (s *EmbeddingService) nextBatch() []repositories.NoteRef {
+	s.queueMu.Lock()
+	defer s.queueMu.Unlock()
+
+	batch := make([]repositories.NoteRef, 0, embeddingBatchSize)
+	for noteID, userID := range s.queue {
+		if len(batch) == embeddingBatchSize {
+			break
+		}
+		batch = append(batch, repositories.NoteRef{ID: noteID, UserID: userID})
+		delete(s.queue, noteID)
+	}
+	return batch
+}
+
+// embedNotes embeds the notes whose text changed since they were last embedded
+func (s *EmbeddingService) embedNotes(ctx context.Context, batch []repositories.NoteRef) error {
+	model := s.embedder.Model()
+
+	var pending []models.NoteEmbedding
+	var texts []string
+	for _, ref := range batch {
+		note, err := s.noteRepo.GetByID(ref.ID, ref.UserID)
+		if err != nil {
+			return err
+		}
+		if note == nil || note.Encrypted {
+			s.Forget(ref.ID, ref.UserID)
+			continue
+		}
+
+		text := embeddingText(note)
+		contentHash, err := s.embeddingRepo.Fingerprint(ctx, note.UserID, model, text)
+		if err != nil {
+			return err
+		}
+
+		existing, err := s.embeddingRepo.Get(ctx, note.ID)
+		if err != nil {
+			return err
+		}
+		if existing != nil && existing.ContentHash == contentHash {
+			continue
+		}
+
+		pending = append(pending, models.NoteEmbedding{NoteID: note.ID, UserID: note.UserID, Model: model, ContentHash: contentHash})
+		texts = append(texts, text)
+	}
+	if len(texts) == 0 {
+		return nil
+	}
+
+	vectors, err := s.embedder.Embed(texts)
+	if err != nil {
+		return err
+	}
+
+	for i := range pending {
+		pending[i].Vector = normalize(vectors[i])
+		if err := s.embeddingRepo.Upsert(ctx, &pending[i]); err != nil {
+			return err
+		}
+		s.indexMu.Lock()
+		if userVectors, ok := s.index[pending[i].UserID]; ok {
+			userVectors[pending[i].NoteID] = pending[i].Vector
+		}
+		s.indexMu.Unlock()
+	}
+	return nil
+}
+
+// SimilarToText returns the user's notes closest in meaning to text, best first
+func (s *EmbeddingService) SimilarToText(ctx context.Context, text string, limit int, minScore float64, userID uuid.UUID) ([]ScoredNoteID, error) {
+	vectors, err := s.embedder.Embed([]string{text})
+	if err != nil {
+		return nil, err
+	}
+	return s.nearest(ctx, normalize(vectors[0]), uuid.Nil, limit, minScore, userID)
+}
+
+// SimilarToNote returns the notes closest in meaning to a note. It reports false when the
+// note has not been embedded yet, in which case it is queued.
+func (s *EmbeddingService) SimilarToNote(ctx context.Context, noteID uuid.UUID, limit int, userID uuid.UUID) ([]ScoredNoteID, bool, error) {
+	embedding, err := s.embeddingRepo.Get(ctx, noteID)
+	if err != nil {
+		return nil, false, err
+	}
+	if embedding == nil || embedding.UserID != userID || embedding.Model != s.embedder.Model() {
+		s.Enqueue(noteID, userID)
+		return []ScoredNoteID{}, false, nil
+	}
+	scored, err := s.nearest(ctx, embedding.Vector, noteID, limit, 0, userID)
+	return scored, true, err
+}
+
+// nearest scans the user's vectors for the closest matches to query
+func (s *EmbeddingService) nearest(ctx context.Context, query []float32, exclude uuid.UUID, limit int, minScore float64, userID uuid.UUID) ([]ScoredNoteID, error) {
+	vectors, err := s.userVectors(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.indexMu.RLock()
+	scored := make([]ScoredNoteID, 0, len(vectors))
+	for noteID, vector := range vectors {
+		if noteID == exclude || len(vector) != len(query) {
+			continue
+		}
+		if score := dot(query, vector); score >= minScore {
+			scored = append(scored, ScoredNoteID{NoteID: noteID, Score: score})
+		}
+	}
+	s.indexMu.RUnlock()
+
+	sort.Slice(scored, func(i, j int) bool { return scored[i].Score > scored[j].Score })
+	if len(scored) > limit {
+		scored = scored[:limit]
+	}
+	return scored, nil
+}
+
+// userVectors returns the user's part of the index, loading it from the database on first use
+func (s *EmbeddingService) userVectors(ctx context.Context, userID uuid.UUID) (map[uuid.UUID][]float32, error) {
+	s.indexMu.RLock()
+	vectors, ok := s.index[userID]
+	s.indexMu.RUnlock()
+	if ok {
+		return vectors, nil
+	}
+
+	embeddings, err := s.embeddingRepo.ListByUser(ctx, userID, s.embedder.Model())
+	if err != nil {
+		return nil, fmt.Errorf("failed to load embeddings: %v", err)
+	}
+	vectors = make(map[uuid.UUID][]float32, len(embeddings))
+	for _, embedding := range embeddings {
+		vectors[embedding.NoteID] = embedding.Vector
+	}
+
+	s.indexMu.Lock()
+	if existing, ok := s.index[userID]; ok {
+		vectors = existing
+	} else {
+		s.index[userID] = vectors
+	}
+	s.indexMu.Unlock()
+	return vectors, nil
+}
+
+// embeddingText is the text of a note that gets embedded
+func embeddingText(note *models.Note) string {
+	text := note.Title + "\n\n" + utils.PlainText(note.Content)
+	if len(text) > maxEmbeddingText {
+		// Cut on a rune boundary so the text stays valid UTF-8
+		cut := maxEmbeddingText
+		for cut > 0 && !utf8.RuneStart(text[cut]) {
+			cut--
+		}
+		text = text[:cut]
+	}
+	return text
+}
+
+func normalize(vector []float32) []float32 {
+	var sum float64
+	for _, v := range vector {
+		sum += float64(v) * float64(v)
+	}
+	norm := math.Sqrt(sum)
+	if norm == 0 {
+		return vector
+	}
+	normalized := make([]float32, len(vector))
+	for i, v := range vector {
+		normalized[i] = float32(float64(v) / norm)
+	}
+	return normalized
+}
+
+func dot(a, b []float32) float64 {
+	var sum float64
+	for i := range a {
+		sum += float64(a[i]) * float64(b[i])
+	}
+	return sum
+}
@@ -0,0 +1,65 @@
+package services
+
+import (
+	"math"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name  string
+		input []float32
+		want  []float32
+	}{
+		{"unit axis", []float32{0, 2, 0}, []float32{0, 1, 0}},
+		{"3-4-5", []float32{3, 4}, []float32{0.6, 0.8}},
+		{"negative", []float32{-3, 0, 4}, []float32{-0.6, 0, 0.8}},
+		{"already unit", []float32{0.6, 0.8}, []float32{0.6, 0.8}},
+		{"tiny", []float32{1e-20, 1e-20}, []float32{float32(math.Sqrt2 / 2), float32(math.Sqrt2 / 2)}},
+		{"zero", []float32{0, 0, 0}, []float32{0, 0, 0}},
+		{"empty", []float32{}, []float32{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := normalize(tt.input)
+			if len(got) != len(tt.want) {
+				t.Fatalf("normalize(%v) = %v, want %v", tt.input, got, tt.want)
+			}
+			for i := range got {
+				if math.Abs(float64(got[i]-tt.want[i])) > 1e-6 {
+					t.Fatalf("normalize(%v) = %v, want %v", tt.input, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestNormalizeKeepsInput(t *testing.T) {
+	input := []float32{3, 4}
+	normalize(input)
+	if input[0] != 3 || input[1] != 4 {
+		t.Errorf("normalize changed its input to %v", input)
+	}
+}
+
+// TestNormalizedDot checks that the dot product of normalized vectors is their cosine similarity
+func TestNormalizedDot(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b []float32
+		want float64
+	}{
+		{"same direction", []float32{1, 2, 3}, []float32{2, 4, 6}, 1},
+		{"opposite", []float32{1, 2, 3}, []float32{-1, -2, -3}, -1},
+		{"orthogonal", []float32{1, 0}, []float32{0, 5}, 0},
+		{"45 degrees", []float32{1, 0}, []float32{3, 3}, math.Sqrt2 / 2},
+		{"zero vector", []float32{0, 0}, []float32{1, 1}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := dot(normalize(tt.a), normalize(tt.b)); math.Abs(got-tt.want) > 1e-6 {
+				t.Errorf("dot(normalize(%v), normalize(%v)) = %v, want %v", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Kinds of uploadable files. The kind decides how text is extracted from a file.
+const (
+	FileKindImage    = "image"    // Text is read by OCR
+	FileKindAudio    = "audio"    // Text is transcribed
+	FileKindDocument = "document" // Stored without extracting text
+)
+
+// Default upload size limits per kind, in megabytes
+var defaultFileKindLimitsMB = map[string]int64{
+	FileKindImage:    10,
+	FileKindAudio:    100,
+	FileKindDocument: 20,
+}
+
+// FileType is an uploadable type of file
+type FileType struct {
+	Extensions  []string
+	ContentType string   // Served with downloads
+	Sniffed     []string // Content types the first bytes of the file may be detected as
+	Kind        string
+}
+
+// fileTypes is the allowlist of uploadable files. An upload must have one of the extensions of
+// a type and content that is detected as one of that type's sniffed content types.
+var fileTypes = []FileType{
+	{Extensions: []string{".jpg", ".jpeg"}, ContentType: "image/jpeg", Sniffed: []string{"image/jpeg"}, Kind: FileKindImage},
+	{Extensions: []string{".png"}, ContentType: "image/png", Sniffed: []string{"image/png"}, Kind: FileKindImage},
+	{Extensions: []string{".gif"}, ContentType: "image/gif", Sniffed: []string{"image/gif"}, Kind: FileKindImage},
+	{Extensions: []string{".mp3"}, ContentType: "audio/mpeg", Sniffed: []string{"audio/mpeg"}, Kind: FileKindAudio},
+	{Extensions: []string{".wav"}, ContentType: "audio/wav", Sniffed: []string{"audio/wave"}, Kind: FileKindAudio},
+	{Extensions: []string{".ogg"}, ContentType: "audio/ogg", Sniffed: []string{"application/ogg"}, Kind: FileKindAudio},
+	{Extensions: []string{".m4a"}, ContentType: "audio/mp4", Sniffed: []string{"audio/mp4", "video/mp4"}, Kind: FileKindAudio},
+	{Extensions: []string{".pdf"}, ContentType: "application/pdf", Sniffed: []string{"application/pdf"}, Kind: FileKindDocument},
+	{Extensions: []string{".doc"}, ContentType: "application/msword", Sniffed: []string{"application/x-ole-storage"}, Kind: FileKindDocument},
+	{
+		Extensions:  []string{".docx"},
+		ContentType: "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+		Sniffed:     []string{"application/zip"},
+		Kind:        FileKindDocument,
+	},
+	{Extensions: []string{".txt"}, ContentType: "text/plain; charset=utf-8", Sniffed: []string{"text/plain"}, Kind: FileKindDocument},
+}
+
+// LookupFileType returns the type of file a name's extension belongs to, or nil if such files
+// cannot be uploaded
+func LookupFileType(fileName string) *FileType {
+	ext := strings.ToLower(filepath.Ext(fileName))
+	for i := range fileTypes {
+		for _, candidate := range fileTypes[i].Extensions {
+			if candidate == ext {
+				return &fileTypes[i]
+			}
+		}
+	}
+	return nil
+}
+
+// DetectFileType checks an upload's name against the allowlist and its first bytes against the
+// type the name claims
+func DetectFileType(fileName string, head []byte) (*FileType, error) {
+	fileType := LookupFileType(fileName)
+	if fileType == nil {
+		return nil, fmt.Errorf("unsupported file type: %q", filepath.Ext(fileName))
+	}
+	sniffed := sniffContentType(head)
+	for _, accepted := range fileType.Sniffed {
+		if sniffed == accepted {
+			return fileType, nil
+		}
+	}
+	return nil, fmt.Errorf("file content (%s) does not match its extension %s", sniffed, strings.ToLower(filepath.Ext(fileName)))
+}
+
+// MaxSize returns the largest upload of this type allowed, set by UPLOAD_MAX_<KIND>_MB
+func (t *FileType) MaxSize() int64 {
+	return fileKindLimit(t.Kind)
+}
+
+// MaxUploadSize returns the largest upload of any type allowed
+func MaxUploadSize() int64 {
+	var largest int64
+	for kind := range defaultFileKindLimitsMB {
+		if limit := fileKindLimit(kind); limit > largest {
+			largest = limit
+		}
+	}
+	return largest
+}
+
+func fileKindLimit(kind string) int64 {
+	megabytes := defaultFileKindLimitsMB[kind]
+	if value := os.Getenv("UPLOAD_MAX_" + strings.ToUpper(kind) + "_MB"); value != "" {
+		if parsed, err := strconv.ParseInt(value, 10, 64); err == nil && parsed > 0 {
+			megabytes = parsed
+		}
+	}
+	return megabytes << 20
+}
+
+// sniffLength is how many leading bytes of a file content sniffing looks at
+const sniffLength = 512
+
+// sniffContentType detects the content type of a file from its first bytes (up to 512). It
+// knows the formats http.DetectContentType misses: MP3 without ID3 tags, MPEG-4 audio and
+// legacy Office documents.
+func sniffContentType(head []byte) string {
+	switch {
+	case len(head) >= 2 && head[0] == 0xFF && head[1]&0xE0 == 0xE0 && head[1]&0x06 != 0:
+		// An MPEG audio frame sync with a valid layer
+		return "audio/mpeg"
+	case len(head) >= 12 && string(head[4:8]) == "ftyp" && (string(head[8:11]) == "M4A" || string(head[8:11]) == "M4B"):
+		return "audio/mp4"
+	case bytes.HasPrefix(head, []byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1}):
+		return "application/x-ole-storage"
+	}
+	contentType := http.DetectContentType(head)
+	if i := strings.Index(contentType, ";"); i >= 0 {
+		contentType = contentType[:i]
+	}
+	return contentType
+}
@@ -1,11 +1,14 @@
 package services
 
 import (
+	"context"
 	"fmt"
 	"io"
+	"mime"
 	"mime/multipart"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
@@ -14,15 +17,31 @@ import (
 	"NoteSense/contracts"
 	"NoteSense/models"
 	"NoteSense/repositories"
+	"NoteSense/storage"
+	"NoteSense/utils"
 	"log"
 	"os/exec"
 )
 
+// defaultStorageQuotaMB is how much each user may store unless STORAGE_QUOTA_MB says otherwise
+const defaultStorageQuotaMB = 1024
+
+// maxStoreAttempts bounds how often a file is stored again after its blob was deleted under it
+const maxStoreAttempts = 3
+
+// extractionMargins head the text extracted from each type of file when it is appended to a note
+var extractionMargins = map[string]string{
+	"image": "------------------------------ Data extracted from image --------------------------------",
+	"audio": "------------------------------ Data extracted from audio --------------------------------",
+}
+
 type FileUploadService struct {
 	fileMetadataRepo *repositories.FileMetadataRepository
 	speechService    *SpeechToTextService // Speech-to-text dependency
 	ocrService       *OCRService          // Add OCR service dependency
 	noteService      *NoteService
+	cipher           *repositories.ContentCipher // At-rest encryption of stored files
+	blobs            storage.BlobStore           // Where the bytes of uploaded files are kept
 }
 
 // Update the constructor to accept OCRService
@@ -31,12 +50,16 @@ func NewFileUploadService(
 	speechService *SpeechToTextService,
 	ocrService *OCRService, // Add this parameter
 	noteService *NoteService,
+	cipher *repositories.ContentCipher,
+	blobs storage.BlobStore,
 ) *FileUploadService {
 	return &FileUploadService{
 		fileMetadataRepo: fileMetadataRepo,
 		speechService:    speechService,
 		ocrService:       ocrService, // Set the OCR service
 		noteService:      noteService,
+		cipher:           cipher,
+		blobs:            blobs,
 	}
 }
 
@@ -46,80 +69,110 @@ func (s *FileUploadService) SaveFile(file *multipart.FileHeader, userID uuid.UUI
 		return nil, fmt.Errorf("invalid user ID")
 	}
 
-	// Create upload directory if not exists
-	uploadDir := "./../uploadedFiles"
-	if err := os.MkdirAll(uploadDir, os.ModePerm); err != nil {
-		return nil, fmt.Errorf("failed to create upload directory: %v", err)
+	open := func() (io.ReadCloser, error) {
+		src, err := file.Open()
+		if err != nil {
+			return nil, fmt.Errorf("failed to open uploaded file: %v", err)
+		}
+		return src, nil
 	}
+	return s.processFile(file.Filename, open, file.Size, userID, noteID)
+}
 
-	// Generate unique filename
-	fileExt := filepath.Ext(file.Filename)
-	uniqueFileName := fmt.Sprintf("%s%s", uuid.New().String(), fileExt)
-	filePath := filepath.Join(uploadDir, uniqueFileName)
-
-	// Save uploaded file
-	dst, err := os.Create(filePath)
+// processFile stores an uploaded file, extracts its text and appends the text to its note.
+// Direct and resumable uploads both end here. The file is streamed from open, which may be
+// called more than once, so it is never held in memory as a whole.
+func (s *FileUploadService) processFile(fileName string, open func() (io.ReadCloser, error), size int64, userID, noteID uuid.UUID) (*models.FileMetadata, error) {
+	// Resolve the target note first: locked notes must not receive plaintext extractions
+	note, err := s.noteService.GetNoteByID(noteID, userID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create file: %v", err)
+		return nil, err
 	}
-	defer dst.Close()
 
-	src, err := file.Open()
+	// The extension must be allowed and the content must be what the extension claims
+	head, err := readHead(open)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open uploaded file: %v", err)
+		return nil, err
 	}
-	defer src.Close()
-
-	if _, err = io.Copy(dst, src); err != nil {
-		return nil, fmt.Errorf("failed to save file: %v", err)
+	fileType, err := DetectFileType(fileName, head)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkUploadSize(fileType, size, userID); err != nil {
+		return nil, err
 	}
 
-	// Determine file type
-	fileType := s.determineFileType(file.Filename)
+	// Save uploaded file, encrypted at rest when a master key is configured
+	storageKey, err := s.storeBlob(open, userID)
+	if err != nil {
+		return nil, err
+	}
 
-	// Extract text based on file type
+	// Extract text based on file type. OCR, transcription and enrichment are
+	// skipped for locked notes so no plaintext derived from them is stored.
 	var extractedText string
-	var additionalMargin string
-	switch fileType {
-	case "image":
-		extractedText, _ = s.ocrService.ProcessImage(filePath)
-		additionalMargin = "------------------------------ Data extracted from image --------------------------------"
-	case "audio":
-		extractedText, _ = s.speechService.TranscribeAudio(filePath)
-		additionalMargin = "------------------------------ Data extracted from audio --------------------------------"
-	}
+	var enrichedText string
+	if !note.Encrypted && (fileType.Kind == FileKindImage || fileType.Kind == FileKindAudio) {
+		// OCR and transcription read a plaintext working copy that is removed afterwards
+		workPath, err := writeWorkingCopy(open, filepath.Ext(fileName))
+		if err != nil {
+			return nil, err
+		}
+		defer os.Remove(workPath)
 
-	enrichedText, err := s.enrichText(extractedText)
-	if err != nil {
-		log.Printf("Text enrichment error: %v", err)
-		// Use original text if enrichment fails
-		enrichedText = extractedText
+		switch fileType.Kind {
+		case FileKindImage:
+			extractedText, _ = s.ocrService.ProcessImage(workPath)
+		case FileKindAudio:
+			extractedText, _ = s.speechService.TranscribeAudio(workPath)
+		}
+
+		if extractedText != "" {
+			enrichedText, err = s.enrichText(extractedText)
+			if err != nil {
+				log.Printf("Text enrichment error: %v", err)
+				// Use original text if enrichment fails
+				enrichedText = extractedText
+			}
+		}
 	}
 
 	// Create file metadata
 	fileMetadata := &models.FileMetadata{
 		UserID:        userID,
-		FileName:      file.Filename,
-		FileType:      fileType,
-		FilePath:      filePath,
+		NoteID:        &noteID,
+		FileName:      fileName,
+		FileType:      fileType.Kind,
+		ContentType:   fileType.ContentType,
+		StorageKey:    storageKey,
+		Size:          size,
 		ExtractedText: enrichedText,
 		ProcessedAt:   time.Now(),
 	}
 
-	// Save metadata to database
-	if err := s.fileMetadataRepo.Create(fileMetadata); err != nil {
-		return nil, fmt.Errorf("failed to save file metadata: %v", err)
+	// Save metadata to database. Should the blob have been deleted since it was stored, along
+	// with the last other file of the same bytes, it is stored again.
+	for attempt := 1; ; attempt++ {
+		err := s.fileMetadataRepo.Create(context.Background(), fileMetadata, s.blobs)
+		if err == nil {
+			break
+		}
+		if err != repositories.ErrBlobMissing || attempt == maxStoreAttempts {
+			return nil, fmt.Errorf("failed to save file metadata: %v", err)
+		}
+		if fileMetadata.StorageKey, err = s.storeBlob(open, userID); err != nil {
+			return nil, err
+		}
 	}
 
-	// Implement appending the extracted text to the existing Note contents
-	note, err := s.noteService.GetNoteByID(noteID, userID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to add text to note: %v", err)
+	if note.Encrypted || enrichedText == "" {
+		return fileMetadata, nil
 	}
 
+	// Implement appending the extracted text to the existing Note contents
 	if _, err := s.noteService.UpdateNote(&contracts.UpdateNoteRequest{
 		NoteID:  noteID,
-		Content: note.Content + "\n\n" + additionalMargin + "\n" + enrichedText,
+		Content: note.Content + extractedTextBlock(fileType.Kind, enrichedText),
 	}, userID); err != nil {
 		return nil, fmt.Errorf("failed to update note: %v", err)
 	}
@@ -127,25 +180,269 @@ func (s *FileUploadService) SaveFile(file *multipart.FileHeader, userID uuid.UUI
 	return fileMetadata, nil
 }
 
-func (s *FileUploadService) determineFileType(filename string) string {
-	ext := strings.ToLower(filepath.Ext(filename))
+// readHead returns the first bytes of a file, as many as content sniffing looks at
+func readHead(open func() (io.ReadCloser, error)) ([]byte, error) {
+	src, err := open()
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+	head := make([]byte, sniffLength)
+	n, err := io.ReadFull(src, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, fmt.Errorf("failed to read uploaded file: %v", err)
+	}
+	return head[:n], nil
+}
+
+// storeBlob streams a file through at-rest encryption into the blob store and returns its key
+func (s *FileUploadService) storeBlob(open func() (io.ReadCloser, error), userID uuid.UUID) (string, error) {
+	src, err := open()
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+	stored, err := s.cipher.EncryptFile(context.Background(), userID, src)
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt file: %v", err)
+	}
+	key, _, err := s.blobs.Put(context.Background(), stored)
+	if err != nil {
+		return "", fmt.Errorf("failed to save file: %v", err)
+	}
+	return key, nil
+}
+
+// writeWorkingCopy copies a file into a temporary file for tools that read from disk and
+// returns its path; the caller removes it
+func writeWorkingCopy(open func() (io.ReadCloser, error), ext string) (string, error) {
+	src, err := open()
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+	workFile, err := os.CreateTemp("", "notesense-*"+ext)
+	if err != nil {
+		return "", fmt.Errorf("failed to create working file: %v", err)
+	}
+	_, err = io.Copy(workFile, src)
+	if closeErr := workFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(workFile.Name())
+		return "", fmt.Errorf("failed to write working file: %v", err)
+	}
+	return workFile.Name(), nil
+}
 
-	imageExtensions := map[string]bool{
-		".jpg": true, ".jpeg": true, ".png": true, ".gif": true,
+// checkUploadSize checks an upload of the given size against its type's size limit and the
+// user's storage quota
+func (s *FileUploadService) checkUploadSize(fileType *FileType, size int64, userID uuid.UUID) error {
+	if limit := fileType.MaxSize(); size > limit {
+		return fmt.Errorf("file too large: %s files may be at most %d MB", fileType.Kind, limit>>20)
 	}
+	return s.checkQuota(size, 0, userID)
+}
 
-	audioExtensions := map[string]bool{
-		".mp3": true, ".wav": true, ".ogg": true, ".m4a": true,
+// checkQuota checks that size more bytes fit in the user's storage quota besides their files and
+// the bytes reserved by their uploads in progress
+func (s *FileUploadService) checkQuota(size, reserved int64, userID uuid.UUID) error {
+	quota := StorageQuota()
+	if quota == 0 {
+		return nil
+	}
+	used, err := s.fileMetadataRepo.UsageByUser(context.Background(), userID)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve storage usage: %v", err)
+	}
+	if used.Bytes+reserved+size > quota {
+		if reserved > 0 {
+			return fmt.Errorf("storage quota exceeded: %d of %d MB used, %d MB reserved by uploads in progress", used.Bytes>>20, quota>>20, reserved>>20)
+		}
+		return fmt.Errorf("storage quota exceeded: %d of %d MB used", used.Bytes>>20, quota>>20)
+	}
+	return nil
+}
+
+// GetStorageUsage returns how much storage the user's files take up, in total and per kind
+func (s *FileUploadService) GetStorageUsage(userID uuid.UUID) (*contracts.StorageUsageResponse, error) {
+	if userID == uuid.Nil {
+		return nil, fmt.Errorf("user ID is required")
+	}
+	used, err := s.fileMetadataRepo.UsageByUser(context.Background(), userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve storage usage: %v", err)
 	}
 
-	switch {
-	case imageExtensions[ext]:
-		return "image"
-	case audioExtensions[ext]:
-		return "audio"
-	default:
-		return "unsupported"
+	response := &contracts.StorageUsageResponse{
+		UsedBytes:  used.Bytes,
+		QuotaBytes: StorageQuota(),
+		Files:      used.Files,
+		ByKind:     used.ByKind,
+		MaxSizes:   make(map[string]int64, len(defaultFileKindLimitsMB)),
+	}
+	for kind := range defaultFileKindLimitsMB {
+		response.MaxSizes[kind] = fileKindLimit(kind)
+	}
+	return response, nil
+}
+
+// StorageQuota returns the bytes each user may store, set by STORAGE_QUOTA_MB; 0 is unlimited
+func StorageQuota() int64 {
+	megabytes := int64(defaultStorageQuotaMB)
+	if value := os.Getenv("STORAGE_QUOTA_MB"); value != "" {
+		if parsed, err := strconv.ParseInt(value, 10, 64); err == nil && parsed >= 0 {
+			megabytes = parsed
+		}
+	}
+	return megabytes << 20
+}
+
+// GetAttachments returns the files attached to one of the user's notes
+func (s *FileUploadService) GetAttachments(noteID, userID uuid.UUID) (*contracts.AttachmentsResponse, error) {
+	if _, err := s.noteService.GetNoteByID(noteID, userID); err != nil {
+		return nil, err
+	}
+	files, err := s.fileMetadataRepo.ListByNote(context.Background(), noteID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve attachments: %v", err)
+	}
+
+	response := &contracts.AttachmentsResponse{Attachments: make([]contracts.Attachment, 0, len(files))}
+	for _, file := range files {
+		attachment := contracts.Attachment{
+			ID:          file.ID,
+			FileName:    file.FileName,
+			FileType:    file.FileType,
+			ContentType: FileContentType(&file),
+			Size:        file.Size,
+			CreatedAt:   file.CreatedAt,
+		}
+		if file.NoteID != nil {
+			attachment.NoteID = *file.NoteID
+		}
+		response.Attachments = append(response.Attachments, attachment)
+	}
+	return response, nil
+}
+
+// ReadFile returns one of the user's files with a reader of its decrypted contents, which
+// seeks so ranges are served without reading or decrypting the rest. The caller closes it.
+func (s *FileUploadService) ReadFile(fileID, userID uuid.UUID) (*models.FileMetadata, io.ReadSeekCloser, error) {
+	file, err := s.getFile(fileID, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ctx := context.Background()
+	blob, err := s.blobs.Open(ctx, file.StorageKey)
+	if err == storage.ErrNotFound {
+		return nil, nil, fmt.Errorf("file contents not found")
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read file: %v", err)
+	}
+
+	contents, err := s.cipher.OpenFile(ctx, userID, blob)
+	if err != nil {
+		blob.Close()
+		return nil, nil, fmt.Errorf("failed to decrypt file: %v", err)
+	}
+	return file, struct {
+		io.ReadSeeker
+		io.Closer
+	}{contents, blob}, nil
+}
+
+// DeleteFile removes one of the user's files and the text extracted from it from its note.
+// The blob is kept while other files have the same bytes.
+func (s *FileUploadService) DeleteFile(fileID, userID uuid.UUID) (*models.FileMetadata, error) {
+	file, err := s.getFile(fileID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if file.NoteID != nil && file.ExtractedText != "" {
+		if err := s.removeExtractedText(*file.NoteID, file, userID); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.fileMetadataRepo.Delete(context.Background(), file, s.blobs); err != nil {
+		return nil, fmt.Errorf("failed to delete file: %v", err)
+	}
+	return file, nil
+}
+
+// removeExtractedText takes the block of text extracted from a file out of its note. Blocks the
+// user has since edited are left alone.
+func (s *FileUploadService) removeExtractedText(noteID uuid.UUID, file *models.FileMetadata, userID uuid.UUID) error {
+	note, err := s.noteService.GetNoteByID(noteID, userID)
+	if err != nil {
+		if err.Error() == "note not found" {
+			return nil
+		}
+		return fmt.Errorf("failed to retrieve note: %v", err)
+	}
+	if note.Encrypted {
+		return nil
+	}
+
+	// Note content is sanitized when saved, so the block may have been changed
+	block := extractedTextBlock(file.FileType, file.ExtractedText)
+	for _, candidate := range []string{block, utils.SanitizeMarkdown(block)} {
+		if !strings.Contains(note.Content, candidate) {
+			continue
+		}
+		content := strings.Replace(note.Content, candidate, "", 1)
+		if content == "" {
+			// An empty content leaves an update's content unchanged
+			content = " "
+		}
+		if _, err := s.noteService.UpdateNote(&contracts.UpdateNoteRequest{NoteID: noteID, Content: content}, userID); err != nil {
+			return fmt.Errorf("failed to update note: %v", err)
+		}
+		return nil
+	}
+	return nil
+}
+
+func (s *FileUploadService) getFile(fileID, userID uuid.UUID) (*models.FileMetadata, error) {
+	if fileID == uuid.Nil {
+		return nil, fmt.Errorf("file ID is required")
+	}
+	if userID == uuid.Nil {
+		return nil, fmt.Errorf("user ID is required")
+	}
+	file, err := s.fileMetadataRepo.GetByID(context.Background(), fileID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve file: %v", err)
+	}
+	if file == nil {
+		return nil, fmt.Errorf("file not found")
+	}
+	return file, nil
+}
+
+// extractedTextBlock is what uploading a file appends to its note
+func extractedTextBlock(fileType, text string) string {
+	return "\n\n" + extractionMargins[fileType] + "\n" + text
+}
+
+// FileContentType returns the media type a file is served with
+func FileContentType(file *models.FileMetadata) string {
+	if file.ContentType != "" {
+		return file.ContentType
+	}
+	// Files uploaded before content types were recorded are judged by their name
+	if fileType := LookupFileType(file.FileName); fileType != nil {
+		return fileType.ContentType
+	}
+	if contentType := mime.TypeByExtension(strings.ToLower(filepath.Ext(file.FileName))); contentType != "" {
+		return contentType
 	}
+	return "application/octet-stream"
 }
 
 func (s *FileUploadService) enrichText(text string) (string, error) {
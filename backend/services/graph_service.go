@@ -0,0 +1,361 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"NoteSense/contracts"
+	"NoteSense/models"
+	"NoteSense/repositories"
+
+	"github.com/google/uuid"
+)
+
+// Limits of graph queries
+const (
+	MaxGraphDepth   = 5
+	DefaultHubCount = 10
+	MaxHubCount     = 100
+)
+
+// GraphService answers questions about the graph formed by notes and their connections.
+// Neighborhoods are walked in the database; the other queries load the filtered graph,
+// which holds only note keys and edges, and work on it in memory.
+type GraphService struct {
+	ConnectionRepo *repositories.ConnectionRepository
+	NoteService    *NoteService
+}
+
+// NewGraphService creates a new GraphService
+func NewGraphService(connectionRepo *repositories.ConnectionRepository, noteService *NoteService) *GraphService {
+	return &GraphService{
+		ConnectionRepo: connectionRepo,
+		NoteService:    noteService,
+	}
+}
+
+// Neighborhood returns the notes within depth hops of a note and the connections among them
+func (s *GraphService) Neighborhood(noteID uuid.UUID, depth int, direction string, filter repositories.GraphFilter, userID uuid.UUID) (*contracts.GraphResponse, error) {
+	if depth < 1 || depth > MaxGraphDepth {
+		return nil, fmt.Errorf("depth must be between 1 and %d", MaxGraphDepth)
+	}
+	if err := validateWalkDirection(direction); err != nil {
+		return nil, err
+	}
+	if _, err := s.NoteService.GetNoteByID(noteID, userID); err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	depths, err := s.ConnectionRepo.Neighborhood(ctx, noteID, depth, direction, filter, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to walk connections: %v", err)
+	}
+	ids := make([]uuid.UUID, 0, len(depths))
+	for id := range depths {
+		ids = append(ids, id)
+	}
+
+	// The walk already applied the filter; only the edge types still narrow the subgraph
+	subgraph := repositories.GraphFilter{Types: filter.Types}
+	notes, err := s.ConnectionRepo.GraphNotes(ctx, ids, subgraph, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve notes: %v", err)
+	}
+	edges, err := s.ConnectionRepo.GraphEdges(ctx, ids, subgraph, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve connections: %v", err)
+	}
+
+	graph := newNoteGraph(notes, edges)
+	response := &contracts.GraphResponse{Nodes: make([]contracts.GraphNode, 0, len(notes)), Edges: graph.graphEdges(nil)}
+	for _, id := range graph.order {
+		d := depths[id]
+		node := graph.graphNode(id)
+		node.Depth = &d
+		response.Nodes = append(response.Nodes, node)
+	}
+	sort.SliceStable(response.Nodes, func(i, j int) bool { return *response.Nodes[i].Depth < *response.Nodes[j].Depth })
+	return response, nil
+}
+
+// ShortestPath returns a path with the fewest hops between two notes of the filtered graph
+func (s *GraphService) ShortestPath(fromID, toID uuid.UUID, direction string, filter repositories.GraphFilter, userID uuid.UUID) (*contracts.GraphPathResponse, error) {
+	if err := validateWalkDirection(direction); err != nil {
+		return nil, err
+	}
+	for _, id := range []uuid.UUID{fromID, toID} {
+		if _, err := s.NoteService.GetNoteByID(id, userID); err != nil {
+			return nil, err
+		}
+	}
+
+	graph, err := s.loadGraph(filter, userID)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := graph.notes[fromID]; !ok {
+		return nil, fmt.Errorf("no path between notes")
+	}
+	if _, ok := graph.notes[toID]; !ok {
+		return nil, fmt.Errorf("no path between notes")
+	}
+
+	// Breadth-first search, remembering the edge each note was reached by
+	reachedBy := map[uuid.UUID]int{fromID: -1}
+	queue := []uuid.UUID{fromID}
+	for len(queue) > 0 && !containsKey(reachedBy, toID) {
+		current := queue[0]
+		queue = queue[1:]
+		for _, step := range graph.steps(current, direction) {
+			if _, seen := reachedBy[step.to]; seen {
+				continue
+			}
+			reachedBy[step.to] = step.edge
+			queue = append(queue, step.to)
+		}
+	}
+	if !containsKey(reachedBy, toID) {
+		return nil, fmt.Errorf("no path between notes")
+	}
+
+	var path []uuid.UUID
+	var edgeIndexes []int
+	for id := toID; ; {
+		path = append([]uuid.UUID{id}, path...)
+		edge := reachedBy[id]
+		if edge < 0 {
+			break
+		}
+		edgeIndexes = append([]int{edge}, edgeIndexes...)
+		id = graph.edges[edge].OtherEnd(id)
+	}
+
+	response := &contracts.GraphPathResponse{
+		From:   fromID,
+		To:     toID,
+		Length: len(edgeIndexes),
+		Nodes:  make([]contracts.GraphNode, 0, len(path)),
+		Edges:  graph.graphEdges(edgeIndexes),
+	}
+	for _, id := range path {
+		response.Nodes = append(response.Nodes, graph.graphNode(id))
+	}
+	return response, nil
+}
+
+// Clusters returns the groups of notes connected to each other, ignoring direction, largest first.
+// Groups smaller than minSize are left out.
+func (s *GraphService) Clusters(filter repositories.GraphFilter, minSize int, userID uuid.UUID) (*contracts.GraphClustersResponse, error) {
+	if minSize < 1 {
+		return nil, fmt.Errorf("minimum cluster size must be at least 1")
+	}
+	graph, err := s.loadGraph(filter, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &contracts.GraphClustersResponse{Clusters: []contracts.GraphCluster{}}
+	visited := make(map[uuid.UUID]bool, len(graph.order))
+	for _, start := range graph.order {
+		if visited[start] {
+			continue
+		}
+		visited[start] = true
+		members := []uuid.UUID{start}
+		edgeSet := make(map[int]bool)
+		for i := 0; i < len(members); i++ {
+			for _, step := range graph.steps(members[i], repositories.WalkBoth) {
+				edgeSet[step.edge] = true
+				if !visited[step.to] {
+					visited[step.to] = true
+					members = append(members, step.to)
+				}
+			}
+		}
+		if len(members) < minSize {
+			continue
+		}
+
+		edgeIndexes := make([]int, 0, len(edgeSet))
+		for edge := range edgeSet {
+			edgeIndexes = append(edgeIndexes, edge)
+		}
+		sort.Ints(edgeIndexes)
+		cluster := contracts.GraphCluster{Size: len(members), Nodes: make([]contracts.GraphNode, 0, len(members)), Edges: graph.graphEdges(edgeIndexes)}
+		for _, id := range members {
+			cluster.Nodes = append(cluster.Nodes, graph.graphNode(id))
+		}
+		response.Clusters = append(response.Clusters, cluster)
+	}
+	sort.SliceStable(response.Clusters, func(i, j int) bool { return response.Clusters[i].Size > response.Clusters[j].Size })
+	return response, nil
+}
+
+// Orphans returns the notes of the filtered graph that have no connections
+func (s *GraphService) Orphans(filter repositories.GraphFilter, userID uuid.UUID) (*contracts.GraphNodesResponse, error) {
+	graph, err := s.loadGraph(filter, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &contracts.GraphNodesResponse{Nodes: []contracts.GraphNode{}}
+	for _, id := range graph.order {
+		if len(graph.incident[id]) == 0 {
+			response.Nodes = append(response.Nodes, graph.graphNode(id))
+		}
+	}
+	return response, nil
+}
+
+// Hubs returns the most connected notes of the filtered graph
+func (s *GraphService) Hubs(filter repositories.GraphFilter, limit int, userID uuid.UUID) (*contracts.GraphNodesResponse, error) {
+	if limit < 1 || limit > MaxHubCount {
+		return nil, fmt.Errorf("limit must be between 1 and %d", MaxHubCount)
+	}
+	graph, err := s.loadGraph(filter, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := []contracts.GraphNode{}
+	for _, id := range graph.order {
+		if len(graph.incident[id]) > 0 {
+			nodes = append(nodes, graph.graphNode(id))
+		}
+	}
+	sort.SliceStable(nodes, func(i, j int) bool { return nodes[i].Degree > nodes[j].Degree })
+	if len(nodes) > limit {
+		nodes = nodes[:limit]
+	}
+	return &contracts.GraphNodesResponse{Nodes: nodes}, nil
+}
+
+// loadGraph loads the user's filtered graph
+func (s *GraphService) loadGraph(filter repositories.GraphFilter, userID uuid.UUID) (*noteGraph, error) {
+	if userID == uuid.Nil {
+		return nil, fmt.Errorf("user ID is required")
+	}
+	ctx := context.Background()
+	notes, err := s.ConnectionRepo.GraphNotes(ctx, nil, filter, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve notes: %v", err)
+	}
+	edges, err := s.ConnectionRepo.GraphEdges(ctx, nil, filter, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve connections: %v", err)
+	}
+	return newNoteGraph(notes, edges), nil
+}
+
+// validateWalkDirection checks the direction a walk follows connections in
+func validateWalkDirection(direction string) error {
+	switch direction {
+	case repositories.WalkBoth, repositories.WalkOutgoing, repositories.WalkIncoming:
+		return nil
+	}
+	return fmt.Errorf("invalid direction: %s", direction)
+}
+
+func containsKey(m map[uuid.UUID]int, key uuid.UUID) bool {
+	_, ok := m[key]
+	return ok
+}
+
+// noteGraph is an in-memory graph of notes, in creation order, and the edges between them
+type noteGraph struct {
+	order    []uuid.UUID
+	notes    map[uuid.UUID]*models.Note
+	edges    []models.NoteConnection
+	incident map[uuid.UUID][]int // Indexes of the edges touching each note
+}
+
+// graphStep is one hop along an edge
+type graphStep struct {
+	to   uuid.UUID
+	edge int
+}
+
+func newNoteGraph(notes []models.Note, edges []models.NoteConnection) *noteGraph {
+	graph := &noteGraph{
+		order:    make([]uuid.UUID, 0, len(notes)),
+		notes:    make(map[uuid.UUID]*models.Note, len(notes)),
+		edges:    edges,
+		incident: make(map[uuid.UUID][]int, len(notes)),
+	}
+	for i := range notes {
+		graph.order = append(graph.order, notes[i].ID)
+		graph.notes[notes[i].ID] = &notes[i]
+	}
+	for i, edge := range edges {
+		graph.incident[edge.SourceID] = append(graph.incident[edge.SourceID], i)
+		graph.incident[edge.TargetID] = append(graph.incident[edge.TargetID], i)
+	}
+	return graph
+}
+
+// steps returns the hops that can be taken from a note in the given direction
+func (g *noteGraph) steps(id uuid.UUID, direction string) []graphStep {
+	var steps []graphStep
+	for _, i := range g.incident[id] {
+		edge := &g.edges[i]
+		outgoing := edge.SourceID == id
+		if edge.Directed && ((direction == repositories.WalkOutgoing && !outgoing) || (direction == repositories.WalkIncoming && outgoing)) {
+			continue
+		}
+		steps = append(steps, graphStep{to: edge.OtherEnd(id), edge: i})
+	}
+	return steps
+}
+
+// graphNode describes a note with its degrees within the graph
+func (g *noteGraph) graphNode(id uuid.UUID) contracts.GraphNode {
+	node := contracts.GraphNode{ID: id, Categories: []string{}}
+	if note, ok := g.notes[id]; ok {
+		node.Title = note.Title
+		node.Emoji = note.Emoji
+		node.Status = note.Status
+		if note.Categories != nil {
+			node.Categories = note.Categories
+		}
+	}
+	for _, i := range g.incident[id] {
+		edge := &g.edges[i]
+		switch {
+		case !edge.Directed:
+			node.InDegree++
+			node.OutDegree++
+		case edge.SourceID == id:
+			node.OutDegree++
+		default:
+			node.InDegree++
+		}
+	}
+	node.Degree = len(g.incident[id])
+	return node
+}
+
+// graphEdges describes the edges at the given indexes, or every edge when indexes is nil
+func (g *noteGraph) graphEdges(indexes []int) []contracts.GraphEdge {
+	if indexes == nil {
+		indexes = make([]int, len(g.edges))
+		for i := range g.edges {
+			indexes[i] = i
+		}
+	}
+	edges := make([]contracts.GraphEdge, 0, len(indexes))
+	for _, i := range indexes {
+		edge := &g.edges[i]
+		edges = append(edges, contracts.GraphEdge{
+			ID:       edge.ID,
+			Source:   edge.SourceID,
+			Target:   edge.TargetID,
+			Type:     string(edge.Type),
+			Directed: edge.Directed,
+			Label:    edge.Label,
+			Weight:   edge.Weight,
+		})
+	}
+	return edges
+}
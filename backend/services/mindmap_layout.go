@@ -0,0 +1,268 @@
+package services
+
+import (
+	"fmt"
+	"math"
+
+	"NoteSense/contracts"
+
+	"github.com/google/uuid"
+)
+
+// Mind map layouts the server can compute coordinates with
+const (
+	LayoutForce        = "force"        // Connected notes pull together, all notes push apart
+	LayoutHierarchical = "hierarchical" // Notes in rows following the direction of connections
+)
+
+const (
+	layoutSpacing  = 160.0 // Preferred distance between neighbouring nodes
+	levelSpacing   = 140.0 // Distance between the rows of a hierarchical layout
+	goldenAngle    = 2.399963229728653
+	forceSteps     = 300
+	maxForcePairs  = 20000000 // Caps the work of a force layout on large maps
+	minForceSteps  = 20
+	minForceLength = 0.01
+	centerGravity  = 0.05
+)
+
+// validateLayout checks a requested mind map layout; an empty layout computes no coordinates
+func validateLayout(layout string) error {
+	switch layout {
+	case "", LayoutForce, LayoutHierarchical:
+		return nil
+	}
+	return fmt.Errorf("invalid layout: %s", layout)
+}
+
+// layoutMindmap sets the coordinates of the nodes the user has not placed by hand
+func layoutMindmap(nodes []contracts.MindmapNode, edges []contracts.GraphEdge, layout string) {
+	if len(nodes) == 0 {
+		return
+	}
+	switch layout {
+	case LayoutForce:
+		forceLayout(nodes, edges)
+	case LayoutHierarchical:
+		hierarchicalLayout(nodes, edges)
+	}
+}
+
+// layoutEdge is an edge between two node indexes
+type layoutEdge struct {
+	from, to int
+	directed bool
+	weight   float64
+}
+
+func layoutEdges(nodes []contracts.MindmapNode, edges []contracts.GraphEdge) []layoutEdge {
+	index := make(map[uuid.UUID]int, len(nodes))
+	for i, node := range nodes {
+		index[node.ID] = i
+	}
+	result := make([]layoutEdge, 0, len(edges))
+	for _, edge := range edges {
+		from, ok := index[edge.Source]
+		to, ok2 := index[edge.Target]
+		if !ok || !ok2 || from == to {
+			continue
+		}
+		weight := edge.Weight
+		if weight <= 0 {
+			weight = 1
+		}
+		result = append(result, layoutEdge{from: from, to: to, directed: edge.Directed, weight: weight})
+	}
+	return result
+}
+
+// forceLayout places nodes with the Fruchterman-Reingold algorithm. Nodes start on a spiral so the
+// result is the same for the same map, and pinned nodes stay put while the others settle around them.
+func forceLayout(nodes []contracts.MindmapNode, edges []contracts.GraphEdge) {
+	n := len(nodes)
+	x := make([]float64, n)
+	y := make([]float64, n)
+	for i, node := range nodes {
+		if node.Pinned {
+			x[i], y[i] = *node.X, *node.Y
+			continue
+		}
+		radius := layoutSpacing * math.Sqrt(float64(i)+0.5)
+		x[i] = radius * math.Cos(float64(i)*goldenAngle)
+		y[i] = radius * math.Sin(float64(i)*goldenAngle)
+	}
+
+	steps := forceSteps
+	if n*n*steps > maxForcePairs {
+		steps = maxForcePairs / (n * n)
+		if steps < minForceSteps {
+			steps = minForceSteps
+		}
+	}
+	links := layoutEdges(nodes, edges)
+	k := layoutSpacing
+	temperature := k * math.Sqrt(float64(n))
+	cooling := temperature / float64(steps)
+	dx := make([]float64, n)
+	dy := make([]float64, n)
+
+	for step := 0; step < steps; step++ {
+		for i := range dx {
+			dx[i], dy[i] = 0, 0
+		}
+		// Every pair of nodes repels
+		for i := 0; i < n; i++ {
+			for j := i + 1; j < n; j++ {
+				ux, uy := x[i]-x[j], y[i]-y[j]
+				d := math.Max(math.Hypot(ux, uy), minForceLength)
+				f := k * k / d
+				dx[i] += ux / d * f
+				dy[i] += uy / d * f
+				dx[j] -= ux / d * f
+				dy[j] -= uy / d * f
+			}
+		}
+		// Everything is pulled gently to the center so unconnected groups stay in view
+		for i := 0; i < n; i++ {
+			d := math.Hypot(x[i], y[i])
+			dx[i] -= x[i] * d / k * centerGravity
+			dy[i] -= y[i] * d / k * centerGravity
+		}
+		// Connected nodes attract, heavier connections more strongly
+		for _, link := range links {
+			ux, uy := x[link.from]-x[link.to], y[link.from]-y[link.to]
+			d := math.Max(math.Hypot(ux, uy), minForceLength)
+			f := d * d / k * link.weight
+			dx[link.from] -= ux / d * f
+			dy[link.from] -= uy / d * f
+			dx[link.to] += ux / d * f
+			dy[link.to] += uy / d * f
+		}
+		for i := 0; i < n; i++ {
+			if nodes[i].Pinned {
+				continue
+			}
+			length := math.Hypot(dx[i], dy[i])
+			if length == 0 {
+				continue
+			}
+			move := math.Min(length, temperature)
+			x[i] += dx[i] / length * move
+			y[i] += dy[i] / length * move
+		}
+		temperature -= cooling
+	}
+
+	for i := range nodes {
+		if !nodes[i].Pinned {
+			nodes[i].X, nodes[i].Y = roundedCoordinate(x[i]), roundedCoordinate(y[i])
+		}
+	}
+}
+
+// hierarchicalLayout places each group of connected notes in rows: notes nothing points to form the
+// top row and every note sits one row below the nearest note leading to it. Undirected connections
+// lead both ways. Groups are placed side by side.
+func hierarchicalLayout(nodes []contracts.MindmapNode, edges []contracts.GraphEdge) {
+	n := len(nodes)
+	links := layoutEdges(nodes, edges)
+	neighbours := make([][]int, n) // Both ways, for finding groups
+	children := make([][]int, n)   // Along the direction of connections
+	incoming := make([]int, n)
+	outgoing := make([]int, n)
+	for _, link := range links {
+		neighbours[link.from] = append(neighbours[link.from], link.to)
+		neighbours[link.to] = append(neighbours[link.to], link.from)
+		children[link.from] = append(children[link.from], link.to)
+		if link.directed {
+			incoming[link.to]++
+			outgoing[link.from]++
+		} else {
+			children[link.to] = append(children[link.to], link.from)
+		}
+	}
+
+	grouped := make([]bool, n)
+	level := make([]int, n)
+	offset := 0.0
+	for start := 0; start < n; start++ {
+		if grouped[start] {
+			continue
+		}
+		// Collect the group in discovery order
+		group := []int{start}
+		grouped[start] = true
+		for i := 0; i < len(group); i++ {
+			for _, next := range neighbours[group[i]] {
+				if !grouped[next] {
+					grouped[next] = true
+					group = append(group, next)
+				}
+			}
+		}
+
+		// Walk down from the notes that only point at others, or from the first note of a group without
+		// directed connections; notes the walk cannot reach start a new walk
+		for _, i := range group {
+			level[i] = -1
+		}
+		var queue []int
+		walk := func() {
+			for len(queue) > 0 {
+				current := queue[0]
+				queue = queue[1:]
+				for _, next := range children[current] {
+					if level[next] < 0 {
+						level[next] = level[current] + 1
+						queue = append(queue, next)
+					}
+				}
+			}
+		}
+		for _, i := range group {
+			if incoming[i] == 0 && outgoing[i] > 0 {
+				level[i] = 0
+				queue = append(queue, i)
+			}
+		}
+		walk()
+		for _, seed := range group {
+			if level[seed] < 0 {
+				level[seed] = 0
+				queue = append(queue, seed)
+				walk()
+			}
+		}
+
+		var rows [][]int
+		for _, i := range group {
+			for len(rows) <= level[i] {
+				rows = append(rows, nil)
+			}
+			rows[level[i]] = append(rows[level[i]], i)
+		}
+		width := 0
+		for _, row := range rows {
+			if len(row) > width {
+				width = len(row)
+			}
+		}
+		for depth, row := range rows {
+			// Center each row under the widest one
+			indent := float64(width-len(row)) * layoutSpacing / 2
+			for column, i := range row {
+				if !nodes[i].Pinned {
+					nodes[i].X = roundedCoordinate(offset + indent + float64(column)*layoutSpacing)
+					nodes[i].Y = roundedCoordinate(float64(depth) * levelSpacing)
+				}
+			}
+		}
+		offset += float64(width+1) * layoutSpacing
+	}
+}
+
+// roundedCoordinate rounds a coordinate to a tenth of a unit to keep payloads small
+func roundedCoordinate(value float64) *float64 {
+	rounded := math.Round(value*10) / 10
+	return &rounded
+}
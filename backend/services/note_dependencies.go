@@ -0,0 +1,208 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"NoteSense/contracts"
+	"NoteSense/models"
+
+	"github.com/google/uuid"
+)
+
+// Kanban card orders computed from note dependencies
+const KanbanOrderCriticalPath = "critical_path"
+
+// Directions of a dependency tree
+const (
+	DependencyTreeDependencies = "dependencies" // What the note waits for
+	DependencyTreeDependents   = "dependents"   // What waits for the note
+)
+
+// DependencyBlockedError refuses a Kanban move while notes the moved note depends on are unfinished
+type DependencyBlockedError struct {
+	Blockers []contracts.DependencyNote
+}
+
+func (e *DependencyBlockedError) Error() string {
+	return fmt.Sprintf("note is blocked by %d unfinished dependencies", len(e.Blockers))
+}
+
+// dependencyBlockers returns the unfinished notes a note depends on when moving it between two
+// columns would start or finish it
+func (s *NoteService) dependencyBlockers(note *models.Note, from, to *models.BoardColumn, flow *workflow, userID uuid.UUID) ([]contracts.DependencyNote, error) {
+	if to.State != models.StateInProgress && to.State != models.StateDone {
+		return nil, nil
+	}
+	if to.State == from.State {
+		return nil, nil
+	}
+
+	notes, err := s.ConnectionRepo.UnfinishedDependencies(context.Background(), note.ID, flow.statusesIn(models.StateDone), userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check dependencies: %v", err)
+	}
+	blockers := make([]contracts.DependencyNote, 0, len(notes))
+	for _, dependency := range notes {
+		blockers = append(blockers, dependencyNote(&dependency))
+	}
+	return blockers, nil
+}
+
+// GetDependencyTree returns the notes a note depends on, or the notes depending on it, as a tree
+func (s *NoteService) GetDependencyTree(noteID uuid.UUID, direction string, userID uuid.UUID) (*contracts.DependencyTreeResponse, error) {
+	if direction != DependencyTreeDependencies && direction != DependencyTreeDependents {
+		return nil, fmt.Errorf("invalid direction: %s", direction)
+	}
+	root, err := s.GetNoteByID(noteID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	flow, err := s.loadWorkflow(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	edges, err := s.ConnectionRepo.DependencyEdges(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve dependencies: %v", err)
+	}
+	ids := []uuid.UUID{noteID}
+	seen := map[uuid.UUID]bool{noteID: true}
+	dependencies := make(map[uuid.UUID][]uuid.UUID)
+	dependents := make(map[uuid.UUID][]uuid.UUID)
+	for _, edge := range edges {
+		dependencies[edge.SourceID] = append(dependencies[edge.SourceID], edge.TargetID)
+		dependents[edge.TargetID] = append(dependents[edge.TargetID], edge.SourceID)
+		for _, id := range []uuid.UUID{edge.SourceID, edge.TargetID} {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+	notes, err := s.ConnectionRepo.NoteSummaries(ctx, ids, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve notes: %v", err)
+	}
+	byID := make(map[uuid.UUID]*models.Note, len(notes)+1)
+	for i := range notes {
+		byID[notes[i].ID] = &notes[i]
+	}
+	byID[noteID] = root
+
+	children := dependencies
+	if direction == DependencyTreeDependents {
+		children = dependents
+	}
+	expanded := make(map[uuid.UUID]bool)
+	var build func(id uuid.UUID) contracts.DependencyTreeNode
+	build = func(id uuid.UUID) contracts.DependencyTreeNode {
+		note := byID[id]
+		node := contracts.DependencyTreeNode{
+			DependencyNote: dependencyNote(note),
+			Done:           flow.stateOf(note.Status) == models.StateDone,
+			Children:       []contracts.DependencyTreeNode{},
+		}
+		for _, dependency := range dependencies[id] {
+			if note := byID[dependency]; note != nil && flow.stateOf(note.Status) != models.StateDone {
+				node.Blocked = true
+			}
+		}
+		if expanded[id] {
+			node.Repeated = true
+			return node
+		}
+		expanded[id] = true
+		for _, child := range children[id] {
+			node.Children = append(node.Children, build(child))
+		}
+		return node
+	}
+
+	return &contracts.DependencyTreeResponse{Direction: direction, Root: build(noteID)}, nil
+}
+
+// orderByCriticalPath puts the unfinished cards that the longest chains of unfinished work wait on
+// first in their columns, and reports the longest chain and what each unfinished card waits for
+func (s *NoteService) orderByCriticalPath(board *contracts.KanbanNotesResponse, userID uuid.UUID) error {
+	edges, err := s.ConnectionRepo.DependencyEdges(context.Background(), userID)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve dependencies: %v", err)
+	}
+
+	var columns [][]models.Note
+	for _, column := range board.Columns {
+		if column.State != models.StateDone {
+			columns = append(columns, column.Notes)
+		}
+	}
+	var order []uuid.UUID
+	unfinished := make(map[uuid.UUID]bool)
+	for _, column := range columns {
+		for _, note := range column {
+			order = append(order, note.ID)
+			unfinished[note.ID] = true
+		}
+	}
+
+	// Only dependencies between unfinished cards still hold work up
+	dependents := make(map[uuid.UUID][]uuid.UUID)
+	board.BlockedBy = make(map[uuid.UUID][]uuid.UUID)
+	for _, edge := range edges {
+		if unfinished[edge.SourceID] && unfinished[edge.TargetID] {
+			dependents[edge.TargetID] = append(dependents[edge.TargetID], edge.SourceID)
+			board.BlockedBy[edge.SourceID] = append(board.BlockedBy[edge.SourceID], edge.TargetID)
+		}
+	}
+
+	// chain is the length of the longest run of unfinished notes starting at a note and
+	// following its dependents. Cycles left over from before cycle checks are cut short.
+	chain := make(map[uuid.UUID]int, len(order))
+	next := make(map[uuid.UUID]uuid.UUID, len(order))
+	visiting := make(map[uuid.UUID]bool)
+	var measure func(id uuid.UUID) int
+	measure = func(id uuid.UUID) int {
+		if length, ok := chain[id]; ok {
+			return length
+		}
+		if visiting[id] {
+			return 0
+		}
+		visiting[id] = true
+		length := 1
+		for _, dependent := range dependents[id] {
+			if candidate := measure(dependent) + 1; candidate > length {
+				length = candidate
+				next[id] = dependent
+			}
+		}
+		visiting[id] = false
+		chain[id] = length
+		return length
+	}
+
+	var start uuid.UUID
+	for _, id := range order {
+		if measure(id) > chain[start] {
+			start = id
+		}
+	}
+	if chain[start] > 1 {
+		for id, ok := start, true; ok; id, ok = next[id] {
+			board.CriticalPath = append(board.CriticalPath, id)
+		}
+	}
+
+	for _, column := range columns {
+		sort.SliceStable(column, func(i, j int) bool { return chain[column[i].ID] > chain[column[j].ID] })
+	}
+	return nil
+}
+
+func dependencyNote(note *models.Note) contracts.DependencyNote {
+	return contracts.DependencyNote{ID: note.ID, Title: note.Title, Emoji: note.Emoji, Status: note.Status}
+}
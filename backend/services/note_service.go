@@ -3,26 +3,111 @@ package services
 import (
 	"context"
 	"fmt"
+	"html"
+	"sort"
+	"strings"
+	"time"
 
 	"NoteSense/contracts"
 	"NoteSense/models"
 	"NoteSense/repositories"
+	"NoteSense/storage"
+	"NoteSense/utils"
 
 	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Search modes: keyword matching, meaning-based matching, or both fused together
+const (
+	SearchModeKeyword  = "keyword"
+	SearchModeSemantic = "semantic"
+	SearchModeHybrid   = "hybrid"
+)
+
+// DefaultNotePageSize is the page size of note listings and searches when none is given
+const DefaultNotePageSize = 50
+
+const (
+	semanticCandidates = 100 // Nearest notes considered before filters apply
+	minSemanticScore   = 0.2 // Cosine similarity below which notes are unrelated
 )
 
 // NoteService handles note-related operations
 type NoteService struct {
-	NoteRepo *repositories.NoteRepository
+	NoteRepo       *repositories.NoteRepository
+	ConnectionRepo *repositories.ConnectionRepository  // Dependencies between notes gate Kanban moves
+	BoardRepo      *repositories.BoardRepository       // Boards define the statuses notes move through
+	EventRepo      *repositories.StatusEventRepository // Moves between statuses are recorded
+	Embeddings     *EmbeddingService                   // Optional; nil disables semantic search
+	Blobs          storage.BlobStore                   // Files attached to a note are deleted with it
 }
 
 // NewNoteService creates a new NoteService
-func NewNoteService(repo *repositories.NoteRepository) *NoteService {
-	return &NoteService{NoteRepo: repo}
+func NewNoteService(repo *repositories.NoteRepository, connectionRepo *repositories.ConnectionRepository, boardRepo *repositories.BoardRepository, eventRepo *repositories.StatusEventRepository, embeddings *EmbeddingService, blobs storage.BlobStore) *NoteService {
+	return &NoteService{NoteRepo: repo, ConnectionRepo: connectionRepo, BoardRepo: boardRepo, EventRepo: eventRepo, Embeddings: embeddings, Blobs: blobs}
 }
 
 // CreateNote creates a new note
 func (s *NoteService) CreateNote(title, content string, categories []string, userID uuid.UUID) (*models.Note, error) {
+	note, err := newNote(title, content, categories, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create note in repository
+	if err := s.NoteRepo.Create(context.Background(), note); err != nil {
+		return nil, err
+	}
+	s.Embeddings.Enqueue(note.ID, userID)
+
+	return note, nil
+}
+
+// CreateNoteInStatus creates a note and moves it to a status of the user's default board in
+// one transaction. The move is checked like any other before the note is stored, so a note that
+// may not go there is never created.
+func (s *NoteService) CreateNoteInStatus(title, content string, categories []string, status string, userID uuid.UUID) (*models.Note, error) {
+	note, err := newNote(title, content, categories, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var created *models.Note
+	err = s.inTransaction(func(tx *NoteService) error {
+		if err := tx.NoteRepo.LockKanban(context.Background(), userID); err != nil {
+			return fmt.Errorf("failed to lock Kanban board: %v", err)
+		}
+		board, err := tx.kanbanBoard(userID)
+		if err != nil {
+			return err
+		}
+		req := &contracts.KanbanUpdateRequest{Status: &status}
+		move, err := tx.planMove(board, nil, note, req, userID)
+		if err != nil {
+			return err
+		}
+
+		if err := tx.NoteRepo.Create(context.Background(), note); err != nil {
+			return fmt.Errorf("failed to create note: %v", err)
+		}
+		moved, err := tx.applyMove(board, nil, note, move, req, userID)
+		if err != nil {
+			return err
+		}
+		created = &moved.Note
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.Embeddings.Enqueue(created.ID, userID)
+
+	return created, nil
+}
+
+// newNote validates and builds a new note in the backlog
+func newNote(title, content string, categories []string, userID uuid.UUID) (*models.Note, error) {
 	// Validate input
 	if title == "" {
 		return nil, fmt.Errorf("title is required")
@@ -31,17 +116,43 @@ func (s *NoteService) CreateNote(title, content string, categories []string, use
 		return nil, fmt.Errorf("user ID is required")
 	}
 
-	// Create note model
-	note := &models.Note{
+	return &models.Note{
 		ID:         uuid.New(),
 		Title:      title,
-		Content:    content,
+		Content:    utils.SanitizeMarkdown(content),
 		Categories: categories,
 		UserID:     userID,
-		Status:     "BACKLOG", // Default status
+		Status:     models.StateBacklog, // Default status
+	}, nil
+}
+
+// CreateLockedNote creates a note whose content was encrypted by the client.
+// The ciphertext and key envelope are stored as-is and never inspected.
+func (s *NoteService) CreateLockedNote(title, ciphertext string, envelope *models.KeyEnvelope, categories []string, userID uuid.UUID) (*models.Note, error) {
+	if title == "" {
+		return nil, fmt.Errorf("title is required")
+	}
+	if userID == uuid.Nil {
+		return nil, fmt.Errorf("user ID is required")
+	}
+	if err := models.ValidateCiphertext(ciphertext); err != nil {
+		return nil, err
+	}
+	if err := envelope.Validate(); err != nil {
+		return nil, err
+	}
+
+	note := &models.Note{
+		ID:          uuid.New(),
+		Title:       title,
+		Content:     ciphertext,
+		Categories:  categories,
+		UserID:      userID,
+		Status:      models.StateBacklog, // Default status
+		Encrypted:   true,
+		KeyEnvelope: envelope,
 	}
 
-	// Create note in repository
 	if err := s.NoteRepo.Create(context.Background(), note); err != nil {
 		return nil, err
 	}
@@ -49,6 +160,52 @@ func (s *NoteService) CreateNote(title, content string, categories []string, use
 	return note, nil
 }
 
+// LockNote replaces a note's plaintext content with client-side ciphertext
+func (s *NoteService) LockNote(noteID uuid.UUID, req *contracts.LockNoteRequest, userID uuid.UUID) (*models.Note, error) {
+	note, err := s.GetNoteByID(noteID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if note.Encrypted {
+		return nil, fmt.Errorf("note is already locked")
+	}
+	if err := models.ValidateCiphertext(req.Content); err != nil {
+		return nil, err
+	}
+	if err := req.KeyEnvelope.Validate(); err != nil {
+		return nil, err
+	}
+
+	note.Content = req.Content
+	note.Encrypted = true
+	note.KeyEnvelope = req.KeyEnvelope
+	if err := s.NoteRepo.Update(context.Background(), note); err != nil {
+		return nil, fmt.Errorf("failed to lock note: %v", err)
+	}
+	s.Embeddings.Forget(note.ID, userID)
+	return note, nil
+}
+
+// UnlockNote stores the decrypted content supplied by the client and drops the key envelope
+func (s *NoteService) UnlockNote(noteID uuid.UUID, req *contracts.UnlockNoteRequest, userID uuid.UUID) (*models.Note, error) {
+	note, err := s.GetNoteByID(noteID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !note.Encrypted {
+		return nil, fmt.Errorf("note is not locked")
+	}
+
+	note.Content = utils.SanitizeMarkdown(req.Content)
+	note.Encrypted = false
+	note.KeyEnvelope = nil
+	if err := s.NoteRepo.Update(context.Background(), note); err != nil {
+		return nil, fmt.Errorf("failed to unlock note: %v", err)
+	}
+	s.Embeddings.Enqueue(note.ID, userID)
+	return note, nil
+}
+
 // GetNotesByUserID retrieves notes for a specific user
 func (s *NoteService) GetNotesByUserID(userID string) ([]models.Note, error) {
 	// Validate input
@@ -60,6 +217,66 @@ func (s *NoteService) GetNotesByUserID(userID string) ([]models.Note, error) {
 	return s.NoteRepo.GetByUserID(context.Background(), userID)
 }
 
+// ListNotes retrieves a user's notes with archive/flag filters and the requested sort order.
+// Paged listings also return the cursor of the next page.
+func (s *NoteService) ListNotes(userID uuid.UUID, opts repositories.NoteListOptions) ([]models.Note, string, error) {
+	if userID == uuid.Nil {
+		return nil, "", fmt.Errorf("user ID is required")
+	}
+
+	switch opts.SortBy {
+	case "", repositories.SortPinned, repositories.SortUpdated, repositories.SortCreated,
+		repositories.SortTitle, repositories.SortPriority, repositories.SortManual:
+	default:
+		return nil, "", fmt.Errorf("invalid sort: %s", opts.SortBy)
+	}
+	switch opts.Archived {
+	case "", "exclude", "only", "include":
+	default:
+		return nil, "", fmt.Errorf("invalid archived filter: %s", opts.Archived)
+	}
+	if err := validatePage(opts.Page); err != nil {
+		return nil, "", err
+	}
+
+	notes, next, err := s.NoteRepo.ListNotes(context.Background(), userID, opts)
+	if err != nil {
+		if err == repositories.ErrInvalidCursor {
+			return nil, "", err
+		}
+		return nil, "", fmt.Errorf("failed to retrieve notes: %v", err)
+	}
+	return notes, next, nil
+}
+
+// validatePage checks that a page size is within bounds
+func validatePage(page repositories.PageRequest) error {
+	if page.Limit < 0 || page.Limit > repositories.MaxPageSize {
+		return fmt.Errorf("limit must be between 1 and %d", repositories.MaxPageSize)
+	}
+	return nil
+}
+
+// ReorderNotes persists the manual order of the user's notes
+func (s *NoteService) ReorderNotes(noteIDs []uuid.UUID, userID uuid.UUID) error {
+	if userID == uuid.Nil {
+		return fmt.Errorf("user ID is required")
+	}
+	if len(noteIDs) == 0 {
+		return fmt.Errorf("note IDs are required")
+	}
+
+	seen := make(map[uuid.UUID]bool, len(noteIDs))
+	for _, noteID := range noteIDs {
+		if seen[noteID] {
+			return fmt.Errorf("duplicate note ID: %s", noteID)
+		}
+		seen[noteID] = true
+	}
+
+	return s.NoteRepo.SetPositions(context.Background(), userID, noteIDs)
+}
+
 // UpdateNote updates an existing note
 func (s *NoteService) UpdateNote(req *contracts.UpdateNoteRequest, userID uuid.UUID) (*models.Note, error) {
 	// Validate input
@@ -74,34 +291,65 @@ func (s *NoteService) UpdateNote(req *contracts.UpdateNoteRequest, userID uuid.U
 	if err != nil {
 		return nil, fmt.Errorf("failed to retrieve existing note: %v", err)
 	}
-
-	// Prepare update data with existing values
-	updateData := models.Note{
-		ID:         req.NoteID,
-		UserID:     existingNote.UserID,
-		Title:      existingNote.Title,
-		Content:    existingNote.Content,
-		Categories: existingNote.Categories,
-		Status:     existingNote.Status,
+	if existingNote == nil {
+		return nil, fmt.Errorf("note not found")
 	}
 
+	// Prepare update data with existing values so untouched fields are preserved
+	updateData := *existingNote
+
 	if req.Title != "" {
 		updateData.Title = req.Title
 	}
 
-	if req.Content != "" {
-		updateData.Content = req.Content
+	if existingNote.Encrypted {
+		// Locked notes only accept new ciphertext together with its envelope
+		if req.Content != "" {
+			if err := models.ValidateCiphertext(req.Content); err != nil {
+				return nil, err
+			}
+			if err := req.KeyEnvelope.Validate(); err != nil {
+				return nil, err
+			}
+			updateData.Content = req.Content
+			updateData.KeyEnvelope = req.KeyEnvelope
+		}
+	} else {
+		if req.KeyEnvelope != nil {
+			return nil, fmt.Errorf("note is not locked; use the lock endpoint to encrypt it")
+		}
+		if req.Content != "" {
+			updateData.Content = utils.SanitizeMarkdown(req.Content)
+		}
 	}
 
 	if req.Categories != nil {
 		updateData.Categories = req.Categories
 	}
 
+	if req.Pinned != nil {
+		updateData.Pinned = *req.Pinned
+	}
+	if req.Favorite != nil {
+		updateData.Favorite = *req.Favorite
+	}
+	if req.Archived != nil && *req.Archived != existingNote.Archived {
+		updateData.Archived = *req.Archived
+		updateData.ArchivedAt = nil
+		if *req.Archived {
+			now := time.Now()
+			updateData.ArchivedAt = &now
+		}
+	}
+
 	// Update note in repository
 	err = s.NoteRepo.Update(context.Background(), &updateData)
 	if err != nil {
 		return nil, fmt.Errorf("failed to update note: %v", err)
 	}
+	if !updateData.Encrypted && (updateData.Title != existingNote.Title || updateData.Content != existingNote.Content) {
+		s.Embeddings.Enqueue(updateData.ID, userID)
+	}
 
 	// Retrieve and return the updated note
 	updatedNote, err := s.NoteRepo.GetByID(req.NoteID, userID)
@@ -132,6 +380,41 @@ func (s *NoteService) GetNoteByID(noteID uuid.UUID, userID uuid.UUID) (*models.N
 	return note, nil
 }
 
+// RenderNote renders a note's Markdown content into sanitized HTML with a table of contents
+func (s *NoteService) RenderNote(noteID uuid.UUID, format string, userID uuid.UUID) (*contracts.RenderNoteResponse, error) {
+	if format == "" {
+		format = "html"
+	}
+	if format != "html" {
+		return nil, fmt.Errorf("unsupported render format: %s", format)
+	}
+
+	note, err := s.GetNoteByID(noteID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if note.Encrypted {
+		return nil, fmt.Errorf("locked notes cannot be rendered on the server")
+	}
+
+	rendered := utils.RenderMarkdown(note.Content)
+	toc := make([]contracts.TOCEntry, 0, len(rendered.Headings))
+	for _, heading := range rendered.Headings {
+		toc = append(toc, contracts.TOCEntry{
+			Level:  heading.Level,
+			Text:   heading.Text,
+			Anchor: heading.Anchor,
+		})
+	}
+
+	return &contracts.RenderNoteResponse{
+		NoteID:          note.ID,
+		Format:          format,
+		HTML:            rendered.HTML,
+		TableOfContents: toc,
+	}, nil
+}
+
 // DeleteNote deletes a note by its ID
 func (s *NoteService) DeleteNote(noteID uuid.UUID, userID uuid.UUID) error {
 	// Validate input
@@ -149,45 +432,342 @@ func (s *NoteService) DeleteNote(noteID uuid.UUID, userID uuid.UUID) error {
 		return fmt.Errorf("note not found")
 	}
 
-	// Delete note from repository
-	if err := s.NoteRepo.Delete(noteID, userID); err != nil {
+	// Delete note from repository, with its attached files
+	if err := s.NoteRepo.Delete(noteID, userID, s.Blobs); err != nil {
 		return fmt.Errorf("failed to delete note: %v", err)
 	}
+	s.Embeddings.Forget(noteID, userID)
 
 	return nil
 }
 
-// SearchNotes searches notes based on query and optional categories
-func (s *NoteService) SearchNotes(query string, categories []string, userID uuid.UUID) ([]models.Note, error) {
+// SearchNotes runs a search written in the query language, combined with any structured filters
+func (s *NoteService) SearchNotes(req *contracts.SearchNotesRequest, userID uuid.UUID) (*contracts.SearchNotesResponse, error) {
 	// Validate input
 	if userID == uuid.Nil {
 		return nil, fmt.Errorf("user ID is required")
 	}
 
-	// Perform search in repository
-	return s.NoteRepo.SearchNotes(context.Background(), query, categories, userID)
+	query, err := repositories.ParseSearchQuery(req.Query)
+	if err != nil {
+		return nil, err
+	}
+	if len(req.Categories) > 0 {
+		query.Filters = append(query.Filters, repositories.SearchFilter{Field: repositories.FieldTag, Op: repositories.OpEq, Values: req.Categories})
+	}
+	if req.Filters != nil {
+		query.AddFilters(req.Filters)
+	}
+	if req.Scope != "" {
+		if req.Scope != repositories.ScopeAll && req.Scope != repositories.ScopeBody && req.Scope != repositories.ScopeAttachments {
+			return nil, fmt.Errorf("invalid search scope: %s", req.Scope)
+		}
+		query.Scope = req.Scope
+	}
+
+	opts := repositories.SearchOptions{Fuzzy: req.Fuzzy, Threshold: repositories.DefaultFuzzyThreshold}
+	if req.FuzzyThreshold != nil {
+		if *req.FuzzyThreshold <= 0 || *req.FuzzyThreshold > 1 {
+			return nil, fmt.Errorf("fuzzy threshold must be between 0 and 1")
+		}
+		opts.Threshold = *req.FuzzyThreshold
+	}
+	page := repositories.PageRequest{Limit: req.Limit, Cursor: req.Cursor}
+	if err := validatePage(page); err != nil {
+		return nil, err
+	}
+
+	mode := req.Mode
+	if mode == "" {
+		mode = SearchModeKeyword
+	}
+	if mode != SearchModeKeyword && mode != SearchModeSemantic && mode != SearchModeHybrid {
+		return nil, fmt.Errorf("invalid search mode: %s", mode)
+	}
+	if mode != SearchModeKeyword && s.Embeddings == nil {
+		return nil, fmt.Errorf("semantic search is not available")
+	}
+	// Without free text there is nothing to compare meaning against
+	if len(query.Words()) == 0 {
+		mode = SearchModeKeyword
+	}
+
+	var hits []repositories.SearchHit
+	var next string
+	if mode == SearchModeKeyword {
+		// Keyword results are paged in the database
+		opts.Page = page
+	}
+	if mode != SearchModeSemantic {
+		// Perform search in repository
+		hits, next, err = s.NoteRepo.SearchNotes(context.Background(), query, opts, userID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if mode != SearchModeKeyword {
+		semantic, err := s.semanticHits(query, userID)
+		if err != nil {
+			return nil, err
+		}
+		if mode == SearchModeSemantic {
+			hits = semantic
+		} else {
+			hits = fuseRankings(hits, semantic)
+		}
+		// Semantic and fused rankings only exist in memory, so they are paged here
+		hits, next, err = repositories.PageHits(hits, "search:"+mode, page)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	response := &contracts.SearchNotesResponse{
+		Results:    make([]contracts.SearchResult, 0, len(hits)),
+		NextCursor: next,
+	}
+	for _, hit := range hits {
+		response.Results = append(response.Results, contracts.SearchResult{
+			Note:           hit.Note,
+			Rank:           hit.Rank,
+			TitleHighlight: hit.TitleHighlight,
+			Snippet:        hit.Snippet,
+			Attachments:    attachmentMatches(hit.Attachments),
+		})
+	}
+
+	// Offer a correction for fuzzy searches and for searches that found nothing,
+	// once on the first page
+	if page.Cursor == "" && (opts.Fuzzy || len(hits) == 0) {
+		suggestion, err := s.NoteRepo.SuggestQuery(context.Background(), query, opts.Threshold, userID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to suggest query: %v", err)
+		}
+		response.Suggestion = suggestion
+	}
+	return response, nil
 }
 
-// GetKanbanNotes retrieves notes organized in Kanban columns
-func (s *NoteService) GetKanbanNotes(userID uuid.UUID) (*contracts.KanbanNotesResponse, error) {
+// semanticHits returns the notes closest in meaning to the query's text that also satisfy its filters
+func (s *NoteService) semanticHits(query *repositories.SearchQuery, userID uuid.UUID) ([]repositories.SearchHit, error) {
+	ctx := context.Background()
+	scored, err := s.Embeddings.SimilarToText(ctx, strings.Join(query.Words(), " "), semanticCandidates, minSemanticScore, userID)
+	if err != nil {
+		return nil, fmt.Errorf("semantic search failed: %v", err)
+	}
+	if len(scored) == 0 {
+		return []repositories.SearchHit{}, nil
+	}
+
+	ids := make([]uuid.UUID, len(scored))
+	for i, candidate := range scored {
+		ids[i] = candidate.NoteID
+	}
+	notes, err := s.NoteRepo.FilterNotes(ctx, query, ids, userID)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[uuid.UUID]models.Note, len(notes))
+	for _, note := range notes {
+		byID[note.ID] = note
+	}
+
+	hits := make([]repositories.SearchHit, 0, len(notes))
+	for _, candidate := range scored {
+		if note, ok := byID[candidate.NoteID]; ok {
+			hits = append(hits, repositories.SearchHit{Note: note, Rank: candidate.Score, TitleHighlight: html.EscapeString(note.Title)})
+		}
+	}
+	return hits, nil
+}
+
+// fuseRankings merges keyword and semantic results with reciprocal rank fusion, so neither
+// score scale dominates. Keyword highlights are kept where a note appears in both lists.
+func fuseRankings(keyword, semantic []repositories.SearchHit) []repositories.SearchHit {
+	const k = 60.0
+
+	fused := make(map[uuid.UUID]*repositories.SearchHit)
+	var order []uuid.UUID
+	add := func(hits []repositories.SearchHit) {
+		for rank, hit := range hits {
+			score := 1 / (k + float64(rank+1))
+			if existing, ok := fused[hit.Note.ID]; ok {
+				existing.Rank += score
+				continue
+			}
+			hit.Rank = score
+			fused[hit.Note.ID] = &hit
+			order = append(order, hit.Note.ID)
+		}
+	}
+	add(keyword)
+	add(semantic)
+
+	hits := make([]repositories.SearchHit, 0, len(order))
+	for _, id := range order {
+		hits = append(hits, *fused[id])
+	}
+	sort.SliceStable(hits, func(i, j int) bool { return hits[i].Rank > hits[j].Rank })
+	return hits
+}
+
+// SimilarNotes returns the notes closest in meaning to a note
+func (s *NoteService) SimilarNotes(noteID uuid.UUID, limit int, userID uuid.UUID) (*contracts.SimilarNotesResponse, error) {
+	if s.Embeddings == nil {
+		return nil, fmt.Errorf("semantic search is not available")
+	}
+	note, err := s.GetNoteByID(noteID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &contracts.SimilarNotesResponse{NoteID: note.ID, Results: []contracts.SimilarNote{}}
+	if note.Encrypted {
+		// Locked notes are never embedded
+		return response, nil
+	}
+
+	ctx := context.Background()
+	scored, ready, err := s.Embeddings.SimilarToNote(ctx, note.ID, limit, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find similar notes: %v", err)
+	}
+	response.Pending = !ready
+	if len(scored) == 0 {
+		return response, nil
+	}
+
+	ids := make([]uuid.UUID, len(scored))
+	for i, candidate := range scored {
+		ids[i] = candidate.NoteID
+	}
+	notes, err := s.NoteRepo.FilterNotes(ctx, &repositories.SearchQuery{}, ids, userID)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[uuid.UUID]models.Note, len(notes))
+	for _, similar := range notes {
+		byID[similar.ID] = similar
+	}
+	for _, candidate := range scored {
+		if similar, ok := byID[candidate.NoteID]; ok {
+			response.Results = append(response.Results, contracts.SimilarNote{Note: similar, Score: candidate.Score})
+		}
+	}
+	return response, nil
+}
+
+// resultNotes returns the notes of search results, in their order
+func resultNotes(results *contracts.SearchNotesResponse) []models.Note {
+	notes := make([]models.Note, len(results.Results))
+	for i, result := range results.Results {
+		notes[i] = result.Note
+	}
+	return notes
+}
+
+// attachmentMatches converts repository attachment matches into their response form
+func attachmentMatches(matches []repositories.AttachmentMatch) []contracts.AttachmentMatch {
+	if len(matches) == 0 {
+		return nil
+	}
+	converted := make([]contracts.AttachmentMatch, len(matches))
+	for i, match := range matches {
+		offsets := make([]contracts.TextRange, len(match.Offsets))
+		for j, offset := range match.Offsets {
+			offsets[j] = contracts.TextRange{Start: offset.Start, End: offset.End}
+		}
+		converted[i] = contracts.AttachmentMatch{
+			FileID:   match.FileID,
+			FileName: match.FileName,
+			FileType: match.FileType,
+			Snippet:  match.Snippet,
+			Offsets:  offsets,
+		}
+	}
+	return converted
+}
+
+// GetKanbanNotes retrieves notes laid out on the user's default board. Paged requests return up
+// to Limit notes per column, or the next page of a single column when Column is set.
+func (s *NoteService) GetKanbanNotes(userID uuid.UUID, opts repositories.KanbanPageOptions) (*contracts.KanbanNotesResponse, error) {
 	// Validate input
 	if userID == uuid.Nil {
 		return nil, fmt.Errorf("user ID is required")
 	}
+	if opts.Order != "" && opts.Order != KanbanOrderCriticalPath {
+		return nil, fmt.Errorf("invalid kanban order: %s", opts.Order)
+	}
+	paged := opts.Column != "" || opts.Page.Limit > 0 || opts.Page.Cursor != ""
+	if paged && opts.Order != "" {
+		// Ordering needs the whole board at once
+		return nil, fmt.Errorf("critical path order cannot be paged")
+	}
 
-	// Retrieve Kanban notes from repository
-	kanbanNotes, err := s.NoteRepo.GetKanbanNotes(userID.String())
+	board, err := s.kanbanBoard(userID)
+	if err != nil {
+		return nil, err
+	}
+	flow, err := s.loadWorkflow(userID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to retrieve Kanban notes: %v", err)
+		return nil, err
 	}
 
-	// Convert to KanbanNotesResponse
-	return &contracts.KanbanNotesResponse{
-		Backlog:    kanbanNotes.Backlog,
-		Todo:       kanbanNotes.Todo,
-		InProgress: kanbanNotes.InProgress,
-		Done:       kanbanNotes.Done,
-	}, nil
+	var response *contracts.KanbanNotesResponse
+	if paged {
+		response, err = s.getKanbanPage(board, flow, userID, opts)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		notes, err := s.NoteRepo.GetKanbanNotes(context.Background(), userID, nil, opts.OmitContent)
+		if err != nil {
+			return nil, fmt.Errorf("failed to retrieve Kanban notes: %v", err)
+		}
+		response = groupBoard(board, notes, flow)
+	}
+
+	if opts.Order == KanbanOrderCriticalPath {
+		if err := s.orderByCriticalPath(response, userID); err != nil {
+			return nil, err
+		}
+	}
+	return response, nil
+}
+
+// getKanbanPage loads board columns one page at a time
+func (s *NoteService) getKanbanPage(board *models.Board, flow *workflow, userID uuid.UUID, opts repositories.KanbanPageOptions) (*contracts.KanbanNotesResponse, error) {
+	if err := validatePage(opts.Page); err != nil {
+		return nil, err
+	}
+	response := newBoardResponse(board)
+	if opts.Column != "" {
+		var columns []contracts.KanbanColumnNotes
+		for _, column := range response.Columns {
+			if column.Key == opts.Column {
+				columns = append(columns, column)
+			}
+		}
+		if len(columns) == 0 {
+			return nil, fmt.Errorf("invalid kanban column: %s", opts.Column)
+		}
+		response.Columns = columns
+	} else if opts.Page.Cursor != "" {
+		// Each column is paged separately, so a cursor only makes sense for one of them
+		return nil, fmt.Errorf("cursor requires a kanban column")
+	}
+
+	for i := range response.Columns {
+		column := &response.Columns[i]
+		statuses := flow.columnStatuses(board, &column.BoardColumn)
+		notes, next, err := s.NoteRepo.GetKanbanColumn(context.Background(), userID, column.Key, statuses, opts.Page, opts.OmitContent)
+		if err != nil {
+			return nil, err
+		}
+		column.Notes = notes
+		column.NextCursor = next
+	}
+	return response, nil
 }
 
 // UpdateNoteState updates the state of a note
@@ -204,13 +784,8 @@ func (s *NoteService) UpdateNoteState(noteID uuid.UUID, req *contracts.UpdateNot
 	}
 
 	// Validate state
-	validStates := map[string]bool{
-		"backlog":     true,
-		"todo":        true,
-		"in_progress": true,
-		"done":        true,
-	}
-	if !validStates[req.State] {
+	state := models.CanonicalState(req.State)
+	if state == "" {
 		return fmt.Errorf("invalid state: %s", req.State)
 	}
 
@@ -218,7 +793,7 @@ func (s *NoteService) UpdateNoteState(noteID uuid.UUID, req *contracts.UpdateNot
 	updateData := &models.Note{
 		ID:     noteID,
 		UserID: userID,
-		Status: req.State,
+		Status: state,
 	}
 
 	// Perform update in repository
@@ -230,25 +805,89 @@ func (s *NoteService) UpdateNoteState(noteID uuid.UUID, req *contracts.UpdateNot
 	return nil
 }
 
-// UpdateNoteStateAndPriority updates the state and/or priority of a note
-func (s *NoteService) UpdateNoteStateAndPriority(noteID uuid.UUID, status *string, priority *int, userID uuid.UUID) (*models.Note, error) {
-	// Retrieve existing note
-	existingNote, err := s.NoteRepo.GetByID(noteID, userID)
+// UpdateNoteStateAndPriority updates the state and/or priority of a note.
+// The status is a column key of the user's default board or a canonical state, which lands in the
+// first column in that state. Moves must follow the board's transitions and respect WIP limits.
+// When position is set, the note is placed at that index of its (new) Kanban column.
+// Moving a note into progress or done is refused while notes it depends on are unfinished,
+// unless the request forces it.
+func (s *NoteService) UpdateNoteStateAndPriority(noteID uuid.UUID, req *contracts.KanbanUpdateRequest, userID uuid.UUID) (*contracts.KanbanUpdateResponse, error) {
+	board, err := s.kanbanBoard(userID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to retrieve existing note: %v", err)
+		return nil, err
+	}
+	return s.moveCard(board, nil, noteID, req, userID)
+}
+
+// moveCard moves a note on a board. cards are the notes a stored board shows, in board order;
+// nil means every note, in the order shared by /notes/kanban. The move is checked and made in
+// one transaction, holding the user's Kanban lock.
+func (s *NoteService) moveCard(board *models.Board, cards []models.Note, noteID uuid.UUID, req *contracts.KanbanUpdateRequest, userID uuid.UUID) (*contracts.KanbanUpdateResponse, error) {
+	var response *contracts.KanbanUpdateResponse
+	err := s.inTransaction(func(tx *NoteService) error {
+		if err := tx.NoteRepo.LockKanban(context.Background(), userID); err != nil {
+			return fmt.Errorf("failed to lock Kanban board: %v", err)
+		}
+
+		// Retrieve existing note
+		existingNote, err := tx.NoteRepo.GetByID(noteID, userID)
+		if err != nil {
+			return fmt.Errorf("failed to retrieve existing note: %v", err)
+		}
+		if existingNote == nil {
+			return fmt.Errorf("note not found")
+		}
+
+		move, err := tx.planMove(board, cards, existingNote, req, userID)
+		if err != nil {
+			return err
+		}
+		response, err = tx.applyMove(board, cards, existingNote, move, req, userID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// cardMove is a checked move of a note on a board
+type cardMove struct {
+	flow     *workflow
+	to       *models.BoardColumn
+	response *contracts.KanbanUpdateResponse // Carries the warnings of a forced move
+}
+
+// planMove checks that a note may move as requested: the board must allow the transition, the
+// target column must be under its WIP limit and the notes it depends on must be finished
+func (s *NoteService) planMove(board *models.Board, cards []models.Note, note *models.Note, req *contracts.KanbanUpdateRequest, userID uuid.UUID) (*cardMove, error) {
+	status, priority := req.Status, req.Priority
+
+	flow, err := s.loadWorkflow(userID)
+	if err != nil {
+		return nil, err
 	}
 
 	// Validate state if provided
+	from := flow.columnOf(board, note.Status)
+	to := from
 	if status != nil {
-		validStates := map[string]bool{
-			"backlog":     true,
-			"todo":        true,
-			"in_progress": true,
-			"done":        true,
-		}
-		if !validStates[*status] {
+		to = moveTarget(board, *status)
+		if to == nil {
 			return nil, fmt.Errorf("invalid note state: %s", *status)
 		}
+		if !board.Allows(from.Key, to.Key) {
+			return nil, fmt.Errorf("moving from %s to %s is not allowed", from.Name, to.Name)
+		}
+		if to.Key != from.Key && to.WIPLimit > 0 {
+			count, err := s.columnCount(board, flow, cards, to, userID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to check WIP limit: %v", err)
+			}
+			if count >= int64(to.WIPLimit) {
+				return nil, fmt.Errorf("column %s is at its WIP limit of %d", to.Name, to.WIPLimit)
+			}
+		}
 	}
 
 	// Validate priority if provided
@@ -258,149 +897,96 @@ func (s *NoteService) UpdateNoteStateAndPriority(noteID uuid.UUID, status *strin
 		}
 	}
 
-	// Prepare update data with existing values
-	updateData := models.Note{
-		ID:         noteID,
-		UserID:     existingNote.UserID,
-		Title:      existingNote.Title,
-		Content:    existingNote.Content,
-		Categories: existingNote.Categories,
-		Status:     existingNote.Status,
-		Priority:   existingNote.Priority,
+	// Starting or finishing a note waits for the notes it depends on
+	response := &contracts.KanbanUpdateResponse{}
+	if status != nil {
+		blockers, err := s.dependencyBlockers(note, from, to, flow, userID)
+		if err != nil {
+			return nil, err
+		}
+		if len(blockers) > 0 && !req.Force {
+			return nil, &DependencyBlockedError{Blockers: blockers}
+		}
+		if len(blockers) > 0 {
+			response.BlockedBy = blockers
+			response.Warnings = append(response.Warnings, fmt.Sprintf("moved ahead of %d unfinished dependencies", len(blockers)))
+		}
 	}
+	return &cardMove{flow: flow, to: to, response: response}, nil
+}
+
+// applyMove makes a move planMove checked: it updates the note, records the status change and
+// places the card in its column
+func (s *NoteService) applyMove(board *models.Board, cards []models.Note, existingNote *models.Note, move *cardMove, req *contracts.KanbanUpdateRequest, userID uuid.UUID) (*contracts.KanbanUpdateResponse, error) {
+	noteID, flow, to := existingNote.ID, move.flow, move.to
+
+	// Prepare update data with existing values
+	updateData := *existingNote
 
 	// Update state if provided
-	if status != nil {
-		updateData.Status = *status
+	if req.Status != nil {
+		updateData.Status = to.Key
 	}
 
 	// Update priority if provided
-	if priority != nil {
-		updateData.Priority = *priority
+	if req.Priority != nil {
+		updateData.Priority = *req.Priority
 	}
 
 	// Update note in repository
-	err = s.NoteRepo.Update(context.Background(), &updateData)
+	err := s.NoteRepo.Update(context.Background(), &updateData)
 	if err != nil {
 		return nil, fmt.Errorf("failed to update note: %v", err)
 	}
-
-	// Retrieve and return the updated note
-	updatedNote, err := s.NoteRepo.GetByID(noteID, userID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to retrieve updated note: %v", err)
-	}
-
-	return updatedNote, nil
-}
-
-// ConnectNotes connects two notes
-func (s *NoteService) ConnectNotes(noteID, connectedNoteID uuid.UUID, connectionType string, userID uuid.UUID) error {
-	// Validate input
-	if noteID == uuid.Nil {
-		return fmt.Errorf("note ID is required")
-	}
-	if connectedNoteID == uuid.Nil {
-		return fmt.Errorf("connected note ID is required")
-	}
-	if connectionType == "" {
-		return fmt.Errorf("connection type is required")
-	}
-	if userID == uuid.Nil {
-		return fmt.Errorf("user ID is required")
-	}
-
-	// Prevent self-linking
-	if noteID == connectedNoteID {
-		return fmt.Errorf("cannot link a note to itself")
-	}
-
-	// Fetch the note to ensure it exists and belongs to the user
-	note, err := s.GetNoteByID(noteID, userID)
-	if err != nil {
-		return err
+	if !updateData.Encrypted && (updateData.Title != existingNote.Title || updateData.Content != existingNote.Content) {
+		s.Embeddings.Enqueue(updateData.ID, userID)
 	}
 
-	// Check if already connected
-	for _, existingID := range note.ConnectedNoteIDs {
-		if existingID == connectedNoteID.String() {
-			return fmt.Errorf("notes are already connected")
+	// Record the move for flow analytics
+	if updateData.Status != existingNote.Status {
+		event := &models.StatusEvent{
+			UserID:     userID,
+			NoteID:     noteID,
+			FromStatus: existingNote.Status,
+			FromState:  flow.stateOf(existingNote.Status),
+			ToStatus:   updateData.Status,
+			ToState:    to.State,
+		}
+		if board.ID != uuid.Nil {
+			event.BoardID = &board.ID
+		}
+		if err := s.EventRepo.Create(context.Background(), event); err != nil {
+			return nil, fmt.Errorf("failed to record status change: %v", err)
 		}
 	}
 
-	// Verify the connected note exists and belongs to the user
-	// We don't need to store the note, just verify it exists
-	_, err = s.GetNoteByID(connectedNoteID, userID)
-	if err != nil {
-		return err
-	}
-
-	// Add connection to the note
-	note.ConnectedNoteIDs = append(note.ConnectedNoteIDs, connectedNoteID.String())
-	note.ConnectionTypes = append(note.ConnectionTypes, connectionType)
-
-	// Save the updated note
-	if err := s.NoteRepo.Update(context.Background(), note); err != nil {
-		return fmt.Errorf("failed to update note connections: %v", err)
-	}
-
-	return nil
-}
-
-// UnlinkNotes removes a connection between two notes
-func (s *NoteService) UnlinkNotes(noteID, connectedNoteID uuid.UUID, userID uuid.UUID) error {
-	// Validate input
-	if noteID == uuid.Nil {
-		return fmt.Errorf("note ID is required")
-	}
-	if connectedNoteID == uuid.Nil {
-		return fmt.Errorf("connected note ID is required")
-	}
-	if userID == uuid.Nil {
-		return fmt.Errorf("user ID is required")
-	}
-
-	// Fetch the note to ensure it exists and belongs to the user
-	note, err := s.GetNoteByID(noteID, userID)
-	if err != nil {
-		return err
-	}
-
-	// Find and remove the connection
-	for i, existingIDStr := range note.ConnectedNoteIDs {
-		if existingIDStr == connectedNoteID.String() {
-			// Remove the connection
-			note.ConnectedNoteIDs = append(note.ConnectedNoteIDs[:i], note.ConnectedNoteIDs[i+1:]...)
-			note.ConnectionTypes = append(note.ConnectionTypes[:i], note.ConnectionTypes[i+1:]...)
-
-			// Save the updated note
-			if err := s.NoteRepo.Update(context.Background(), note); err != nil {
-				return fmt.Errorf("failed to update note connections: %v", err)
-			}
-
-			return nil
+	// Persist the manual order within the Kanban column
+	if req.Position != nil {
+		if err := s.placeCard(board, flow, cards, noteID, to, *req.Position, userID); err != nil {
+			return nil, fmt.Errorf("failed to reorder Kanban column: %v", err)
 		}
 	}
 
-	return fmt.Errorf("connection not found")
-}
-
-// GetNotesMindmap retrieves notes for mindmap visualization
-func (s *NoteService) GetNotesMindmap(userIDStr string) (*contracts.MindmapNotesResponse, error) {
-	// Parse user ID
-	userID, err := uuid.Parse(userIDStr)
+	// Retrieve and return the updated note
+	updatedNote, err := s.NoteRepo.GetByID(noteID, userID)
 	if err != nil {
-		return nil, fmt.Errorf("invalid user ID: %v", err)
+		return nil, fmt.Errorf("failed to retrieve updated note: %v", err)
 	}
 
-	// Retrieve notes and connections for mindmap
-	noteConnections, err := s.NoteRepo.GetNotesMindmap(context.Background(), userID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to retrieve notes for mindmap: %v", err)
-	}
+	response := move.response
+	response.Note = *updatedNote
+	return response, nil
+}
 
-	// Create and return mindmap response
-	return &contracts.MindmapNotesResponse{
-		NoteConnections: noteConnections,
-	}, nil
+// inTransaction runs fn with a copy of the service whose repositories work within one
+// transaction, committed when fn returns nil
+func (s *NoteService) inTransaction(fn func(tx *NoteService) error) error {
+	return s.NoteRepo.Transaction(context.Background(), func(db *gorm.DB) error {
+		tx := *s
+		tx.NoteRepo = s.NoteRepo.WithTx(db)
+		tx.ConnectionRepo = s.ConnectionRepo.WithTx(db)
+		tx.BoardRepo = s.BoardRepo.WithTx(db)
+		tx.EventRepo = s.EventRepo.WithTx(db)
+		return fn(&tx)
+	})
 }
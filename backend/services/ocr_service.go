@@ -16,17 +16,12 @@ func NewOCRService() *OCRService {
 }
 
 func (s *OCRService) ProcessImage(imagePath string) (string, error) {
-	// Get the current working directory
-	currentDir, err := os.Getwd()
+	// Resolve the image path relative to the current working directory
+	absImagePath, err := filepath.Abs(imagePath)
 	if err != nil {
-		return "", fmt.Errorf("failed to get current directory: %v", err)
+		return "", fmt.Errorf("failed to resolve image path: %v", err)
 	}
 
-	// Construct absolute path considering the project structure
-	// Use filepath.Join to correctly handle path separators
-	absImagePath := filepath.Join(currentDir, "..", "uploadedFiles", filepath.Base(imagePath))
-	absImagePath = filepath.Clean(absImagePath)
-
 	// Use absolute path to the script
 	scriptPath, err := filepath.Abs("./scripts/ocr.py")
 	if err != nil {
@@ -37,7 +32,6 @@ func (s *OCRService) ProcessImage(imagePath string) (string, error) {
 	pythonPath := filepath.Join(filepath.Dir(scriptPath), "venv", "bin", "python3")
 
 	// Extensive logging for debugging
-	// log.Printf("Current Directory: %s", currentDir)
 	// log.Printf("Image Relative Path: %s", imagePath)
 	// log.Printf("Image Absolute Path: %s", absImagePath)
 	// log.Printf("Script Path: %s", scriptPath)
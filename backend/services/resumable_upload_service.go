@@ -0,0 +1,475 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"NoteSense/contracts"
+	"NoteSense/encryption"
+	"NoteSense/models"
+	"NoteSense/repositories"
+
+	"github.com/google/uuid"
+)
+
+const (
+	defaultUploadExpiryHours = 24
+	defaultMaxUploads        = 10
+	uploadSweepInterval      = time.Hour
+)
+
+// sha256HexPattern matches a lowercase hex SHA-256 digest
+var sha256HexPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// UploadOffsetError is returned when a chunk does not start where the upload left off
+type UploadOffsetError struct {
+	Expected int64
+}
+
+func (e *UploadOffsetError) Error() string {
+	return fmt.Sprintf("upload offset mismatch: expected %d", e.Expected)
+}
+
+// ResumableUploadService receives large files in chunks. Chunks are appended to a staging file
+// on the server's disk, encrypted with the user's data key when at-rest encryption is enabled,
+// and a completed upload goes through the same processing as a direct upload. Uploads untouched
+// for UPLOAD_EXPIRY_HOURS expire and their chunks are deleted. A user may have UPLOAD_MAX_SESSIONS
+// uploads in progress, whose declared sizes are reserved against their storage quota.
+type ResumableUploadService struct {
+	SessionRepo *repositories.UploadSessionRepository
+	FileService *FileUploadService
+	stagingDir  string
+	expiry      time.Duration
+	maxUploads  int64
+	locks       map[uuid.UUID]*uploadLock // Held per upload; chunks of one upload are written one at a time
+	locksMu     sync.Mutex
+}
+
+// uploadLock is the lock of one upload, kept in the map while anyone holds or waits for it
+type uploadLock struct {
+	sync.Mutex
+	users int
+}
+
+// NewResumableUploadService creates a new ResumableUploadService. Chunks are staged in
+// UPLOAD_STAGING_DIR, or a directory under the system's temporary directory.
+func NewResumableUploadService(sessionRepo *repositories.UploadSessionRepository, fileService *FileUploadService) *ResumableUploadService {
+	stagingDir := os.Getenv("UPLOAD_STAGING_DIR")
+	if stagingDir == "" {
+		stagingDir = filepath.Join(os.TempDir(), "notesense-uploads")
+	}
+	hours := defaultUploadExpiryHours
+	if value := os.Getenv("UPLOAD_EXPIRY_HOURS"); value != "" {
+		if parsed, err := strconv.Atoi(value); err == nil && parsed > 0 {
+			hours = parsed
+		}
+	}
+	maxUploads := int64(defaultMaxUploads)
+	if value := os.Getenv("UPLOAD_MAX_SESSIONS"); value != "" {
+		if parsed, err := strconv.ParseInt(value, 10, 64); err == nil && parsed > 0 {
+			maxUploads = parsed
+		}
+	}
+	return &ResumableUploadService{
+		SessionRepo: sessionRepo,
+		FileService: fileService,
+		stagingDir:  stagingDir,
+		expiry:      time.Duration(hours) * time.Hour,
+		maxUploads:  maxUploads,
+		locks:       make(map[uuid.UUID]*uploadLock),
+	}
+}
+
+// CreateUpload starts a resumable upload of a file to one of the user's notes. The type, size
+// and quota are checked now so a doomed upload is refused before any chunk is sent, and the size
+// stays reserved against the quota until the upload ends so other resumable uploads cannot
+// claim it.
+func (s *ResumableUploadService) CreateUpload(req *contracts.CreateUploadRequest, userID uuid.UUID) (*models.UploadSession, error) {
+	if userID == uuid.Nil {
+		return nil, fmt.Errorf("user ID is required")
+	}
+	if req.FileName == "" {
+		return nil, fmt.Errorf("file name is required")
+	}
+	if req.Size <= 0 {
+		return nil, fmt.Errorf("upload size must be positive")
+	}
+	if req.Checksum != "" && !sha256HexPattern.MatchString(req.Checksum) {
+		return nil, fmt.Errorf("checksum must be a lowercase hex SHA-256 digest")
+	}
+	fileType := LookupFileType(req.FileName)
+	if fileType == nil {
+		return nil, fmt.Errorf("unsupported file type: %q", filepath.Ext(req.FileName))
+	}
+	if _, err := s.FileService.noteService.GetNoteByID(req.NoteID, userID); err != nil {
+		return nil, err
+	}
+	if err := s.FileService.checkUploadSize(fileType, req.Size, userID); err != nil {
+		return nil, err
+	}
+
+	session := &models.UploadSession{
+		UserID:    userID,
+		NoteID:    req.NoteID,
+		FileName:  req.FileName,
+		Size:      req.Size,
+		Checksum:  req.Checksum,
+		Sealed:    s.FileService.cipher.Enabled(),
+		ExpiresAt: time.Now().Add(s.expiry),
+	}
+	var refused error
+	err := s.SessionRepo.Create(context.Background(), session, func(reserved repositories.UploadReservation) error {
+		if reserved.Uploads >= s.maxUploads {
+			refused = fmt.Errorf("too many uploads in progress: at most %d at a time", s.maxUploads)
+		} else {
+			refused = s.FileService.checkQuota(req.Size, reserved.Bytes, userID)
+		}
+		return refused
+	})
+	if refused != nil {
+		return nil, refused
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create upload: %v", err)
+	}
+
+	if err := os.MkdirAll(s.stagingDir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create upload staging directory: %v", err)
+	}
+	staged, err := os.OpenFile(s.stagingPath(session.ID), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create upload staging file: %v", err)
+	}
+	staged.Close()
+	return session, nil
+}
+
+// GetUpload returns one of the user's uploads in progress
+func (s *ResumableUploadService) GetUpload(sessionID, userID uuid.UUID) (*models.UploadSession, error) {
+	if sessionID == uuid.Nil {
+		return nil, fmt.Errorf("upload ID is required")
+	}
+	session, err := s.SessionRepo.GetByID(context.Background(), sessionID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve upload: %v", err)
+	}
+	if session == nil || session.ExpiresAt.Before(time.Now()) {
+		return nil, fmt.Errorf("upload not found")
+	}
+	return session, nil
+}
+
+// AppendChunk writes the bytes read from chunk at offset, which must be where the upload left
+// off. With a checksum (base64 SHA-256 of the chunk) a chunk that does not match is discarded;
+// without one, the bytes received before a broken connection are kept so the client can resume.
+func (s *ResumableUploadService) AppendChunk(sessionID uuid.UUID, offset int64, chunk io.Reader, checksum string, userID uuid.UUID) (*models.UploadSession, error) {
+	session, unlock, err := s.lockUpload(sessionID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	if offset != session.Offset {
+		return nil, &UploadOffsetError{Expected: session.Offset}
+	}
+	var expected []byte
+	if checksum != "" {
+		if expected, err = base64.StdEncoding.DecodeString(checksum); err != nil || len(expected) != sha256.Size {
+			return nil, fmt.Errorf("chunk checksum must be a base64 SHA-256 digest")
+		}
+	}
+
+	staged, err := os.OpenFile(s.stagingPath(session.ID), os.O_RDWR, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open upload staging file: %v", err)
+	}
+	defer staged.Close()
+	// Bytes past the recorded offset are left over from a chunk that was not recorded
+	position, err := stagedPosition(staged, session, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare upload staging file: %v", err)
+	}
+	if err := staged.Truncate(position); err != nil {
+		return nil, fmt.Errorf("failed to prepare upload staging file: %v", err)
+	}
+	if _, err := staged.Seek(position, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to prepare upload staging file: %v", err)
+	}
+	sink, err := s.stagingWriter(staged, session, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare upload staging file: %v", err)
+	}
+
+	remaining := session.Size - offset
+	hash := sha256.New()
+	written, readErr := io.Copy(io.MultiWriter(sink, hash), io.LimitReader(chunk, remaining+1))
+	switch {
+	case written > remaining:
+		staged.Truncate(position)
+		return nil, fmt.Errorf("chunk exceeds the upload size of %d bytes", session.Size)
+	case expected != nil && (readErr != nil || !bytes.Equal(hash.Sum(nil), expected)):
+		staged.Truncate(position)
+		if readErr != nil {
+			return nil, fmt.Errorf("failed to receive chunk: %v", readErr)
+		}
+		return nil, fmt.Errorf("chunk checksum mismatch")
+	}
+	// Only a chunk that reached the disk in full is recorded
+	err = sink.Close()
+	if err == nil {
+		err = checkStaged(staged, session, offset+written)
+	}
+	if err == nil {
+		err = staged.Sync()
+	}
+	if err != nil {
+		staged.Truncate(position)
+		return nil, fmt.Errorf("failed to write upload staging file: %v", err)
+	}
+
+	session.Offset += written
+	session.ExpiresAt = time.Now().Add(s.expiry)
+	if err := s.SessionRepo.SetOffset(context.Background(), session); err != nil {
+		return nil, fmt.Errorf("failed to record upload progress: %v", err)
+	}
+	if readErr != nil {
+		return nil, fmt.Errorf("failed to receive chunk after %d bytes: %v", written, readErr)
+	}
+	return session, nil
+}
+
+// CompleteUpload verifies a fully received upload against its checksum and processes it like a
+// direct upload. An upload whose processing fails, for instance over quota, can be completed
+// again; one that does not match its checksum is discarded.
+func (s *ResumableUploadService) CompleteUpload(sessionID, userID uuid.UUID) (*models.FileMetadata, error) {
+	session, unlock, err := s.lockUpload(sessionID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	if session.Offset < session.Size {
+		return nil, fmt.Errorf("upload is incomplete: %d of %d bytes received", session.Offset, session.Size)
+	}
+
+	// The staged file is read once to check it, then streamed again by processing
+	staged, err := s.openStaged(session)
+	if err != nil {
+		return nil, err
+	}
+	hash := sha256.New()
+	read, err := io.Copy(hash, staged)
+	staged.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read upload staging file: %v", err)
+	}
+	if read != session.Size {
+		return nil, fmt.Errorf("failed to read upload: staged %d of %d bytes", read, session.Size)
+	}
+	if session.Checksum != "" && hex.EncodeToString(hash.Sum(nil)) != session.Checksum {
+		s.discard(session)
+		return nil, fmt.Errorf("upload checksum mismatch; the upload was discarded")
+	}
+
+	open := func() (io.ReadCloser, error) { return s.openStaged(session) }
+	metadata, err := s.FileService.processFile(session.FileName, open, session.Size, userID, session.NoteID)
+	if err != nil {
+		return nil, err
+	}
+	s.discard(session)
+	return metadata, nil
+}
+
+// AbortUpload cancels an upload in progress and deletes its chunks
+func (s *ResumableUploadService) AbortUpload(sessionID, userID uuid.UUID) error {
+	session, unlock, err := s.lockUpload(sessionID, userID)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return s.discard(session)
+}
+
+// Start deletes expired uploads now and then every hour until ctx is done
+func (s *ResumableUploadService) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(uploadSweepInterval)
+		defer ticker.Stop()
+		for {
+			if err := s.sweep(ctx); err != nil {
+				log.Printf("Failed to delete expired uploads: %v", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// sweep deletes expired uploads, and staging files no upload has touched for as long, such as
+// those of uploads whose note was deleted
+func (s *ResumableUploadService) sweep(ctx context.Context) error {
+	now := time.Now()
+	sessions, err := s.SessionRepo.ListExpired(ctx, now)
+	if err != nil {
+		return err
+	}
+	for i := range sessions {
+		// A chunk being written when the upload expired is finished first
+		unlock := s.lock(sessions[i].ID)
+		err := s.discard(&sessions[i])
+		unlock()
+		if err != nil {
+			return err
+		}
+	}
+
+	entries, err := os.ReadDir(s.stagingDir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || now.Sub(info.ModTime()) < s.expiry {
+			continue
+		}
+		if err := os.Remove(filepath.Join(s.stagingDir, entry.Name())); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if len(sessions) > 0 {
+		log.Printf("Deleted %d expired uploads", len(sessions))
+	}
+	return nil
+}
+
+// discard deletes an upload and its staging file. The caller holds its lock; anyone waiting on
+// it finds the upload gone.
+func (s *ResumableUploadService) discard(session *models.UploadSession) error {
+	if err := os.Remove(s.stagingPath(session.ID)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete upload staging file: %v", err)
+	}
+	if err := s.SessionRepo.Delete(context.Background(), session.ID); err != nil {
+		return fmt.Errorf("failed to delete upload: %v", err)
+	}
+	return nil
+}
+
+func (s *ResumableUploadService) stagingPath(sessionID uuid.UUID) string {
+	return filepath.Join(s.stagingDir, sessionID.String())
+}
+
+// stagingWriter returns the writer a chunk goes through onto the staging file: the file itself,
+// or a sealer when the upload is encrypted. Closing it does not close the file.
+func (s *ResumableUploadService) stagingWriter(staged *os.File, session *models.UploadSession, offset int64) (io.WriteCloser, error) {
+	if !session.Sealed {
+		return nopWriteCloser{staged}, nil
+	}
+	return s.FileService.cipher.SealStaging(context.Background(), session.UserID, staged, offset)
+}
+
+// openStaged returns a reader of the bytes of an upload, decrypted from its staging file
+func (s *ResumableUploadService) openStaged(session *models.UploadSession) (io.ReadCloser, error) {
+	staged, err := os.Open(s.stagingPath(session.ID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read upload staging file: %v", err)
+	}
+	if !session.Sealed {
+		return staged, nil
+	}
+	contents, err := s.FileService.cipher.OpenStaging(context.Background(), session.UserID, staged)
+	if err != nil {
+		staged.Close()
+		return nil, fmt.Errorf("failed to read upload staging file: %v", err)
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{contents, staged}, nil
+}
+
+// stagedPosition returns where the first offset bytes of an upload end in its staging file
+func stagedPosition(staged io.ReadSeeker, session *models.UploadSession, offset int64) (int64, error) {
+	if !session.Sealed {
+		return offset, nil
+	}
+	return encryption.FramePosition(staged, offset)
+}
+
+// checkStaged checks that a staging file holds exactly the first offset bytes of its upload
+func checkStaged(staged *os.File, session *models.UploadSession, offset int64) error {
+	position, err := stagedPosition(staged, session, offset)
+	if err != nil {
+		return err
+	}
+	info, err := staged.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() != position {
+		return fmt.Errorf("staged %d bytes where %d were expected", info.Size(), position)
+	}
+	return nil
+}
+
+// nopWriteCloser adds a Close that does nothing to a writer
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+// lockUpload returns one of the user's uploads in progress with its lock held, and the matching
+// unlock. The upload is looked up before locking, so only the owner of an existing upload takes
+// its lock, and again after, as whoever held it may have moved it on or discarded it.
+func (s *ResumableUploadService) lockUpload(sessionID, userID uuid.UUID) (*models.UploadSession, func(), error) {
+	if _, err := s.GetUpload(sessionID, userID); err != nil {
+		return nil, nil, err
+	}
+	unlock := s.lock(sessionID)
+	session, err := s.GetUpload(sessionID, userID)
+	if err != nil {
+		unlock()
+		return nil, nil, err
+	}
+	return session, unlock, nil
+}
+
+// lock serializes work on one upload within this process and returns the matching unlock. The
+// upload's entry is removed once nobody holds or waits for it.
+func (s *ResumableUploadService) lock(sessionID uuid.UUID) func() {
+	s.locksMu.Lock()
+	held := s.locks[sessionID]
+	if held == nil {
+		held = &uploadLock{}
+		s.locks[sessionID] = held
+	}
+	held.users++
+	s.locksMu.Unlock()
+
+	held.Lock()
+	return func() {
+		held.Unlock()
+		s.locksMu.Lock()
+		held.users--
+		if held.users == 0 {
+			delete(s.locks, sessionID)
+		}
+		s.locksMu.Unlock()
+	}
+}
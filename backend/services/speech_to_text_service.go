@@ -28,7 +28,7 @@ func (s *SpeechToTextService) TranscribeAudio(audioPath string) (string, error)
 		return "", fmt.Errorf("PYTHON_VENV_PATH environment variable not set")
 	}
 	cmd := exec.Command(pythonPath, scriptPath, audioPath)
-	cmd.Dir = "../uploadedFiles" // Set working directory
+	cmd.Dir = filepath.Dir(scriptPath)
 
 	output, err := cmd.Output()
 	if err != nil {
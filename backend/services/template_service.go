@@ -0,0 +1,260 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"NoteSense/contracts"
+	"NoteSense/models"
+	"NoteSense/repositories"
+
+	"github.com/google/uuid"
+)
+
+// templateVariablePattern matches placeholders such as {{date}} or {{ user.name }}
+var templateVariablePattern = regexp.MustCompile(`\{\{\s*([A-Za-z0-9_.\-]+)\s*\}\}`)
+
+// TemplateService handles note template operations
+type TemplateService struct {
+	TemplateRepo *repositories.TemplateRepository
+	UserRepo     *repositories.UserRepository
+	NoteService  *NoteService
+	admins       adminList
+}
+
+// NewTemplateService creates a new TemplateService
+func NewTemplateService(templateRepo *repositories.TemplateRepository, userRepo *repositories.UserRepository, noteService *NoteService) *TemplateService {
+	return &TemplateService{
+		TemplateRepo: templateRepo,
+		UserRepo:     userRepo,
+		NoteService:  noteService,
+		admins:       adminListFromEnv(),
+	}
+}
+
+// CreateTemplate creates a new template owned by the user
+func (s *TemplateService) CreateTemplate(req *contracts.TemplateRequest, userID uuid.UUID) (*models.NoteTemplate, error) {
+	if userID == uuid.Nil {
+		return nil, fmt.Errorf("user ID is required")
+	}
+	if req.Name == "" {
+		return nil, fmt.Errorf("template name is required")
+	}
+
+	template := &models.NoteTemplate{
+		UserID:        userID,
+		Name:          req.Name,
+		Scope:         req.Scope,
+		Title:         req.Title,
+		Content:       req.Content,
+		Categories:    req.Categories,
+		DefaultStatus: req.DefaultStatus,
+		Prompts:       req.Prompts,
+	}
+	if err := validateTemplate(template); err != nil {
+		return nil, err
+	}
+	if err := s.checkScope(template, userID); err != nil {
+		return nil, err
+	}
+
+	if err := s.TemplateRepo.Create(context.Background(), template); err != nil {
+		return nil, fmt.Errorf("failed to create template: %v", err)
+	}
+	return template, nil
+}
+
+// GetTemplates returns the user's templates together with the templates admins shared with the workspace
+func (s *TemplateService) GetTemplates(userID uuid.UUID) ([]models.NoteTemplate, error) {
+	if userID == uuid.Nil {
+		return nil, fmt.Errorf("user ID is required")
+	}
+	return s.TemplateRepo.ListVisible(context.Background(), userID, s.admins.emails())
+}
+
+// GetTemplateByID returns a single template visible to the user
+func (s *TemplateService) GetTemplateByID(templateID, userID uuid.UUID) (*models.NoteTemplate, error) {
+	if templateID == uuid.Nil {
+		return nil, fmt.Errorf("template ID is required")
+	}
+
+	template, err := s.TemplateRepo.GetVisibleByID(context.Background(), templateID, userID, s.admins.emails())
+	if err != nil {
+		return nil, err
+	}
+	if template == nil {
+		return nil, fmt.Errorf("template not found")
+	}
+	return template, nil
+}
+
+// UpdateTemplate updates a template. Only the owner may modify it, even for workspace templates.
+func (s *TemplateService) UpdateTemplate(templateID uuid.UUID, req *contracts.TemplateRequest, userID uuid.UUID) (*models.NoteTemplate, error) {
+	template, err := s.GetTemplateByID(templateID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if template.UserID != userID {
+		return nil, fmt.Errorf("only the template owner can modify it")
+	}
+
+	if req.Name != "" {
+		template.Name = req.Name
+	}
+	if req.Scope != "" {
+		template.Scope = req.Scope
+	}
+	if req.Title != "" {
+		template.Title = req.Title
+	}
+	if req.Content != "" {
+		template.Content = req.Content
+	}
+	if req.Categories != nil {
+		template.Categories = req.Categories
+	}
+	if req.DefaultStatus != "" {
+		template.DefaultStatus = req.DefaultStatus
+	}
+	if req.Prompts != nil {
+		template.Prompts = req.Prompts
+	}
+	if err := validateTemplate(template); err != nil {
+		return nil, err
+	}
+	if err := s.checkScope(template, userID); err != nil {
+		return nil, err
+	}
+
+	if err := s.TemplateRepo.Update(context.Background(), template); err != nil {
+		return nil, fmt.Errorf("failed to update template: %v", err)
+	}
+	return template, nil
+}
+
+// DeleteTemplate deletes a template owned by the user
+func (s *TemplateService) DeleteTemplate(templateID, userID uuid.UUID) error {
+	template, err := s.GetTemplateByID(templateID, userID)
+	if err != nil {
+		return err
+	}
+	if template.UserID != userID {
+		return fmt.Errorf("only the template owner can delete it")
+	}
+	return s.TemplateRepo.Delete(context.Background(), templateID, userID)
+}
+
+// CreateNoteFromTemplate renders a template and stores the result as a new note
+func (s *TemplateService) CreateNoteFromTemplate(templateID uuid.UUID, values map[string]string, userID uuid.UUID) (*models.Note, error) {
+	template, err := s.GetTemplateByID(templateID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.UserRepo.FindByID(userID.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to load user: %v", err)
+	}
+
+	variables, err := templateVariables(template, user, values, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	title := renderTemplateText(template.Title, variables)
+	if title == "" {
+		title = template.Name
+	}
+	content := renderTemplateText(template.Content, variables)
+
+	categories := make([]string, 0, len(template.Categories))
+	for _, category := range template.Categories {
+		categories = append(categories, renderTemplateText(category, variables))
+	}
+
+	// A default status is checked against the user's board before the note is created
+	if template.DefaultStatus != "" {
+		return s.NoteService.CreateNoteInStatus(title, content, categories, template.DefaultStatus, userID)
+	}
+	return s.NoteService.CreateNote(title, content, categories, userID)
+}
+
+// checkScope makes sure only admins share templates with the workspace; any user may keep
+// or make a template private
+func (s *TemplateService) checkScope(template *models.NoteTemplate, userID uuid.UUID) error {
+	if template.Scope != models.TemplateScopeWorkspace {
+		return nil
+	}
+	user, err := s.UserRepo.FindByID(userID.String())
+	if err != nil {
+		return fmt.Errorf("failed to load user: %v", err)
+	}
+	if !s.admins.includes(user) {
+		return fmt.Errorf("only admins can share templates with the workspace")
+	}
+	return nil
+}
+
+// validateTemplate checks the scope and default status of a template, normalizing the status
+// to its canonical state
+func validateTemplate(template *models.NoteTemplate) error {
+	if template.Scope != models.TemplateScopeUser && template.Scope != models.TemplateScopeWorkspace {
+		return fmt.Errorf("invalid template scope: %s", template.Scope)
+	}
+
+	if template.DefaultStatus != "" {
+		state := models.CanonicalState(template.DefaultStatus)
+		if state == "" {
+			return fmt.Errorf("invalid default status: %s", template.DefaultStatus)
+		}
+		template.DefaultStatus = state
+	}
+
+	for _, prompt := range template.Prompts {
+		if !templateVariablePattern.MatchString("{{" + prompt + "}}") {
+			return fmt.Errorf("invalid prompt name: %q", prompt)
+		}
+	}
+	return nil
+}
+
+// templateVariables builds the variable set for rendering: built-ins first, then the custom prompts
+func templateVariables(template *models.NoteTemplate, user *models.User, values map[string]string, now time.Time) (map[string]string, error) {
+	variables := map[string]string{
+		"date":       now.Format("2006-01-02"),
+		"time":       now.Format("15:04"),
+		"datetime":   now.Format("2006-01-02 15:04"),
+		"weekday":    now.Weekday().String(),
+		"user.name":  user.Name,
+		"user.email": user.Email,
+	}
+
+	var missing []string
+	for _, prompt := range template.Prompts {
+		value, ok := values[prompt]
+		if !ok {
+			missing = append(missing, prompt)
+			continue
+		}
+		variables[prompt] = value
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("missing values for template prompts: %s", strings.Join(missing, ", "))
+	}
+
+	return variables, nil
+}
+
+// renderTemplateText substitutes known placeholders and leaves unknown ones untouched
+func renderTemplateText(text string, variables map[string]string) string {
+	return templateVariablePattern.ReplaceAllStringFunc(text, func(match string) string {
+		name := templateVariablePattern.FindStringSubmatch(match)[1]
+		if value, ok := variables[name]; ok {
+			return value
+		}
+		return match
+	})
+}
@@ -12,14 +12,35 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
+// searchLanguages lists the Postgres text search configurations users may choose from
+var searchLanguages = map[string]bool{
+	"simple":     true,
+	"danish":     true,
+	"dutch":      true,
+	"english":    true,
+	"finnish":    true,
+	"french":     true,
+	"german":     true,
+	"hungarian":  true,
+	"italian":    true,
+	"norwegian":  true,
+	"portuguese": true,
+	"romanian":   true,
+	"russian":    true,
+	"spanish":    true,
+	"swedish":    true,
+	"turkish":    true,
+}
+
 // UserService holds the user repository
 type UserService struct {
 	UserRepo *repositories.UserRepository
+	NoteRepo *repositories.NoteRepository
 }
 
 // NewUserService creates a new UserService
-func NewUserService(repo *repositories.UserRepository) *UserService {
-	return &UserService{UserRepo: repo}
+func NewUserService(repo *repositories.UserRepository, noteRepo *repositories.NoteRepository) *UserService {
+	return &UserService{UserRepo: repo, NoteRepo: noteRepo}
 }
 
 // SignUp handles user registration logic
@@ -91,3 +112,31 @@ func (s *UserService) Login(email, password string) (*contracts.LoginResponse, e
 		User:  *existingUser,
 	}, nil
 }
+
+// UpdateSettings applies the user's preferences. Changing the search language reindexes their notes.
+func (s *UserService) UpdateSettings(req *contracts.UserSettingsRequest, userID uuid.UUID) (*models.User, error) {
+	if userID == uuid.Nil {
+		return nil, fmt.Errorf("user ID is required")
+	}
+
+	user, err := s.UserRepo.FindByID(userID.String())
+	if err != nil {
+		return nil, err
+	}
+
+	if req.SearchLanguage != "" && req.SearchLanguage != user.SearchLanguage {
+		if !searchLanguages[req.SearchLanguage] {
+			return nil, fmt.Errorf("unsupported search language: %s", req.SearchLanguage)
+		}
+		if err := s.UserRepo.UpdateSearchLanguage(context.Background(), userID, req.SearchLanguage); err != nil {
+			return nil, fmt.Errorf("failed to update search language: %v", err)
+		}
+		user.SearchLanguage = req.SearchLanguage
+
+		if err := s.NoteRepo.ReindexUser(context.Background(), userID); err != nil {
+			return nil, fmt.Errorf("failed to reindex notes: %v", err)
+		}
+	}
+
+	return user, nil
+}
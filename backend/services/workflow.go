@@ -0,0 +1,192 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"NoteSense/contracts"
+	"NoteSense/models"
+
+	"github.com/google/uuid"
+)
+
+// workflow resolves note statuses against the columns of a user's boards. A note's status is
+// a column key or a canonical state; every status belongs to one canonical state.
+type workflow struct {
+	states map[string]string // Known statuses and their canonical states
+}
+
+func newWorkflow(boards []models.Board) *workflow {
+	flow := &workflow{states: make(map[string]string)}
+	for state, spellings := range models.StateSpellings() {
+		for _, spelling := range spellings {
+			flow.states[spelling] = state
+		}
+	}
+	for _, board := range boards {
+		for _, column := range board.Columns {
+			flow.states[column.Key] = column.State
+		}
+	}
+	return flow
+}
+
+// stateOf returns the canonical state of a status; unknown statuses wait in the backlog
+func (w *workflow) stateOf(status string) string {
+	if state, ok := w.states[normalizeStatus(status)]; ok {
+		return state
+	}
+	return models.StateBacklog
+}
+
+// statusesIn returns the known statuses in a canonical state
+func (w *workflow) statusesIn(state string) []string {
+	var statuses []string
+	for status, candidate := range w.states {
+		if candidate == state {
+			statuses = append(statuses, status)
+		}
+	}
+	sort.Strings(statuses)
+	return statuses
+}
+
+// columnOf returns the board column a note with the given status appears in
+func (w *workflow) columnOf(board *models.Board, status string) *models.BoardColumn {
+	status = normalizeStatus(status)
+	return board.ColumnFor(status, w.stateOf(status))
+}
+
+// columnStatuses returns the known statuses whose notes appear in a board column
+func (w *workflow) columnStatuses(board *models.Board, column *models.BoardColumn) []string {
+	var statuses []string
+	for status, state := range w.states {
+		if board.ColumnFor(status, state).Key == column.Key {
+			statuses = append(statuses, status)
+		}
+	}
+	sort.Strings(statuses)
+	return statuses
+}
+
+func normalizeStatus(status string) string {
+	return strings.ToLower(strings.TrimSpace(status))
+}
+
+// moveTarget returns the column a note moved to status lands in: the column with that key, else
+// the first column in the canonical state the status spells. Nil means the board has no such column.
+func moveTarget(board *models.Board, status string) *models.BoardColumn {
+	if column := board.Column(normalizeStatus(status)); column != nil {
+		return column
+	}
+	if state := models.CanonicalState(status); state != "" {
+		return board.FirstColumnIn(state)
+	}
+	return nil
+}
+
+// loadWorkflow loads the statuses defined by the user's boards
+func (s *NoteService) loadWorkflow(userID uuid.UUID) (*workflow, error) {
+	boards, err := s.BoardRepo.ListByUser(context.Background(), userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve boards: %v", err)
+	}
+	return newWorkflow(boards), nil
+}
+
+// kanbanBoard returns the user's default board, or the built-in board when they have not chosen one
+func (s *NoteService) kanbanBoard(userID uuid.UUID) (*models.Board, error) {
+	board, err := s.BoardRepo.GetDefault(context.Background(), userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve board: %v", err)
+	}
+	if board == nil {
+		board = models.DefaultBoard(userID)
+	}
+	return board, nil
+}
+
+// newBoardResponse returns a board with its columns and no cards
+func newBoardResponse(board *models.Board) *contracts.KanbanNotesResponse {
+	response := &contracts.KanbanNotesResponse{
+		Name:        board.Name,
+		Transitions: board.Transitions,
+		Columns:     make([]contracts.KanbanColumnNotes, 0, len(board.Columns)),
+	}
+	if board.ID != uuid.Nil {
+		id := board.ID
+		response.BoardID = &id
+	}
+	for _, column := range board.Columns {
+		response.Columns = append(response.Columns, contracts.KanbanColumnNotes{BoardColumn: column, Notes: []models.Note{}})
+	}
+	return response
+}
+
+// groupBoard lays notes out on a board, keeping their order within each column
+func groupBoard(board *models.Board, notes []models.Note, flow *workflow) *contracts.KanbanNotesResponse {
+	response := newBoardResponse(board)
+	index := make(map[string]int, len(response.Columns))
+	for i, column := range response.Columns {
+		index[column.Key] = i
+	}
+	for _, note := range notes {
+		i := index[flow.columnOf(board, note.Status).Key]
+		response.Columns[i].Notes = append(response.Columns[i].Notes, note)
+	}
+	return response
+}
+
+// columnCount counts the cards in a board column; see moveCard for cards
+func (s *NoteService) columnCount(board *models.Board, flow *workflow, cards []models.Note, column *models.BoardColumn, userID uuid.UUID) (int64, error) {
+	if cards == nil {
+		return s.NoteRepo.CountWithStatuses(context.Background(), userID, flow.columnStatuses(board, column))
+	}
+	var count int64
+	for _, card := range cards {
+		if flow.columnOf(board, card.Status).Key == column.Key {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// placeCard puts a note at the given index of a board column; see moveCard for cards
+func (s *NoteService) placeCard(board *models.Board, flow *workflow, cards []models.Note, noteID uuid.UUID, column *models.BoardColumn, position int, userID uuid.UUID) error {
+	if cards == nil {
+		return s.NoteRepo.MoveInKanbanColumn(context.Background(), userID, noteID, flow.columnStatuses(board, column), position)
+	}
+
+	var columnIDs []uuid.UUID
+	for _, card := range cards {
+		if card.ID != noteID && flow.columnOf(board, card.Status).Key == column.Key {
+			columnIDs = append(columnIDs, card.ID)
+		}
+	}
+	if position < 0 {
+		position = 0
+	}
+	if position > len(columnIDs) {
+		position = len(columnIDs)
+	}
+	ordered := make([]uuid.UUID, 0, len(columnIDs)+1)
+	ordered = append(ordered, columnIDs[:position]...)
+	ordered = append(ordered, noteID)
+	ordered = append(ordered, columnIDs[position:]...)
+	return s.BoardRepo.SetCardPositions(context.Background(), board.ID, ordered)
+}
+
+// sortBoardCards puts the cards placed on a board by hand first, in their positions; the others
+// keep their order
+func sortBoardCards(notes []models.Note, positions map[uuid.UUID]int) {
+	sort.SliceStable(notes, func(i, j int) bool {
+		pi, placedI := positions[notes[i].ID]
+		pj, placedJ := positions[notes[j].ID]
+		if placedI != placedJ {
+			return placedI
+		}
+		return placedI && pi < pj
+	})
+}
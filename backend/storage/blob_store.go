@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+// ErrNotFound is returned for keys a store does not hold
+var ErrNotFound = errors.New("blob not found")
+
+// BlobStore keeps the bytes of uploaded files. Keys are the hex SHA-256 of the stored bytes, so
+// a blob never changes once written and storing the same bytes twice yields the same key.
+type BlobStore interface {
+	// Put stores everything read from r and returns its key and size
+	Put(ctx context.Context, r io.Reader) (key string, size int64, err error)
+	// Open returns a reader of a blob that can seek, so parts of it are read without the
+	// rest; the caller closes it
+	Open(ctx context.Context, key string) (io.ReadSeekCloser, error)
+	// Delete removes a blob. Deleting a blob that does not exist is not an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// NewBlobStoreFromEnv creates the store BLOB_STORE selects: "local" (the default), which keeps
+// blobs under BLOB_DIR, or "s3", configured by the S3_* variables
+func NewBlobStoreFromEnv() (BlobStore, error) {
+	switch backend := strings.ToLower(strings.TrimSpace(os.Getenv("BLOB_STORE"))); backend {
+	case "", "local":
+		dir := os.Getenv("BLOB_DIR")
+		if dir == "" {
+			dir = "./../uploadedFiles"
+		}
+		return NewLocalStore(dir)
+	case "s3":
+		return NewS3StoreFromEnv()
+	default:
+		return nil, fmt.Errorf("unknown BLOB_STORE %q, expected local or s3", backend)
+	}
+}
+
+// ValidKey reports whether a key has the form stores hand out
+func ValidKey(key string) bool {
+	if len(key) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(key)
+	return err == nil && strings.ToLower(key) == key
+}
+
+// keyPath spreads blobs over two levels of directories named after the leading key bytes
+func keyPath(key string) string {
+	return path.Join(key[:2], key[2:4], key)
+}
+
+// spool copies r into a new temporary file in dir while hashing it. The file is positioned at
+// its start; the caller closes and removes it.
+func spool(r io.Reader, dir string) (*os.File, string, int64, error) {
+	file, err := os.CreateTemp(dir, ".blob-*")
+	if err != nil {
+		return nil, "", 0, fmt.Errorf("failed to create temporary blob: %v", err)
+	}
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(file, hash), r)
+	if err == nil {
+		_, err = file.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, "", 0, fmt.Errorf("failed to write temporary blob: %v", err)
+	}
+	return file, hex.EncodeToString(hash.Sum(nil)), size, nil
+}
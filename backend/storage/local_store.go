@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// LocalStore keeps blobs in a directory on the local filesystem
+type LocalStore struct {
+	root string
+}
+
+// NewLocalStore creates a store rooted at dir, creating the directory if needed
+func NewLocalStore(dir string) (*LocalStore, error) {
+	root, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve blob directory: %v", err)
+	}
+	if err := os.MkdirAll(root, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create blob directory: %v", err)
+	}
+	return &LocalStore{root: root}, nil
+}
+
+// Put stores a blob. It is spooled into the store's own directory first, so moving it under
+// its key is a rename and readers never see a partial blob.
+func (s *LocalStore) Put(ctx context.Context, r io.Reader) (string, int64, error) {
+	file, key, size, err := spool(r, s.root)
+	if err != nil {
+		return "", 0, err
+	}
+	file.Close()
+	defer os.Remove(file.Name())
+
+	target := s.path(key)
+	if _, err := os.Stat(target); err == nil {
+		// The same bytes are already stored
+		return key, size, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0700); err != nil {
+		return "", 0, fmt.Errorf("failed to create blob directory: %v", err)
+	}
+	if err := os.Rename(file.Name(), target); err != nil {
+		return "", 0, fmt.Errorf("failed to store blob: %v", err)
+	}
+	return key, size, nil
+}
+
+// Open returns the blob's file
+func (s *LocalStore) Open(ctx context.Context, key string) (io.ReadSeekCloser, error) {
+	if !ValidKey(key) {
+		return nil, ErrNotFound
+	}
+	file, err := os.Open(s.path(key))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open blob: %v", err)
+	}
+	return file, nil
+}
+
+// Delete removes a blob from disk
+func (s *LocalStore) Delete(ctx context.Context, key string) error {
+	if !ValidKey(key) {
+		return nil
+	}
+	if err := os.Remove(s.path(key)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete blob: %v", err)
+	}
+	return nil
+}
+
+func (s *LocalStore) path(key string) string {
+	return filepath.Join(s.root, filepath.FromSlash(keyPath(key)))
+}
@@ -0,0 +1,824 @@
+package utils
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Heading describes a rendered heading, used to build a table of contents
+type Heading struct {
+	Level  int    `json:"level"`
+	Text   string `json:"text"`
+	Anchor string `json:"anchor"`
+}
+
+// RenderedMarkdown is the sanitized HTML output of a Markdown document and its headings
+type RenderedMarkdown struct {
+	HTML     string
+	Headings []Heading
+}
+
+var (
+	atxHeadingPattern     = regexp.MustCompile(`^ {0,3}(#{1,6})(?:[ \t]+(.*?))?(?:[ \t]+#+)?[ \t]*$`)
+	thematicBreakPattern  = regexp.MustCompile(`^ {0,3}(?:(?:\*[ \t]*){3,}|(?:-[ \t]*){3,}|(?:_[ \t]*){3,})$`)
+	fencePattern          = regexp.MustCompile("^( {0,3})(`{3,}|~{3,})[ \t]*([^`]*)$")
+	blockquotePattern     = regexp.MustCompile(`^ {0,3}>[ ]?`)
+	listItemPattern       = regexp.MustCompile(`^( {0,3})([-*+]|\d{1,9}[.)])(?:([ \t]+)(.*)|$)`)
+	setextH1Pattern       = regexp.MustCompile(`^ {0,3}=+[ \t]*$`)
+	setextH2Pattern       = regexp.MustCompile(`^ {0,3}-+[ \t]*$`)
+	tableDelimiterPattern = regexp.MustCompile(`^[ \t]*\|?[ \t]*:?-+:?[ \t]*(?:\|[ \t]*:?-+:?[ \t]*)*\|?[ \t]*$`)
+	htmlBlockPattern      = regexp.MustCompile(`^ {0,3}(?:<!--|</?[A-Za-z][A-Za-z0-9-]*(?:[\s/>]|$))`)
+	taskItemPattern       = regexp.MustCompile(`^\[([ xX])\](?:[ \t]+|$)`)
+	inlineHTMLPattern     = regexp.MustCompile(`^(?:<[A-Za-z][A-Za-z0-9-]*(?:\s+[^\s"'>/=]+(?:\s*=\s*(?:"[^"]*"|'[^']*'|[^\s"'=<>` + "`" + `]+))?)*\s*/?>|</[A-Za-z][A-Za-z0-9-]*\s*>|<!--[\s\S]*?-->)`)
+	autolinkPattern       = regexp.MustCompile(`^<([A-Za-z][A-Za-z0-9+.-]{1,31}:[^\s<>]*)>`)
+	emailAutolinkPattern  = regexp.MustCompile(`^<([A-Za-z0-9.!#$%&'*+/=?^_{|}~-]+@[A-Za-z0-9](?:[A-Za-z0-9-]{0,61}[A-Za-z0-9])?(?:\.[A-Za-z0-9](?:[A-Za-z0-9-]{0,61}[A-Za-z0-9])?)*)>`)
+	bareURLPattern        = regexp.MustCompile(`^(?:https?://|www\.)[^\s<]+`)
+	entityPattern         = regexp.MustCompile(`^&(?:#[0-9]{1,7}|#[xX][0-9A-Fa-f]{1,6}|[A-Za-z][A-Za-z0-9]{1,31});`)
+)
+
+// RenderMarkdown converts CommonMark with GFM tables, task lists, strikethrough and
+// autolinks into sanitized HTML. Headings get stable id anchors for the table of contents.
+func RenderMarkdown(source string) *RenderedMarkdown {
+	source = strings.ReplaceAll(source, "\r\n", "\n")
+	source = strings.ReplaceAll(source, "\r", "\n")
+	source = strings.ReplaceAll(source, "\t", "    ")
+
+	r := &markdownRenderer{anchors: make(map[string]int)}
+	rendered := r.renderBlocks(strings.Split(source, "\n"))
+
+	return &RenderedMarkdown{
+		HTML:     SanitizeHTML(rendered),
+		Headings: r.headings,
+	}
+}
+
+type markdownRenderer struct {
+	headings []Heading
+	anchors  map[string]int
+}
+
+// renderBlocks renders a sequence of lines as block-level Markdown
+func (r *markdownRenderer) renderBlocks(lines []string) string {
+	var out strings.Builder
+
+	for i := 0; i < len(lines); {
+		line := lines[i]
+
+		if strings.TrimSpace(line) == "" {
+			i++
+			continue
+		}
+
+		if m := fencePattern.FindStringSubmatch(line); m != nil {
+			i = r.renderFencedCode(&out, lines, i, m)
+			continue
+		}
+
+		if m := atxHeadingPattern.FindStringSubmatch(line); m != nil {
+			r.renderHeading(&out, len(m[1]), m[2])
+			i++
+			continue
+		}
+
+		if thematicBreakPattern.MatchString(line) {
+			out.WriteString("<hr />\n")
+			i++
+			continue
+		}
+
+		if blockquotePattern.MatchString(line) {
+			var quoted []string
+			for i < len(lines) && strings.TrimSpace(lines[i]) != "" {
+				if loc := blockquotePattern.FindStringIndex(lines[i]); loc != nil {
+					quoted = append(quoted, lines[i][loc[1]:])
+				} else {
+					// Lazy continuation of a quoted paragraph
+					quoted = append(quoted, lines[i])
+				}
+				i++
+			}
+			out.WriteString("<blockquote>\n")
+			out.WriteString(r.renderBlocks(quoted))
+			out.WriteString("</blockquote>\n")
+			continue
+		}
+
+		if listItemPattern.MatchString(line) {
+			i = r.renderList(&out, lines, i)
+			continue
+		}
+
+		if i+1 < len(lines) && strings.Contains(line, "|") && tableDelimiterPattern.MatchString(lines[i+1]) {
+			if next, ok := r.renderTable(&out, lines, i); ok {
+				i = next
+				continue
+			}
+		}
+
+		if htmlBlockPattern.MatchString(line) {
+			for i < len(lines) && strings.TrimSpace(lines[i]) != "" {
+				out.WriteString(lines[i])
+				out.WriteString("\n")
+				i++
+			}
+			continue
+		}
+
+		if strings.HasPrefix(line, "    ") {
+			i = r.renderIndentedCode(&out, lines, i)
+			continue
+		}
+
+		i = r.renderParagraph(&out, lines, i)
+	}
+
+	return out.String()
+}
+
+func (r *markdownRenderer) renderHeading(out *strings.Builder, level int, raw string) {
+	content := r.renderInline(strings.TrimSpace(raw))
+	text := strings.TrimSpace(html.UnescapeString(stripTags(content)))
+	anchor := r.anchorFor(text)
+
+	r.headings = append(r.headings, Heading{Level: level, Text: text, Anchor: anchor})
+	fmt.Fprintf(out, "<h%d id=\"%s\"><a class=\"anchor\" href=\"#%s\"></a>%s</h%d>\n", level, anchor, anchor, content, level)
+}
+
+// anchorFor builds a GitHub-style slug, de-duplicated within the document
+func (r *markdownRenderer) anchorFor(text string) string {
+	var slug strings.Builder
+	for _, c := range strings.ToLower(text) {
+		switch {
+		case unicode.IsLetter(c) || unicode.IsDigit(c) || c == '_' || c == '-':
+			slug.WriteRune(c)
+		case c == ' ':
+			slug.WriteRune('-')
+		}
+	}
+
+	anchor := slug.String()
+	if anchor == "" {
+		anchor = "section"
+	}
+	if count, ok := r.anchors[anchor]; ok {
+		r.anchors[anchor] = count + 1
+		anchor = anchor + "-" + strconv.Itoa(count+1)
+	}
+	r.anchors[anchor] = 0
+	return anchor
+}
+
+func (r *markdownRenderer) renderFencedCode(out *strings.Builder, lines []string, start int, m []string) int {
+	indent := len(m[1])
+	fence := m[2]
+	info := strings.Fields(html.UnescapeString(m[3]))
+
+	var code []string
+	i := start + 1
+	for ; i < len(lines); i++ {
+		trimmed := strings.TrimLeft(lines[i], " ")
+		if len(lines[i])-len(trimmed) <= 3 && strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]+" ") == "" {
+			i++
+			break
+		}
+		line := lines[i]
+		for n := 0; n < indent && strings.HasPrefix(line, " "); n++ {
+			line = line[1:]
+		}
+		code = append(code, line)
+	}
+
+	out.WriteString("<pre><code")
+	if len(info) > 0 {
+		fmt.Fprintf(out, " class=\"language-%s\"", html.EscapeString(info[0]))
+	}
+	out.WriteString(">")
+	for _, line := range code {
+		out.WriteString(html.EscapeString(line))
+		out.WriteString("\n")
+	}
+	out.WriteString("</code></pre>\n")
+	return i
+}
+
+func (r *markdownRenderer) renderIndentedCode(out *strings.Builder, lines []string, start int) int {
+	var code []string
+	i := start
+	for ; i < len(lines); i++ {
+		if strings.HasPrefix(lines[i], "    ") {
+			code = append(code, lines[i][4:])
+		} else if strings.TrimSpace(lines[i]) == "" {
+			code = append(code, "")
+		} else {
+			break
+		}
+	}
+	for len(code) > 0 && code[len(code)-1] == "" {
+		code = code[:len(code)-1]
+	}
+
+	out.WriteString("<pre><code>")
+	for _, line := range code {
+		out.WriteString(html.EscapeString(line))
+		out.WriteString("\n")
+	}
+	out.WriteString("</code></pre>\n")
+	return i
+}
+
+func (r *markdownRenderer) renderParagraph(out *strings.Builder, lines []string, start int) int {
+	paragraph := []string{strings.TrimLeft(lines[start], " ")}
+	i := start + 1
+	for ; i < len(lines); i++ {
+		line := lines[i]
+		if strings.TrimSpace(line) == "" {
+			break
+		}
+		if setextH1Pattern.MatchString(line) {
+			r.renderHeading(out, 1, strings.Join(paragraph, "\n"))
+			return i + 1
+		}
+		if setextH2Pattern.MatchString(line) {
+			r.renderHeading(out, 2, strings.Join(paragraph, "\n"))
+			return i + 1
+		}
+		if interruptsParagraph(line) {
+			break
+		}
+		paragraph = append(paragraph, strings.TrimLeft(line, " "))
+	}
+
+	out.WriteString("<p>")
+	out.WriteString(r.renderInline(strings.TrimRight(strings.Join(paragraph, "\n"), " ")))
+	out.WriteString("</p>\n")
+	return i
+}
+
+// interruptsParagraph reports whether line starts a block that may interrupt a paragraph
+func interruptsParagraph(line string) bool {
+	if atxHeadingPattern.MatchString(line) || thematicBreakPattern.MatchString(line) ||
+		fencePattern.MatchString(line) || blockquotePattern.MatchString(line) || htmlBlockPattern.MatchString(line) {
+		return true
+	}
+	if m := listItemPattern.FindStringSubmatch(line); m != nil && strings.TrimSpace(m[4]) != "" {
+		// Ordered lists only interrupt a paragraph when they start at 1
+		if unicode.IsDigit(rune(m[2][0])) {
+			return strings.TrimLeft(m[2][:len(m[2])-1], "0") == "1"
+		}
+		return true
+	}
+	return false
+}
+
+type listItem struct {
+	lines []string
+	task  string
+}
+
+func (r *markdownRenderer) renderList(out *strings.Builder, lines []string, start int) int {
+	first := listItemPattern.FindStringSubmatch(lines[start])
+	ordered := unicode.IsDigit(rune(first[2][0]))
+	delimiter := first[2][len(first[2])-1:]
+	startNumber := 1
+	if ordered {
+		startNumber, _ = strconv.Atoi(first[2][:len(first[2])-1])
+	}
+
+	// continuesList reports whether line is another item of this list
+	continuesList := func(line string) bool {
+		m := listItemPattern.FindStringSubmatch(line)
+		return m != nil && unicode.IsDigit(rune(m[2][0])) == ordered && m[2][len(m[2])-1:] == delimiter && !thematicBreakPattern.MatchString(line)
+	}
+
+	var items []listItem
+	loose := false
+	i := start
+	for i < len(lines) {
+		if !continuesList(lines[i]) {
+			break
+		}
+		m := listItemPattern.FindStringSubmatch(lines[i])
+
+		// Content starts after the marker and up to four spaces of padding
+		contentIndent := len(m[1]) + len(m[2]) + 1
+		if len(m[3]) > 1 && len(m[3]) <= 4 {
+			contentIndent = len(m[1]) + len(m[2]) + len(m[3])
+		}
+		item := listItem{lines: []string{m[4]}}
+		if len(m[3]) > 4 {
+			item.lines[0] = strings.Repeat(" ", len(m[3])-1) + m[4]
+		}
+		i++
+
+		blankBefore := false
+		for i < len(lines) {
+			line := lines[i]
+			if strings.TrimSpace(line) == "" {
+				blankBefore = true
+				item.lines = append(item.lines, "")
+				i++
+				continue
+			}
+			indent := len(line) - len(strings.TrimLeft(line, " "))
+			if indent >= contentIndent {
+				if blankBefore {
+					loose = true
+				}
+				item.lines = append(item.lines, line[contentIndent:])
+				blankBefore = false
+				i++
+				continue
+			}
+			if !blankBefore && !interruptsParagraph(line) && !listItemPattern.MatchString(line) {
+				// Lazy paragraph continuation
+				item.lines = append(item.lines, strings.TrimLeft(line, " "))
+				i++
+				continue
+			}
+			break
+		}
+
+		// Trailing blank lines belong between items, not inside them
+		trailing := 0
+		for len(item.lines) > 0 && item.lines[len(item.lines)-1] == "" {
+			item.lines = item.lines[:len(item.lines)-1]
+			trailing++
+		}
+		if trailing > 0 && i < len(lines) && continuesList(lines[i]) {
+			loose = true
+		}
+		if trailing > 0 {
+			i -= trailing
+			for i < len(lines) && strings.TrimSpace(lines[i]) == "" {
+				i++
+			}
+		}
+
+		if tm := taskItemPattern.FindStringSubmatch(item.lines[0]); tm != nil {
+			item.task = tm[1]
+			item.lines[0] = item.lines[0][len(tm[0]):]
+		}
+		items = append(items, item)
+
+		if trailing > 0 && (i >= len(lines) || !continuesList(lines[i])) {
+			break
+		}
+	}
+
+	hasTasks := false
+	for _, item := range items {
+		if item.task != "" {
+			hasTasks = true
+		}
+	}
+
+	tag := "ul"
+	if ordered {
+		tag = "ol"
+	}
+	out.WriteString("<" + tag)
+	if ordered && startNumber != 1 {
+		fmt.Fprintf(out, " start=\"%d\"", startNumber)
+	}
+	if hasTasks {
+		out.WriteString(" class=\"contains-task-list\"")
+	}
+	out.WriteString(">\n")
+
+	for _, item := range items {
+		if item.task != "" {
+			out.WriteString("<li class=\"task-list-item\"><input type=\"checkbox\" disabled")
+			if item.task != " " {
+				out.WriteString(" checked")
+			}
+			out.WriteString(" /> ")
+		} else {
+			out.WriteString("<li>")
+		}
+
+		body := r.renderBlocks(item.lines)
+		if !loose {
+			body = unwrapTightParagraphs(body)
+		}
+		out.WriteString(strings.TrimSuffix(body, "\n"))
+		out.WriteString("</li>\n")
+	}
+	out.WriteString("</" + tag + ">\n")
+	return i
+}
+
+// unwrapTightParagraphs removes the <p> wrappers a tight list item does not render
+func unwrapTightParagraphs(body string) string {
+	var out strings.Builder
+	for _, line := range strings.SplitAfter(body, "\n") {
+		if strings.HasPrefix(line, "<p>") && strings.HasSuffix(strings.TrimSuffix(line, "\n"), "</p>") {
+			trimmed := strings.TrimSuffix(line, "\n")
+			out.WriteString(trimmed[3 : len(trimmed)-4])
+			if strings.HasSuffix(line, "\n") {
+				out.WriteString("\n")
+			}
+			continue
+		}
+		out.WriteString(line)
+	}
+	return out.String()
+}
+
+func (r *markdownRenderer) renderTable(out *strings.Builder, lines []string, start int) (int, bool) {
+	header := splitTableRow(lines[start])
+	delimiters := splitTableRow(lines[start+1])
+	if len(header) != len(delimiters) {
+		return start, false
+	}
+
+	aligns := make([]string, len(delimiters))
+	for n, cell := range delimiters {
+		cell = strings.TrimSpace(cell)
+		left := strings.HasPrefix(cell, ":")
+		right := strings.HasSuffix(cell, ":")
+		switch {
+		case left && right:
+			aligns[n] = "center"
+		case right:
+			aligns[n] = "right"
+		case left:
+			aligns[n] = "left"
+		}
+	}
+
+	writeRow := func(cells []string, tag string) {
+		out.WriteString("<tr>\n")
+		for n := range aligns {
+			out.WriteString("<" + tag)
+			if aligns[n] != "" {
+				fmt.Fprintf(out, " align=\"%s\"", aligns[n])
+			}
+			out.WriteString(">")
+			if n < len(cells) {
+				out.WriteString(r.renderInline(strings.TrimSpace(cells[n])))
+			}
+			out.WriteString("</" + tag + ">\n")
+		}
+		out.WriteString("</tr>\n")
+	}
+
+	out.WriteString("<table>\n<thead>\n")
+	writeRow(header, "th")
+	out.WriteString("</thead>\n")
+
+	i := start + 2
+	if i < len(lines) && strings.TrimSpace(lines[i]) != "" && strings.Contains(lines[i], "|") {
+		out.WriteString("<tbody>\n")
+		for ; i < len(lines); i++ {
+			if strings.TrimSpace(lines[i]) == "" || !strings.Contains(lines[i], "|") || interruptsParagraph(lines[i]) {
+				break
+			}
+			writeRow(splitTableRow(lines[i]), "td")
+		}
+		out.WriteString("</tbody>\n")
+	}
+	out.WriteString("</table>\n")
+	return i, true
+}
+
+// splitTableRow splits a GFM table row on unescaped pipes
+func splitTableRow(line string) []string {
+	line = strings.TrimSpace(line)
+	line = strings.TrimPrefix(line, "|")
+	if strings.HasSuffix(line, "|") && !strings.HasSuffix(line, `\|`) {
+		line = line[:len(line)-1]
+	}
+
+	var cells []string
+	var cell strings.Builder
+	for i := 0; i < len(line); i++ {
+		if line[i] == '\\' && i+1 < len(line) && line[i+1] == '|' {
+			cell.WriteByte('|')
+			i++
+			continue
+		}
+		if line[i] == '|' {
+			cells = append(cells, cell.String())
+			cell.Reset()
+			continue
+		}
+		cell.WriteByte(line[i])
+	}
+	return append(cells, cell.String())
+}
+
+// renderInline renders inline Markdown: code spans, emphasis, links, images, autolinks and raw HTML
+func (r *markdownRenderer) renderInline(text string) string {
+	var out strings.Builder
+
+	for i := 0; i < len(text); {
+		c := text[i]
+		switch {
+		case c == '\\' && i+1 < len(text):
+			next := text[i+1]
+			if next == '\n' {
+				out.WriteString("<br />\n")
+				i += 2
+				continue
+			}
+			if strings.IndexByte("!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~", next) >= 0 {
+				out.WriteString(html.EscapeString(string(next)))
+				i += 2
+				continue
+			}
+
+		case c == '`':
+			run := countRun(text[i:], '`')
+			if end := findClosingRun(text[i+run:], "`", run); end >= 0 {
+				code := strings.ReplaceAll(text[i+run:i+run+end], "\n", " ")
+				if len(code) > 2 && code[0] == ' ' && code[len(code)-1] == ' ' && strings.TrimSpace(code) != "" {
+					code = code[1 : len(code)-1]
+				}
+				out.WriteString("<code>" + html.EscapeString(code) + "</code>")
+				i += run + end + run
+				continue
+			}
+			out.WriteString(text[i : i+run])
+			i += run
+			continue
+
+		case c == '!' && strings.HasPrefix(text[i+1:], "["):
+			if label, dest, title, length, ok := parseLink(text[i+1:]); ok {
+				alt := html.UnescapeString(stripTags(r.renderInline(label)))
+				fmt.Fprintf(&out, "<img src=\"%s\" alt=\"%s\"", html.EscapeString(dest), html.EscapeString(alt))
+				if title != "" {
+					fmt.Fprintf(&out, " title=\"%s\"", html.EscapeString(title))
+				}
+				out.WriteString(" />")
+				i += 1 + length
+				continue
+			}
+
+		case c == '[':
+			if label, dest, title, length, ok := parseLink(text[i:]); ok {
+				fmt.Fprintf(&out, "<a href=\"%s\"", html.EscapeString(dest))
+				if title != "" {
+					fmt.Fprintf(&out, " title=\"%s\"", html.EscapeString(title))
+				}
+				out.WriteString(">" + r.renderInline(label) + "</a>")
+				i += length
+				continue
+			}
+
+		case c == '<':
+			if m := autolinkPattern.FindStringSubmatch(text[i:]); m != nil {
+				fmt.Fprintf(&out, "<a href=\"%s\">%s</a>", html.EscapeString(m[1]), html.EscapeString(m[1]))
+				i += len(m[0])
+				continue
+			}
+			if m := emailAutolinkPattern.FindStringSubmatch(text[i:]); m != nil {
+				fmt.Fprintf(&out, "<a href=\"mailto:%s\">%s</a>", html.EscapeString(m[1]), html.EscapeString(m[1]))
+				i += len(m[0])
+				continue
+			}
+			if m := inlineHTMLPattern.FindString(text[i:]); m != "" {
+				// Raw HTML is passed through and sanitized with the rest of the output
+				out.WriteString(m)
+				i += len(m)
+				continue
+			}
+
+		case c == '&':
+			if m := entityPattern.FindString(text[i:]); m != "" {
+				out.WriteString(m)
+				i += len(m)
+				continue
+			}
+
+		case (c == 'h' || c == 'w') && (i == 0 || !isWordByte(text[i-1])):
+			if m := bareURLPattern.FindString(text[i:]); m != "" {
+				m = trimAutolink(m)
+				href := m
+				if strings.HasPrefix(m, "www.") {
+					href = "http://" + m
+				}
+				fmt.Fprintf(&out, "<a href=\"%s\">%s</a>", html.EscapeString(href), html.EscapeString(m))
+				i += len(m)
+				continue
+			}
+
+		case c == '*' || c == '_' || c == '~':
+			if rendered, length, ok := r.renderEmphasis(text, i); ok {
+				out.WriteString(rendered)
+				i += length
+				continue
+			}
+			run := countRun(text[i:], c)
+			out.WriteString(text[i : i+run])
+			i += run
+			continue
+
+		case c == ' ':
+			run := countRun(text[i:], ' ')
+			if i+run < len(text) && text[i+run] == '\n' {
+				// Two trailing spaces make a hard line break; fewer are dropped
+				if run >= 2 {
+					out.WriteString("<br />")
+				}
+				i += run
+				continue
+			}
+			out.WriteString(text[i : i+run])
+			i += run
+			continue
+
+		case c == '\n':
+			out.WriteString("\n")
+			i++
+			for i < len(text) && text[i] == ' ' {
+				i++
+			}
+			continue
+		}
+
+		// One byte at a time: converting it to a string on its own would split multi-byte runes
+		out.WriteString(html.EscapeString(text[i : i+1]))
+		i++
+	}
+
+	return out.String()
+}
+
+// renderEmphasis handles *em*, **strong**, _em_, __strong__ and ~~strikethrough~~ starting at text[i]
+func (r *markdownRenderer) renderEmphasis(text string, i int) (string, int, bool) {
+	c := text[i]
+	run := countRun(text[i:], c)
+	if i+run >= len(text) || text[i+run] == ' ' || text[i+run] == '\n' {
+		return "", 0, false
+	}
+	// Underscores never open emphasis inside a word
+	if c == '_' && i > 0 && isWordByte(text[i-1]) {
+		return "", 0, false
+	}
+
+	var size int
+	var tag string
+	switch {
+	case c == '~':
+		if run != 2 {
+			return "", 0, false
+		}
+		size, tag = 2, "del"
+	case run >= 2:
+		size, tag = 2, "strong"
+	default:
+		size, tag = 1, "em"
+	}
+
+	delimiter := strings.Repeat(string(c), size)
+	for offset := i + size; offset < len(text); {
+		end := strings.Index(text[offset:], delimiter)
+		if end < 0 {
+			return "", 0, false
+		}
+		end += offset
+		closingRun := countRun(text[end:], c)
+		prev := text[end-1]
+		afterOK := c != '_' || end+closingRun >= len(text) || !isWordByte(text[end+closingRun])
+		if end > i+size && prev != ' ' && prev != '\n' && afterOK && (size == 2 || closingRun != 2 || run >= 2) {
+			inner := r.renderInline(text[i+size : end])
+			return "<" + tag + ">" + inner + "</" + tag + ">", end + size - i, true
+		}
+		offset = end + closingRun
+	}
+	return "", 0, false
+}
+
+// parseLink parses "[label](destination "title")" at the start of text
+func parseLink(text string) (label, dest, title string, length int, ok bool) {
+	depth := 0
+	closeBracket := -1
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '\\':
+			i++
+		case '[':
+			depth++
+		case ']':
+			depth--
+			if depth == 0 {
+				closeBracket = i
+			}
+		}
+		if closeBracket >= 0 {
+			break
+		}
+	}
+	if closeBracket < 0 || closeBracket+1 >= len(text) || text[closeBracket+1] != '(' {
+		return "", "", "", 0, false
+	}
+
+	rest := text[closeBracket+2:]
+	depth = 1
+	closeParen := -1
+	for i := 0; i < len(rest) && closeParen < 0; i++ {
+		switch rest[i] {
+		case '\\':
+			i++
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				closeParen = i
+			}
+		}
+	}
+	if closeParen < 0 {
+		return "", "", "", 0, false
+	}
+
+	inside := strings.TrimSpace(rest[:closeParen])
+	if strings.HasPrefix(inside, "<") {
+		if end := strings.IndexByte(inside, '>'); end > 0 {
+			dest = inside[1:end]
+			inside = strings.TrimSpace(inside[end+1:])
+		}
+	} else if sp := strings.IndexAny(inside, " \n"); sp >= 0 {
+		dest = inside[:sp]
+		inside = strings.TrimSpace(inside[sp:])
+	} else {
+		dest = inside
+		inside = ""
+	}
+
+	if inside != "" {
+		if len(inside) < 2 {
+			return "", "", "", 0, false
+		}
+		open, close := inside[0], inside[len(inside)-1]
+		if !((open == '"' && close == '"') || (open == '\'' && close == '\'') || (open == '(' && close == ')')) {
+			return "", "", "", 0, false
+		}
+		title = html.UnescapeString(inside[1 : len(inside)-1])
+	}
+
+	return text[1:closeBracket], html.UnescapeString(dest), title, closeBracket + 2 + closeParen + 1, true
+}
+
+// trimAutolink drops trailing punctuation and unbalanced closing parentheses from a bare URL
+func trimAutolink(url string) string {
+	for len(url) > 0 {
+		last := url[len(url)-1]
+		if strings.IndexByte("?!.,:*_~'\"", last) >= 0 {
+			url = url[:len(url)-1]
+			continue
+		}
+		if last == ')' && strings.Count(url, "(") < strings.Count(url, ")") {
+			url = url[:len(url)-1]
+			continue
+		}
+		break
+	}
+	return url
+}
+
+// findClosingRun finds a run of exactly n delimiters in text
+func findClosingRun(text, delimiter string, n int) int {
+	for offset := 0; offset < len(text); {
+		idx := strings.Index(text[offset:], delimiter)
+		if idx < 0 {
+			return -1
+		}
+		idx += offset
+		run := countRun(text[idx:], delimiter[0])
+		if run == n {
+			return idx
+		}
+		offset = idx + run
+	}
+	return -1
+}
+
+func countRun(text string, c byte) int {
+	n := 0
+	for n < len(text) && text[n] == c {
+		n++
+	}
+	return n
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c >= 0x80 || unicode.IsLetter(rune(c)) || unicode.IsDigit(rune(c))
+}
+
+var tagPattern = regexp.MustCompile(`<[^>]*>`)
+
+// stripTags removes HTML tags from rendered inline content
+func stripTags(s string) string {
+	return tagPattern.ReplaceAllString(s, "")
+}
+
+// PlainText strips HTML tags and decodes entities, for indexing and snippets
+func PlainText(s string) string {
+	return html.UnescapeString(stripTags(s))
+}
@@ -0,0 +1,56 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRenderMarkdown(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"setext heading", "Setext\n===", `<h1 id="setext"><a class="anchor" href="#setext"></a>Setext</h1>` + "\n"},
+		{"emphasis", "*em* **strong** ~~del~~ `code`", "<p><em>em</em> <strong>strong</strong> <del>del</del> <code>code</code></p>\n"},
+		{"escaped emphasis", `\*not em\*`, "<p>*not em*</p>\n"},
+		{"text escaping", "a & b < c", "<p>a &amp; b &lt; c</p>\n"},
+		{"hard break", "a\\\nb", "<p>a<br />\nb</p>\n"},
+		{"thematic break", "***", "<hr />\n"},
+		{"link", `[link](https://x.com "T")`, `<p><a href="https://x.com" title="T" rel="nofollow noopener noreferrer">link</a></p>` + "\n"},
+		{"image", "![alt](a.png)", `<p><img src="a.png" alt="alt" /></p>` + "\n"},
+		{"bare URL", "https://example.com/a", `<p><a href="https://example.com/a" rel="nofollow noopener noreferrer">https://example.com/a</a></p>` + "\n"},
+		{"autolink", "<https://x.com>", `<p><a href="https://x.com" rel="nofollow noopener noreferrer">https://x.com</a></p>` + "\n"},
+		{"bullet list", "- a\n- b", "<ul>\n<li>a</li>\n<li>b</li>\n</ul>\n"},
+		{"ordered list", "1. a\n2. b", "<ol>\n<li>a</li>\n<li>b</li>\n</ol>\n"},
+		{"ordered list start", "3. a", "<ol start=\"3\">\n<li>a</li>\n</ol>\n"},
+		{"task list", "- [ ] todo\n- [x] done", `<ul class="contains-task-list">` + "\n" +
+			`<li class="task-list-item"><input type="checkbox" disabled /> todo</li>` + "\n" +
+			`<li class="task-list-item"><input type="checkbox" disabled checked /> done</li>` + "\n</ul>\n"},
+		{"blockquote", "> quote", "<blockquote>\n<p>quote</p>\n</blockquote>\n"},
+		{"fenced code", "```go\nx := 1 < 2\n```", `<pre><code class="language-go">x := 1 &lt; 2` + "\n</code></pre>\n"},
+		{"indented code", "    code", "<pre><code>code\n</code></pre>\n"},
+		{"table", "| a | b |\n|:--|--:|\n| 1 | 2 |", "<table>\n<thead>\n<tr>\n" +
+			`<th align="left">a</th>` + "\n" + `<th align="right">b</th>` + "\n</tr>\n</thead>\n<tbody>\n<tr>\n" +
+			`<td align="left">1</td>` + "\n" + `<td align="right">2</td>` + "\n</tr>\n</tbody>\n</table>\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RenderMarkdown(tt.input).HTML; got != tt.want {
+				t.Errorf("RenderMarkdown(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderMarkdownHeadings(t *testing.T) {
+	rendered := RenderMarkdown("# Title\n## Title\n### Ünïcode & *Marks*!\n")
+	want := []Heading{
+		{Level: 1, Text: "Title", Anchor: "title"},
+		{Level: 2, Text: "Title", Anchor: "title-1"},
+		{Level: 3, Text: "Ünïcode & Marks!", Anchor: "ünïcode--marks"},
+	}
+	if !reflect.DeepEqual(rendered.Headings, want) {
+		t.Errorf("Headings = %+v, want %+v", rendered.Headings, want)
+	}
+}
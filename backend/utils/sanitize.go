@@ -0,0 +1,426 @@
+package utils
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+// allowedTags maps each permitted HTML element to the attributes it may carry
+var allowedTags = map[string]map[string]bool{
+	"a":          {"href": true, "title": true, "class": true},
+	"abbr":       {"title": true},
+	"b":          {},
+	"blockquote": {},
+	"br":         {},
+	"code":       {"class": true},
+	"del":        {},
+	"div":        {},
+	"em":         {},
+	"h1":         {"id": true},
+	"h2":         {"id": true},
+	"h3":         {"id": true},
+	"h4":         {"id": true},
+	"h5":         {"id": true},
+	"h6":         {"id": true},
+	"hr":         {},
+	"i":          {},
+	"img":        {"src": true, "alt": true, "title": true, "width": true, "height": true},
+	"input":      {"type": true, "checked": true, "disabled": true},
+	"kbd":        {},
+	"li":         {"class": true},
+	"mark":       {},
+	"ol":         {"start": true},
+	"p":          {},
+	"pre":        {},
+	"s":          {},
+	"span":       {},
+	"strong":     {},
+	"sub":        {},
+	"sup":        {},
+	"table":      {},
+	"tbody":      {},
+	"td":         {"align": true},
+	"th":         {"align": true},
+	"thead":      {},
+	"tr":         {},
+	"u":          {},
+	"ul":         {"class": true},
+}
+
+// droppedContentTags are removed together with everything they contain
+var droppedContentTags = map[string]bool{
+	"script":   true,
+	"style":    true,
+	"iframe":   true,
+	"object":   true,
+	"embed":    true,
+	"noscript": true,
+	"template": true,
+	"textarea": true,
+	"select":   true,
+	"title":    true,
+	"xmp":      true,
+	"noembed":  true,
+	"frameset": true,
+}
+
+var (
+	tagNamePattern    = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9-]*`)
+	attributePattern  = regexp.MustCompile(`([^\s"'>/=]+)(?:\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'=<>` + "`" + `]+)))?`)
+	safeClassPattern  = regexp.MustCompile(`^[A-Za-z0-9 _-]*$`)
+	safeNumberPattern = regexp.MustCompile(`^[0-9]{1,5}%?$`)
+	safeDataImage     = regexp.MustCompile(`^data:image/(png|jpe?g|gif|webp);base64,[A-Za-z0-9+/=\s]+$`)
+)
+
+// SanitizeHTML removes every HTML element and attribute that is not on the allowlist.
+// Text outside of tags is left untouched.
+func SanitizeHTML(input string) string {
+	var out strings.Builder
+	out.Grow(len(input))
+
+	i := 0
+	for i < len(input) {
+		lt := strings.IndexByte(input[i:], '<')
+		if lt < 0 {
+			out.WriteString(input[i:])
+			break
+		}
+		out.WriteString(input[i : i+lt])
+		i += lt
+
+		rest := input[i:]
+		switch {
+		case strings.HasPrefix(rest, "<!--"):
+			end := strings.Index(rest[4:], "-->")
+			if end < 0 {
+				return out.String()
+			}
+			i += 4 + end + 3
+			continue
+		case strings.HasPrefix(rest, "<!") || strings.HasPrefix(rest, "<?"):
+			end := strings.IndexByte(rest, '>')
+			if end < 0 {
+				return out.String()
+			}
+			i += end + 1
+			continue
+		}
+
+		closing := strings.HasPrefix(rest, "</")
+		nameStart := 1
+		if closing {
+			nameStart = 2
+		}
+		name := tagNamePattern.FindString(rest[nameStart:])
+		if name == "" {
+			// Not a tag, e.g. "a < b", which browsers also treat as text
+			out.WriteString("<")
+			i++
+			continue
+		}
+
+		end := findTagEnd(rest)
+		if end < 0 {
+			// Unterminated tag: escape it rather than letting a browser recover it
+			out.WriteString("&lt;")
+			i++
+			continue
+		}
+
+		lowerName := strings.ToLower(name)
+		rawAttributes := rest[nameStart+len(name) : end]
+		i += end + 1
+
+		if droppedContentTags[lowerName] {
+			if !closing {
+				i = skipElementContent(input, i, lowerName)
+			}
+			continue
+		}
+
+		attributes, ok := allowedTags[lowerName]
+		if !ok {
+			continue
+		}
+
+		if closing {
+			out.WriteString("</" + lowerName + ">")
+			continue
+		}
+
+		sanitized := sanitizeAttributes(lowerName, rawAttributes, attributes)
+		if lowerName == "input" && sanitized == "" {
+			// Only task list checkboxes are allowed through
+			continue
+		}
+
+		out.WriteString("<" + lowerName)
+		out.WriteString(sanitized)
+		if strings.HasSuffix(strings.TrimSpace(rawAttributes), "/") {
+			out.WriteString(" /")
+		}
+		out.WriteString(">")
+	}
+
+	return out.String()
+}
+
+// SanitizeMarkdown sanitizes the HTML in Markdown source as SanitizeHTML does, for content that
+// is stored and returned as written. Code blocks and code spans are kept as they are: Markdown
+// renders them as text, and sanitizing them would mangle code such as "Vec<T>".
+func SanitizeMarkdown(source string) string {
+	var out, text strings.Builder
+	flush := func() {
+		out.WriteString(sanitizeMarkdownText(text.String()))
+		text.Reset()
+	}
+
+	lines := strings.SplitAfter(source, "\n")
+	inList := false    // The last block started with a list item
+	afterBlank := true // The previous line was blank, so an indented line starts code
+	for i := 0; i < len(lines); {
+		line := strings.ReplaceAll(strings.TrimRight(lines[i], "\r\n"), "\t", "    ")
+		content := strings.TrimLeft(blockquotePrefix.ReplaceAllString(line, ""), " ")
+		if m := listItemPattern.FindStringSubmatch(content); m != nil {
+			// A list item may start with a fence
+			content, inList = m[4], true
+		}
+
+		if fence := fenceOpening(line, content, inList); fence != "" {
+			flush()
+			end := i + 1
+			for end < len(lines) && !closesFence(lines[end], fence) {
+				end++
+			}
+			if end < len(lines) {
+				end++
+			}
+			// An unclosed fence runs to the end of the document, as it renders
+			out.WriteString(strings.Join(lines[i:end], ""))
+			i = end
+			afterBlank = false
+			continue
+		}
+		if afterBlank && !inList && strings.HasPrefix(line, "    ") && strings.TrimSpace(line) != "" {
+			flush()
+			for i < len(lines) && (strings.HasPrefix(strings.ReplaceAll(lines[i], "\t", "    "), "    ") || strings.TrimSpace(lines[i]) == "") {
+				out.WriteString(lines[i])
+				i++
+			}
+			afterBlank = true
+			continue
+		}
+
+		switch {
+		case strings.TrimSpace(line) == "":
+			afterBlank = true
+		case listItemPattern.MatchString(line):
+			inList, afterBlank = true, false
+		default:
+			if !strings.HasPrefix(line, " ") {
+				inList = false
+			}
+			afterBlank = false
+		}
+		text.WriteString(lines[i])
+		i++
+	}
+	flush()
+	return out.String()
+}
+
+// blockquotePrefix matches the quote markers starting a line
+var blockquotePrefix = regexp.MustCompile(`^(?: {0,3}>[ ]?)+`)
+
+// fenceOpening returns the fence a line opens a code block with, or "". Fences are indented by
+// at most three spaces, except inside list items, whose content is indented further.
+func fenceOpening(line, content string, inList bool) string {
+	if !strings.HasPrefix(content, "```") && !strings.HasPrefix(content, "~~~") {
+		return ""
+	}
+	if !inList && !fencePattern.MatchString(blockquotePrefix.ReplaceAllString(line, "")) {
+		return ""
+	}
+	fence := content[:countRun(content, content[0])]
+	if fence[0] == '`' && strings.Contains(content[len(fence):], "`") {
+		// Backticks in the info string make it inline code instead
+		return ""
+	}
+	return fence
+}
+
+// closesFence reports whether line closes a code block opened with fence
+func closesFence(line, fence string) bool {
+	line = strings.TrimSpace(blockquotePrefix.ReplaceAllString(strings.TrimRight(line, "\r\n"), ""))
+	return strings.HasPrefix(line, fence) && strings.Trim(line, fence[:1]) == ""
+}
+
+// sanitizeMarkdownText sanitizes Markdown text outside of code blocks, keeping code spans.
+// A tag cut in two by a code span is left unterminated, which SanitizeHTML escapes.
+func sanitizeMarkdownText(text string) string {
+	var out strings.Builder
+	written := 0
+	for i := 0; i < len(text); {
+		switch text[i] {
+		case '\\':
+			i += 2
+			continue
+		case '`':
+		default:
+			i++
+			continue
+		}
+		run := countRun(text[i:], '`')
+		end := findClosingRun(text[i+run:], "`", run)
+		if end < 0 {
+			i += run
+			continue
+		}
+		out.WriteString(SanitizeHTML(text[written:i]))
+		out.WriteString(text[i : i+run+end+run])
+		i += run + end + run
+		written = i
+	}
+	if written < len(text) {
+		out.WriteString(SanitizeHTML(text[written:]))
+	}
+	return out.String()
+}
+
+// findTagEnd returns the index of the '>' closing the tag at the start of s, honoring quotes
+func findTagEnd(s string) int {
+	var quote byte
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '>':
+			return i
+		case c == '<':
+			return -1
+		}
+	}
+	return -1
+}
+
+// skipElementContent returns the position just after the closing tag of name. An element that
+// is never closed, such as "<title>" mentioned in prose, only loses its opening tag; the text
+// after it is kept and sanitized like any other.
+func skipElementContent(input string, from int, name string) int {
+	lower := strings.ToLower(input[from:])
+	idx := strings.Index(lower, "</"+name)
+	if idx < 0 {
+		return from
+	}
+	end := strings.IndexByte(lower[idx:], '>')
+	if end < 0 {
+		return from
+	}
+	return from + idx + end + 1
+}
+
+// sanitizeAttributes keeps only allowed attributes with safe values and re-serializes them
+func sanitizeAttributes(tag, raw string, allowed map[string]bool) string {
+	var out strings.Builder
+	seen := make(map[string]bool)
+	hrefValue := ""
+
+	for _, match := range attributePattern.FindAllStringSubmatch(raw, -1) {
+		name := strings.ToLower(match[1])
+		if !allowed[name] || seen[name] {
+			continue
+		}
+		value := html.UnescapeString(match[2] + match[3] + match[4])
+
+		switch name {
+		case "href":
+			if !isSafeURL(value, false) {
+				continue
+			}
+		case "src":
+			if !isSafeURL(value, true) {
+				continue
+			}
+		case "class", "id":
+			if !safeClassPattern.MatchString(value) {
+				continue
+			}
+		case "width", "height", "start":
+			if !safeNumberPattern.MatchString(value) {
+				continue
+			}
+		case "align":
+			value = strings.ToLower(value)
+			if value != "left" && value != "right" && value != "center" {
+				continue
+			}
+		case "type":
+			if tag != "input" || strings.ToLower(value) != "checkbox" {
+				continue
+			}
+			value = "checkbox"
+		}
+		seen[name] = true
+		if name == "href" {
+			hrefValue = value
+		}
+
+		if tag == "input" && name != "type" {
+			// Boolean attributes on task list checkboxes
+			out.WriteString(" " + name)
+			continue
+		}
+		out.WriteString(" " + name + `="` + html.EscapeString(value) + `"`)
+	}
+
+	// Task list checkboxes are always rendered read-only
+	if tag == "input" {
+		if !seen["type"] {
+			return ""
+		}
+		if !seen["disabled"] {
+			out.WriteString(" disabled")
+		}
+	}
+	if tag == "a" && seen["href"] && !strings.HasPrefix(hrefValue, "#") {
+		out.WriteString(` rel="nofollow noopener noreferrer"`)
+	}
+
+	return out.String()
+}
+
+// isSafeURL accepts relative URLs and http(s)/mailto links. Images may also use inline raster data URIs.
+func isSafeURL(value string, image bool) bool {
+	cleaned := strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f || r == ' ' {
+			return -1
+		}
+		return r
+	}, value)
+	lower := strings.ToLower(cleaned)
+
+	colon := strings.IndexByte(lower, ':')
+	if colon < 0 {
+		return true
+	}
+	// A colon after a path, query or fragment separator is not a scheme
+	if sep := strings.IndexAny(lower, "/?#"); sep >= 0 && sep < colon {
+		return true
+	}
+
+	switch lower[:colon] {
+	case "http", "https":
+		return true
+	case "mailto":
+		return !image
+	case "data":
+		return image && safeDataImage.MatchString(lower)
+	}
+	return false
+}
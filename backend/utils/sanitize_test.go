@@ -0,0 +1,113 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSanitizeHTML(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"plain text", "a < b and c > d", "a < b and c > d"},
+		{"allowed tags", "<p><strong>bold</strong> <em>it</em></p>", "<p><strong>bold</strong> <em>it</em></p>"},
+		{"script", "before<script>alert(1)</script>after", "beforeafter"},
+		{"script in capitals", "<SCRIPT>alert(1)</SCRIPT>ok", "ok"},
+		{"unclosed script", "Use the <script> tag to", "Use the  tag to"},
+		{"unclosed title keeps the rest", "Use the <title> tag. More text", "Use the  tag. More text"},
+		{"nested dropped tags", "<div><style>p{}</style><iframe src=x></iframe>text</div>", "<div>text</div>"},
+		{"unknown tag", "<custom>text</custom>", "text"},
+		{"event attribute", `<img src="a.png" onerror="alert(1)">`, `<img src="a.png">`},
+		{"event attribute unquoted", `<p onclick=alert(1)>x</p>`, `<p>x</p>`},
+		{"style attribute", `<span style="background:url(x)">x</span>`, `<span>x</span>`},
+		{"javascript link", `<a href="javascript:alert(1)">x</a>`, `<a>x</a>`},
+		{"javascript link in capitals", `<a href="JaVaScRiPt:alert(1)">x</a>`, `<a>x</a>`},
+		{"javascript link with whitespace", "<a href=\" java\tscript:alert(1)\">x</a>", `<a>x</a>`},
+		{"entity-encoded scheme", `<a href="&#106;avascript:alert(1)">x</a>`, `<a>x</a>`},
+		{"hex entity-encoded scheme", `<a href="&#x6A;avascript&#58;alert(1)">x</a>`, `<a>x</a>`},
+		{"vbscript link", `<a href="vbscript:msgbox(1)">x</a>`, `<a>x</a>`},
+		{"data link", `<a href="data:text/html,<script>alert(1)</script>">x</a>`, `<a>x</a>`},
+		{"https link", `<a href="https://example.com">x</a>`, `<a href="https://example.com" rel="nofollow noopener noreferrer">x</a>`},
+		{"fragment link", `<a href="#intro">x</a>`, `<a href="#intro">x</a>`},
+		{"relative link with colon", `<a href="/notes?at=10:30">x</a>`, `<a href="/notes?at=10:30" rel="nofollow noopener noreferrer">x</a>`},
+		{"data image", `<img src="data:image/png;base64,iVBORw0K">`, `<img src="data:image/png;base64,iVBORw0K">`},
+		{"svg data image", `<img src="data:image/svg+xml;base64,PHN2Zz4=">`, `<img>`},
+		{"quoted angle bracket", `<img alt="a>b" src="x.png">`, `<img alt="a&gt;b" src="x.png">`},
+		{"unterminated tag", `<img src=x onerror=alert(1)`, `&lt;img src=x onerror=alert(1)`},
+		{"tag cut by another tag", `<img src=x <script>alert(1)</script>`, `&lt;img src=x `},
+		{"comment", "a<!-- <script>alert(1)</script> -->b", "ab"},
+		{"unclosed comment", "a<!-- b", "a"},
+		{"doctype", "<!DOCTYPE html>text", "text"},
+		{"task checkbox", `<input type="checkbox" checked>`, `<input type="checkbox" checked disabled>`},
+		{"text input", `<input type="text" value="x">`, ""},
+		{"bad class", `<code class="x&quot; onmouseover=&quot;alert(1)">y</code>`, `<code>y</code>`},
+		{"duplicate attribute", `<a href="#a" href="javascript:alert(1)">x</a>`, `<a href="#a">x</a>`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SanitizeHTML(tt.input); got != tt.want {
+				t.Errorf("SanitizeHTML(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSanitizeMarkdown(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"plain markdown", "# Title\n\n- [ ] task\n- *item*\n", "# Title\n\n- [ ] task\n- *item*\n"},
+		{"raw script", "text <script>alert(1)</script> more", "text  more"},
+		{"event attribute", "<img src=x onerror=alert(1)>", "<img src=\"x\">"},
+		{"code span", "Use `Vec<T>` and `<script>`", "Use `Vec<T>` and `<script>`"},
+		{"double backtick span", "``a ` <b>``", "``a ` <b>``"},
+		{"unmatched backtick", "a ` <script>x</script>", "a ` "},
+		{"escaped backtick", "\\`<script>x</script>`", "\\``"},
+		{"fenced code", "```go\nmap<string>int\n<script>\n```\nafter <script>x</script>", "```go\nmap<string>int\n<script>\n```\nafter "},
+		{"tilde fence", "~~~\n<iframe>\n~~~\n", "~~~\n<iframe>\n~~~\n"},
+		{"unclosed fence", "```\n<b onclick=x>", "```\n<b onclick=x>"},
+		{"fence in list", "- item\n\n      ```\n      Vec<T>\n      ```\n", "- item\n\n      ```\n      Vec<T>\n      ```\n"},
+		{"fence in quote", "> ```\n> <T>\n> ```\n", "> ```\n> <T>\n> ```\n"},
+		{"indented code", "para\n\n    map<string>int\n\ntext<x>", "para\n\n    map<string>int\n\ntext"},
+		{"indented paragraph continuation", "para\n    <script>x</script>", "para\n    "},
+		{"tag cut by code span", "<img src=x `a` onerror=alert(1)>", "&lt;img src=x `a` onerror=alert(1)>"},
+		{"crlf", "a\r\n```\r\n<T>\r\n```\r\n<u>b</u>", "a\r\n```\r\n<T>\r\n```\r\n<u>b</u>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SanitizeMarkdown(tt.input); got != tt.want {
+				t.Errorf("SanitizeMarkdown(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestRenderMarkdownSanitizes checks that raw HTML in Markdown never survives rendering
+func TestRenderMarkdownSanitizes(t *testing.T) {
+	inputs := []string{
+		"<script>alert(1)</script>",
+		"<img src=x onerror=alert(1)>",
+		"[x](javascript:alert(1))",
+		"[x](JAVASCRIPT:alert(1))",
+		"[x](&#106;avascript:alert(1))",
+		"![x](javascript:alert(1))",
+		"<javascript:alert(1)>",
+		"<div onmouseover=\"alert(1)\">\n\ntext\n\n</div>",
+		"- <svg onload=alert(1)>",
+		"> <iframe src=\"https://example.com\"></iframe>",
+		"| a |\n| - |\n| <img src=x onerror=alert(1)> |",
+		"<a href=\"javascript:alert(1)\">x</a>",
+	}
+	for _, input := range inputs {
+		rendered := strings.ToLower(RenderMarkdown(input).HTML)
+		for _, bad := range []string{"<script", "onerror", "onload", "onmouseover", `="javascript:`, "<iframe", "<svg"} {
+			if strings.Contains(rendered, bad) {
+				t.Errorf("RenderMarkdown(%q) = %q, contains %q", input, rendered, bad)
+			}
+		}
+	}
+}
@@ -35,9 +35,16 @@ const GridNoteView: React.FC = () => {
   useEffect(() => {
     const fetchNotes = async () => {
       try {
-        const response = await axios.get('/api/notes');
-        setNotes(response.data.notes);
-        setFilteredNotes(response.data.notes);
+        // Notes come a page at a time; follow the cursors to the last page
+        const all: Note[] = [];
+        let cursor: string | undefined;
+        do {
+          const response = await axios.get('/api/notes', { params: { limit: 200, cursor } });
+          all.push(...(response.data.notes || []));
+          cursor = response.data.nextCursor;
+        } while (cursor);
+        setNotes(all);
+        setFilteredNotes(all);
       } catch (error) {
         console.error('Failed to fetch notes', error);
       }
@@ -60,18 +60,26 @@ export interface UpdateNoteRequest {
   categories?: string[]
 }
 
+// Largest page the notes API serves
+const NOTE_PAGE_SIZE = 200
+
 const noteService = {
   // Get all notes for a user
   getUserNotes: async (): Promise<Note[]> => {
     try {
       console.log("API Base URL:", API_BASE_URL);
-      const response = await api.get('/notes');
-      console.log('Get notes response:', response.data); // Debug log
-      
-      // Handle both possible response formats
-      const notes = response.data.notes || response.data.Notes || response.data || [];
+      // Notes come a page at a time; follow the cursors to the last page
+      const notes: Note[] = [];
+      let cursor: string | undefined;
+      do {
+        const response = await api.get('/notes', {
+          params: { limit: NOTE_PAGE_SIZE, cursor },
+        });
+        notes.push(...(response.data.notes || []));
+        cursor = response.data.nextCursor;
+      } while (cursor);
       console.log('Parsed notes:', notes); // Debug log
-      
+
       return notes;
     } catch (error) {
       console.error('Error fetching notes:', error);
@@ -163,7 +171,7 @@ const noteService = {
       q: query,
       categories: categories || [],
     })
-    return response.data.notes
+    return (response.data.results || []).map((result: { note: Note }) => result.note)
   },
 
   // Get Kanban-organized notes
@@ -173,8 +181,21 @@ const noteService = {
     in_progress: Note[];
     done: Note[];
   }> => {
+    // The board is laid out in columns; group them by the state they belong to
     const response = await api.get("/notes/kanban")
-    return response.data
+    const board: { backlog: Note[]; todo: Note[]; in_progress: Note[]; done: Note[] } = {
+      backlog: [],
+      todo: [],
+      in_progress: [],
+      done: [],
+    }
+    for (const column of response.data.columns ?? []) {
+      const state = column.state as keyof typeof board
+      if (board[state]) {
+        board[state].push(...column.notes)
+      }
+    }
+    return board
   },
 
   api: api,